@@ -16,8 +16,14 @@ import (
 	"cboard-go/internal/core/auth"
 	"cboard-go/internal/core/config"
 	"cboard-go/internal/core/database"
+	"cboard-go/internal/core/kvstore"
+	"cboard-go/internal/core/secrets"
 	"cboard-go/internal/models"
+	"cboard-go/internal/services/auditchain"
+	"cboard-go/internal/services/device"
+	"cboard-go/internal/services/emaildomain"
 	"cboard-go/internal/services/geoip"
+	"cboard-go/internal/services/privacy"
 	"cboard-go/internal/services/scheduler"
 	"cboard-go/internal/utils"
 
@@ -35,6 +41,13 @@ func main() {
 		log.Fatal("配置未正确加载")
 	}
 
+	if err := secrets.Configure(cfg.SecretsMasterKey, cfg.SecretsPreviousKeys); err != nil {
+		log.Fatalf("加载加密主密钥失败: %v", err)
+	}
+	if !secrets.Enabled() {
+		log.Println("警告: SECRETS_MASTER_KEY 未设置，支付密钥与 SMTP 密码将以明文保存")
+	}
+
 	if cfg.Debug {
 		gin.SetMode(gin.DebugMode)
 	} else {
@@ -49,6 +62,21 @@ func main() {
 		log.Fatalf("数据库迁移失败: %v", err)
 	}
 
+	store, err := kvstore.Open(cfg.StateStore, cfg.RedisURL, database.GetDB())
+	if err != nil {
+		log.Fatalf("初始化状态存储失败: %v", err)
+	}
+	kvstore.SetDefault(store)
+	log.Printf("限流与 CSRF 状态存储: %s", cfg.StateStore)
+
+	if cfg.BreachedPasswordsDir != "" {
+		if info, err := os.Stat(cfg.BreachedPasswordsDir); err != nil || !info.IsDir() {
+			log.Printf("泄露密码库目录不可用，跳过泄露密码检查: %s", cfg.BreachedPasswordsDir)
+		} else {
+			auth.SetBreachedPasswordDir(cfg.BreachedPasswordsDir)
+		}
+	}
+
 	ensureDefaultAdmin()
 
 	ensureDefaultEmailTemplates()
@@ -89,8 +117,39 @@ func main() {
 	} else {
 		log.Println("GeoIP 数据库已加载，地理位置解析功能已启用")
 	}
+	if err := geoip.InitASN(os.Getenv("GEOIP_ASN_DB_PATH")); err != nil {
+		log.Printf("ASN 数据库未加载（订阅共享检测将不使用 ASN 维度）: %v", err)
+	}
 	defer geoip.Close()
 
+	uaRulesPath := os.Getenv("UA_RULES_PATH")
+	if uaRulesPath == "" {
+		uaRulesPath = "./data/ua_rules.json"
+	}
+	if err := device.InitUARules(uaRulesPath); err != nil {
+		log.Printf("加载 UA 规则文件失败，使用内置规则: %v", err)
+	}
+
+	disposablePath := os.Getenv("DISPOSABLE_DOMAINS_PATH")
+	if disposablePath == "" {
+		disposablePath = "./data/disposable_domains.txt"
+	}
+	if err := emaildomain.InitDisposableDomains(disposablePath); err != nil {
+		log.Printf("加载一次性邮箱列表失败，使用内置列表: %v", err)
+	}
+
+	auditArchiveDir := os.Getenv("AUDIT_ARCHIVE_DIR")
+	if auditArchiveDir == "" {
+		auditArchiveDir = "./data/audit_archive"
+	}
+	auditchain.SetArchiveDir(auditArchiveDir)
+
+	dataExportDir := os.Getenv("DATA_EXPORT_DIR")
+	if dataExportDir == "" {
+		dataExportDir = "./data/exports"
+	}
+	privacy.SetExportDir(dataExportDir)
+
 	if !cfg.DisableScheduleTasks {
 		sched := scheduler.NewScheduler()
 		sched.Start()
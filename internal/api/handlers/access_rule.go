@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/ipaccess"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type accessRuleRequest struct {
+	Scope    string `json:"scope" binding:"required"`
+	Action   string `json:"action" binding:"required"`
+	Type     string `json:"type" binding:"required"`
+	Value    string `json:"value" binding:"required"`
+	Priority *int   `json:"priority"`
+	Enabled  *bool  `json:"enabled"`
+	Note     string `json:"note"`
+}
+
+// apply 将请求写入规则并校验
+func (req *accessRuleRequest) apply(rule *models.AccessRule) error {
+	rule.Scope = strings.TrimSpace(req.Scope)
+	rule.Action = strings.TrimSpace(req.Action)
+	rule.Type = strings.TrimSpace(req.Type)
+	rule.Value = strings.TrimSpace(req.Value)
+	rule.Note = strings.TrimSpace(req.Note)
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	} else if rule.ID == 0 {
+		rule.Priority = 100
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	} else if rule.ID == 0 {
+		rule.Enabled = true
+	}
+	return ipaccess.Validate(*rule)
+}
+
+// GetAccessRules 访问控制规则列表，按作用范围和优先级排序
+func GetAccessRules(c *gin.Context) {
+	query := database.GetDB().Model(&models.AccessRule{})
+	if scope := c.Query("scope"); scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+	var rules []models.AccessRule
+	if err := query.Order("scope ASC, priority ASC, id ASC").Find(&rules).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取访问规则失败", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", rules)
+}
+
+// CreateAccessRule 创建访问控制规则
+func CreateAccessRule(c *gin.Context) {
+	var req accessRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	var rule models.AccessRule
+	if err := req.apply(&rule); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if err := database.GetDB().Create(&rule).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "创建访问规则失败", err)
+		return
+	}
+	ipaccess.Invalidate()
+	utils.CreateAuditLogSimple(c, "create_access_rule", "access_rule", rule.ID,
+		fmt.Sprintf("创建访问规则: [%s] %s %s %s，优先级 %d", rule.Scope, rule.Action, rule.Type, rule.Value, rule.Priority))
+	utils.SuccessResponse(c, http.StatusCreated, "访问规则已创建", rule)
+}
+
+// UpdateAccessRule 更新访问控制规则
+func UpdateAccessRule(c *gin.Context) {
+	db := database.GetDB()
+	var rule models.AccessRule
+	if err := db.First(&rule, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "访问规则不存在", err)
+		return
+	}
+	var req accessRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	if err := req.apply(&rule); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if err := db.Save(&rule).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "更新访问规则失败", err)
+		return
+	}
+	ipaccess.Invalidate()
+	utils.CreateAuditLogSimple(c, "update_access_rule", "access_rule", rule.ID,
+		fmt.Sprintf("更新访问规则: [%s] %s %s %s，优先级 %d，启用 %v", rule.Scope, rule.Action, rule.Type, rule.Value, rule.Priority, rule.Enabled))
+	utils.SuccessResponse(c, http.StatusOK, "访问规则已更新", rule)
+}
+
+// DeleteAccessRule 删除访问控制规则
+func DeleteAccessRule(c *gin.Context) {
+	db := database.GetDB()
+	var rule models.AccessRule
+	if err := db.First(&rule, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "访问规则不存在", err)
+		return
+	}
+	if err := db.Delete(&rule).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除访问规则失败", err)
+		return
+	}
+	ipaccess.Invalidate()
+	utils.CreateAuditLogSimple(c, "delete_access_rule", "access_rule", rule.ID,
+		fmt.Sprintf("删除访问规则: [%s] %s %s %s", rule.Scope, rule.Action, rule.Type, rule.Value))
+	utils.SuccessResponse(c, http.StatusOK, "访问规则已删除", nil)
+}
+
+// TestAccessRule 用当前规则判定指定 IP 在某个范围内能否访问，便于管理员确认配置
+func TestAccessRule(c *gin.Context) {
+	var req struct {
+		IP    string `json:"ip" binding:"required"`
+		Scope string `json:"scope" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	ip := strings.TrimSpace(req.IP)
+	if net.ParseIP(ip) == nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的 IP 地址", nil)
+		return
+	}
+	decision, err := ipaccess.Evaluate(database.GetDB(), req.Scope, ip)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "读取访问规则失败", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", decision)
+}
@@ -12,6 +12,7 @@ import (
 	"strings"
 
 	"cboard-go/internal/core/database"
+	"cboard-go/internal/core/secrets"
 	"cboard-go/internal/middleware"
 	"cboard-go/internal/models"
 	"cboard-go/internal/utils"
@@ -790,6 +791,10 @@ func GetAdminEmailConfig(c *gin.Context) {
 	database.GetDB().Where("category = ?", "email").Find(&configs)
 	configMap := make(map[string]interface{})
 	for _, config := range configs {
+		if models.IsSecretSystemConfig(config.Category, config.Key) {
+			configMap[config.Key] = secrets.Mask(config.Value)
+			continue
+		}
 		configMap[config.Key] = config.Value
 	}
 	utils.SuccessResponse(c, http.StatusOK, "", configMap)
@@ -860,6 +865,7 @@ func GetPaymentConfig(c *gin.Context) {
 
 	configsResponse := make([]PaymentConfigResponse, len(paymentConfigs))
 	for i, config := range paymentConfigs {
+		config = maskPaymentSecrets(config)
 		configsResponse[i] = PaymentConfigResponse{
 			ID:                   config.ID,
 			PayType:              config.PayType,
@@ -943,6 +949,10 @@ func UpdateEmailConfig(c *gin.Context) {
 	}
 	db := database.GetDB()
 	for key, value := range req {
+		// 脱敏值原样提交表示未修改
+		if str, ok := value.(string); ok && secrets.IsMasked(str) && models.IsSecretSystemConfig("email", key) {
+			continue
+		}
 		if err := upsertSystemConfig(db, "email", key, fmt.Sprintf("%v", value)); err != nil {
 			utils.LogError("UpdateEmailConfig", err, map[string]interface{}{"key": key})
 			utils.ErrorResponse(c, http.StatusInternalServerError, "更新配置失败，请稍后重试", err)
@@ -1039,7 +1049,7 @@ func CreatePaymentConfig(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "创建支付配置失败", err)
 		return
 	}
-	utils.SuccessResponse(c, http.StatusCreated, "支付配置创建成功", paymentConfig)
+	utils.SuccessResponse(c, http.StatusCreated, "支付配置创建成功", maskPaymentSecrets(paymentConfig))
 }
 
 func UpdatePaymentConfig(c *gin.Context) {
@@ -1073,9 +1083,6 @@ func UpdatePaymentConfig(c *gin.Context) {
 	}
 
 	utils.LogInfo("UpdatePaymentConfig: 收到请求, id=%s, pay_type=%s, config_json不为nil=%v", id, req.PayType, req.ConfigJSON != nil)
-	if req.ConfigJSON != nil {
-		utils.LogInfo("UpdatePaymentConfig: config_json内容=%+v", req.ConfigJSON)
-	}
 
 	db := database.GetDB()
 	var paymentConfig models.PaymentConfig
@@ -1097,7 +1104,7 @@ func UpdatePaymentConfig(c *gin.Context) {
 	if req.AppID != nil {
 		paymentConfig.AppID = ptrToNullString(req.AppID)
 	}
-	if req.MerchantPrivateKey != nil {
+	if req.MerchantPrivateKey != nil && !secrets.IsMasked(*req.MerchantPrivateKey) {
 		paymentConfig.MerchantPrivateKey = ptrToNullString(req.MerchantPrivateKey)
 	}
 	if req.AlipayPublicKey != nil {
@@ -1109,19 +1116,19 @@ func UpdatePaymentConfig(c *gin.Context) {
 	if req.WechatMchID != nil {
 		paymentConfig.WechatMchID = ptrToNullString(req.WechatMchID)
 	}
-	if req.WechatAPIKey != nil {
+	if req.WechatAPIKey != nil && !secrets.IsMasked(*req.WechatAPIKey) {
 		paymentConfig.WechatAPIKey = ptrToNullString(req.WechatAPIKey)
 	}
 	if req.PaypalClientID != nil {
 		paymentConfig.PaypalClientID = ptrToNullString(req.PaypalClientID)
 	}
-	if req.PaypalSecret != nil {
+	if req.PaypalSecret != nil && !secrets.IsMasked(*req.PaypalSecret) {
 		paymentConfig.PaypalSecret = ptrToNullString(req.PaypalSecret)
 	}
 	if req.StripePublishableKey != nil {
 		paymentConfig.StripePublishableKey = ptrToNullString(req.StripePublishableKey)
 	}
-	if req.StripeSecretKey != nil {
+	if req.StripeSecretKey != nil && !secrets.IsMasked(*req.StripeSecretKey) {
 		paymentConfig.StripeSecretKey = ptrToNullString(req.StripeSecretKey)
 	}
 	if req.BankName != nil {
@@ -1157,19 +1164,19 @@ func UpdatePaymentConfig(c *gin.Context) {
 		paymentConfig.SortOrder = *req.SortOrder
 	}
 	if req.ConfigJSON != nil {
+		restoreMaskedConfigSecrets(req.ConfigJSON, paymentConfig.ConfigJSON)
 		bytes, err := json.Marshal(req.ConfigJSON)
 		if err != nil {
 			utils.LogError("UpdatePaymentConfig: ConfigJSON序列化失败", err, map[string]interface{}{
-				"id":          id,
-				"config_json": req.ConfigJSON,
+				"id": id,
 			})
 			utils.ErrorResponse(c, http.StatusBadRequest, "配置JSON格式错误", err)
 			return
 		}
 		oldConfigJSON := paymentConfig.ConfigJSON.String
 		paymentConfig.ConfigJSON = sql.NullString{String: string(bytes), Valid: true}
-		utils.LogInfo("UpdatePaymentConfig: 更新ConfigJSON, id=%s, 旧值长度=%d, 新值长度=%d, 新值=%s",
-			id, len(oldConfigJSON), len(string(bytes)), string(bytes))
+		utils.LogInfo("UpdatePaymentConfig: 更新ConfigJSON, id=%s, 旧值长度=%d, 新值长度=%d",
+			id, len(oldConfigJSON), len(string(bytes)))
 	} else {
 		utils.LogInfo("UpdatePaymentConfig: ConfigJSON为nil，跳过更新, id=%s", id)
 	}
@@ -1185,6 +1192,8 @@ func UpdatePaymentConfig(c *gin.Context) {
 
 	utils.LogInfo("UpdatePaymentConfig: 保存成功, id=%s, 最终ConfigJSON长度=%d", id, len(paymentConfig.ConfigJSON.String))
 
+	paymentConfig = maskPaymentSecrets(paymentConfig)
+
 	responseData := gin.H{
 		"id":                     paymentConfig.ID,
 		"pay_type":               paymentConfig.PayType,
@@ -1284,3 +1293,45 @@ func ptrToNullString(s *string) sql.NullString {
 	}
 	return database.NullString(*s)
 }
+
+// maskPaymentSecrets 返回给管理端的支付配置，密钥只显示末 4 位
+func maskPaymentSecrets(config models.PaymentConfig) models.PaymentConfig {
+	for _, field := range config.SecretFields() {
+		if field.Valid {
+			field.String = secrets.Mask(field.String)
+		}
+	}
+	if !config.ConfigJSON.Valid {
+		return config
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(config.ConfigJSON.String), &data); err != nil {
+		return config
+	}
+	for _, key := range models.PaymentSecretConfigKeys {
+		if str, ok := data[key].(string); ok {
+			data[key] = secrets.Mask(str)
+		}
+	}
+	if encoded, err := json.Marshal(data); err == nil {
+		config.ConfigJSON.String = string(encoded)
+	}
+	return config
+}
+
+// restoreMaskedConfigSecrets ConfigJSON 中原样提交的脱敏值替换回已保存的密钥
+func restoreMaskedConfigSecrets(data map[string]interface{}, saved sql.NullString) {
+	var existing map[string]interface{}
+	if saved.Valid {
+		_ = json.Unmarshal([]byte(saved.String), &existing)
+	}
+	for _, key := range models.PaymentSecretConfigKeys {
+		if str, ok := data[key].(string); ok && secrets.IsMasked(str) {
+			if old, exists := existing[key]; exists {
+				data[key] = old
+			} else {
+				delete(data, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/middleware"
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAPIKeyDays = 90
+	maxAPIKeyDays     = 365
+)
+
+func apiKeyResponse(key *models.APIKey) gin.H {
+	return gin.H{
+		"id":           key.ID,
+		"name":         key.Name,
+		"prefix":       key.Prefix,
+		"scopes":       key.ScopeList(),
+		"allowed_ips":  key.AllowedIPs,
+		"expires_at":   key.ExpiresAt,
+		"last_used_at": key.LastUsedAt,
+		"last_used_ip": key.LastUsedIP,
+		"revoked_at":   key.RevokedAt,
+		"created_at":   key.CreatedAt,
+	}
+}
+
+// normalizeAllowedIPs 校验 IP/CIDR 列表
+func normalizeAllowedIPs(entries []string) (string, error) {
+	list := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			if _, network, err := net.ParseCIDR(entry); err == nil {
+				list = append(list, network.String())
+				continue
+			}
+		} else if ip := net.ParseIP(entry); ip != nil {
+			list = append(list, ip.String())
+			continue
+		}
+		return "", fmt.Errorf("无效的 IP 或 CIDR: %s", entry)
+	}
+	return strings.Join(list, ","), nil
+}
+
+// GetAPIKeys 当前管理员的 API 密钥
+func GetAPIKeys(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	var keys []models.APIKey
+	if err := database.GetDB().Where("user_id = ?", user.ID).Order("id DESC").Find(&keys).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取 API 密钥失败", err)
+		return
+	}
+	list := make([]gin.H, 0, len(keys))
+	for i := range keys {
+		list = append(list, apiKeyResponse(&keys[i]))
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", list)
+}
+
+// CreateAPIKey 创建 API 密钥，明文只在创建时返回一次
+func CreateAPIKey(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name          string   `json:"name" binding:"required"`
+		Scopes        []string `json:"scopes" binding:"required"`
+		AllowedIPs    []string `json:"allowed_ips"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len([]rune(name)) > 100 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "名称不能为空且不超过100个字符", nil)
+		return
+	}
+	scopes, err := normalizePermissions(req.Scopes)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if len(scopes) == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请至少选择一项权限", nil)
+		return
+	}
+	granted := make(map[string]bool)
+	for _, p := range middleware.AdminPermissions(c) {
+		granted[p] = true
+	}
+	for _, s := range scopes {
+		if !granted[s] {
+			utils.ErrorResponse(c, http.StatusForbidden, fmt.Sprintf("不能授予自己没有的权限: %s", s), nil)
+			return
+		}
+	}
+	allowedIPs, err := normalizeAllowedIPs(req.AllowedIPs)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = defaultAPIKeyDays
+	}
+	if days < 1 || days > maxAPIKeyDays {
+		utils.ErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("有效期需在 1-%d 天之间", maxAPIKeyDays), nil)
+		return
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "生成密钥失败", err)
+		return
+	}
+	token := models.APIKeyPrefix + hex.EncodeToString(b)
+	expiresAt := utils.GetBeijingTime().Add(time.Duration(days) * 24 * time.Hour)
+	key := models.APIKey{
+		UserID:     user.ID,
+		Name:       name,
+		Prefix:     token[:12],
+		KeyHash:    utils.HashToken(token),
+		Scopes:     strings.Join(scopes, ","),
+		AllowedIPs: allowedIPs,
+		ExpiresAt:  &expiresAt,
+	}
+	if err := database.GetDB().Create(&key).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "创建 API 密钥失败", err)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "create_api_key", "api_key", key.ID,
+		fmt.Sprintf("创建 API 密钥: %s (%s)，权限 %s，有效期 %d 天", key.Name, key.Prefix, key.Scopes, days))
+
+	data := apiKeyResponse(&key)
+	data["token"] = token
+	utils.SuccessResponse(c, http.StatusCreated, "API 密钥已创建，请立即保存，之后将无法再次查看", data)
+}
+
+// RevokeAPIKey 撤销 API 密钥，立即生效
+func RevokeAPIKey(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	db := database.GetDB()
+	var key models.APIKey
+	if err := db.Where("id = ? AND user_id = ?", c.Param("id"), user.ID).First(&key).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "API 密钥不存在", err)
+		return
+	}
+	if key.RevokedAt != nil {
+		utils.SuccessResponse(c, http.StatusOK, "API 密钥已撤销", nil)
+		return
+	}
+	if err := db.Model(&key).Update("revoked_at", utils.GetBeijingTime()).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "撤销 API 密钥失败", err)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "revoke_api_key", "api_key", key.ID,
+		fmt.Sprintf("撤销 API 密钥: %s (%s)", key.Name, key.Prefix))
+	utils.SuccessResponse(c, http.StatusOK, "API 密钥已撤销", nil)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -11,9 +12,12 @@ import (
 	"cboard-go/internal/core/database"
 	"cboard-go/internal/middleware"
 	"cboard-go/internal/models"
+	"cboard-go/internal/services/captcha"
 	"cboard-go/internal/services/email"
 	"cboard-go/internal/services/geoip"
+	"cboard-go/internal/services/loginrisk"
 	"cboard-go/internal/services/notification"
+	"cboard-go/internal/services/session"
 	"cboard-go/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -48,6 +52,10 @@ func Register(c *gin.Context) {
 
 	db := database.GetDB()
 
+	if !checkEmailDomain(c, db, req.Email, "register") {
+		return
+	}
+
 	var count int64
 	if db.Model(&models.User{}).Where("email = ?", req.Email).Count(&count); count > 0 {
 		utils.ErrorResponse(c, http.StatusBadRequest, "该邮箱已被注册，请直接登录或使用其他邮箱", nil)
@@ -58,8 +66,7 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	if valid, msg := auth.ValidatePasswordStrength(req.Password, 8); !valid {
-		utils.ErrorResponse(c, http.StatusBadRequest, msg, nil)
+	if !validateNewPassword(c, db, auth.LoadPasswordPolicy(db), nil, req.Password, req.Username, req.Email) {
 		return
 	}
 
@@ -119,16 +126,11 @@ func Register(c *gin.Context) {
 		ipAddress = c.RemoteIP()
 	}
 
-	atk, err := utils.CreateAccessToken(user.ID, user.Email, user.IsAdmin)
+	tokens, err := session.Create(db, &user, session.Client{IP: ipAddress, UserAgent: c.GetHeader("User-Agent"), LoginMethod: "register"})
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "生成令牌失败", err)
 		return
 	}
-	rtk, err := utils.CreateRefreshToken(user.ID, user.Email)
-	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "生成刷新令牌失败", err)
-		return
-	}
 
 	now := utils.GetBeijingTime()
 	user.LastLogin = database.NullTime(now)
@@ -148,6 +150,8 @@ func Register(c *gin.Context) {
 		UserAgent:   database.NullString(c.GetHeader("User-Agent")),
 		Location:    location,
 		LoginStatus: "success",
+
+		DeviceFingerprint: database.NullString(loginrisk.Fingerprint(c.GetHeader("User-Agent"))),
 	}
 	if err := db.Create(&loginHistory).Error; err != nil {
 		utils.LogError("Register: 创建登录历史失败", err, map[string]interface{}{"user_id": user.ID, "ip": ipAddress})
@@ -159,9 +163,10 @@ func Register(c *gin.Context) {
 
 	handleRegisterNotification(user)
 	utils.SuccessResponse(c, http.StatusCreated, "注册成功", gin.H{
-		"access_token":  atk,
-		"refresh_token": rtk,
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
 		"token_type":    "bearer",
+		"session_id":    tokens.SessionID,
 		"user": gin.H{
 			"id":          user.ID,
 			"username":    user.Username,
@@ -219,6 +224,7 @@ func LoginJSON(c *gin.Context) {
 		handleLoginFailure(c, ipAddress, req.Username, "密码错误", nil)
 		return
 	}
+	auth.UpgradePasswordHash(db, &user, req.Password)
 
 	finalizeLogin(c, db, &user, ipAddress)
 }
@@ -232,25 +238,28 @@ func RefreshToken(c *gin.Context) {
 		return
 	}
 
-	claims, err := utils.VerifyToken(req.RefreshToken)
-	if err != nil {
-		utils.ErrorResponse(c, http.StatusUnauthorized, "无效的刷新令牌", err)
-		return
-	}
-	if claims.Type != "refresh" {
-		utils.ErrorResponse(c, http.StatusUnauthorized, "令牌类型错误", nil)
-		return
-	}
-
-	accessToken, err := utils.CreateAccessToken(claims.UserID, claims.Email, claims.IsAdmin)
+	db := database.GetDB()
+	ipAddress := utils.GetRealClientIP(c)
+	tokens, s, err := session.Refresh(db, req.RefreshToken, session.Client{IP: ipAddress, UserAgent: c.GetHeader("User-Agent")})
 	if err != nil {
+		if errors.Is(err, session.ErrTokenReuse) && s != nil {
+			c.Set("user_id", s.UserID)
+			utils.CreateSecurityLog(c, "refresh_token_reuse", "HIGH",
+				fmt.Sprintf("检测到刷新令牌重复使用，已撤销会话 %s (用户ID: %d, IP: %s)", s.DeviceName, s.UserID, ipAddress),
+				map[string]interface{}{"user_id": s.UserID, "session_id": s.SessionID, "ip": ipAddress, "session_ip": s.IPAddress})
+		}
+		if errors.Is(err, session.ErrInvalidToken) || errors.Is(err, session.ErrSessionRevoked) || errors.Is(err, session.ErrTokenReuse) {
+			utils.ErrorResponse(c, http.StatusUnauthorized, err.Error(), nil)
+			return
+		}
 		utils.ErrorResponse(c, http.StatusInternalServerError, "生成令牌失败", err)
 		return
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
-		"access_token": accessToken,
-		"token_type":   "bearer",
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"token_type":    "bearer",
 	})
 }
 
@@ -288,6 +297,11 @@ func Logout(c *gin.Context) {
 	if err := models.AddToBlacklist(database.GetDB(), utils.HashToken(token), user.ID, expiresAt); err != nil {
 		utils.LogError("Logout: failed to add token to blacklist", err, map[string]interface{}{"user_id": user.ID})
 	}
+	if claims.SessionID != "" {
+		if err := session.RevokeBySessionID(database.GetDB(), claims.SessionID, session.ReasonLogout); err != nil {
+			utils.LogError("Logout: failed to revoke session", err, map[string]interface{}{"user_id": user.ID})
+		}
+	}
 
 	utils.SuccessResponse(c, http.StatusOK, "登出成功", nil)
 }
@@ -402,6 +416,10 @@ func handleRegisterNotification(user models.User) {
 func checkSuspiciousLogin(c *gin.Context, identifier, ipAddress string) {
 	isSuspicious, reason := utils.CheckBruteForcePattern(c, identifier)
 	if isSuspicious {
+		// 自适应人机验证：该 IP 后续请求需要先完成验证
+		if err := captcha.MarkSuspicious(ipAddress); err != nil {
+			utils.LogError("checkSuspiciousLogin: 标记可疑 IP 失败", err, nil)
+		}
 		utils.CreateSecurityLog(c, "login_attempt", "HIGH",
 			fmt.Sprintf("检测到可疑登录行为: %s", reason),
 			map[string]interface{}{"identifier": identifier, "ip": ipAddress, "reason": reason})
@@ -471,14 +489,29 @@ func finalizeLogin(c *gin.Context, db *gorm.DB, user *models.User, ipAddress str
 		return
 	}
 
-	atk, err := utils.CreateAccessToken(user.ID, user.Email, user.IsAdmin)
-	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "生成令牌失败", err)
+	if !c.GetBool("two_factor_passed") {
+		if required, enroll := twoFactorGate(db, user); required {
+			issueTwoFactorChallenge(c, user, ipAddress, enroll)
+			return
+		}
+	}
+
+	// 通过两步验证或通行密钥登录的不再要求邮箱验证码
+	userAgent := c.GetHeader("User-Agent")
+	risk, riskSettings := assessLoginRisk(c, db, user, ipAddress)
+	verified := c.GetBool("two_factor_passed") || c.GetBool("step_up_passed")
+	if !verified && riskSettings.RequireStepUp(risk) {
+		issueStepUpChallenge(c, db, user, ipAddress, risk)
 		return
 	}
-	rtk, err := utils.CreateRefreshToken(user.ID, user.Email)
+
+	loginMethod := c.GetString("login_method")
+	if loginMethod == "" {
+		loginMethod = "password"
+	}
+	tokens, err := session.Create(db, user, session.Client{IP: ipAddress, UserAgent: userAgent, LoginMethod: loginMethod})
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "生成刷新令牌失败", err)
+		utils.ErrorResponse(c, http.StatusInternalServerError, "生成令牌失败", err)
 		return
 	}
 
@@ -496,16 +529,20 @@ func finalizeLogin(c *gin.Context, db *gorm.DB, user *models.User, ipAddress str
 	}
 
 	loginHistory := models.LoginHistory{
-		UserID:      user.ID,
-		LoginTime:   now,
-		IPAddress:   database.NullString(ipAddress),
-		UserAgent:   database.NullString(c.GetHeader("User-Agent")),
-		Location:    location,
-		LoginStatus: "success",
+		UserID:            user.ID,
+		LoginTime:         now,
+		IPAddress:         database.NullString(ipAddress),
+		UserAgent:         database.NullString(userAgent),
+		Location:          location,
+		DeviceFingerprint: database.NullString(risk.Fingerprint),
+		LoginStatus:       "success",
 	}
 	if err := db.Create(&loginHistory).Error; err != nil {
 		utils.LogError("Login: 创建登录历史失败", err, map[string]interface{}{"user_id": user.ID, "ip": ipAddress})
 	}
+	if !c.GetBool("step_up_passed") && riskSettings.ShouldAlert(risk) {
+		sendLoginAlert(db, user, tokens.SessionID, ipAddress, risk)
+	}
 
 	c.Set("user_id", user.ID)
 	utils.SetResponseStatus(c, http.StatusOK)
@@ -515,17 +552,39 @@ func finalizeLogin(c *gin.Context, db *gorm.DB, user *models.User, ipAddress str
 		map[string]interface{}{"user_id": user.ID, "username": user.Username, "ip": ipAddress})
 	utils.CreateAuditLogSimple(c, "login", "auth", user.ID, fmt.Sprintf("用户登录: %s", user.Username))
 
-	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
-		"access_token":  atk,
-		"refresh_token": rtk,
+	data := gin.H{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
 		"token_type":    "bearer",
+		"session_id":    tokens.SessionID,
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
 			"email":    user.Email,
 			"is_admin": user.IsAdmin,
 		},
-	})
+	}
+	if codes, ok := c.Get("recovery_codes"); ok {
+		data["recovery_codes"] = codes
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", data)
+}
+
+// validateInviteCode 校验邀请码是否可用（存在、启用、未过期且未达使用上限）
+func validateInviteCode(db *gorm.DB, inviteCodeStr string) error {
+	inviteCodeStr = strings.ToUpper(strings.TrimSpace(inviteCodeStr))
+	var inviteCode models.InviteCode
+	if err := db.Where("UPPER(code) = ? AND is_active = ?", inviteCodeStr, true).First(&inviteCode).Error; err != nil {
+		return fmt.Errorf("邀请码无效")
+	}
+	now := utils.GetBeijingTime()
+	if inviteCode.ExpiresAt.Valid && inviteCode.ExpiresAt.Time.Before(now) {
+		return fmt.Errorf("邀请码已过期")
+	}
+	if inviteCode.MaxUses.Valid && inviteCode.UsedCount >= int(inviteCode.MaxUses.Int64) {
+		return fmt.Errorf("邀请码已达到使用上限")
+	}
+	return nil
 }
 
 func processInviteCode(db *gorm.DB, inviteCodeStr string, newUserID uint) {
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/middleware"
+	"cboard-go/internal/services/captcha"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCaptchaConfig 前端渲染人机验证组件所需的公开配置，required 表示当前 IP 是否需要验证
+func GetCaptchaConfig(c *gin.Context) {
+	settings, err := captcha.LoadSettings(database.GetDB())
+	if err != nil {
+		utils.LogError("GetCaptchaConfig: 人机验证配置无效", err, nil)
+	}
+	ip := utils.GetRealClientIP(c)
+	if ip == "" {
+		ip = c.ClientIP()
+	}
+	mode := captcha.ModeOff
+	if settings.Enabled() {
+		mode = settings.Mode
+	}
+	siteKey := ""
+	if settings != nil {
+		siteKey = settings.SiteKey
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"enabled":  settings.Enabled(),
+		"mode":     mode,
+		"provider": settings.ProviderName(),
+		"site_key": siteKey,
+		"required": middleware.CaptchaRequired(c, settings, ip),
+	})
+}
+
+// CreateCaptchaChallenge 获取自建验证码题目
+func CreateCaptchaChallenge(c *gin.Context) {
+	settings, err := captcha.LoadSettings(database.GetDB())
+	if err != nil || !settings.Enabled() || settings.ProviderName() != captcha.ProviderBuiltin {
+		utils.ErrorResponse(c, http.StatusBadRequest, "未启用自建验证码", nil)
+		return
+	}
+	builtin, ok := settings.Provider.(*captcha.Builtin)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusBadRequest, "未启用自建验证码", nil)
+		return
+	}
+	challenge, err := builtin.NewChallenge()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "生成验证码失败", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", challenge)
+}
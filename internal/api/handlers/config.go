@@ -13,6 +13,7 @@ import (
 
 	"cboard-go/internal/core/config"
 	"cboard-go/internal/core/database"
+	"cboard-go/internal/core/secrets"
 	"cboard-go/internal/models"
 	"cboard-go/internal/services/email"
 	"cboard-go/internal/services/geoip"
@@ -38,6 +39,11 @@ func updateSettingsCommon(c *gin.Context, category string) {
 				targetCat = "system" // 特殊处理
 			}
 
+			// 管理端回传的脱敏值表示未修改密钥
+			if str, ok := val.(string); ok && secrets.IsMasked(str) && models.IsSecretSystemConfig(targetCat, key) {
+				continue
+			}
+
 			valStr := fmt.Sprintf("%v", val)
 			if _, ok := val.([]interface{}); ok {
 				if jsonBytes, err := json.Marshal(val); err == nil {
@@ -69,6 +75,13 @@ func updateSettingsCommon(c *gin.Context, category string) {
 	utils.SuccessResponse(c, http.StatusOK, "设置已保存", nil)
 }
 
+// maskSystemConfig 加密保存的配置项（如 SMTP 密码）对外只返回脱敏值
+func maskSystemConfig(config *models.SystemConfig) {
+	if models.IsSecretSystemConfig(config.Category, config.Key) {
+		config.Value = secrets.Mask(config.Value)
+	}
+}
+
 func GetSystemConfigs(c *gin.Context) {
 	db := database.GetDB()
 	var configs []models.SystemConfig
@@ -85,6 +98,9 @@ func GetSystemConfigs(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "获取配置失败", err)
 		return
 	}
+	for i := range configs {
+		maskSystemConfig(&configs[i])
+	}
 	utils.SuccessResponse(c, http.StatusOK, "", configs)
 }
 
@@ -94,6 +110,7 @@ func GetSystemConfig(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusNotFound, "配置不存在", err)
 		return
 	}
+	maskSystemConfig(&config)
 	utils.SuccessResponse(c, http.StatusOK, "", config)
 }
 
@@ -103,6 +120,10 @@ func CreateSystemConfig(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
 		return
 	}
+	if models.IsSecretSystemConfig(req.Category, req.Key) && secrets.IsMasked(req.Value) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请填写完整的配置值", nil)
+		return
+	}
 
 	db := database.GetDB()
 	var exist models.SystemConfig
@@ -120,6 +141,7 @@ func CreateSystemConfig(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "创建配置失败", err)
 		return
 	}
+	maskSystemConfig(&req)
 	utils.SuccessResponse(c, http.StatusCreated, "", req)
 }
 
@@ -155,9 +177,16 @@ func UpdateSystemConfig(c *gin.Context) {
 		category = "system" // 默认 category
 	}
 
+	// 脱敏值原样提交表示未修改
+	keepValue := models.IsSecretSystemConfig(category, key) && secrets.IsMasked(req.Value)
+
 	var config models.SystemConfig
 	err := db.Where("key = ? AND category = ?", key, category).First(&config).Error
 	if err != nil {
+		if keepValue {
+			utils.ErrorResponse(c, http.StatusBadRequest, "请填写完整的配置值", nil)
+			return
+		}
 		config = models.SystemConfig{
 			Key:         key,
 			Value:       req.Value,
@@ -173,7 +202,9 @@ func UpdateSystemConfig(c *gin.Context) {
 			return
 		}
 	} else {
-		config.Value = req.Value
+		if !keepValue {
+			config.Value = req.Value
+		}
 		if req.Type != "" {
 			config.Type = req.Type
 		}
@@ -185,6 +216,7 @@ func UpdateSystemConfig(c *gin.Context) {
 			return
 		}
 	}
+	maskSystemConfig(&config)
 	utils.SuccessResponse(c, http.StatusOK, "更新成功", config)
 }
 
@@ -197,10 +229,15 @@ func GetAdminSettings(c *gin.Context) {
 		"registration": {
 			"registration_enabled": "true", "email_verification_required": "true", "min_password_length": 8,
 			"invite_code_required": "false", "default_subscription_device_limit": 3, "default_subscription_duration_months": 1,
+			"email_domain_allowlist": []string{}, "email_domain_denylist": []string{}, "block_disposable_email": "true", "email_mx_check": "false",
 		},
 		"security": {
 			"login_fail_limit": 5, "login_lock_time": 30, "session_timeout": 120,
-			"ip_whitelist_enabled": "false", "ip_whitelist": "",
+			"ip_whitelist_enabled": "false", "ip_whitelist": "", "require_admin_2fa": "false",
+			"captcha_mode": "off", "captcha_provider": "none", "captcha_site_key": "", "captcha_secret_key": "",
+			"password_min_classes": 3, "password_disallow_personal": "true", "password_history_count": 3, "password_breach_check": "true",
+			"access_bypass_ips": []string{}, "login_risk_enabled": "true", "login_risk_alert_score": 40, "login_risk_step_up": "false", "login_risk_step_up_score": 70, "login_risk_max_speed": 1000,
+			"account_deletion_cooling_days": 7,
 		},
 		"theme": {
 			"default_theme": "light", "allow_user_theme": "true",
@@ -216,7 +253,6 @@ func GetAdminSettings(c *gin.Context) {
 			"node_test_timeout":          "5",
 			"test_url":                   "https://ping.pe",
 		},
-		"custom_node": {},
 		"notification": {
 			"system_notifications":              "true",
 			"email_notifications":               "true",
@@ -224,6 +260,13 @@ func GetAdminSettings(c *gin.Context) {
 			"new_user_notifications":            "true",
 			"new_order_notifications":           "true",
 		},
+		"oauth": {
+			"auto_register": "true", "link_by_email": "false",
+			"github_enabled": "false", "github_client_id": "", "github_client_secret": "",
+			"google_enabled": "false", "google_client_id": "", "google_client_secret": "",
+			"oidc_enabled": "false", "oidc_display_name": "SSO", "oidc_discovery_url": "",
+			"oidc_client_id": "", "oidc_client_secret": "", "oidc_scopes": "openid email profile",
+		},
 		"admin_notification": {
 			"admin_notification_enabled":        "false",
 			"admin_email_notification":          "false",
@@ -271,12 +314,22 @@ func GetAdminSettings(c *gin.Context) {
 		"support_qq":               true,
 		"support_email":            true,
 		"domain_name":              true,
+		"github_client_id":         true,
+		"github_client_secret":     true,
+		"google_client_id":         true,
+		"google_client_secret":     true,
+		"oidc_client_id":           true,
+		"oidc_client_secret":       true,
+		"captcha_site_key":         true,
+		"captcha_secret_key":       true,
 	}
 
 	for cat, catDefaults := range settings {
 		for key := range catDefaults {
 			if val, ok := configMap[cat][key]; ok {
-				if val == "true" || val == "false" {
+				if models.IsSecretSystemConfig(cat, key) {
+					settings[cat][key] = secrets.Mask(val)
+				} else if val == "true" || val == "false" {
 					settings[cat][key] = (val == "true")
 				} else if strings.HasPrefix(val, "[") {
 					var arr []string
@@ -316,6 +369,9 @@ func UpdateAdminNotificationSystemSettings(c *gin.Context) {
 func UpdateNodeHealthSettings(c *gin.Context) {
 	updateSettingsCommon(c, "node_health")
 }
+func UpdateOAuthSettings(c *gin.Context) {
+	updateSettingsCommon(c, "oauth")
+}
 
 func UploadFile(c *gin.Context) {
 	file, err := c.FormFile("file")
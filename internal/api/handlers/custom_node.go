@@ -12,6 +12,8 @@ import (
 	"cboard-go/internal/core/database"
 	"cboard-go/internal/models"
 	"cboard-go/internal/services/config_update"
+	"cboard-go/internal/services/node_server"
+	"cboard-go/internal/services/panel"
 	"cboard-go/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -121,6 +123,9 @@ func CreateCustomNode(c *gin.Context) {
 		Port             int        `json:"port"`
 		ExpireTime       *time.Time `json:"expire_time"`
 		FollowUserExpire bool       `json:"follow_user_expire"`
+		PanelID          *uint      `json:"panel_id"`
+		PanelInbound     string     `json:"panel_inbound"`
+		ServerOpts       string     `json:"server_opts"`
 		Preview          bool       `json:"preview"`
 	}
 
@@ -128,6 +133,10 @@ func CreateCustomNode(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error(), err)
 		return
 	}
+	if _, err := node_server.ParseServerOptions(req.ServerOpts); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
 
 	db := database.GetDB()
 
@@ -160,6 +169,9 @@ func CreateCustomNode(c *gin.Context) {
 			IsActive:         true,
 			ExpireTime:       req.ExpireTime,
 			FollowUserExpire: req.FollowUserExpire,
+			PanelID:          req.PanelID,
+			PanelInbound:     req.PanelInbound,
+			ServerOpts:       req.ServerOpts,
 		}
 
 		if req.Preview {
@@ -198,6 +210,9 @@ func CreateCustomNode(c *gin.Context) {
 		IsActive:         true,
 		ExpireTime:       req.ExpireTime,
 		FollowUserExpire: req.FollowUserExpire,
+		PanelID:          req.PanelID,
+		PanelInbound:     req.PanelInbound,
+		ServerOpts:       req.ServerOpts,
 	}
 
 	if err := db.Create(&customNode).Error; err != nil {
@@ -292,6 +307,9 @@ func UpdateCustomNode(c *gin.Context) {
 		IsActive         *bool      `json:"is_active"`
 		ExpireTime       *time.Time `json:"expire_time"`
 		FollowUserExpire *bool      `json:"follow_user_expire"`
+		PanelID          *uint      `json:"panel_id"`
+		PanelInbound     *string    `json:"panel_inbound"`
+		ServerOpts       *string    `json:"server_opts"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -329,6 +347,23 @@ func UpdateCustomNode(c *gin.Context) {
 	if req.FollowUserExpire != nil {
 		node.FollowUserExpire = *req.FollowUserExpire
 	}
+	if req.PanelID != nil {
+		if *req.PanelID == 0 {
+			node.PanelID = nil
+		} else {
+			node.PanelID = req.PanelID
+		}
+	}
+	if req.PanelInbound != nil {
+		node.PanelInbound = *req.PanelInbound
+	}
+	if req.ServerOpts != nil {
+		if _, err := node_server.ParseServerOptions(*req.ServerOpts); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		node.ServerOpts = *req.ServerOpts
+	}
 
 	if err := db.Save(&node).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "更新失败: "+err.Error(), err)
@@ -348,6 +383,11 @@ func DeleteCustomNode(c *gin.Context) {
 		return
 	}
 
+	// 远程客户端删除失败时保留节点与分配记录，稍后重试
+	if err := panel.NewPanelService().RemoveByNode([]uint{node.ID}); err != nil {
+		utils.ErrorResponse(c, http.StatusBadGateway, "远程面板删除客户端失败，请稍后重试: "+err.Error(), err)
+		return
+	}
 	db.Where("custom_node_id = ?", nodeID).Delete(&models.UserCustomNode{})
 
 	if err := db.Delete(&node).Error; err != nil {
@@ -370,6 +410,10 @@ func BatchDeleteCustomNodes(c *gin.Context) {
 
 	db := database.GetDB()
 
+	if err := panel.NewPanelService().RemoveByNode(req.NodeIDs); err != nil {
+		utils.ErrorResponse(c, http.StatusBadGateway, "远程面板删除客户端失败，请稍后重试: "+err.Error(), err)
+		return
+	}
 	db.Where("custom_node_id IN ?", req.NodeIDs).Delete(&models.UserCustomNode{})
 
 	if err := db.Where("id IN ?", req.NodeIDs).Delete(&models.CustomNode{}).Error; err != nil {
@@ -410,6 +454,7 @@ func BatchAssignCustomNodes(c *gin.Context) {
 	}
 
 	assignedCount := 0
+	created := make([]models.UserCustomNode, 0)
 	for _, userID := range req.UserIDs {
 		for _, nodeID := range req.NodeIDs {
 			var existing models.UserCustomNode
@@ -421,8 +466,15 @@ func BatchAssignCustomNodes(c *gin.Context) {
 				UserID:       userID,
 				CustomNodeID: nodeID,
 			}
+			var err error
+			if userNode.UUID, userNode.Password, err = config_update.GenerateNodeCredentials(); err != nil {
+				// 已创建的分配由面板同步任务补建远程客户端
+				utils.ErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("已分配 %d 个节点关系，其余分配失败", assignedCount), err)
+				return
+			}
 			if err := db.Create(&userNode).Error; err == nil {
 				assignedCount++
+				created = append(created, userNode)
 			}
 
 			var user models.User
@@ -438,6 +490,17 @@ func BatchAssignCustomNodes(c *gin.Context) {
 		}
 	}
 
+	if len(created) > 0 {
+		go func() {
+			panelService := panel.NewPanelService()
+			for i := range created {
+				if err := panelService.Provision(&created[i]); err != nil {
+					utils.LogWarn("远程面板创建客户端失败: assignment=%d, %v", created[i].ID, err)
+				}
+			}
+		}()
+	}
+
 	utils.SuccessResponse(c, http.StatusOK, fmt.Sprintf("成功分配 %d 个节点关系", assignedCount), nil)
 }
 
@@ -557,22 +620,35 @@ func GetCustomNodeLink(c *gin.Context) {
 		return
 	}
 
-	var link string
+	// 指定 user_id 时使用该用户的专属凭据生成链接
+	var userNode *models.UserCustomNode
+	if userID := c.Query("user_id"); userID != "" {
+		var un models.UserCustomNode
+		if err := db.Where("user_id = ? AND custom_node_id = ?", userID, node.ID).First(&un).Error; err != nil {
+			utils.ErrorResponse(c, http.StatusNotFound, "节点未分配给该用户", err)
+			return
+		}
+		if err := config_update.EnsureUserNodeCredentials(db, &un); err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "生成节点凭据失败", err)
+			return
+		}
+		userNode = &un
+	}
+
+	var proxyNode *config_update.ProxyNode
 	if node.Config != "" {
-		var proxyNode config_update.ProxyNode
-		if err := json.Unmarshal([]byte(node.Config), &proxyNode); err == nil {
+		var pn config_update.ProxyNode
+		if err := json.Unmarshal([]byte(node.Config), &pn); err == nil {
 			if node.DisplayName != "" {
-				proxyNode.Name = node.DisplayName
-			} else if proxyNode.Name == "" {
-				proxyNode.Name = node.Name
+				pn.Name = node.DisplayName
+			} else if pn.Name == "" {
+				pn.Name = node.Name
 			}
-
-			service := config_update.NewConfigUpdateService()
-			link = service.NodeToLink(&proxyNode)
+			proxyNode = &pn
 		} else {
 			var nodeConfig models.NodeConfig
 			if err2 := json.Unmarshal([]byte(node.Config), &nodeConfig); err2 == nil {
-				proxyNode := &config_update.ProxyNode{
+				proxyNode = &config_update.ProxyNode{
 					Name:     node.DisplayName,
 					Type:     nodeConfig.Type,
 					Server:   nodeConfig.Server,
@@ -587,13 +663,19 @@ func GetCustomNodeLink(c *gin.Context) {
 				if proxyNode.Name == "" {
 					proxyNode.Name = node.Name
 				}
-
-				service := config_update.NewConfigUpdateService()
-				link = service.NodeToLink(proxyNode)
 			}
 		}
 	}
 
+	var link string
+	if proxyNode != nil {
+		if userNode != nil {
+			config_update.ApplyUserCredentials(proxyNode, userNode.UUID, userNode.Password)
+		}
+		service := config_update.NewConfigUpdateService()
+		link = service.NodeToLink(proxyNode)
+	}
+
 	if link == "" {
 		link = "无法生成链接: 配置格式错误或协议不支持"
 	}
@@ -650,6 +732,11 @@ func AssignCustomNodeToUser(c *gin.Context) {
 		UserID:       parseUint(userID),
 		CustomNodeID: req.CustomNodeID,
 	}
+	var err error
+	if userNode.UUID, userNode.Password, err = config_update.GenerateNodeCredentials(); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "分配失败", err)
+		return
+	}
 
 	if err := db.Create(&userNode).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "分配失败: "+err.Error(), err)
@@ -667,6 +754,12 @@ func AssignCustomNodeToUser(c *gin.Context) {
 		db.Save(&user)
 	}
 
+	if err := panel.NewPanelService().Provision(&userNode); err != nil {
+		utils.LogWarn("远程面板创建客户端失败: assignment=%d, %v", userNode.ID, err)
+		utils.SuccessResponse(c, http.StatusOK, "分配成功，但远程面板同步失败: "+err.Error(), userNode)
+		return
+	}
+
 	utils.SuccessResponse(c, http.StatusOK, "分配成功", userNode)
 }
 
@@ -675,6 +768,16 @@ func UnassignCustomNodeFromUser(c *gin.Context) {
 	nodeID := c.Param("node_id")
 	db := database.GetDB()
 
+	var userNode models.UserCustomNode
+	if err := db.Preload("CustomNode").Where("user_id = ? AND custom_node_id = ?", userID, nodeID).First(&userNode).Error; err == nil {
+		// 远程客户端删除失败时保留分配记录，避免面板上残留客户端，重新分配时重复创建
+		if err := panel.NewPanelService().Remove(&userNode); err != nil {
+			utils.LogWarn("远程面板删除客户端失败: assignment=%d, %v", userNode.ID, err)
+			utils.ErrorResponse(c, http.StatusBadGateway, "远程面板删除客户端失败，请稍后重试: "+err.Error(), err)
+			return
+		}
+	}
+
 	if err := db.Where("user_id = ? AND custom_node_id = ?", userID, nodeID).Delete(&models.UserCustomNode{}).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "取消分配失败: "+err.Error(), err)
 		return
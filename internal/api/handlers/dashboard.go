@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -9,6 +10,7 @@ import (
 
 	"cboard-go/internal/core/database"
 	"cboard-go/internal/models"
+	"cboard-go/internal/services/sharing"
 	"cboard-go/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -306,9 +308,14 @@ func GetAbnormalUsers(c *gin.Context) {
 		Group("user_id").
 		Having("COUNT(*) >= ?", minReset)
 
+	sharingThreshold := sharing.LoadSettings(db).ScoreThreshold
+	sharingSubQuery := db.Model(&models.SharingScore{}).
+		Select("user_id").
+		Where("score >= ?", sharingThreshold)
+
 	query := db.Model(&models.User{}).
-		Where("is_active = ? OR (last_login IS NULL AND created_at < ?) OR id IN (?) OR id IN (?)",
-			false, oneMonthAgo, subscriptionSubQuery, resetSubQuery)
+		Where("is_active = ? OR (last_login IS NULL AND created_at < ?) OR id IN (?) OR id IN (?) OR id IN (?)",
+			false, oneMonthAgo, subscriptionSubQuery, resetSubQuery, sharingSubQuery)
 
 	if len(dateRange) == 2 {
 		query = query.Where("created_at BETWEEN ? AND ?", startTime, endTime)
@@ -342,6 +349,33 @@ func MarkUserNormal(c *gin.Context) {
 	utils.SuccessResponse(c, http.StatusOK, "已标记为正常", nil)
 }
 
+// GetSubscriptionSharingReport 实时分析订阅的共享得分，并返回最近的拉取记录
+func GetSubscriptionSharingReport(c *gin.Context) {
+	db := database.GetDB()
+	var sub models.Subscription
+	if err := db.First(&sub, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "订阅不存在", err)
+		return
+	}
+
+	report, err := sharing.NewDetector().AnalyzeSubscription(sub.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "分析订阅共享失败", err)
+		return
+	}
+
+	var fetches []models.SubscriptionFetch
+	db.Where("subscription_id = ?", sub.ID).Order("created_at DESC").Limit(100).Find(&fetches)
+
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"subscription_id": sub.ID,
+		"user_id":         sub.UserID,
+		"threshold":       sharing.LoadSettings(db).ScoreThreshold,
+		"report":          report,
+		"fetches":         fetches,
+	})
+}
+
 func buildAbnormalUserData(db *gorm.DB, users []models.User) []gin.H {
 	now := utils.GetBeijingTime()
 	startTime := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
@@ -352,6 +386,7 @@ func buildAbnormalUserData(db *gorm.DB, users []models.User) []gin.H {
 func buildAbnormalUserDataWithDateRange(db *gorm.DB, users []models.User, startTime, endTime time.Time, minSub, minReset int) []gin.H {
 	now := utils.GetBeijingTime()
 	oneMonthAgo := now.AddDate(0, -1, 0)
+	sharingThreshold := sharing.LoadSettings(db).ScoreThreshold
 	userList := make([]gin.H, 0, len(users))
 
 	for _, user := range users {
@@ -375,6 +410,14 @@ func buildAbnormalUserDataWithDateRange(db *gorm.DB, users []models.User, startT
 			Where("user_id = ? AND created_at >= ? AND created_at <= ?", user.ID, startTime, endTime).
 			Count(&subscriptionCount)
 
+		var sharingScore models.SharingScore
+		hasSharingScore := db.Where("user_id = ?", user.ID).Order("score DESC").First(&sharingScore).Error == nil
+		var sharingReport *sharing.Report
+		if hasSharingScore {
+			sharingReport = &sharing.Report{}
+			json.Unmarshal([]byte(sharingScore.Evidence), sharingReport)
+		}
+
 		abnormalType := "unknown"
 		abnormalCount := 0
 		description := ""
@@ -383,6 +426,13 @@ func buildAbnormalUserDataWithDateRange(db *gorm.DB, users []models.User, startT
 			abnormalType = "disabled"
 			abnormalCount = 1
 			description = "账户已被禁用"
+		} else if hasSharingScore && sharingScore.Score >= sharingThreshold {
+			abnormalType = "suspected_sharing"
+			abnormalCount = sharingScore.Score
+			description = fmt.Sprintf("疑似共享订阅，共享得分 %d（%s 窗口）", sharingScore.Score, sharingScore.Window)
+			for _, e := range sharingReport.Evidence {
+				description += "；" + e.Detail
+			}
 		} else if resetCount >= int64(minReset) {
 			abnormalType = "frequent_reset"
 			abnormalCount = int(resetCount)
@@ -425,6 +475,8 @@ func buildAbnormalUserDataWithDateRange(db *gorm.DB, users []models.User, startT
 			"subscription_count": subscriptionCount,
 			"description":        description,
 			"last_activity":      lastActivity,
+			"sharing_score":      sharingScore.Score,
+			"sharing_report":     sharingReport,
 		})
 	}
 
@@ -98,6 +98,7 @@ func GetDevices(c *gin.Context) {
 			"subscription_type":  getString(d.SubscriptionType),
 			"is_active":          d.IsActive,
 			"is_allowed":         d.IsAllowed,
+			"approval_status":    d.ApprovalStatus,
 			"first_seen":         firstSeen,
 			"last_access":        d.LastAccess.Format("2006-01-02 15:04:05"),
 			"last_seen":          lastSeen,
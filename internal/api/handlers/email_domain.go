@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/services/emaildomain"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// checkEmailDomain 按邮箱域名策略校验邮箱，被拒绝时记录安全日志并写入错误响应
+func checkEmailDomain(c *gin.Context, db *gorm.DB, email, action string) bool {
+	if err := emailDomainError(c, db, email, action); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return false
+	}
+	return true
+}
+
+// emailDomainError 按邮箱域名策略校验邮箱，被拒绝时记录安全日志并返回原因，由调用方决定如何响应
+func emailDomainError(c *gin.Context, db *gorm.DB, email, action string) error {
+	err := emaildomain.LoadPolicy(db).Check(c.Request.Context(), email)
+	if err == nil {
+		return nil
+	}
+	var rejection *emaildomain.Rejection
+	if errors.As(err, &rejection) {
+		ip := utils.GetRealClientIP(c)
+		utils.CreateSecurityLog(c, "email_domain_rejected", "MEDIUM",
+			fmt.Sprintf("邮箱域名被拒绝: %s (%s)", rejection.Domain, rejection.Rule),
+			map[string]interface{}{
+				"email":  email,
+				"domain": rejection.Domain,
+				"rule":   rejection.Rule,
+				"action": action,
+				"ip":     ip,
+			})
+	}
+	return err
+}
+
+// GetDisposableDomains 一次性邮箱列表的加载状态
+func GetDisposableDomains(c *gin.Context) {
+	utils.SuccessResponse(c, http.StatusOK, "", emaildomain.CurrentDisposableStatus())
+}
+
+// UpdateDisposableDomains 上传新的一次性邮箱列表（纯文本，每行一个域名），
+// 请求体为空时从 url 参数（仅限白名单内的 https 来源）或默认地址下载
+func UpdateDisposableDomains(c *gin.Context) {
+	data, err := c.GetRawData()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+
+	var count int
+	source := "upload"
+	if len(data) == 0 {
+		source = c.Query("url")
+		if source == "" {
+			source = emaildomain.DefaultDisposableListURL
+		}
+		count, err = emaildomain.DownloadDisposableDomains(c.Request.Context(), source)
+	} else {
+		count, err = emaildomain.SaveDisposableDomains(data)
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "更新一次性邮箱列表失败: "+err.Error(), nil)
+		return
+	}
+
+	utils.CreateAuditLogSimple(c, "update_disposable_domains", "email_domain", 0,
+		fmt.Sprintf("更新一次性邮箱列表: %d 个域名，来源 %s", count, source))
+	utils.SuccessResponse(c, http.StatusOK, "一次性邮箱列表已更新", emaildomain.CurrentDisposableStatus())
+}
+
+// TestEmailDomain 用当前策略检查指定邮箱，便于管理员确认配置
+func TestEmailDomain(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	result := gin.H{"email": req.Email, "allowed": true}
+	if err := emaildomain.LoadPolicy(database.GetDB()).Check(c.Request.Context(), req.Email); err != nil {
+		result["allowed"] = false
+		result["reason"] = err.Error()
+		var rejection *emaildomain.Rejection
+		if errors.As(err, &rejection) {
+			result["rule"] = rejection.Rule
+		}
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", result)
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"fmt"
+	"html"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/core/kvstore"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/email"
+	"cboard-go/internal/services/loginrisk"
+	"cboard-go/internal/services/session"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	challengeTypeStepUp = "login_step_up"
+	stepUpTTL           = 10 * time.Minute
+	stepUpMaxAttempts   = 5
+)
+
+// assessLoginRisk 评估本次登录的风险，分数达到提醒阈值时记录安全日志
+func assessLoginRisk(c *gin.Context, db *gorm.DB, user *models.User, ipAddress string) (*loginrisk.Assessment, loginrisk.Settings) {
+	settings := loginrisk.LoadSettings(db)
+	risk := loginrisk.Assess(db, settings, user.ID, ipAddress, c.GetHeader("User-Agent"), time.Now())
+	if settings.ShouldAlert(risk) {
+		utils.CreateSecurityLog(c, "login_risk", "MEDIUM",
+			fmt.Sprintf("风险登录: 用户 %s (IP: %s) %s", user.Username, ipAddress, strings.Join(risk.Reasons(), "；")),
+			map[string]interface{}{
+				"user_id":  user.ID,
+				"ip":       ipAddress,
+				"score":    risk.Score,
+				"signals":  risk.Signals,
+				"location": risk.LocationString(),
+				"device":   risk.DeviceName,
+			})
+	}
+	return risk, settings
+}
+
+func recordLoginRisk(db *gorm.DB, user *models.User, sessionID, ipAddress, action string, risk *loginrisk.Assessment) *models.LoginRiskEvent {
+	event := &models.LoginRiskEvent{
+		UserID:     user.ID,
+		SessionID:  sessionID,
+		IPAddress:  ipAddress,
+		Location:   risk.LocationString(),
+		DeviceName: risk.DeviceName,
+		Score:      risk.Score,
+		Signals:    strings.Join(risk.Signals, ","),
+		Action:     action,
+	}
+	if err := db.Create(event).Error; err != nil {
+		utils.LogError("recordLoginRisk: 保存风险登录记录失败", err, map[string]interface{}{"user_id": user.ID})
+	}
+	return event
+}
+
+// sendLoginAlert 发送"是否本人登录"邮件，邮件中的链接可直接退出该次登录
+func sendLoginAlert(db *gorm.DB, user *models.User, sessionID, ipAddress string, risk *loginrisk.Assessment) {
+	token := utils.GenerateSubscriptionURL()
+	hash := utils.HashToken(token)
+	event := recordLoginRisk(db, user, sessionID, ipAddress, "alert", risk)
+	if event.ID == 0 || db.Model(event).Update("revoke_hash", hash).Error != nil {
+		return
+	}
+
+	loginTime := utils.GetBeijingTime().Format("2006-01-02 15:04:05")
+	db.Create(&models.Notification{
+		UserID:   database.NullInt64(int64(user.ID)),
+		Title:    "新的登录提醒",
+		Content:  fmt.Sprintf("您的账户于 %s 在 %s（IP: %s）登录。如果不是您本人操作，请立即退出该登录并修改密码。", loginTime, risk.DeviceName, ipAddress),
+		Type:     "security",
+		IsActive: true,
+	})
+
+	go func() {
+		builder := email.NewEmailTemplateBuilder()
+		revokeURL := fmt.Sprintf("%s/api/v1/login-alert/%s", builder.GetBaseURL(), token)
+		content := builder.GetLoginAlertTemplate(user.Username, risk.DeviceName, ipAddress, risk.LocationString(),
+			loginTime, strings.Join(risk.Reasons(), "；"), revokeURL)
+		if err := email.NewEmailService().QueueEmail(user.Email, "新的登录提醒", content, "login_alert"); err != nil {
+			utils.LogWarn("sendLoginAlert: 邮件入队失败 user=%d: %v", user.ID, err)
+		}
+	}()
+}
+
+// maskEmail 隐藏邮箱用户名中间部分，如 a***e@example.com
+func maskEmail(addr string) string {
+	at := strings.LastIndexByte(addr, '@')
+	if at <= 0 {
+		return addr
+	}
+	name := []rune(addr[:at])
+	if len(name) <= 2 {
+		return string(name[:1]) + "***" + addr[at:]
+	}
+	return string(name[:1]) + "***" + string(name[len(name)-1:]) + addr[at:]
+}
+
+func generateNumericCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(900000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", 100000+n.Int64()), nil
+}
+
+// issueStepUpChallenge 高风险登录改为先发送邮箱验证码，验证通过后才签发令牌
+func issueStepUpChallenge(c *gin.Context, db *gorm.DB, user *models.User, ipAddress string, risk *loginrisk.Assessment) {
+	code, err := generateNumericCode()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "生成验证码失败", err)
+		return
+	}
+	// 旧的登录验证码作废，同一时间只有一个有效
+	db.Model(&models.VerificationCode{}).
+		Where("email = ? AND purpose = ? AND used = ?", user.Email, challengeTypeStepUp, 0).
+		Update("used", 1)
+	verificationCode := models.VerificationCode{
+		Email:     user.Email,
+		Code:      code,
+		ExpiresAt: utils.GetBeijingTime().Add(stepUpTTL),
+		Purpose:   challengeTypeStepUp,
+	}
+	if err := db.Create(&verificationCode).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "保存验证码失败", err)
+		return
+	}
+	token, err := utils.CreateChallengeToken(user.ID, user.Email, challengeTypeStepUp, stepUpTTL)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "生成验证令牌失败", err)
+		return
+	}
+
+	content := email.NewEmailTemplateBuilder().GetLoginStepUpTemplate(user.Username, code, ipAddress, risk.LocationString())
+	emailService := email.NewEmailService()
+	if err := emailService.SendEmail(user.Email, "登录验证码", content); err != nil {
+		if queueErr := emailService.QueueEmail(user.Email, "登录验证码", content, "verification"); queueErr != nil {
+			utils.LogError("issueStepUpChallenge: 发送验证码邮件失败", queueErr, map[string]interface{}{"user_id": user.ID})
+			utils.ErrorResponse(c, http.StatusInternalServerError, "发送验证码邮件失败", err)
+			return
+		}
+	}
+
+	recordLoginRisk(db, user, "", ipAddress, "step_up", risk)
+	c.Set("user_id", user.ID)
+	utils.CreateAuditLogSimple(c, "login_step_up", "auth", user.ID,
+		fmt.Sprintf("风险登录需要邮箱验证: %s (IP: %s, 风险分 %d)", user.Username, ipAddress, risk.Score))
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"step_up_required": true,
+		"challenge_token":  token,
+		"expires_in":       int(stepUpTTL.Seconds()),
+		"methods":          []string{"email_code"},
+		"email":            maskEmail(user.Email),
+	})
+}
+
+// VerifyLoginStepUp 风险登录的第二步：使用验证令牌 + 邮箱验证码换取访问令牌
+func VerifyLoginStepUp(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+
+	db := database.GetDB()
+	ipAddress := utils.GetRealClientIP(c)
+	user, _, ok := parseChallengeToken(c, db, req.ChallengeToken, challengeTypeStepUp)
+	if !ok {
+		return
+	}
+
+	// 有效期内最多尝试 stepUpMaxAttempts 次，超过后验证码作废，重新登录也不会重置次数
+	attempts, _, _ := kvstore.Default().Incr(fmt.Sprintf("login_step_up:attempts:%d", user.ID), stepUpTTL)
+	if attempts > stepUpMaxAttempts {
+		db.Model(&models.VerificationCode{}).
+			Where("email = ? AND purpose = ? AND used = ?", user.Email, challengeTypeStepUp, 0).
+			Update("used", 1)
+		utils.ErrorResponse(c, http.StatusTooManyRequests, "验证码错误次数过多，请重新登录", nil)
+		return
+	}
+
+	var code models.VerificationCode
+	err := db.Where("email = ? AND code = ? AND purpose = ? AND used = ?", user.Email, strings.TrimSpace(req.Code), challengeTypeStepUp, 0).
+		Order("created_at DESC").First(&code).Error
+	if err != nil || code.IsExpired() {
+		twoFactorFailure(c, user, ipAddress, "step_up")
+		return
+	}
+	if result := db.Model(&code).Where("used = ?", 0).Update("used", 1); result.Error != nil || result.RowsAffected == 0 {
+		twoFactorFailure(c, user, ipAddress, "step_up")
+		return
+	}
+
+	utils.CreateAuditLogSimple(c, "login_step_up_verified", "auth", user.ID, fmt.Sprintf("风险登录邮箱验证通过: %s", user.Username))
+	c.Set("step_up_passed", true)
+	finalizeLogin(c, db, user, ipAddress)
+}
+
+// ShowLoginAlert 登录提醒邮件中的链接，仅展示确认页，避免邮件安全扫描自动触发
+func ShowLoginAlert(c *gin.Context) {
+	event, ok := findLoginAlert(c)
+	if !ok {
+		return
+	}
+	body := fmt.Sprintf(`<p>设备：<strong>%s</strong></p><p>IP：%s</p><p>位置：%s</p><p>时间：%s</p>
+<form method="POST"><button type="submit" style="padding: 10px 30px; border: 0; border-radius: 4px; color: #fff; background: #e74c3c; font-size: 16px;">不是我，退出该登录</button></form>`,
+		html.EscapeString(event.DeviceName), html.EscapeString(event.IPAddress), html.EscapeString(event.Location),
+		event.CreatedAt.Format("2006-01-02 15:04:05"))
+	writeApprovalPage(c, http.StatusOK, "确认退出登录", body)
+}
+
+// ConfirmLoginAlert 撤销提醒邮件对应的会话
+func ConfirmLoginAlert(c *gin.Context) {
+	event, ok := findLoginAlert(c)
+	if !ok {
+		return
+	}
+	db := database.GetDB()
+	now := utils.GetBeijingTime()
+	result := db.Model(event).Where("revoked_at IS NULL").Updates(map[string]interface{}{"revoked_at": now, "revoke_hash": nil})
+	if result.Error != nil {
+		writeApprovalPage(c, http.StatusInternalServerError, "操作失败", "<p>请稍后重试或登录官网处理</p>")
+		return
+	}
+	if event.SessionID != "" {
+		if err := session.RevokeBySessionID(db, event.SessionID, session.ReasonLoginAlert); err != nil {
+			utils.LogError("ConfirmLoginAlert: 撤销会话失败", err, map[string]interface{}{"user_id": event.UserID})
+			writeApprovalPage(c, http.StatusInternalServerError, "操作失败", "<p>请稍后重试或登录官网处理</p>")
+			return
+		}
+	}
+
+	c.Set("user_id", event.UserID)
+	utils.CreateSecurityLog(c, "login_alert_revoked", "HIGH",
+		fmt.Sprintf("用户通过登录提醒邮件退出了来自 %s 的登录", event.IPAddress),
+		map[string]interface{}{"user_id": event.UserID, "event_id": event.ID, "session_id": event.SessionID, "ip": event.IPAddress})
+	writeApprovalPage(c, http.StatusOK, "已退出该登录", "<p>该设备需要重新登录。建议立即修改密码并开启两步验证。</p>")
+}
+
+func findLoginAlert(c *gin.Context) (*models.LoginRiskEvent, bool) {
+	var event models.LoginRiskEvent
+	token := c.Param("token")
+	if token == "" || database.GetDB().Where("revoke_hash = ? AND revoked_at IS NULL", utils.HashToken(token)).First(&event).Error != nil {
+		writeApprovalPage(c, http.StatusNotFound, "链接已失效", "<p>该登录已被退出或链接无效</p>")
+		return nil, false
+	}
+	return &event, true
+}
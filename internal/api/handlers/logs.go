@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -10,7 +11,9 @@ import (
 	"time"
 
 	"cboard-go/internal/core/database"
+	"cboard-go/internal/middleware"
 	"cboard-go/internal/models"
+	"cboard-go/internal/services/auditchain"
 	"cboard-go/internal/services/geoip"
 	"cboard-go/internal/utils"
 
@@ -487,17 +490,77 @@ func ExportLogs(c *gin.Context) {
 	c.Data(http.StatusOK, "text/csv; charset=utf-8", []byte(csvContent.String()))
 }
 
+// ClearLogs 审计日志不再直接删除：早于 before 的日志（默认全部）写入归档文件后移出日志表，
+// 并保存锚点以便剩余日志继续校验
 func ClearLogs(c *gin.Context) {
-	db := database.GetDB()
-
-	result := db.Where("1 = 1").Delete(&models.AuditLog{})
+	before := time.Now()
+	if value := strings.TrimSpace(c.Query("before")); value != "" {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local)
+		if err != nil {
+			if t, err = time.ParseInLocation("2006-01-02", value, time.Local); err != nil {
+				utils.ErrorResponse(c, http.StatusBadRequest, "时间格式错误", err)
+				return
+			}
+		}
+		before = t
+	}
 
-	if result.Error != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "清空日志失败", result.Error)
+	var createdBy *uint
+	if user, ok := middleware.GetCurrentUser(c); ok {
+		createdBy = &user.ID
+	}
+	anchor, err := auditchain.Archive(database.GetDB(), before, createdBy)
+	if errors.Is(err, auditchain.ErrNothingToArchive) {
+		utils.SuccessResponse(c, http.StatusOK, "没有需要归档的日志", gin.H{"deleted_count": 0})
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "归档日志失败", err)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, fmt.Sprintf("已清空 %d 条日志", result.RowsAffected), gin.H{
-		"deleted_count": result.RowsAffected,
+	utils.CreateAuditLogSimple(c, "archive_audit_logs", "audit_log", anchor.ID,
+		fmt.Sprintf("归档审计日志 #%d-#%d，共 %d 条，文件 %s", anchor.FirstID, anchor.LastID, anchor.Count, anchor.ArchiveFile))
+	utils.SuccessResponse(c, http.StatusOK, fmt.Sprintf("已归档 %d 条日志", anchor.Count), gin.H{
+		"deleted_count": anchor.Count,
+		"anchor":        anchor,
 	})
 }
+
+// VerifyAuditLogs 校验审计日志哈希链，archives=true 时同时校验归档文件
+func VerifyAuditLogs(c *gin.Context) {
+	db := database.GetDB()
+	report, err := auditchain.Verify(db)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "校验审计日志失败", err)
+		return
+	}
+	result := gin.H{"report": report}
+
+	if c.Query("archives") == "true" {
+		var anchors []models.AuditLogAnchor
+		db.Order("id ASC").Find(&anchors)
+		archives := make([]gin.H, 0, len(anchors))
+		for i := range anchors {
+			item := gin.H{"anchor_id": anchors[i].ID, "file": anchors[i].ArchiveFile}
+			if r, err := auditchain.VerifyArchive(auditchain.ArchiveDir(), &anchors[i]); err != nil {
+				item["error"] = err.Error()
+			} else {
+				item["report"] = r
+			}
+			archives = append(archives, item)
+		}
+		result["archives"] = archives
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", result)
+}
+
+// GetAuditLogAnchors 审计日志归档记录
+func GetAuditLogAnchors(c *gin.Context) {
+	var anchors []models.AuditLogAnchor
+	if err := database.GetDB().Order("id DESC").Find(&anchors).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取归档记录失败", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", anchors)
+}
@@ -476,21 +476,71 @@ func ImportNodeLinks(c *gin.Context) {
 	}
 	db := database.GetDB()
 	imp, skp := 0, 0
-	for _, link := range req.Links {
-		if parsed, err := config_update.ParseNodeLink(strings.TrimSpace(link)); err == nil {
-			node := buildNodeModel(parsed, true)
-			if findExistingNode(db, generateNodeKey(node.Type, node.Name, node.Config), node.Type) == nil {
-				if db.Create(&node).Error == nil {
-					imp++
-					continue
-				}
+	failed := make([]*config_update.LinkLintResult, 0)
+	for _, result := range config_update.LintNodeLinks(req.Links) {
+		if !result.Valid {
+			if result.Link != "" {
+				failed = append(failed, result)
+			}
+			continue
+		}
+		node := buildNodeModel(result.Node, true)
+		if findExistingNode(db, generateNodeKey(node.Type, node.Name, node.Config), node.Type) == nil {
+			if db.Create(&node).Error == nil {
+				imp++
+				continue
 			}
-			skp++
 		}
+		skp++
 	}
-	utils.SuccessResponse(c, http.StatusOK, fmt.Sprintf("成功 %d, 跳过 %d", imp, skp), gin.H{
+	utils.SuccessResponse(c, http.StatusOK, fmt.Sprintf("成功 %d, 跳过 %d, 失败 %d", imp, skp, len(failed)), gin.H{
 		"imported": imp,
 		"skipped":  skp,
+		"failed":   failed,
+	})
+}
+
+// LintNodeLinks 批量检查节点分享链接，返回解析结果、错误、警告及规范化链接
+func LintNodeLinks(c *gin.Context) {
+	var req struct {
+		Links   []string `json:"links"`
+		Content string   `json:"content"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+	links := req.Links
+	for _, line := range strings.Split(req.Content, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			links = append(links, line)
+		}
+	}
+	if len(links) == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请提供要检查的链接", nil)
+		return
+	}
+	if len(links) > 500 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "单次最多检查 500 条链接", nil)
+		return
+	}
+
+	results := config_update.LintNodeLinks(links)
+	valid, warned := 0, 0
+	for _, r := range results {
+		if r.Valid {
+			valid++
+		}
+		if len(r.Warnings) > 0 {
+			warned++
+		}
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"total":    len(results),
+		"valid":    valid,
+		"invalid":  len(results) - valid,
+		"warnings": warned,
+		"results":  results,
 	})
 }
 
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/node_server"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// checkNodeBackendToken 校验节点后端通信密钥，每个专线节点使用自己的密钥，只能访问 :id 对应的节点
+func checkNodeBackendToken(c *gin.Context, db *gorm.DB) bool {
+	token := c.Query("token")
+	if token == "" {
+		token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	token = strings.TrimSpace(token)
+	var node models.CustomNode
+	if token == "" || db.Select("id", "backend_token_hash").First(&node, c.Param("id")).Error != nil ||
+		node.BackendTokenHash == "" ||
+		subtle.ConstantTimeCompare([]byte(utils.HashToken(token)), []byte(node.BackendTokenHash)) != 1 {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "通信密钥错误", nil)
+		return false
+	}
+	return true
+}
+
+// IssueCustomNodeBackendToken 为专线节点签发新的后端通信密钥，旧密钥立即失效
+func IssueCustomNodeBackendToken(c *gin.Context) {
+	db := database.GetDB()
+	var node models.CustomNode
+	if err := db.First(&node, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "节点不存在", err)
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "生成通信密钥失败", err)
+		return
+	}
+	token := hex.EncodeToString(b)
+	if err := db.Model(&node).Update("backend_token_hash", utils.HashToken(token)).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "保存通信密钥失败", err)
+		return
+	}
+
+	utils.CreateAuditLogSimple(c, "issue_node_backend_token", "custom_node", node.ID,
+		fmt.Sprintf("签发专线节点后端通信密钥: %s", node.Name))
+	utils.SuccessResponse(c, http.StatusOK, "通信密钥已生成，请立即保存，之后无法再次查看", gin.H{
+		"node_id": node.ID,
+		"token":   token,
+	})
+}
+
+// GetNodeBackendUsers 返回专线节点当前有效的用户及其专属凭据，供节点后端同步
+func GetNodeBackendUsers(c *gin.Context) {
+	db := database.GetDB()
+	if !checkNodeBackendToken(c, db) {
+		return
+	}
+
+	var node models.CustomNode
+	if err := db.First(&node, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "节点不存在", err)
+		return
+	}
+
+	users, err := node_server.ListNodeUsers(db, &node)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取节点用户失败", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"node_id": node.ID,
+		"users":   users,
+	})
+}
+
+// GetNodeBackendConfig 节点服务器拉取自身的完整服务端配置
+func GetNodeBackendConfig(c *gin.Context) {
+	db := database.GetDB()
+	if !checkNodeBackendToken(c, db) {
+		return
+	}
+	writeServerConfig(c, db, false)
+}
+
+// DownloadCustomNodeServerConfig 管理员下载专线节点的服务端配置
+func DownloadCustomNodeServerConfig(c *gin.Context) {
+	writeServerConfig(c, database.GetDB(), true)
+}
+
+func writeServerConfig(c *gin.Context, db *gorm.DB, attachment bool) {
+	var node models.CustomNode
+	if err := db.First(&node, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "节点不存在", err)
+		return
+	}
+
+	format := c.DefaultQuery("format", node_server.FormatXray)
+	data, err := node_server.GenerateServerConfig(db, &node, format)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "生成服务端配置失败: "+err.Error(), nil)
+		return
+	}
+
+	if attachment {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=node-%d-%s.json", node.ID, format))
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/panel"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetNodePanels(c *gin.Context) {
+	var panels []models.NodePanel
+	if err := database.GetDB().Order("id ASC").Find(&panels).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取面板列表失败", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", panels)
+}
+
+func CreateNodePanel(c *gin.Context) {
+	var req struct {
+		Name     string `json:"name" binding:"required"`
+		Type     string `json:"type" binding:"required"`
+		BaseURL  string `json:"base_url" binding:"required"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+	if req.Type != panel.TypeXUI && req.Type != panel.TypeMarzban {
+		utils.ErrorResponse(c, http.StatusBadRequest, "不支持的面板类型", nil)
+		return
+	}
+
+	p := models.NodePanel{
+		Name:     req.Name,
+		Type:     req.Type,
+		BaseURL:  strings.TrimRight(strings.TrimSpace(req.BaseURL), "/"),
+		Username: req.Username,
+		IsActive: true,
+	}
+	if req.Password != "" {
+		encrypted, err := utils.EncryptAES(req.Password)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "加密面板密码失败", err)
+			return
+		}
+		p.Password = encrypted
+	}
+
+	if err := database.GetDB().Create(&p).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "创建面板失败", err)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "create_node_panel", "node_panel", p.ID, "创建外部节点面板: "+p.Name)
+	utils.SuccessResponse(c, http.StatusCreated, "创建成功", p)
+}
+
+func UpdateNodePanel(c *gin.Context) {
+	db := database.GetDB()
+	var p models.NodePanel
+	if err := db.First(&p, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "面板不存在", err)
+		return
+	}
+
+	var req struct {
+		Name     string  `json:"name"`
+		BaseURL  string  `json:"base_url"`
+		Username *string `json:"username"`
+		Password string  `json:"password"`
+		IsActive *bool   `json:"is_active"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+
+	if req.Name != "" {
+		p.Name = req.Name
+	}
+	if req.BaseURL != "" {
+		p.BaseURL = strings.TrimRight(strings.TrimSpace(req.BaseURL), "/")
+	}
+	if req.Username != nil {
+		p.Username = *req.Username
+	}
+	if req.Password != "" {
+		encrypted, err := utils.EncryptAES(req.Password)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "加密面板密码失败", err)
+			return
+		}
+		p.Password = encrypted
+	}
+	if req.IsActive != nil {
+		p.IsActive = *req.IsActive
+	}
+
+	if err := db.Save(&p).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "更新面板失败", err)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "update_node_panel", "node_panel", p.ID, "更新外部节点面板: "+p.Name)
+	utils.SuccessResponse(c, http.StatusOK, "更新成功", p)
+}
+
+func DeleteNodePanel(c *gin.Context) {
+	db := database.GetDB()
+	var p models.NodePanel
+	if err := db.First(&p, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "面板不存在", err)
+		return
+	}
+
+	var nodeCount int64
+	db.Model(&models.CustomNode{}).Where("panel_id = ?", p.ID).Count(&nodeCount)
+	if nodeCount > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "仍有专线节点关联该面板，无法删除", nil)
+		return
+	}
+
+	if err := db.Delete(&p).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除面板失败", err)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "delete_node_panel", "node_panel", p.ID, "删除外部节点面板: "+p.Name)
+	utils.SuccessResponse(c, http.StatusOK, "删除成功", nil)
+}
+
+func TestNodePanel(c *gin.Context) {
+	var p models.NodePanel
+	if err := database.GetDB().First(&p, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "面板不存在", err)
+		return
+	}
+	if err := panel.TestPanel(&p); err != nil {
+		utils.ErrorResponse(c, http.StatusBadGateway, "面板连接失败: "+err.Error(), nil)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "面板连接成功", nil)
+}
+
+func SyncNodePanels(c *gin.Context) {
+	if err := panel.NewPanelService().SyncAll(); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "同步失败", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "同步完成", nil)
+}
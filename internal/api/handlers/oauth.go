@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"cboard-go/internal/core/auth"
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/oauth"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+func loadOAuthProvider(c *gin.Context, db *gorm.DB) (*oauth.Settings, *oauth.Provider, bool) {
+	settings, err := oauth.LoadSettings(db)
+	if err != nil {
+		utils.LogWarn("加载第三方登录配置失败: %v", err)
+	}
+	if settings == nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "加载第三方登录配置失败", err)
+		return nil, nil, false
+	}
+	provider, err := settings.Provider(c.Param("provider"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error(), nil)
+		return nil, nil, false
+	}
+	return settings, provider, true
+}
+
+func oauthRedirectURI(c *gin.Context, db *gorm.DB, provider string) string {
+	return utils.GetBuildBaseURL(c.Request, db) + "/oauth/callback/" + provider
+}
+
+// GetOAuthProviders 获取已启用的第三方登录方式
+func GetOAuthProviders(c *gin.Context) {
+	settings, err := oauth.LoadSettings(database.GetDB())
+	if err != nil {
+		utils.LogWarn("加载第三方登录配置失败: %v", err)
+	}
+	providers := []*oauth.Provider{}
+	autoRegister := false
+	if settings != nil {
+		providers = append(providers, settings.Providers...)
+		autoRegister = settings.AutoRegister
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"providers":     providers,
+		"auto_register": autoRegister,
+	})
+}
+
+// OAuthAuthorize 生成第三方授权地址，前端跳转后由回调页提交授权码
+func OAuthAuthorize(c *gin.Context) {
+	var req struct {
+		InviteCode string `json:"invite_code"`
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	db := database.GetDB()
+	_, provider, ok := loadOAuthProvider(c, db)
+	if !ok {
+		return
+	}
+	authURL, state, err := provider.AuthCodeURL(oauthRedirectURI(c, db, provider.Name), strings.TrimSpace(req.InviteCode), 0)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "生成授权地址失败", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"authorize_url": authURL,
+		"state":         state,
+	})
+}
+
+// OAuthCallback 使用授权码完成登录、注册或绑定
+func OAuthCallback(c *gin.Context) {
+	var req struct {
+		Code  string `json:"code" binding:"required"`
+		State string `json:"state" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+
+	db := database.GetDB()
+	ipAddress := utils.GetRealClientIP(c)
+	settings, provider, ok := loadOAuthProvider(c, db)
+	if !ok {
+		return
+	}
+	state, err := oauth.TakeState(req.State, provider.Name)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	identity, err := provider.Exchange(c.Request.Context(), req.Code, state)
+	if err != nil {
+		utils.CreateSecurityLog(c, "oauth_failed", "MEDIUM",
+			fmt.Sprintf("第三方登录失败: %s (IP: %s): %v", provider.DisplayName, ipAddress, err),
+			map[string]interface{}{"provider": provider.Name, "ip": ipAddress})
+		utils.ErrorResponse(c, http.StatusBadRequest, provider.DisplayName+" 授权失败，请重试", err)
+		return
+	}
+
+	if state.LinkUserID != 0 {
+		linkOAuthIdentity(c, db, provider, identity, state.LinkUserID)
+		return
+	}
+
+	var link models.OAuthIdentity
+	err = db.Where("provider = ? AND subject = ?", provider.Name, identity.Subject).First(&link).Error
+	if err == nil {
+		var user models.User
+		if err := db.First(&user, link.UserID).Error; err != nil {
+			utils.ErrorResponse(c, http.StatusUnauthorized, "用户不存在", err)
+			return
+		}
+		touchOAuthIdentity(db, &link, identity)
+		oauthLogin(c, db, &user, provider, ipAddress)
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "查询绑定信息失败", err)
+		return
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		utils.ErrorResponse(c, http.StatusBadRequest, provider.DisplayName+" 账号未提供已验证的邮箱，无法登录", nil)
+		return
+	}
+
+	var user models.User
+	err = db.Where("email = ?", identity.Email).First(&user).Error
+	if err == nil {
+		// 管理员账号从不按邮箱自动绑定，避免第三方邮箱被接管后取得后台权限
+		if !settings.LinkByEmail || user.IsAdmin {
+			utils.ErrorResponse(c, http.StatusConflict, "该邮箱已注册，请先使用密码登录后在个人资料中绑定", nil)
+			return
+		}
+		if err := createOAuthIdentity(db, user.ID, provider.Name, identity); err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "绑定第三方账号失败", err)
+			return
+		}
+		c.Set("user_id", user.ID)
+		utils.CreateAuditLogSimple(c, "oauth_linked", "auth", user.ID,
+			fmt.Sprintf("通过已验证邮箱自动绑定 %s 账号: %s", provider.DisplayName, identity.Email))
+		oauthLogin(c, db, &user, provider, ipAddress)
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "查询用户失败", err)
+		return
+	}
+
+	newUser, err := registerOAuthUser(c, db, settings, provider, identity, state.InviteCode)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	c.Set("user_id", newUser.ID)
+	utils.CreateSecurityLog(c, "register_success", "INFO",
+		fmt.Sprintf("注册成功: 用户 %s 通过 %s (IP: %s)", newUser.Username, provider.DisplayName, ipAddress),
+		map[string]interface{}{"user_id": newUser.ID, "username": newUser.Username, "ip": ipAddress, "provider": provider.Name})
+	utils.CreateAuditLogSimple(c, "oauth_register", "auth", newUser.ID,
+		fmt.Sprintf("通过 %s 注册: %s", provider.DisplayName, newUser.Email))
+	handleRegisterNotification(*newUser)
+	oauthLogin(c, db, newUser, provider, ipAddress)
+}
+
+func oauthLogin(c *gin.Context, db *gorm.DB, user *models.User, provider *oauth.Provider, ipAddress string) {
+	var maintenance models.SystemConfig
+	if err := db.Where("key = ? AND category = ?", "maintenance_mode", "system").First(&maintenance).Error; err == nil &&
+		maintenance.Value == "true" && !user.IsAdmin {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "系统维护中，请稍后再试", nil)
+		return
+	}
+	c.Set("user_id", user.ID)
+	utils.CreateAuditLogSimple(c, "oauth_login", "auth", user.ID,
+		fmt.Sprintf("通过 %s 登录: %s (IP: %s)", provider.DisplayName, user.Username, ipAddress))
+	c.Set("login_method", provider.Name)
+	finalizeLogin(c, db, user, ipAddress)
+}
+
+func createOAuthIdentity(db *gorm.DB, userID uint, provider string, identity *oauth.Identity) error {
+	now := utils.GetBeijingTime()
+	return db.Create(&models.OAuthIdentity{
+		UserID:      userID,
+		Provider:    provider,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		Name:        identity.Name,
+		AvatarURL:   identity.AvatarURL,
+		LastLoginAt: &now,
+	}).Error
+}
+
+func touchOAuthIdentity(db *gorm.DB, link *models.OAuthIdentity, identity *oauth.Identity) {
+	now := utils.GetBeijingTime()
+	db.Model(link).Updates(map[string]interface{}{
+		"email":         identity.Email,
+		"name":          identity.Name,
+		"avatar_url":    identity.AvatarURL,
+		"last_login_at": now,
+	})
+}
+
+func linkOAuthIdentity(c *gin.Context, db *gorm.DB, provider *oauth.Provider, identity *oauth.Identity, userID uint) {
+	c.Set("user_id", userID)
+	var existing models.OAuthIdentity
+	if err := db.Where("provider = ? AND subject = ?", provider.Name, identity.Subject).First(&existing).Error; err == nil {
+		if existing.UserID == userID {
+			utils.SuccessResponse(c, http.StatusOK, "已绑定该账号", existing)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusConflict, "该 "+provider.DisplayName+" 账号已绑定其他用户", nil)
+		return
+	}
+	var count int64
+	db.Model(&models.OAuthIdentity{}).Where("user_id = ? AND provider = ?", userID, provider.Name).Count(&count)
+	if count > 0 {
+		utils.ErrorResponse(c, http.StatusConflict, "已绑定其他 "+provider.DisplayName+" 账号，请先解绑", nil)
+		return
+	}
+	if err := createOAuthIdentity(db, userID, provider.Name, identity); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "绑定第三方账号失败", err)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "oauth_linked", "auth", userID,
+		fmt.Sprintf("绑定 %s 账号: %s", provider.DisplayName, identity.Email))
+	utils.SuccessResponse(c, http.StatusOK, "绑定成功", gin.H{"linked": true, "provider": provider.Name})
+}
+
+// registerOAuthUser 自动注册：遵循注册开关与邀请码设置，邮箱已由第三方验证
+func registerOAuthUser(c *gin.Context, db *gorm.DB, settings *oauth.Settings, provider *oauth.Provider, identity *oauth.Identity, inviteCode string) (*models.User, error) {
+	if !settings.AutoRegister {
+		return nil, errors.New("该邮箱尚未注册，请先注册账号后再绑定")
+	}
+	if val, _ := getSystemConfigValue(db, "registration", "registration_enabled"); val == "false" {
+		return nil, errors.New("系统已关闭注册")
+	}
+	// 与邮箱注册使用同一域名策略
+	if err := emailDomainError(c, db, identity.Email, "oauth_register"); err != nil {
+		return nil, err
+	}
+	if val, _ := getSystemConfigValue(db, "registration", "invite_code_required"); val == "true" {
+		if inviteCode == "" {
+			return nil, errors.New("注册需要邀请码，请填写邀请码后重试")
+		}
+		if err := validateInviteCode(db, inviteCode); err != nil {
+			return nil, err
+		}
+	}
+
+	randomPassword := make([]byte, 32)
+	if _, err := rand.Read(randomPassword); err != nil {
+		return nil, err
+	}
+	hashed, err := auth.HashPassword(hex.EncodeToString(randomPassword))
+	if err != nil {
+		return nil, fmt.Errorf("密码加密失败: %v", err)
+	}
+
+	var user models.User
+	err = utils.WithTransaction(db, func(tx *gorm.DB) error {
+		username, err := oauthUsername(tx, identity)
+		if err != nil {
+			return err
+		}
+		user = models.User{
+			Username:   username,
+			Email:      identity.Email,
+			Password:   hashed,
+			IsActive:   true,
+			IsVerified: true,
+		}
+		if identity.Name != "" {
+			user.Nickname = database.NullString(truncateRunes(identity.Name, 50))
+		}
+		if identity.AvatarURL != "" && len(identity.AvatarURL) <= 255 {
+			user.Avatar = database.NullString(identity.AvatarURL)
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return fmt.Errorf("创建用户失败: %v", err)
+		}
+		if err := createOAuthIdentity(tx, user.ID, provider.Name, identity); err != nil {
+			return fmt.Errorf("绑定第三方账号失败: %v", err)
+		}
+		if err := createDefaultSubscription(tx, user.ID); err != nil {
+			return fmt.Errorf("创建默认订阅失败: %v", err)
+		}
+		if inviteCode != "" {
+			processInviteCode(tx, inviteCode, user.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.First(&user, user.ID)
+	return &user, nil
+}
+
+// oauthUsername 由第三方用户名或邮箱前缀生成可用的用户名
+func oauthUsername(db *gorm.DB, identity *oauth.Identity) (string, error) {
+	base := identity.Username
+	if base == "" {
+		base = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+	base = usernameInvalidChars.ReplaceAllString(base, "_")
+	if len(base) > 15 {
+		base = base[:15]
+	}
+	if len(base) < 3 {
+		base = "user_" + base
+	}
+	candidate := base
+	for i := 0; i < 10; i++ {
+		var count int64
+		db.Model(&models.User{}).Where("username = ?", candidate).Count(&count)
+		if count == 0 {
+			return candidate, nil
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s_%04d", base, n.Int64())
+	}
+	return "", errors.New("生成用户名失败，请重试")
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// GetOAuthIdentities 获取当前用户绑定的第三方账号
+func GetOAuthIdentities(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	var links []models.OAuthIdentity
+	if err := database.GetDB().Where("user_id = ?", user.ID).Order("id ASC").Find(&links).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取绑定信息失败", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", links)
+}
+
+// LinkOAuthIdentity 已登录用户发起绑定，回调与登录共用
+func LinkOAuthIdentity(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	db := database.GetDB()
+	_, provider, ok := loadOAuthProvider(c, db)
+	if !ok {
+		return
+	}
+	authURL, state, err := provider.AuthCodeURL(oauthRedirectURI(c, db, provider.Name), "", user.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "生成授权地址失败", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"authorize_url": authURL,
+		"state":         state,
+	})
+}
+
+// UnlinkOAuthIdentity 解绑第三方账号；通过第三方注册的用户可使用找回密码设置登录密码
+func UnlinkOAuthIdentity(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	db := database.GetDB()
+	provider := c.Param("provider")
+	result := db.Where("user_id = ? AND provider = ?", user.ID, provider).Delete(&models.OAuthIdentity{})
+	if result.Error != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "解绑失败", result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.ErrorResponse(c, http.StatusNotFound, "未绑定该账号", nil)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "oauth_unlinked", "auth", user.ID, fmt.Sprintf("解绑第三方账号: %s", provider))
+	utils.SuccessResponse(c, http.StatusOK, "解绑成功", nil)
+}
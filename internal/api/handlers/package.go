@@ -8,6 +8,7 @@ import (
 
 	"cboard-go/internal/core/database"
 	"cboard-go/internal/models"
+	"cboard-go/internal/services/device"
 	"cboard-go/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -65,12 +66,25 @@ func CreatePackage(c *gin.Context) {
 		SortOrder     int     `json:"sort_order"`
 		IsActive      bool    `json:"is_active"`
 		IsRecommended bool    `json:"is_recommended"`
+
+		OverflowPolicy     string `json:"overflow_policy"`
+		OverflowGraceHours int    `json:"overflow_grace_hours"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
 		return
 	}
+	if req.OverflowPolicy == "" {
+		req.OverflowPolicy = device.OverflowReject
+	}
+	if !device.ValidOverflowPolicy(req.OverflowPolicy) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的设备超限策略", nil)
+		return
+	}
+	if req.OverflowGraceHours <= 0 {
+		req.OverflowGraceHours = 24
+	}
 
 	db := database.GetDB()
 	pkg := models.Package{
@@ -81,6 +95,9 @@ func CreatePackage(c *gin.Context) {
 		SortOrder:     req.SortOrder,
 		IsActive:      req.IsActive,
 		IsRecommended: req.IsRecommended,
+
+		OverflowPolicy:     req.OverflowPolicy,
+		OverflowGraceHours: req.OverflowGraceHours,
 	}
 
 	if req.Description != "" {
@@ -107,6 +124,9 @@ func UpdatePackage(c *gin.Context) {
 		SortOrder     *int     `json:"sort_order"`     // 使用指针，允许检测是否提供
 		IsActive      *bool    `json:"is_active"`      // 使用指针，允许检测是否提供
 		IsRecommended *bool    `json:"is_recommended"` // 使用指针，允许检测是否提供
+
+		OverflowPolicy     *string `json:"overflow_policy"`
+		OverflowGraceHours *int    `json:"overflow_grace_hours"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -175,6 +195,20 @@ func UpdatePackage(c *gin.Context) {
 	if req.IsRecommended != nil {
 		pkg.IsRecommended = *req.IsRecommended
 	}
+	if req.OverflowPolicy != nil {
+		if !device.ValidOverflowPolicy(*req.OverflowPolicy) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "无效的设备超限策略", nil)
+			return
+		}
+		pkg.OverflowPolicy = *req.OverflowPolicy
+	}
+	if req.OverflowGraceHours != nil {
+		if *req.OverflowGraceHours < 1 || *req.OverflowGraceHours > 720 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "宽限时长需在1-720小时之间", nil)
+			return
+		}
+		pkg.OverflowGraceHours = *req.OverflowGraceHours
+	}
 
 	if err := db.Save(&pkg).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "更新套餐失败", err)
@@ -193,6 +227,9 @@ func UpdatePackage(c *gin.Context) {
 		"is_recommended": pkg.IsRecommended,
 		"created_at":     pkg.CreatedAt.Format("2006-01-02 15:04:05"),
 		"updated_at":     pkg.UpdatedAt.Format("2006-01-02 15:04:05"),
+
+		"overflow_policy":      pkg.OverflowPolicy,
+		"overflow_grace_hours": pkg.OverflowGraceHours,
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "更新成功", responseData)
@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"cboard-go/internal/core/auth"
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/passkey"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func newPasskeyService(c *gin.Context, db *gorm.DB) (*passkey.Service, bool) {
+	svc, err := passkey.NewService(db, passkey.RelyingPartyFromRequest(c.Request, db, totpIssuer(db)))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "通行密钥服务不可用", err)
+		return nil, false
+	}
+	return svc, true
+}
+
+// hasSecondFactor 用户是否还有可用的第二步验证方式（TOTP 或通行密钥）
+func hasSecondFactor(db *gorm.DB, user *models.User) bool {
+	return user.TwoFactorEnabled || passkey.CountCredentials(db, user.ID) > 0
+}
+
+// BeginPasskeyLogin 无密码登录第一步：获取验证参数
+func BeginPasskeyLogin(c *gin.Context) {
+	db := database.GetDB()
+	svc, ok := newPasskeyService(c, db)
+	if !ok {
+		return
+	}
+	options, sessionID, err := svc.BeginPasskeyLogin()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "发起通行密钥登录失败", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"session_id": sessionID,
+		"options":    options,
+	})
+}
+
+// FinishPasskeyLogin 无密码登录第二步：校验验证器签名并签发令牌
+func FinishPasskeyLogin(c *gin.Context) {
+	var req struct {
+		SessionID  string          `json:"session_id" binding:"required"`
+		Credential json.RawMessage `json:"credential" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+
+	db := database.GetDB()
+	ipAddress := utils.GetRealClientIP(c)
+	svc, ok := newPasskeyService(c, db)
+	if !ok {
+		return
+	}
+	user, cred, err := svc.FinishPasskeyLogin(req.SessionID, req.Credential)
+	if err != nil {
+		if errors.Is(err, passkey.ErrCloneWarning) {
+			utils.CreateSecurityLog(c, "passkey_clone_warning", "HIGH",
+				fmt.Sprintf("通行密钥签名计数异常: 用户 %s，凭据 %s (IP: %s)", user.Username, cred.Name, ipAddress),
+				map[string]interface{}{"user_id": user.ID, "credential_id": cred.ID, "ip": ipAddress})
+		}
+		handleLoginFailure(c, ipAddress, "passkey", "通行密钥验证失败: "+err.Error(), err)
+		return
+	}
+
+	var maintenance models.SystemConfig
+	if err := db.Where("key = ? AND category = ?", "maintenance_mode", "system").First(&maintenance).Error; err == nil &&
+		maintenance.Value == "true" && !user.IsAdmin {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "系统维护中，请稍后再试", nil)
+		return
+	}
+
+	c.Set("user_id", user.ID)
+	utils.CreateAuditLogSimple(c, "passkey_login", "auth", user.ID,
+		fmt.Sprintf("使用通行密钥登录: %s，凭据 %s (IP: %s)", user.Username, cred.Name, ipAddress))
+	// 通行密钥登录要求验证器完成用户验证，本身即满足两步验证
+	c.Set("two_factor_passed", true)
+	c.Set("login_method", "passkey")
+	finalizeLogin(c, db, user, ipAddress)
+}
+
+// BeginTwoFactorPasskey 登录第二步使用通行密钥：凭验证令牌获取验证参数
+func BeginTwoFactorPasskey(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	db := database.GetDB()
+	user, _, ok := parseChallengeToken(c, db, req.ChallengeToken, challengeTypeVerify)
+	if !ok {
+		return
+	}
+	svc, ok := newPasskeyService(c, db)
+	if !ok {
+		return
+	}
+	options, sessionID, err := svc.BeginLogin(user)
+	if err != nil {
+		if errors.Is(err, passkey.ErrNoCredentials) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "未绑定通行密钥", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "发起通行密钥验证失败", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"session_id": sessionID,
+		"options":    options,
+	})
+}
+
+// verifyPasskeySecondFactor 校验登录第二步提交的通行密钥
+func verifyPasskeySecondFactor(c *gin.Context, db *gorm.DB, user *models.User, sessionID string, credential json.RawMessage) bool {
+	svc, ok := newPasskeyService(c, db)
+	if !ok {
+		return false
+	}
+	cred, err := svc.FinishLogin(user, sessionID, credential)
+	if err != nil {
+		if errors.Is(err, passkey.ErrCloneWarning) {
+			utils.CreateSecurityLog(c, "passkey_clone_warning", "HIGH",
+				fmt.Sprintf("通行密钥签名计数异常: 用户 %s，凭据 %s", user.Username, cred.Name),
+				map[string]interface{}{"user_id": user.ID, "credential_id": cred.ID})
+		}
+		utils.LogWarn("通行密钥两步验证失败: user_id=%d, error=%v", user.ID, err)
+		return false
+	}
+	return true
+}
+
+// ListPasskeys 获取当前用户绑定的通行密钥
+func ListPasskeys(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	creds, err := passkey.ListCredentials(database.GetDB(), user.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取通行密钥失败", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", creds)
+}
+
+// passkeyReauth 绑定或删除通行密钥前再次确认身份
+type passkeyReauth struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// confirmPasskeyChange 校验当前密码，或已启用 TOTP 时的验证码
+func confirmPasskeyChange(c *gin.Context, db *gorm.DB, user *models.User, req passkeyReauth, action string) bool {
+	if req.Password != "" && auth.VerifyPassword(req.Password, user.Password) {
+		return true
+	}
+	if req.Code != "" && user.TwoFactorEnabled && verifyTOTPForUser(db, user, user.TOTPSecret, req.Code) {
+		return true
+	}
+	utils.SetResponseStatus(c, http.StatusBadRequest)
+	utils.CreateAuditLogSimple(c, "passkey_reauth_failed", "auth", user.ID, action+"失败: 密码或验证码错误")
+	utils.ErrorResponse(c, http.StatusBadRequest, "密码或验证码错误", nil)
+	return false
+}
+
+// BeginPasskeyRegistration 开始绑定通行密钥，需要当前密码或验证码；
+// 绑定会话只在确认身份后签发且与用户绑定、一次有效，完成绑定无需再次确认
+func BeginPasskeyRegistration(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	var req passkeyReauth
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	db := database.GetDB()
+	if !confirmPasskeyChange(c, db, user, req, "绑定通行密钥") {
+		return
+	}
+	svc, ok := newPasskeyService(c, db)
+	if !ok {
+		return
+	}
+	options, sessionID, err := svc.BeginRegistration(user)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "发起通行密钥绑定失败", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"session_id": sessionID,
+		"options":    options,
+	})
+}
+
+// FinishPasskeyRegistration 完成绑定；首次启用第二步验证时同时生成恢复码
+func FinishPasskeyRegistration(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		SessionID  string          `json:"session_id" binding:"required"`
+		Name       string          `json:"name"`
+		Credential json.RawMessage `json:"credential" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	if len([]rune(req.Name)) > 100 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "名称过长", nil)
+		return
+	}
+
+	db := database.GetDB()
+	svc, ok := newPasskeyService(c, db)
+	if !ok {
+		return
+	}
+	hadSecondFactor := hasSecondFactor(db, user)
+	cred, err := svc.FinishRegistration(user, req.SessionID, utils.SanitizeInput(req.Name), req.Credential)
+	if err != nil {
+		utils.SetResponseStatus(c, http.StatusBadRequest)
+		utils.CreateAuditLogSimple(c, "passkey_register_failed", "auth", user.ID, "绑定通行密钥失败: "+err.Error())
+		utils.ErrorResponse(c, http.StatusBadRequest, "绑定通行密钥失败", err)
+		return
+	}
+
+	data := gin.H{"credential": cred}
+	if !hadSecondFactor {
+		codes, err := regenerateRecoveryCodes(db, user.ID)
+		if err != nil {
+			utils.LogError("生成恢复码失败", err, map[string]interface{}{"user_id": user.ID})
+		} else {
+			data["recovery_codes"] = codes
+		}
+	}
+	utils.CreateAuditLogSimple(c, "passkey_registered", "auth", user.ID, fmt.Sprintf("绑定通行密钥: %s", cred.Name))
+	utils.SuccessResponse(c, http.StatusOK, "通行密钥已绑定", data)
+}
+
+func getOwnPasskey(c *gin.Context, db *gorm.DB, userID uint) (*models.WebAuthnCredential, bool) {
+	var cred models.WebAuthnCredential
+	if err := db.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&cred).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "通行密钥不存在", err)
+		return nil, false
+	}
+	return &cred, true
+}
+
+// RenamePasskey 修改通行密钥名称
+func RenamePasskey(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	name := strings.TrimSpace(utils.SanitizeInput(req.Name))
+	if name == "" || len([]rune(name)) > 100 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "名称不能为空且不超过 100 个字符", nil)
+		return
+	}
+
+	db := database.GetDB()
+	cred, ok := getOwnPasskey(c, db, user.ID)
+	if !ok {
+		return
+	}
+	old := cred.Name
+	if err := db.Model(cred).Update("name", name).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "修改失败", err)
+		return
+	}
+	cred.Name = name
+	utils.CreateAuditLogSimple(c, "passkey_renamed", "auth", user.ID, fmt.Sprintf("重命名通行密钥: %s -> %s", old, name))
+	utils.SuccessResponse(c, http.StatusOK, "修改成功", cred)
+}
+
+// DeletePasskey 删除通行密钥，需要当前密码或验证码；删除最后一个第二步验证方式时恢复码一并失效
+func DeletePasskey(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	var req passkeyReauth
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	db := database.GetDB()
+	cred, ok := getOwnPasskey(c, db, user.ID)
+	if !ok {
+		return
+	}
+	if !confirmPasskeyChange(c, db, user, req, "删除通行密钥") {
+		return
+	}
+	last := !user.TwoFactorEnabled && passkey.CountCredentials(db, user.ID) <= 1
+	if last && user.IsAdmin && adminTwoFactorRequired(db) {
+		utils.ErrorResponse(c, http.StatusForbidden, "系统要求管理员必须启用两步验证，无法删除最后一个通行密钥", nil)
+		return
+	}
+	if err := db.Delete(cred).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除失败", err)
+		return
+	}
+	if last {
+		db.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{})
+	}
+	utils.CreateAuditLogSimple(c, "passkey_deleted", "auth", user.ID, fmt.Sprintf("删除通行密钥: %s", cred.Name))
+	utils.SuccessResponse(c, http.StatusOK, "通行密钥已删除", nil)
+}
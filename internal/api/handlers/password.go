@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -12,12 +13,39 @@ import (
 	"cboard-go/internal/models"
 	"cboard-go/internal/services/email"
 	"cboard-go/internal/services/notification"
+	"cboard-go/internal/services/session"
 	"cboard-go/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
 )
 
+// validateNewPassword 按密码策略校验新密码，user 为空表示注册，不检查历史密码。
+// 不符合要求时写入错误响应并返回 false
+func validateNewPassword(c *gin.Context, db *gorm.DB, policy auth.PasswordPolicy, user *models.User, password, username, email string) bool {
+	err := policy.Validate(password, username, email)
+	if errors.Is(err, auth.ErrBreachCheckUnavailable) {
+		utils.LogError("validateNewPassword: 泄露密码库不可用，跳过检查", err, nil)
+		err = nil
+	}
+	if err == nil {
+		err = policy.CheckHistory(db, user, password)
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return false
+	}
+	return true
+}
+
+// recordPasswordHistory 保存即将被替换的密码哈希
+func recordPasswordHistory(db *gorm.DB, policy auth.PasswordPolicy, user *models.User) {
+	if err := auth.RecordPasswordHistory(db, user.ID, user.Password, policy.HistoryCount-1); err != nil {
+		utils.LogError("recordPasswordHistory: 保存历史密码失败", err, map[string]interface{}{"user_id": user.ID})
+	}
+}
+
 type ChangePasswordRequest struct {
 	CurrentPassword string `json:"current_password" binding:"required"`
 	NewPassword     string `json:"new_password" binding:"required,min=8"`
@@ -43,9 +71,8 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
-	valid, msg := auth.ValidatePasswordStrength(req.NewPassword, 8)
-	if !valid {
-		utils.ErrorResponse(c, http.StatusBadRequest, msg, nil)
+	policy := auth.LoadPasswordPolicy(db)
+	if !validateNewPassword(c, db, policy, user, req.NewPassword, user.Username, user.Email) {
 		return
 	}
 
@@ -55,11 +82,14 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
+	recordPasswordHistory(db, policy, user)
 	user.Password = hashedPassword
 	if err := db.Save(&user).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "更新密码失败", err)
 		return
 	}
+	// 修改密码后保留当前会话，其余设备需重新登录
+	_, _ = session.RevokeUser(db, user.ID, c.GetString("session_id"), session.ReasonPasswordChanged)
 
 	utils.CreateAuditLogSimple(c, "change_password", "user", user.ID,
 		fmt.Sprintf("用户修改密码: %s", user.Email))
@@ -104,6 +134,9 @@ func ResetPassword(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusNotFound, "用户不存在", err)
 		return
 	}
+	if !guardAdminTarget(c, &user, false) {
+		return
+	}
 
 	hashedPassword, err := auth.HashPassword(req.Password)
 	if err != nil {
@@ -116,6 +149,7 @@ func ResetPassword(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "重置密码失败", err)
 		return
 	}
+	_, _ = session.RevokeUser(db, user.ID, "", session.ReasonPasswordChanged)
 
 	utils.CreateAuditLogSimple(c, "reset_password", "user", user.ID,
 		fmt.Sprintf("管理员重置用户密码: %s (%s)", user.Username, user.Email))
@@ -244,12 +278,6 @@ func ResetPasswordByCode(c *gin.Context) {
 		return
 	}
 
-	valid, msg := auth.ValidatePasswordStrength(req.NewPassword, 8)
-	if !valid {
-		utils.ErrorResponse(c, http.StatusBadRequest, msg, nil)
-		return
-	}
-
 	db := database.GetDB()
 	var user models.User
 	if err := db.Where("email = ?", req.Email).First(&user).Error; err != nil {
@@ -286,6 +314,12 @@ func ResetPasswordByCode(c *gin.Context) {
 		return
 	}
 
+	// 先校验新密码再标记验证码已使用，密码不符合要求时可以直接重试
+	policy := auth.LoadPasswordPolicy(db)
+	if !validateNewPassword(c, db, policy, &user, req.NewPassword, user.Username, user.Email) {
+		return
+	}
+
 	verificationCode.Used = 1
 	if err := db.Model(&verificationCode).Where("id = ?", verificationCode.ID).Update("used", 1).Error; err != nil {
 		utils.LogError("ResetPasswordByCode: mark verification code as used failed", err, map[string]interface{}{
@@ -301,11 +335,13 @@ func ResetPasswordByCode(c *gin.Context) {
 		return
 	}
 
+	recordPasswordHistory(db, policy, &user)
 	user.Password = hashedPassword
 	if err := db.Save(&user).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "重置密码失败", err)
 		return
 	}
+	_, _ = session.RevokeUser(db, user.ID, "", session.ReasonPasswordChanged)
 
 	c.Set("user_id", user.ID)
 	utils.SetResponseStatus(c, http.StatusOK)
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cboard-go/internal/core/auth"
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/email"
+	"cboard-go/internal/services/privacy"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// dataExportInterval 两次数据导出申请的最小间隔
+const dataExportInterval = 24 * time.Hour
+
+// RequestDataExport 申请导出个人数据，后台生成压缩包后通过邮件发送下载链接
+func RequestDataExport(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	db := database.GetDB()
+
+	var recent models.DataExport
+	err := db.Where("user_id = ? AND (status IN ? OR (status = ? AND created_at > ?))", user.ID,
+		[]string{models.DataExportPending, models.DataExportProcessing},
+		models.DataExportReady, utils.GetBeijingTime().Add(-dataExportInterval)).
+		Order("id DESC").First(&recent).Error
+	if err == nil {
+		if recent.Status == models.DataExportReady {
+			utils.ErrorResponse(c, http.StatusTooManyRequests, "24 小时内只能申请一次数据导出，请使用邮件中的下载链接", nil)
+		} else {
+			utils.ErrorResponse(c, http.StatusConflict, "数据导出正在生成中，请稍候", nil)
+		}
+		return
+	}
+
+	export := models.DataExport{UserID: user.ID, Status: models.DataExportPending}
+	if err := db.Create(&export).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "创建导出任务失败", err)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "request_data_export", "user", user.ID, fmt.Sprintf("用户申请导出个人数据: %s", user.Username))
+
+	go runDataExport(db, *user, &export)
+
+	utils.SuccessResponse(c, http.StatusAccepted, "导出任务已创建，完成后将发送下载链接到您的邮箱", export)
+}
+
+func runDataExport(db *gorm.DB, user models.User, export *models.DataExport) {
+	token, err := privacy.BuildExport(db, export)
+	if err != nil {
+		utils.LogError("runDataExport: 生成导出文件失败", err, map[string]interface{}{"user_id": user.ID, "export_id": export.ID})
+		return
+	}
+
+	builder := email.NewEmailTemplateBuilder()
+	downloadURL := fmt.Sprintf("%s/api/v1/data-export/%s", builder.GetBaseURL(), token)
+	expireTime := export.ExpiresAt.Format("2006-01-02 15:04:05")
+	db.Create(&models.Notification{
+		UserID:   database.NullInt64(int64(user.ID)),
+		Title:    "个人数据导出已完成",
+		Content:  fmt.Sprintf("您申请的个人数据导出已生成，下载链接已发送到您的邮箱，有效期至 %s。", expireTime),
+		Type:     "system",
+		IsActive: true,
+	})
+	content := builder.GetDataExportReadyTemplate(user.Username, downloadURL, expireTime)
+	if err := email.NewEmailService().QueueEmail(user.Email, "个人数据导出已完成", content, "data_export"); err != nil {
+		utils.LogWarn("runDataExport: 邮件入队失败 user=%d: %v", user.ID, err)
+	}
+}
+
+// GetDataExports 当前用户的数据导出记录
+func GetDataExports(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	var exports []models.DataExport
+	database.GetDB().Where("user_id = ?", user.ID).Order("id DESC").Limit(20).Find(&exports)
+	utils.SuccessResponse(c, http.StatusOK, "", exports)
+}
+
+// DownloadDataExport 通过邮件中的链接下载导出文件，链接本身即凭证
+func DownloadDataExport(c *gin.Context) {
+	export, path, err := privacy.FindDownload(database.GetDB(), c.Param("token"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error(), nil)
+		return
+	}
+	c.Set("user_id", export.UserID)
+	utils.CreateAuditLogSimple(c, "download_data_export", "user", export.UserID,
+		fmt.Sprintf("下载个人数据导出 #%d (IP: %s)", export.ID, utils.GetRealClientIP(c)))
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(path, export.FileName)
+}
+
+func pendingDeletion(db *gorm.DB, userID uint) (*models.AccountDeletionRequest, bool) {
+	var req models.AccountDeletionRequest
+	if err := db.Where("user_id = ? AND status = ?", userID, models.DeletionPending).First(&req).Error; err != nil {
+		return nil, false
+	}
+	return &req, true
+}
+
+// GetAccountDeletion 当前的注销申请，没有时返回 null
+func GetAccountDeletion(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	db := database.GetDB()
+	data := gin.H{"request": nil, "cooling_off_days": privacy.CoolingOffDays(db)}
+	if req, ok := pendingDeletion(db, user.ID); ok {
+		data["request"] = req
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", data)
+}
+
+// RequestAccountDeletion 申请注销账号，需验证密码（已启用两步验证时还需验证码），冷静期后执行
+func RequestAccountDeletion(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Password     string `json:"password" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+		Reason       string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	if user.IsAdmin {
+		utils.ErrorResponse(c, http.StatusForbidden, privacy.ErrAdminAccount.Error(), nil)
+		return
+	}
+
+	db := database.GetDB()
+	if _, exists := pendingDeletion(db, user.ID); exists {
+		utils.ErrorResponse(c, http.StatusConflict, "已有进行中的注销申请", nil)
+		return
+	}
+	if !auth.VerifyPassword(req.Password, user.Password) {
+		utils.SetResponseStatus(c, http.StatusBadRequest)
+		utils.CreateAuditLogSimple(c, "account_deletion_failed", "user", user.ID, "申请注销账号失败: 密码错误")
+		utils.ErrorResponse(c, http.StatusBadRequest, "密码错误", nil)
+		return
+	}
+	if user.TwoFactorEnabled {
+		if _, verified := verifySecondFactor(db, user, req.Code, req.RecoveryCode); !verified {
+			utils.SetResponseStatus(c, http.StatusBadRequest)
+			utils.CreateAuditLogSimple(c, "account_deletion_failed", "user", user.ID, "申请注销账号失败: 验证码错误")
+			utils.ErrorResponse(c, http.StatusBadRequest, "验证码错误", nil)
+			return
+		}
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	if r := []rune(reason); len(r) > 500 {
+		reason = string(r[:500])
+	}
+	days := privacy.CoolingOffDays(db)
+	now := utils.GetBeijingTime()
+	deletion := models.AccountDeletionRequest{
+		UserID:      user.ID,
+		Status:      models.DeletionPending,
+		Reason:      reason,
+		ScheduledAt: now.Add(time.Duration(days) * 24 * time.Hour),
+	}
+	if err := db.Create(&deletion).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "提交注销申请失败", err)
+		return
+	}
+
+	scheduledTime := deletion.ScheduledAt.Format("2006-01-02 15:04:05")
+	utils.CreateAuditLogSimple(c, "request_account_deletion", "user", user.ID,
+		fmt.Sprintf("用户申请注销账号: %s，计划于 %s 执行", user.Username, scheduledTime))
+	db.Create(&models.Notification{
+		UserID:   database.NullInt64(int64(user.ID)),
+		Title:    "账号注销申请已提交",
+		Content:  fmt.Sprintf("您的账号将于 %s 注销，在此之前可随时撤销申请。", scheduledTime),
+		Type:     "security",
+		IsActive: true,
+	})
+	go func(username, to string) {
+		content := email.NewEmailTemplateBuilder().GetAccountDeletionScheduledTemplate(username, now.Format("2006-01-02 15:04:05"), scheduledTime, days)
+		if err := email.NewEmailService().QueueEmail(to, "账号注销申请已提交", content, "account_deletion_request"); err != nil {
+			utils.LogWarn("RequestAccountDeletion: 邮件入队失败 user=%d: %v", user.ID, err)
+		}
+	}(user.Username, user.Email)
+
+	utils.SuccessResponse(c, http.StatusOK, fmt.Sprintf("注销申请已提交，账号将在 %d 天后注销", days), deletion)
+}
+
+// CancelAccountDeletion 冷静期内撤销注销申请
+func CancelAccountDeletion(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	db := database.GetDB()
+	req, exists := pendingDeletion(db, user.ID)
+	if !exists {
+		utils.ErrorResponse(c, http.StatusNotFound, "没有进行中的注销申请", nil)
+		return
+	}
+	result := db.Model(req).Where("status = ?", models.DeletionPending).
+		Updates(map[string]interface{}{"status": models.DeletionCancelled, "cancelled_at": utils.GetBeijingTime()})
+	if result.Error != nil || result.RowsAffected == 0 {
+		utils.ErrorResponse(c, http.StatusConflict, "注销申请已执行或已撤销", result.Error)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "cancel_account_deletion", "user", user.ID, fmt.Sprintf("用户撤销注销申请: %s", user.Username))
+	utils.SuccessResponse(c, http.StatusOK, "已撤销注销申请", nil)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/node_server"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetCustomNodeRealityKeys(c *gin.Context) {
+	db := database.GetDB()
+	var node models.CustomNode
+	if err := db.First(&node, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "节点不存在", err)
+		return
+	}
+
+	// 顺带停用已过宽限期的旧密钥
+	if _, err := node_server.LoadRealityKeys(db, node.ID); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "读取 Reality 密钥失败", err)
+		return
+	}
+
+	var keys []models.RealityKey
+	db.Where("custom_node_id = ?", node.ID).Order("id DESC").Limit(20).Find(&keys)
+	utils.SuccessResponse(c, http.StatusOK, "", keys)
+}
+
+func RotateCustomNodeRealityKeys(c *gin.Context) {
+	var req struct {
+		GraceHours   *int   `json:"grace_hours"`
+		ShortIDCount *int   `json:"short_id_count"`
+		PrivateKey   string `json:"private_key"` // 可选，导入已有私钥
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+	graceHours := 24
+	if req.GraceHours != nil {
+		graceHours = *req.GraceHours
+	}
+	if graceHours < 0 || graceHours > 24*30 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "宽限期需在 0-720 小时之间", nil)
+		return
+	}
+	shortIDCount := 1
+	if req.ShortIDCount != nil {
+		shortIDCount = *req.ShortIDCount
+	}
+	if shortIDCount < 1 || shortIDCount > 8 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "short ID 数量需在 1-8 之间", nil)
+		return
+	}
+
+	db := database.GetDB()
+	var node models.CustomNode
+	if err := db.First(&node, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "节点不存在", err)
+		return
+	}
+
+	key, err := node_server.RotateRealityKeys(db, &node, time.Duration(graceHours)*time.Hour, shortIDCount, strings.TrimSpace(req.PrivateKey))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "生成 Reality 密钥失败: "+err.Error(), nil)
+		return
+	}
+
+	utils.CreateAuditLogSimple(c, "rotate_reality_key", "custom_node", node.ID,
+		fmt.Sprintf("轮换专线节点 Reality 密钥: %s (宽限期 %d 小时)", node.Name, graceHours))
+	utils.SuccessResponse(c, http.StatusOK, "Reality 密钥已更新", key)
+}
+
+func EndCustomNodeRealityGrace(c *gin.Context) {
+	db := database.GetDB()
+	var node models.CustomNode
+	if err := db.First(&node, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "节点不存在", err)
+		return
+	}
+	if err := node_server.EndRealityGrace(db, node.ID); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "操作失败", err)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "end_reality_grace", "custom_node", node.ID, "结束专线节点 Reality 旧密钥宽限期: "+node.Name)
+	utils.SuccessResponse(c, http.StatusOK, "旧密钥已停用", nil)
+}
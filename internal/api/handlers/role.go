@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/middleware"
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type roleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+func roleResponse(role *models.Role, userCount int64) gin.H {
+	return gin.H{
+		"id":          role.ID,
+		"name":        role.Name,
+		"description": role.Description,
+		"permissions": role.PermissionList(),
+		"is_system":   role.IsSystem,
+		"user_count":  userCount,
+		"created_at":  role.CreatedAt,
+		"updated_at":  role.UpdatedAt,
+	}
+}
+
+// normalizePermissions 去重并校验权限名
+func normalizePermissions(perms []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(perms))
+	for _, p := range perms {
+		p = strings.TrimSpace(p)
+		if p == "" || seen[p] {
+			continue
+		}
+		if !models.IsValidPermission(p) {
+			return nil, fmt.Errorf("未知权限: %s", p)
+		}
+		seen[p] = true
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// guardAdminTarget 只有超级管理员可以操作管理员账号或授予管理员身份，防止角色越权
+func guardAdminTarget(c *gin.Context, target *models.User, grantsAdmin bool) bool {
+	if middleware.IsSuperAdmin(c) || (!target.IsAdmin && !grantsAdmin) {
+		return true
+	}
+	utils.SetResponseStatus(c, http.StatusForbidden)
+	utils.CreateAuditLogSimple(c, "permission_denied", "user", target.ID,
+		fmt.Sprintf("权限不足: 非超级管理员尝试操作管理员账号 %s (%s %s)", target.Username, c.Request.Method, c.FullPath()))
+	utils.ErrorResponse(c, http.StatusForbidden, "只有超级管理员可以操作管理员账号", nil)
+	return false
+}
+
+// requireSuperAdmin 角色的增删改和分配只允许超级管理员操作，否则拥有 roles 权限的管理员可以给自己的角色追加任意权限
+func requireSuperAdmin(c *gin.Context, action string) bool {
+	if middleware.IsSuperAdmin(c) {
+		return true
+	}
+	utils.SetResponseStatus(c, http.StatusForbidden)
+	utils.CreateAuditLogSimple(c, "permission_denied", "role", 0,
+		fmt.Sprintf("权限不足: 非超级管理员尝试%s (%s %s)", action, c.Request.Method, c.FullPath()))
+	utils.ErrorResponse(c, http.StatusForbidden, fmt.Sprintf("只有超级管理员可以%s", action), nil)
+	return false
+}
+
+// GetAdminPermissions 权限定义以及当前管理员拥有的权限
+func GetAdminPermissions(c *gin.Context) {
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"permissions":    models.Permissions,
+		"granted":        middleware.AdminPermissions(c),
+		"is_super_admin": middleware.IsSuperAdmin(c),
+	})
+}
+
+func GetRoles(c *gin.Context) {
+	db := database.GetDB()
+	var roles []models.Role
+	if err := db.Order("id ASC").Find(&roles).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取角色列表失败", err)
+		return
+	}
+	type roleCount struct {
+		RoleID int64
+		Count  int64
+	}
+	var counts []roleCount
+	db.Model(&models.User{}).Select("role_id, COUNT(*) AS count").
+		Where("role_id IS NOT NULL").Group("role_id").Scan(&counts)
+	countMap := make(map[int64]int64)
+	for _, rc := range counts {
+		countMap[rc.RoleID] = rc.Count
+	}
+	list := make([]gin.H, 0, len(roles))
+	for i := range roles {
+		list = append(list, roleResponse(&roles[i], countMap[int64(roles[i].ID)]))
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", list)
+}
+
+func CreateRole(c *gin.Context) {
+	if !requireSuperAdmin(c, "创建角色") {
+		return
+	}
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "角色名称不能为空", nil)
+		return
+	}
+	perms, err := normalizePermissions(req.Permissions)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	db := database.GetDB()
+	var count int64
+	db.Model(&models.Role{}).Where("name = ?", req.Name).Count(&count)
+	if count > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "角色名称已存在", nil)
+		return
+	}
+	role := models.Role{Name: req.Name, Description: strings.TrimSpace(req.Description)}
+	role.SetPermissions(perms)
+	if err := db.Create(&role).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "创建角色失败", err)
+		return
+	}
+	utils.CreateAuditLogWithData(c, "create_role", "role", role.ID,
+		fmt.Sprintf("创建角色: %s", role.Name), nil, roleResponse(&role, 0))
+	utils.SuccessResponse(c, http.StatusCreated, "角色已创建", roleResponse(&role, 0))
+}
+
+func UpdateRole(c *gin.Context) {
+	if !requireSuperAdmin(c, "修改角色") {
+		return
+	}
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	perms, err := normalizePermissions(req.Permissions)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	db := database.GetDB()
+	var role models.Role
+	if err := db.First(&role, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "角色不存在", err)
+		return
+	}
+	before := roleResponse(&role, 0)
+	if name := strings.TrimSpace(req.Name); name != "" && name != role.Name {
+		var count int64
+		db.Model(&models.Role{}).Where("name = ? AND id <> ?", name, role.ID).Count(&count)
+		if count > 0 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "角色名称已存在", nil)
+			return
+		}
+		role.Name = name
+	}
+	role.Description = strings.TrimSpace(req.Description)
+	role.SetPermissions(perms)
+	if err := db.Save(&role).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "更新角色失败", err)
+		return
+	}
+	utils.CreateAuditLogWithData(c, "update_role", "role", role.ID,
+		fmt.Sprintf("更新角色: %s", role.Name), before, roleResponse(&role, 0))
+	utils.SuccessResponse(c, http.StatusOK, "角色已更新", roleResponse(&role, 0))
+}
+
+func DeleteRole(c *gin.Context) {
+	if !requireSuperAdmin(c, "删除角色") {
+		return
+	}
+	db := database.GetDB()
+	var role models.Role
+	if err := db.First(&role, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "角色不存在", err)
+		return
+	}
+	if role.IsSystem {
+		utils.ErrorResponse(c, http.StatusBadRequest, "内置角色不能删除", nil)
+		return
+	}
+	var count int64
+	db.Model(&models.User{}).Where("role_id = ?", role.ID).Count(&count)
+	if count > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("仍有 %d 个管理员使用该角色，请先调整后再删除", count), nil)
+		return
+	}
+	if err := db.Delete(&role).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除角色失败", err)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "delete_role", "role", role.ID, fmt.Sprintf("删除角色: %s", role.Name))
+	utils.SuccessResponse(c, http.StatusOK, "角色已删除", nil)
+}
+
+// AssignUserRole 设置管理员的角色；role_id 为空时按 is_admin 设为超级管理员或普通用户，仅超级管理员可操作
+func AssignUserRole(c *gin.Context) {
+	var req struct {
+		RoleID  *uint `json:"role_id"`
+		IsAdmin *bool `json:"is_admin"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	if !requireSuperAdmin(c, "分配角色") {
+		return
+	}
+	db := database.GetDB()
+	var user models.User
+	if err := db.First(&user, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "用户不存在", err)
+		return
+	}
+	if currentUser, ok := middleware.GetCurrentUser(c); ok && currentUser.ID == user.ID {
+		utils.ErrorResponse(c, http.StatusBadRequest, "不能修改自己的角色", nil)
+		return
+	}
+
+	updates := map[string]interface{}{"role_id": sql.NullInt64{}}
+	isAdmin := user.IsAdmin
+	roleName := ""
+	if req.RoleID != nil {
+		var role models.Role
+		if err := db.First(&role, *req.RoleID).Error; err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "角色不存在", err)
+			return
+		}
+		updates["role_id"] = sql.NullInt64{Int64: int64(role.ID), Valid: true}
+		isAdmin, roleName = true, role.Name
+	} else if req.IsAdmin != nil {
+		isAdmin = *req.IsAdmin
+	}
+	updates["is_admin"] = isAdmin
+	if roleName == "" {
+		roleName = "普通用户"
+		if isAdmin {
+			roleName = "超级管理员"
+		}
+	}
+	if err := db.Model(&user).Updates(updates).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "分配角色失败", err)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "assign_role", "user", user.ID,
+		fmt.Sprintf("设置用户角色: %s (%s) -> %s", user.Username, user.Email, roleName))
+	utils.SuccessResponse(c, http.StatusOK, "角色已更新", nil)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/session"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type sessionItem struct {
+	models.UserSession
+	Current bool `json:"current"`
+}
+
+func sessionItems(list []models.UserSession, currentSID string) []sessionItem {
+	items := make([]sessionItem, 0, len(list))
+	for _, s := range list {
+		items = append(items, sessionItem{UserSession: s, Current: currentSID != "" && s.SessionID == currentSID})
+	}
+	return items
+}
+
+// GetSessions 当前用户的登录会话（设备）列表
+func GetSessions(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	list, err := session.ListActive(database.GetDB(), user.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取会话列表失败", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", sessionItems(list, c.GetString("session_id")))
+}
+
+// RevokeSession 退出指定设备上的登录
+func RevokeSession(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	db := database.GetDB()
+	var s models.UserSession
+	if err := db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), user.ID).First(&s).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "会话不存在或已失效", err)
+		return
+	}
+	if err := session.Revoke(db, &s, session.ReasonUserRevoked); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "退出会话失败", err)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "revoke_session", "session", s.ID,
+		fmt.Sprintf("用户退出会话: %s (%s, IP: %s)", user.Username, s.DeviceName, s.IPAddress))
+	utils.SuccessResponse(c, http.StatusOK, "已退出该设备", nil)
+}
+
+// RevokeOtherSessions 退出除当前设备外的所有会话
+func RevokeOtherSessions(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	current := c.GetString("session_id")
+	if current == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "当前登录未关联会话，请重新登录后再试", nil)
+		return
+	}
+	count, err := session.RevokeUser(database.GetDB(), user.ID, current, session.ReasonOtherLogout)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "退出其他设备失败", err)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "revoke_other_sessions", "session", user.ID,
+		fmt.Sprintf("用户退出其他设备: %s，共 %d 个会话", user.Username, count))
+	utils.SuccessResponse(c, http.StatusOK, fmt.Sprintf("已退出 %d 个其他设备", count), gin.H{"revoked": count})
+}
+
+// GetUserSessions 管理员查看用户的登录会话
+func GetUserSessions(c *gin.Context) {
+	db := database.GetDB()
+	var user models.User
+	if err := db.First(&user, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "用户不存在", err)
+		return
+	}
+	list, err := session.ListActive(db, user.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取会话列表失败", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", sessionItems(list, ""))
+}
+
+// ForceLogoutUser 管理员强制用户在所有设备上退出登录
+func ForceLogoutUser(c *gin.Context) {
+	db := database.GetDB()
+	var user models.User
+	if err := db.First(&user, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "用户不存在", err)
+		return
+	}
+	if !guardAdminTarget(c, &user, false) {
+		return
+	}
+	count, err := session.RevokeUser(db, user.ID, "", session.ReasonAdminLogout)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "强制下线失败", err)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "force_logout", "user", user.ID,
+		fmt.Sprintf("管理员强制用户下线: %s (%s)，共 %d 个会话", user.Username, user.Email, count))
+	utils.SuccessResponse(c, http.StatusOK, fmt.Sprintf("已强制下线 %d 个会话", count), gin.H{"revoked": count})
+}
@@ -10,9 +10,11 @@ import (
 	"cboard-go/internal/core/database"
 	"cboard-go/internal/middleware"
 	"cboard-go/internal/models"
+	"cboard-go/internal/services/device"
 	"cboard-go/internal/services/email"
 	"cboard-go/internal/services/geoip"
 	"cboard-go/internal/services/notification"
+	"cboard-go/internal/services/subscription"
 	"cboard-go/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -88,12 +90,14 @@ func formatDeviceList(devices []models.Device) []gin.H {
 			"created_at":         d.CreatedAt.Format(timeLayout),
 			"is_active":          d.IsActive,
 			"is_allowed":         d.IsAllowed,
+			"approval_status":    d.ApprovalStatus,
 			"user_agent":         getString(d.UserAgent),
 			"software_name":      getString(d.SoftwareName),
 			"software_version":   getString(d.SoftwareVersion),
 			"device_model":       getString(d.DeviceModel),
 			"device_brand":       getString(d.DeviceBrand),
 			"access_count":       d.AccessCount,
+			"is_token_device":    d.SubToken != nil,
 		})
 	}
 	return list
@@ -112,33 +116,7 @@ func getSubscriptionByID(db *gorm.DB, id string, userID uint) (*models.Subscript
 }
 
 func performSubscriptionReset(db *gorm.DB, sub *models.Subscription, resetType, reason string, resetBy *string) error {
-	oldURL := sub.SubscriptionURL
-	var deviceCountBefore int64
-	db.Model(&models.Device{}).Where("subscription_id = ? AND is_active = ?", sub.ID, true).Count(&deviceCountBefore)
-
-	newURL := utils.GenerateSubscriptionURL()
-	sub.SubscriptionURL = newURL
-	sub.CurrentDevices = 0
-
-	if err := db.Save(sub).Error; err != nil {
-		return err
-	}
-
-	reset := models.SubscriptionReset{
-		UserID:             sub.UserID,
-		SubscriptionID:     sub.ID,
-		ResetType:          resetType,
-		Reason:             reason,
-		OldSubscriptionURL: &oldURL,
-		NewSubscriptionURL: &newURL,
-		DeviceCountBefore:  int(deviceCountBefore),
-		DeviceCountAfter:   0,
-		ResetBy:            resetBy,
-	}
-	if err := db.Create(&reset).Error; err != nil {
-		return err
-	}
-	return db.Where("subscription_id = ?", sub.ID).Delete(&models.Device{}).Error
+	return subscription.ResetSubscription(db, sub, resetType, reason, resetBy)
 }
 
 func GetSubscriptions(c *gin.Context) {
@@ -404,6 +382,110 @@ func GetUserSubscriptionDevices(c *gin.Context) {
 	utils.SuccessResponse(c, http.StatusOK, "", formatDeviceList(devices))
 }
 
+// getCurrentUserSubscription 获取当前用户最新的订阅
+func getCurrentUserSubscription(c *gin.Context) (*models.Subscription, bool) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return nil, false
+	}
+	var sub models.Subscription
+	if err := database.GetDB().Where("user_id = ?", user.ID).Order("created_at DESC").First(&sub).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "订阅不存在", err)
+		return nil, false
+	}
+	return &sub, true
+}
+
+func formatDeviceToken(c *gin.Context, d *models.Device) gin.H {
+	universalURL, clashURL := getSubscriptionURLs(c, getString(d.SubToken))
+	lastAccess := ""
+	if d.LastSeen != nil {
+		lastAccess = d.LastSeen.Format(timeLayout)
+	}
+	return gin.H{
+		"id":            d.ID,
+		"name":          getString(d.DeviceName),
+		"software_name": getString(d.SoftwareName),
+		"ip_address":    formatIP(getString(d.IPAddress)),
+		"access_count":  d.AccessCount,
+		"last_access":   lastAccess,
+		"created_at":    d.CreatedAt.Format(timeLayout),
+		"universal_url": universalURL,
+		"clash_url":     clashURL,
+	}
+}
+
+// GetDeviceTokens 列出当前用户的设备专属订阅令牌
+func GetDeviceTokens(c *gin.Context) {
+	sub, ok := getCurrentUserSubscription(c)
+	if !ok {
+		return
+	}
+	var devices []models.Device
+	database.GetDB().Where("subscription_id = ? AND sub_token IS NOT NULL", sub.ID).Order("id ASC").Find(&devices)
+	list := make([]gin.H, 0, len(devices))
+	for i := range devices {
+		list = append(list, formatDeviceToken(c, &devices[i]))
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"tokens":       list,
+		"device_limit": sub.DeviceLimit,
+	})
+}
+
+// CreateDeviceToken 为当前用户签发一个命名的设备订阅令牌
+func CreateDeviceToken(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+	if len([]rune(req.Name)) > 50 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "设备名称不能超过50个字符", nil)
+		return
+	}
+	sub, ok := getCurrentUserSubscription(c)
+	if !ok {
+		return
+	}
+	d, err := device.NewDeviceManager().CreateDeviceToken(sub, req.Name)
+	if err != nil {
+		if err == device.ErrDeviceTokenLimit || err == device.ErrDeviceLimitZero {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		} else {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "创建设备令牌失败", err)
+		}
+		return
+	}
+	utils.CreateAuditLogSimple(c, "create_device_token", "device", d.ID, fmt.Sprintf("创建设备订阅令牌: %s", getString(d.DeviceName)))
+	utils.SuccessResponse(c, http.StatusCreated, "创建成功", formatDeviceToken(c, d))
+}
+
+// RevokeDeviceToken 吊销当前用户的某个设备订阅令牌
+func RevokeDeviceToken(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的设备ID", err)
+		return
+	}
+	sub, ok := getCurrentUserSubscription(c)
+	if !ok {
+		return
+	}
+	if err := device.NewDeviceManager().RevokeDeviceToken(sub.ID, uint(id)); err != nil {
+		if err == device.ErrDeviceTokenInvalid {
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error(), nil)
+		} else {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "吊销设备令牌失败", err)
+		}
+		return
+	}
+	utils.CreateAuditLogSimple(c, "revoke_device_token", "device", uint(id), "吊销设备订阅令牌")
+	utils.SuccessResponse(c, http.StatusOK, "已吊销", nil)
+}
+
 func GetSubscriptionDevices(c *gin.Context) {
 	sub, err := getSubscriptionByID(database.GetDB(), c.Param("id"), 0)
 	if err != nil {
@@ -5,6 +5,7 @@ import (
 	"cboard-go/internal/models"
 	"cboard-go/internal/services/config_update"
 	"cboard-go/internal/services/device"
+	"cboard-go/internal/services/sharing"
 	"cboard-go/internal/utils"
 	"encoding/base64"
 	"encoding/json"
@@ -89,6 +90,19 @@ func checkOldSubscriptionURL(db *gorm.DB, oldURL string) (*models.SubscriptionRe
 	return &reset, &sub, &user, true
 }
 
+// resolveDeviceToken 将设备专属订阅令牌解析为设备及其所属订阅，非设备令牌时返回 nil
+func resolveDeviceToken(db *gorm.DB, token string) (*models.Device, *models.Subscription) {
+	d, err := device.NewDeviceManager().FindDeviceByToken(token)
+	if err != nil {
+		return nil, nil
+	}
+	var sub models.Subscription
+	if err := db.First(&sub, d.SubscriptionID).Error; err != nil {
+		return nil, nil
+	}
+	return d, &sub
+}
+
 func generateErrorConfig(title, message string, baseURL string) string {
 	cleanMessage := strings.ReplaceAll(message, "\n", " ")
 
@@ -197,7 +211,10 @@ func GetSubscriptionConfig(c *gin.Context) {
 	baseURL := utils.GetBuildBaseURL(c.Request, db)
 	var sub models.Subscription
 
-	if err := db.Where("subscription_url = ?", uurl).First(&sub).Error; err != nil {
+	tokenDevice, tokenSub := resolveDeviceToken(db, uurl)
+	if tokenSub != nil {
+		sub = *tokenSub
+	} else if err := db.Where("subscription_url = ?", uurl).First(&sub).Error; err != nil {
 		reset, currentSub, user, isOldURL := checkOldSubscriptionURL(db, uurl)
 		if isOldURL {
 			now := utils.GetBeijingTime()
@@ -241,50 +258,17 @@ func GetSubscriptionConfig(c *gin.Context) {
 		return
 	}
 
-	deviceManager := device.NewDeviceManager()
 	deviceIP := utils.GetRealClientIP(c)
 	deviceUA := c.GetHeader("User-Agent")
 
-	hash := deviceManager.GenerateDeviceHash(deviceUA, deviceIP, "")
-	var currentDevice models.Device
-	deviceExists := db.Where("device_hash = ? AND subscription_id = ?", hash, sub.ID).First(&currentDevice).Error == nil
-
-	if !deviceExists {
-		var sameUADevice models.Device
-		if err := db.Where("subscription_id = ? AND user_agent = ? AND is_active = ?", sub.ID, deviceUA, true).
-			Order("last_access DESC").
-			First(&sameUADevice).Error; err == nil {
-
-			sameUADevice.IPAddress = &deviceIP
-			sameUADevice.DeviceHash = &hash
-			sameUADevice.LastAccess = utils.GetBeijingTime()
-
-			if err := db.Save(&sameUADevice).Error; err == nil {
-				deviceExists = true
-				currentDevice = sameUADevice
-			}
-		}
-	}
-
-	var count int64
-	db.Model(&models.Device{}).Where("subscription_id = ? AND is_active = ?", sub.ID, true).Count(&count)
-
-	shouldRecord := true
-	if !deviceExists {
-		if sub.DeviceLimit > 0 && int(count) >= sub.DeviceLimit {
-			shouldRecord = false
-		} else if sub.DeviceLimit == 0 {
-			shouldRecord = false
-		}
-	}
-
-	if shouldRecord {
-		deviceManager.RecordDeviceAccess(sub.ID, sub.UserID, deviceUA, deviceIP, "clash")
-	}
+	go sharing.NewDetector().RecordFetch(&sub, uurl, deviceIP, deviceUA)
 
 	db.Model(&sub).Update("clash_count", gorm.Expr("clash_count + ?", 1))
 
-	cfg, err := config_update.NewConfigUpdateService().GenerateClashConfig(uurl, deviceIP, deviceUA)
+	// 先校验订阅状态与到期时间，通过后再做设备准入
+	cfg, err := config_update.NewConfigUpdateService().GenerateClashConfig(uurl, func(s *models.Subscription) *device.Admission {
+		return device.NewAdmissionService().Admit(s, tokenDevice, deviceUA, deviceIP, "clash")
+	})
 	if err != nil {
 		c.Header("Content-Type", "application/x-yaml")
 		c.String(200, generateErrorConfig("生成失败", fmt.Sprintf("配置生成错误: %v", err), baseURL))
@@ -299,56 +283,29 @@ func GetUniversalSubscription(c *gin.Context) {
 	uurl := c.Param("url")
 	db := database.GetDB()
 	baseURL := utils.GetBuildBaseURL(c.Request, db)
-	var sub models.Subscription
-
-	if err := db.Where("subscription_url = ?", uurl).First(&sub).Error; err != nil {
-	}
 
 	deviceIP := utils.GetRealClientIP(c)
 	deviceUA := c.GetHeader("User-Agent")
-	deviceManager := device.NewDeviceManager()
-
-	if db.Where("subscription_url = ?", uurl).First(&sub).Error == nil {
-		hash := deviceManager.GenerateDeviceHash(deviceUA, deviceIP, "")
-		var currentDevice models.Device
-		deviceExists := db.Where("device_hash = ? AND subscription_id = ?", hash, sub.ID).First(&currentDevice).Error == nil
-
-		if !deviceExists {
-			var sameUADevice models.Device
-			if err := db.Where("subscription_id = ? AND user_agent = ? AND is_active = ?", sub.ID, deviceUA, true).
-				Order("last_access DESC").
-				First(&sameUADevice).Error; err == nil {
-
-				sameUADevice.IPAddress = &deviceIP
-				sameUADevice.DeviceHash = &hash
-				sameUADevice.LastAccess = utils.GetBeijingTime()
 
-				if err := db.Save(&sameUADevice).Error; err == nil {
-					deviceExists = true
-					currentDevice = sameUADevice
-				}
-			}
-		}
-
-		var count int64
-		db.Model(&models.Device{}).Where("subscription_id = ? AND is_active = ?", sub.ID, true).Count(&count)
-
-		shouldRecord := true
-		if !deviceExists {
-			if sub.DeviceLimit > 0 && int(count) >= sub.DeviceLimit {
-				shouldRecord = false
-			} else if sub.DeviceLimit == 0 {
-				shouldRecord = false
-			}
-		}
-
-		if shouldRecord {
-			deviceManager.RecordDeviceAccess(sub.ID, sub.UserID, deviceUA, deviceIP, "universal")
-			db.Model(&sub).Update("universal_count", gorm.Expr("universal_count + ?", 1))
+	tokenDevice, sub := resolveDeviceToken(db, uurl)
+	if sub == nil {
+		var legacySub models.Subscription
+		if db.Where("subscription_url = ?", uurl).First(&legacySub).Error == nil {
+			sub = &legacySub
 		}
 	}
+	if sub != nil {
+		go sharing.NewDetector().RecordFetch(sub, uurl, deviceIP, deviceUA)
+	}
 
-	cfg, err := config_update.NewConfigUpdateService().GenerateUniversalConfig(uurl, deviceIP, deviceUA, "base64")
+	// 先校验订阅状态与到期时间，通过后再做设备准入
+	cfg, err := config_update.NewConfigUpdateService().GenerateUniversalConfig(uurl, "base64", func(s *models.Subscription) *device.Admission {
+		admission := device.NewAdmissionService().Admit(s, tokenDevice, deviceUA, deviceIP, "universal")
+		if admission.Allowed {
+			db.Model(s).Update("universal_count", gorm.Expr("universal_count + ?", 1))
+		}
+		return admission
+	})
 	if err != nil {
 		c.String(200, generateErrorConfigBase64("错误", "生成配置失败", baseURL))
 		return
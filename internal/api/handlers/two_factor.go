@@ -0,0 +1,565 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cboard-go/internal/core/auth"
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/core/kvstore"
+	"cboard-go/internal/middleware"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/passkey"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	challengeTypeVerify = "2fa_challenge"
+	challengeTypeEnroll = "2fa_enroll"
+	challengeTTL        = 5 * time.Minute
+	// twoFactorMaxAttempts 验证令牌有效期内每个用户最多尝试的次数
+	twoFactorMaxAttempts = 5
+)
+
+// adminTwoFactorRequired 管理员是否被强制启用两步验证（security.require_admin_2fa）
+func adminTwoFactorRequired(db *gorm.DB) bool {
+	val, _ := getSystemConfigValue(db, "security", "require_admin_2fa")
+	return val == "true"
+}
+
+// twoFactorGate 判断登录是否需要第二步；enroll 表示管理员被强制启用但尚未绑定
+func twoFactorGate(db *gorm.DB, user *models.User) (required bool, enroll bool) {
+	if hasSecondFactor(db, user) {
+		return true, false
+	}
+	if user.IsAdmin && adminTwoFactorRequired(db) {
+		return true, true
+	}
+	return false, false
+}
+
+func issueTwoFactorChallenge(c *gin.Context, user *models.User, ipAddress string, enroll bool) {
+	purpose := challengeTypeVerify
+	if enroll {
+		purpose = challengeTypeEnroll
+	}
+	token, err := utils.CreateChallengeToken(user.ID, user.Email, purpose, challengeTTL)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "生成验证令牌失败", err)
+		return
+	}
+
+	c.Set("user_id", user.ID)
+	utils.CreateAuditLogSimple(c, "2fa_challenge", "auth", user.ID,
+		fmt.Sprintf("密码验证通过，等待两步验证: %s (IP: %s)", user.Username, ipAddress))
+
+	methods := []string{"totp"}
+	if !enroll {
+		methods = methods[:0]
+		if user.TwoFactorEnabled {
+			methods = append(methods, "totp")
+		}
+		if passkey.CountCredentials(database.GetDB(), user.ID) > 0 {
+			methods = append(methods, "passkey")
+		}
+		methods = append(methods, "recovery_code")
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"two_factor_required": true,
+		"enrollment_required": enroll,
+		"challenge_token":     token,
+		"expires_in":          int(challengeTTL.Seconds()),
+		"methods":             methods,
+	})
+}
+
+// parseChallengeToken 校验两步验证令牌并返回对应用户
+func parseChallengeToken(c *gin.Context, db *gorm.DB, token string, purposes ...string) (*models.User, string, bool) {
+	claims, err := utils.VerifyToken(token)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "验证令牌无效或已过期，请重新登录", err)
+		return nil, "", false
+	}
+	valid := false
+	for _, p := range purposes {
+		if claims.Type == p {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "令牌类型错误", nil)
+		return nil, "", false
+	}
+	var user models.User
+	if err := db.First(&user, claims.UserID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户不存在", err)
+		return nil, "", false
+	}
+	c.Set("user_id", user.ID)
+	return &user, claims.Type, true
+}
+
+// sealTOTPSecret 加密 TOTP 密钥后保存（与面板密码、Reality 私钥相同）
+func sealTOTPSecret(secret string) (sql.NullString, error) {
+	encrypted, err := utils.EncryptAES(secret)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("加密两步验证密钥失败: %w", err)
+	}
+	return sql.NullString{String: encrypted, Valid: true}, nil
+}
+
+// openTOTPSecret 解密 TOTP 密钥，legacy 表示加密前保存的明文密钥
+func openTOTPSecret(stored sql.NullString) (secret string, legacy bool) {
+	if !stored.Valid || stored.String == "" {
+		return "", false
+	}
+	if plain, err := utils.DecryptAES(stored.String); err == nil {
+		return plain, false
+	}
+	return stored.String, true
+}
+
+// verifyTOTPForUser 校验验证码并记录已使用的时间步长，同一验证码只能使用一次
+func verifyTOTPForUser(db *gorm.DB, user *models.User, stored sql.NullString, code string) bool {
+	secret, legacy := openTOTPSecret(stored)
+	if secret == "" {
+		return false
+	}
+	counter, ok := auth.VerifyTOTP(secret, code, time.Now(), user.TOTPLastCounter)
+	if !ok {
+		return false
+	}
+	result := db.Model(&models.User{}).
+		Where("id = ? AND totp_last_counter < ?", user.ID, counter).
+		Update("totp_last_counter", counter)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	user.TOTPLastCounter = counter
+	// 验证通过时顺带加密历史明文密钥
+	if legacy && stored == user.TOTPSecret {
+		if sealed, err := sealTOTPSecret(secret); err == nil {
+			if db.Model(user).Update("totp_secret", sealed).Error == nil {
+				user.TOTPSecret = sealed
+			}
+		}
+	}
+	return true
+}
+
+// consumeRecoveryCode 使用一次性恢复码
+func consumeRecoveryCode(db *gorm.DB, userID uint, code string) bool {
+	if strings.TrimSpace(code) == "" {
+		return false
+	}
+	now := utils.GetBeijingTime()
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, auth.HashRecoveryCode(code)).
+		Update("used_at", now)
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+// verifySecondFactor 依次尝试 TOTP 验证码和恢复码，返回使用的方式
+func verifySecondFactor(db *gorm.DB, user *models.User, code, recoveryCode string) (string, bool) {
+	if code != "" && user.TOTPSecret.Valid && verifyTOTPForUser(db, user, user.TOTPSecret, code) {
+		return "totp", true
+	}
+	if recoveryCode == "" && strings.Contains(code, "-") {
+		recoveryCode = code
+	}
+	if recoveryCode != "" && consumeRecoveryCode(db, user.ID, recoveryCode) {
+		return "recovery_code", true
+	}
+	return "", false
+}
+
+func regenerateRecoveryCodes(db *gorm.DB, userID uint) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(auth.RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, code := range codes {
+			if err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: auth.HashRecoveryCode(code)}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return codes, err
+}
+
+func totpIssuer(db *gorm.DB) string {
+	if name, _ := getSystemConfigValue(db, "general", "site_name"); strings.TrimSpace(name) != "" {
+		return strings.TrimSpace(name)
+	}
+	return "CBoard"
+}
+
+// startTOTPEnrollment 生成待确认的密钥
+func startTOTPEnrollment(db *gorm.DB, user *models.User) (gin.H, error) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPPendingSecret, err = sealTOTPSecret(secret); err != nil {
+		return nil, err
+	}
+	if err := db.Model(user).Update("totp_pending_secret", user.TOTPPendingSecret).Error; err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"secret":      secret,
+		"otpauth_url": auth.TOTPProvisioningURI(totpIssuer(db), user.Email, secret),
+		"digits":      auth.TOTPDigits,
+		"period":      auth.TOTPPeriod,
+	}, nil
+}
+
+// confirmTOTPEnrollment 校验待确认密钥的验证码，启用两步验证并生成恢复码
+func confirmTOTPEnrollment(db *gorm.DB, user *models.User, code string) ([]string, bool, error) {
+	if !user.TOTPPendingSecret.Valid || user.TOTPPendingSecret.String == "" {
+		return nil, false, nil
+	}
+	if !verifyTOTPForUser(db, user, user.TOTPPendingSecret, code) {
+		return nil, false, nil
+	}
+	user.TOTPSecret = user.TOTPPendingSecret
+	user.TOTPPendingSecret = sql.NullString{}
+	user.TwoFactorEnabled = true
+	if err := db.Model(user).Updates(map[string]interface{}{
+		"totp_secret":         user.TOTPSecret,
+		"totp_pending_secret": user.TOTPPendingSecret,
+		"two_factor_enabled":  true,
+	}).Error; err != nil {
+		return nil, false, err
+	}
+	codes, err := regenerateRecoveryCodes(db, user.ID)
+	return codes, true, err
+}
+
+func twoFactorFailure(c *gin.Context, user *models.User, ipAddress, action string) {
+	middleware.IncrementLoginAttempt(ipAddress)
+	utils.SetResponseStatus(c, http.StatusUnauthorized)
+	utils.CreateAuditLogSimple(c, "2fa_failed", "auth", user.ID,
+		fmt.Sprintf("两步验证失败(%s): %s (IP: %s)", action, user.Username, ipAddress))
+	utils.CreateSecurityLog(c, "2fa_failed", "MEDIUM",
+		fmt.Sprintf("两步验证失败: 用户 %s (IP: %s)", user.Username, ipAddress),
+		map[string]interface{}{"user_id": user.ID, "ip": ipAddress, "action": action})
+	utils.ErrorResponse(c, http.StatusUnauthorized, "验证码错误", nil)
+}
+
+// VerifyTwoFactorLogin 登录第二步：使用验证令牌 + TOTP 验证码、通行密钥或恢复码换取访问令牌
+func VerifyTwoFactorLogin(c *gin.Context) {
+	var req struct {
+		ChallengeToken    string          `json:"challenge_token" binding:"required"`
+		Code              string          `json:"code"`
+		RecoveryCode      string          `json:"recovery_code"`
+		PasskeySessionID  string          `json:"passkey_session_id"`
+		PasskeyCredential json.RawMessage `json:"passkey_credential"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+
+	db := database.GetDB()
+	ipAddress := utils.GetRealClientIP(c)
+	user, purpose, ok := parseChallengeToken(c, db, req.ChallengeToken, challengeTypeVerify, challengeTypeEnroll)
+	if !ok {
+		return
+	}
+
+	// 令牌有效期内最多尝试 twoFactorMaxAttempts 次，按用户计数，重新登录也不会重置次数
+	attemptsKey := fmt.Sprintf("2fa:attempts:%d", user.ID)
+	attempts, _, err := kvstore.Default().Incr(attemptsKey, challengeTTL)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "验证失败，请稍后重试", err)
+		return
+	}
+	if attempts > twoFactorMaxAttempts {
+		utils.SetResponseStatus(c, http.StatusTooManyRequests)
+		utils.CreateAuditLogSimple(c, "2fa_locked", "auth", user.ID,
+			fmt.Sprintf("两步验证错误次数过多: %s (IP: %s)", user.Username, ipAddress))
+		utils.ErrorResponse(c, http.StatusTooManyRequests, "验证码错误次数过多，请稍后重新登录", nil)
+		return
+	}
+
+	if purpose == challengeTypeEnroll {
+		codes, confirmed, err := confirmTOTPEnrollment(db, user, req.Code)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "启用两步验证失败", err)
+			return
+		}
+		if !confirmed {
+			twoFactorFailure(c, user, ipAddress, "enroll")
+			return
+		}
+		kvstore.Default().Delete(attemptsKey)
+		utils.CreateAuditLogSimple(c, "2fa_enabled", "auth", user.ID, fmt.Sprintf("登录时完成两步验证绑定: %s", user.Username))
+		c.Set("two_factor_passed", true)
+		c.Set("recovery_codes", codes)
+		finalizeLogin(c, db, user, ipAddress)
+		return
+	}
+
+	if !hasSecondFactor(db, user) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "未启用两步验证，请重新登录", nil)
+		return
+	}
+	var method string
+	var verified bool
+	if req.PasskeySessionID != "" {
+		method, verified = "passkey", verifyPasskeySecondFactor(c, db, user, req.PasskeySessionID, req.PasskeyCredential)
+	} else {
+		method, verified = verifySecondFactor(db, user, req.Code, req.RecoveryCode)
+	}
+	if !verified {
+		twoFactorFailure(c, user, ipAddress, "login")
+		return
+	}
+
+	kvstore.Default().Delete(attemptsKey)
+	desc := fmt.Sprintf("两步验证通过: %s", user.Username)
+	if method == "recovery_code" {
+		var remaining int64
+		db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+		desc = fmt.Sprintf("使用恢复码通过两步验证: %s，剩余 %d 个", user.Username, remaining)
+	} else if method == "passkey" {
+		desc = fmt.Sprintf("使用通行密钥通过两步验证: %s", user.Username)
+	}
+	utils.CreateAuditLogSimple(c, "2fa_verified", "auth", user.ID, desc)
+	c.Set("two_factor_passed", true)
+	finalizeLogin(c, db, user, ipAddress)
+}
+
+// EnrollTwoFactorAtLogin 被强制启用两步验证的管理员在登录过程中获取绑定密钥
+func EnrollTwoFactorAtLogin(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	db := database.GetDB()
+	user, _, ok := parseChallengeToken(c, db, req.ChallengeToken, challengeTypeEnroll)
+	if !ok {
+		return
+	}
+	data, err := startTOTPEnrollment(db, user)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "生成两步验证密钥失败", err)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "2fa_setup", "auth", user.ID, fmt.Sprintf("登录时开始绑定两步验证: %s", user.Username))
+	utils.SuccessResponse(c, http.StatusOK, "", data)
+}
+
+// GetTwoFactorStatus 获取当前用户的两步验证状态
+func GetTwoFactorStatus(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	db := database.GetDB()
+	var remaining int64
+	db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"enabled":                  hasSecondFactor(db, user),
+		"totp_enabled":             user.TwoFactorEnabled,
+		"passkeys":                 passkey.CountCredentials(db, user.ID),
+		"required":                 user.IsAdmin && adminTwoFactorRequired(db),
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupTwoFactor 开始绑定 TOTP，返回密钥和 otpauth 地址
+func SetupTwoFactor(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	if user.TwoFactorEnabled {
+		utils.ErrorResponse(c, http.StatusBadRequest, "已启用两步验证", nil)
+		return
+	}
+	db := database.GetDB()
+	data, err := startTOTPEnrollment(db, user)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "生成两步验证密钥失败", err)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "2fa_setup", "auth", user.ID, "开始绑定两步验证")
+	utils.SuccessResponse(c, http.StatusOK, "", data)
+}
+
+// ConfirmTwoFactor 输入验证码确认绑定，返回一次性恢复码
+func ConfirmTwoFactor(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	if user.TwoFactorEnabled {
+		utils.ErrorResponse(c, http.StatusBadRequest, "已启用两步验证", nil)
+		return
+	}
+
+	db := database.GetDB()
+	codes, confirmed, err := confirmTOTPEnrollment(db, user, req.Code)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "启用两步验证失败", err)
+		return
+	}
+	if !confirmed {
+		utils.SetResponseStatus(c, http.StatusBadRequest)
+		utils.CreateAuditLogSimple(c, "2fa_failed", "auth", user.ID, "确认绑定两步验证失败: 验证码错误")
+		utils.ErrorResponse(c, http.StatusBadRequest, "验证码错误或未开始绑定", nil)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "2fa_enabled", "auth", user.ID, "启用两步验证")
+	utils.SuccessResponse(c, http.StatusOK, "两步验证已启用，请妥善保存恢复码", gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor 关闭两步验证，需要密码和验证码（或恢复码）
+func DisableTwoFactor(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Password     string `json:"password" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	if !user.TwoFactorEnabled {
+		utils.ErrorResponse(c, http.StatusBadRequest, "未启用两步验证", nil)
+		return
+	}
+
+	db := database.GetDB()
+	passkeys := passkey.CountCredentials(db, user.ID)
+	if user.IsAdmin && adminTwoFactorRequired(db) && passkeys == 0 {
+		utils.ErrorResponse(c, http.StatusForbidden, "系统要求管理员必须启用两步验证", nil)
+		return
+	}
+	if !auth.VerifyPassword(req.Password, user.Password) {
+		utils.SetResponseStatus(c, http.StatusBadRequest)
+		utils.CreateAuditLogSimple(c, "2fa_failed", "auth", user.ID, "关闭两步验证失败: 密码错误")
+		utils.ErrorResponse(c, http.StatusBadRequest, "密码错误", nil)
+		return
+	}
+	if _, verified := verifySecondFactor(db, user, req.Code, req.RecoveryCode); !verified {
+		utils.SetResponseStatus(c, http.StatusBadRequest)
+		utils.CreateAuditLogSimple(c, "2fa_failed", "auth", user.ID, "关闭两步验证失败: 验证码错误")
+		utils.ErrorResponse(c, http.StatusBadRequest, "验证码错误", nil)
+		return
+	}
+
+	if err := db.Model(user).Updates(map[string]interface{}{
+		"two_factor_enabled":  false,
+		"totp_secret":         sql.NullString{},
+		"totp_pending_secret": sql.NullString{},
+	}).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "关闭两步验证失败", err)
+		return
+	}
+	// 仍绑定通行密钥时保留恢复码
+	if passkeys == 0 {
+		db.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{})
+	}
+	utils.CreateAuditLogSimple(c, "2fa_disabled", "auth", user.ID, "关闭两步验证")
+	utils.SuccessResponse(c, http.StatusOK, "两步验证已关闭", nil)
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧恢复码全部失效；仅绑定通行密钥时使用密码确认
+func RegenerateRecoveryCodes(c *gin.Context) {
+	user, ok := getCurrentUserOrError(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Code     string `json:"code"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+
+	db := database.GetDB()
+	if !hasSecondFactor(db, user) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "未启用两步验证", nil)
+		return
+	}
+	var confirmed bool
+	if user.TwoFactorEnabled {
+		confirmed = verifyTOTPForUser(db, user, user.TOTPSecret, req.Code)
+	} else {
+		confirmed = req.Password != "" && auth.VerifyPassword(req.Password, user.Password)
+	}
+	if !confirmed {
+		utils.SetResponseStatus(c, http.StatusBadRequest)
+		utils.CreateAuditLogSimple(c, "2fa_failed", "auth", user.ID, "重新生成恢复码失败: 验证码或密码错误")
+		utils.ErrorResponse(c, http.StatusBadRequest, "验证码或密码错误", nil)
+		return
+	}
+	codes, err := regenerateRecoveryCodes(db, user.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "生成恢复码失败", err)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "2fa_recovery_regenerated", "auth", user.ID, "重新生成两步验证恢复码")
+	utils.SuccessResponse(c, http.StatusOK, "恢复码已重新生成", gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// AdminResetTwoFactor 管理员为丢失验证器的用户关闭两步验证
+func AdminResetTwoFactor(c *gin.Context) {
+	db := database.GetDB()
+	var user models.User
+	if err := db.First(&user, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "用户不存在", err)
+		return
+	}
+	if !guardAdminTarget(c, &user, false) {
+		return
+	}
+	if err := db.Model(&user).Updates(map[string]interface{}{
+		"two_factor_enabled":  false,
+		"totp_secret":         sql.NullString{},
+		"totp_pending_secret": sql.NullString{},
+	}).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "重置两步验证失败", err)
+		return
+	}
+	db.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{})
+	db.Where("user_id = ?", user.ID).Delete(&models.WebAuthnCredential{})
+	utils.CreateAuditLogSimple(c, "2fa_reset", "user", user.ID, fmt.Sprintf("管理员重置用户两步验证（含通行密钥）: %s", user.Username))
+	utils.SuccessResponse(c, http.StatusOK, "已重置该用户的两步验证", nil)
+}
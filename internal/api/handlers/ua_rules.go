@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"cboard-go/internal/services/device"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUARules 获取当前生效的客户端 UA 识别规则
+func GetUARules(c *gin.Context) {
+	rules, status := device.CurrentUARules()
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"rules":  rules,
+		"status": status,
+	})
+}
+
+// UpdateUARules 校验并保存 UA 规则，保存后立即生效
+func UpdateUARules(c *gin.Context) {
+	data, err := c.GetRawData()
+	if err != nil || len(data) == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	rules, err := device.SaveUARules(data)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "保存 UA 规则失败: "+err.Error(), nil)
+		return
+	}
+	utils.CreateAuditLogSimple(c, "update_ua_rules", "ua_rules", 0,
+		fmt.Sprintf("更新 UA 识别规则: 版本 %s，客户端规则 %d 条", rules.Version, len(rules.Software)))
+	_, status := device.CurrentUARules()
+	utils.SuccessResponse(c, http.StatusOK, "UA 规则已保存", gin.H{
+		"rules":  rules,
+		"status": status,
+	})
+}
+
+// ReloadUARules 从磁盘重新加载 UA 规则文件
+func ReloadUARules(c *gin.Context) {
+	if err := device.ReloadUARules(); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "重新加载 UA 规则失败: "+err.Error(), nil)
+		return
+	}
+	_, status := device.CurrentUARules()
+	utils.SuccessResponse(c, http.StatusOK, "UA 规则已重新加载", status)
+}
+
+// TestUARules 用当前规则解析指定的 User-Agent
+func TestUARules(c *gin.Context) {
+	var req struct {
+		UserAgent string `json:"user_agent"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	info := device.NewDeviceManager().ParseUserAgent(req.UserAgent)
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"user_agent":       req.UserAgent,
+		"software_name":    info.SoftwareName,
+		"software_version": info.SoftwareVersion,
+		"os_name":          info.OSName,
+		"os_version":       info.OSVersion,
+		"device_brand":     info.DeviceBrand,
+		"device_model":     info.DeviceModel,
+		"device_type":      info.DeviceType,
+		"device_name":      info.DeviceName,
+	})
+}
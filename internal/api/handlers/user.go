@@ -15,6 +15,7 @@ import (
 	"cboard-go/internal/services/email"
 	"cboard-go/internal/services/geoip"
 	"cboard-go/internal/services/notification"
+	"cboard-go/internal/services/session"
 	"cboard-go/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -693,6 +694,10 @@ func CreateUser(c *gin.Context) {
 		return
 	}
 
+	if !guardAdminTarget(c, &models.User{}, req.IsAdmin) {
+		return
+	}
+
 	db := database.GetDB()
 
 	var existingUser models.User
@@ -858,6 +863,10 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	if !guardAdminTarget(c, &user, req.IsAdmin != nil && *req.IsAdmin) {
+		return
+	}
+
 	beforeData := map[string]interface{}{
 		"username":    user.Username,
 		"email":       user.Email,
@@ -882,6 +891,9 @@ func UpdateUser(c *gin.Context) {
 			utils.ErrorResponse(c, http.StatusBadRequest, "邮箱已被使用", nil)
 			return
 		}
+		if req.Email != user.Email && !checkEmailDomain(c, db, req.Email, "change_email") {
+			return
+		}
 		user.Email = req.Email
 	}
 
@@ -945,6 +957,10 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
+	if !guardAdminTarget(c, &user, false) {
+		return
+	}
+
 	userData := map[string]interface{}{
 		"id":          user.ID,
 		"username":    user.Username,
@@ -1072,6 +1088,15 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.PasswordHistory{}).Error; err != nil {
+		tx.Rollback()
+		utils.LogError("DeleteUser: delete password history failed", err, map[string]interface{}{
+			"user_id": user.ID,
+		})
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除用户历史密码失败", err)
+		return
+	}
+
 	if err := tx.Model(&models.InviteCode{}).Where("user_id = ? AND used_count = 0", user.ID).Delete(&models.InviteCode{}).Error; err != nil {
 		tx.Rollback()
 		utils.LogError("DeleteUser: delete invite codes failed", err, map[string]interface{}{
@@ -1152,21 +1177,23 @@ func LoginAsUser(c *gin.Context) {
 		return
 	}
 
-	accessToken, err := utils.CreateAccessToken(targetUser.ID, targetUser.Email, targetUser.IsAdmin)
-	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "生成令牌失败", err)
+	if !guardAdminTarget(c, &targetUser, false) {
 		return
 	}
 
-	refreshToken, err := utils.CreateRefreshToken(targetUser.ID, targetUser.Email)
+	tokens, err := session.Create(db, &targetUser, session.Client{
+		IP:          utils.GetRealClientIP(c),
+		UserAgent:   c.GetHeader("User-Agent"),
+		LoginMethod: "admin_login_as",
+	})
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "生成刷新令牌失败", err)
+		utils.ErrorResponse(c, http.StatusInternalServerError, "生成令牌失败", err)
 		return
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "登录成功", gin.H{
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
 		"token_type":    "bearer",
 		"user": gin.H{
 			"id":       targetUser.ID,
@@ -1199,6 +1226,10 @@ func UpdateUserStatus(c *gin.Context) {
 		return
 	}
 
+	if !guardAdminTarget(c, &user, req.IsAdmin != nil && *req.IsAdmin) {
+		return
+	}
+
 	if req.Status != "" {
 		switch req.Status {
 		case "active":
@@ -1234,6 +1265,9 @@ func UnlockUserLogin(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusNotFound, "用户不存在", err)
 		return
 	}
+	if !guardAdminTarget(c, &user, false) {
+		return
+	}
 
 	result := db.Where("username = ? OR username = ?", user.Username, user.Email).
 		Where("success = ?", false).
@@ -1435,6 +1469,14 @@ func BatchEnableUsers(c *gin.Context) {
 	}
 
 	db := database.GetDB()
+	// 批量中包含管理员账号时，只有超级管理员可以操作
+	var adminUser models.User
+	if err := db.Where("id IN ? AND is_admin = ?", req.UserIDs, true).First(&adminUser).Error; err == nil {
+		if !guardAdminTarget(c, &adminUser, false) {
+			return
+		}
+	}
+
 	result := db.Model(&models.User{}).Where("id IN ?", req.UserIDs).Update("is_active", true)
 
 	if result.Error != nil {
@@ -468,8 +468,9 @@ func GetPrivacySettings(c *gin.Context) {
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
-		"data_sharing": user.DataSharing,
-		"analytics":    user.Analytics,
+		"data_sharing":            user.DataSharing,
+		"analytics":               user.Analytics,
+		"require_device_approval": user.RequireDeviceApproval,
 	})
 }
 
@@ -495,6 +496,10 @@ func UpdatePrivacySettings(c *gin.Context) {
 		user.Analytics = analytics
 	}
 
+	if requireApproval, ok := req["require_device_approval"].(bool); ok {
+		user.RequireDeviceApproval = requireApproval
+	}
+
 	if err := db.Save(user).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "更新失败", err)
 		return
@@ -49,6 +49,9 @@ func SendVerificationCode(c *gin.Context) {
 			utils.ErrorResponse(c, http.StatusBadRequest, "邮箱不能为空", nil)
 			return
 		}
+		if !checkEmailDomain(c, db, req.Email, "send_verification_code") {
+			return
+		}
 
 		verificationCode := models.VerificationCode{
 			Email:     req.Email,
@@ -3,6 +3,7 @@ package router
 import (
 	"cboard-go/internal/api/handlers"
 	"cboard-go/internal/middleware"
+	"cboard-go/internal/models"
 	"cboard-go/internal/utils"
 	"net/http"
 
@@ -35,25 +36,63 @@ func SetupRouter() *gin.Engine {
 
 	api := r.Group("/api/v1")
 	{
+		// 访问控制规则按路由组划分作用范围，需在认证之前执行
+		acl := middleware.AccessControlMiddleware
 		auth := api.Group("/auth")
+		auth.Use(acl(models.AccessScopeAuth))
 		{
-			auth.POST("/register", middleware.RegisterRateLimitMiddleware(), handlers.Register)
-			auth.POST("/login", middleware.LoginRateLimitMiddleware(), handlers.Login)
-			auth.POST("/login-json", middleware.LoginRateLimitMiddleware(), handlers.LoginJSON)
+			auth.POST("/register", middleware.RegisterRateLimitMiddleware(), middleware.CaptchaMiddleware(), handlers.Register)
+			auth.POST("/login", middleware.LoginRateLimitMiddleware(), middleware.CaptchaMiddleware(), handlers.Login)
+			auth.POST("/login-json", middleware.LoginRateLimitMiddleware(), middleware.CaptchaMiddleware(), handlers.LoginJSON)
+			auth.POST("/2fa/verify", middleware.LoginRateLimitMiddleware(), handlers.VerifyTwoFactorLogin)
+			auth.POST("/login/step-up", middleware.LoginRateLimitMiddleware(), handlers.VerifyLoginStepUp)
+			auth.POST("/2fa/enroll", middleware.LoginRateLimitMiddleware(), handlers.EnrollTwoFactorAtLogin)
+			auth.POST("/2fa/passkey", middleware.LoginRateLimitMiddleware(), handlers.BeginTwoFactorPasskey)
+			auth.POST("/passkey/login/begin", middleware.LoginRateLimitMiddleware(), handlers.BeginPasskeyLogin)
+			auth.POST("/passkey/login/finish", middleware.LoginRateLimitMiddleware(), handlers.FinishPasskeyLogin)
+			auth.GET("/oauth/providers", handlers.GetOAuthProviders)
+			auth.GET("/captcha/config", handlers.GetCaptchaConfig)
+			auth.POST("/captcha/challenge", middleware.CaptchaChallengeRateLimitMiddleware(), handlers.CreateCaptchaChallenge)
+			auth.POST("/oauth/:provider/authorize", middleware.LoginRateLimitMiddleware(), handlers.OAuthAuthorize)
+			auth.POST("/oauth/:provider/callback", middleware.LoginRateLimitMiddleware(), handlers.OAuthCallback)
 			auth.POST("/refresh", handlers.RefreshToken)
 			auth.POST("/logout", middleware.AuthMiddleware(), handlers.Logout)
-			auth.POST("/verification/send", middleware.VerifyCodeRateLimitMiddleware(), handlers.SendVerificationCode)
+			auth.POST("/verification/send", middleware.VerifyCodeRateLimitMiddleware(), middleware.CaptchaMiddleware(), handlers.SendVerificationCode)
 			auth.POST("/verification/verify", handlers.VerifyCode)
-			auth.POST("/forgot-password", middleware.VerifyCodeRateLimitMiddleware(), handlers.ForgotPassword)
+			auth.POST("/forgot-password", middleware.VerifyCodeRateLimitMiddleware(), middleware.CaptchaMiddleware(), handlers.ForgotPassword)
 			auth.POST("/reset-password", handlers.ResetPasswordByCode)
 		}
 
 		api.POST("/payment/notify/:type", handlers.PaymentNotify)
 		api.GET("/payment/notify/:type", handlers.PaymentNotify)
 
+		// 节点后端接口（通信密钥认证）
+		server := api.Group("/server")
+		{
+			server.GET("/custom-nodes/:id/users", handlers.GetNodeBackendUsers)
+			server.GET("/custom-nodes/:id/config", handlers.GetNodeBackendConfig)
+		}
+
+		deviceApproval := api.Group("/device-approval")
+		deviceApproval.Use(acl(models.AccessScopeUser))
+		{
+			deviceApproval.GET("/:token", handlers.ShowDeviceApproval)
+			deviceApproval.POST("/:token", handlers.ConfirmDeviceApproval)
+		}
+
+		loginAlert := api.Group("/login-alert")
+		loginAlert.Use(acl(models.AccessScopeUser))
+		{
+			loginAlert.GET("/:token", handlers.ShowLoginAlert)
+			loginAlert.POST("/:token", handlers.ConfirmLoginAlert)
+		}
+
+		api.GET("/data-export/:token", acl(models.AccessScopeUser), handlers.DownloadDataExport)
+
 		api.Use(middleware.CSRFMiddleware())
 
 		users := api.Group("/users")
+		users.Use(acl(models.AccessScopeUser))
 		users.Use(middleware.AuthMiddleware())
 		{
 			users.GET("/me", handlers.GetCurrentUser)
@@ -69,12 +108,34 @@ func SetupRouter() *gin.Engine {
 			users.GET("/theme", handlers.GetUserTheme)
 			users.PUT("/theme", handlers.UpdateUserTheme)
 			users.GET("/login-history", handlers.GetLoginHistory)
+			users.GET("/2fa", handlers.GetTwoFactorStatus)
+			users.POST("/2fa/setup", handlers.SetupTwoFactor)
+			users.POST("/2fa/confirm", handlers.ConfirmTwoFactor)
+			users.POST("/2fa/disable", handlers.DisableTwoFactor)
+			users.POST("/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
+			users.GET("/passkeys", handlers.ListPasskeys)
+			users.POST("/passkeys/register/begin", handlers.BeginPasskeyRegistration)
+			users.POST("/passkeys/register/finish", handlers.FinishPasskeyRegistration)
+			users.PUT("/passkeys/:id", handlers.RenamePasskey)
+			users.DELETE("/passkeys/:id", handlers.DeletePasskey)
+			users.GET("/oauth", handlers.GetOAuthIdentities)
+			users.POST("/oauth/:provider/link", handlers.LinkOAuthIdentity)
+			users.DELETE("/oauth/:provider", handlers.UnlinkOAuthIdentity)
+			users.GET("/sessions", handlers.GetSessions)
+			users.POST("/sessions/revoke-others", handlers.RevokeOtherSessions)
+			users.DELETE("/sessions/:id", handlers.RevokeSession)
 			users.GET("/activities", handlers.GetUserActivities)
 			users.GET("/subscription-resets", handlers.GetSubscriptionResets)
 			users.GET("/devices", handlers.GetUserDevices)
+			users.GET("/data-exports", handlers.GetDataExports)
+			users.POST("/data-exports", handlers.RequestDataExport)
+			users.GET("/account-deletion", handlers.GetAccountDeletion)
+			users.POST("/account-deletion", handlers.RequestAccountDeletion)
+			users.DELETE("/account-deletion", handlers.CancelAccountDeletion)
 		}
 
 		xboardCompat := api.Group("")
+		xboardCompat.Use(acl(models.AccessScopeUser))
 		xboardCompat.Use(middleware.AuthMiddleware())
 		{
 			xboardCompat.GET("/user/info", handlers.GetCurrentUserXBoardCompat)
@@ -83,6 +144,7 @@ func SetupRouter() *gin.Engine {
 		}
 
 		subscriptions := api.Group("/subscriptions")
+		subscriptions.Use(acl(models.AccessScopeUser))
 		subscriptions.Use(middleware.AuthMiddleware())
 		{
 			subscriptions.GET("", handlers.GetSubscriptions)
@@ -94,9 +156,15 @@ func SetupRouter() *gin.Engine {
 			subscriptions.POST("/send-subscription-email", handlers.SendSubscriptionEmailSelf)
 			subscriptions.POST("/convert-to-balance", handlers.ConvertSubscriptionToBalance)
 			subscriptions.DELETE("/devices/:id", handlers.DeleteDevice)
+			subscriptions.POST("/devices/:id/approve", handlers.ApproveUserDevice)
+			subscriptions.POST("/devices/:id/deny", handlers.DenyUserDevice)
+			subscriptions.GET("/device-tokens", handlers.GetDeviceTokens)
+			subscriptions.POST("/device-tokens", handlers.CreateDeviceToken)
+			subscriptions.DELETE("/device-tokens/:id", handlers.RevokeDeviceToken)
 		}
 
 		subscribePublic := api.Group("")
+		subscribePublic.Use(acl(models.AccessScopeSubscribe))
 		subscribePublic.Use(middleware.CSRFExemptMiddleware())
 		{
 			subscribePublic.GET("/subscribe/:url", handlers.GetSubscriptionConfig)
@@ -107,6 +175,7 @@ func SetupRouter() *gin.Engine {
 		}
 
 		orders := api.Group("/orders")
+		orders.Use(acl(models.AccessScopeUser))
 		orders.Use(middleware.AuthMiddleware())
 		{
 			orders.GET("", handlers.GetOrders)
@@ -120,27 +189,31 @@ func SetupRouter() *gin.Engine {
 		}
 
 		packages := api.Group("/packages")
+		packages.Use(acl(models.AccessScopeUser))
 		{
 			packages.GET("", handlers.GetPackages)
 			packages.GET("/:id", handlers.GetPackage)
 		}
 
 		payment := api.Group("/payment")
+		payment.Use(acl(models.AccessScopeUser))
 		payment.Use(middleware.AuthMiddleware())
 		{
 			payment.GET("/methods", handlers.GetPaymentMethods)
 			payment.POST("", handlers.CreatePayment)
 			payment.GET("/status/:id", handlers.GetPaymentStatus)
 		}
-		api.GET("/payment-methods/active", handlers.GetPaymentMethods)
+		api.GET("/payment-methods/active", acl(models.AccessScopeUser), handlers.GetPaymentMethods)
 
 		nodes := api.Group("/nodes")
+		nodes.Use(acl(models.AccessScopeUser))
 		{
 			nodes.GET("", middleware.TryAuthMiddleware(), handlers.GetNodes)
 			nodes.GET("/stats", middleware.TryAuthMiddleware(), handlers.GetNodeStats)
 			nodes.GET("/:id", handlers.GetNode)
 		}
 		nodesAuth := api.Group("/nodes")
+		nodesAuth.Use(acl(models.AccessScopeUser))
 		nodesAuth.Use(middleware.AuthMiddleware())
 		{
 			nodesAuth.POST("/:id/test", handlers.TestNode)
@@ -149,6 +222,7 @@ func SetupRouter() *gin.Engine {
 		}
 
 		coupons := api.Group("/coupons")
+		coupons.Use(acl(models.AccessScopeUser))
 		{
 			coupons.GET("", handlers.GetCoupons)
 			coupons.GET("/:code", handlers.GetCoupon)
@@ -159,9 +233,11 @@ func SetupRouter() *gin.Engine {
 		{
 			couponsAuth.GET("/my", handlers.GetUserCoupons)
 		}
-		couponsAdmin := coupons.Group("/admin")
+		couponsAdmin := api.Group("/coupons/admin")
+		couponsAdmin.Use(acl(models.AccessScopeAdmin))
 		couponsAdmin.Use(middleware.AuthMiddleware())
 		couponsAdmin.Use(middleware.AdminMiddleware())
+		couponsAdmin.Use(middleware.RequirePermission(models.PermOrders))
 		{
 			couponsAdmin.GET("", handlers.GetAdminCoupons)
 			couponsAdmin.GET("/:id", handlers.GetAdminCoupon)
@@ -171,6 +247,7 @@ func SetupRouter() *gin.Engine {
 		}
 
 		notifications := api.Group("/notifications")
+		notifications.Use(acl(models.AccessScopeUser))
 		notifications.Use(middleware.AuthMiddleware())
 		{
 			notifications.GET("", handlers.GetNotifications)
@@ -181,8 +258,10 @@ func SetupRouter() *gin.Engine {
 			notifications.GET("/user-notifications", handlers.GetUserNotifications)
 		}
 		notificationsAdmin := api.Group("/notifications/admin")
+		notificationsAdmin.Use(acl(models.AccessScopeAdmin))
 		notificationsAdmin.Use(middleware.AuthMiddleware())
 		notificationsAdmin.Use(middleware.AdminMiddleware())
+		notificationsAdmin.Use(middleware.RequirePermission(models.PermSettings))
 		{
 			notificationsAdmin.GET("/notifications", handlers.GetAdminNotifications)
 			notificationsAdmin.POST("/notifications", handlers.CreateAdminNotification)
@@ -191,6 +270,7 @@ func SetupRouter() *gin.Engine {
 		}
 
 		tickets := api.Group("/tickets")
+		tickets.Use(acl(models.AccessScopeUser))
 		tickets.Use(middleware.AuthMiddleware())
 		{
 			tickets.GET("", handlers.GetTickets)
@@ -202,8 +282,10 @@ func SetupRouter() *gin.Engine {
 			tickets.PUT("/:id", handlers.CloseTicket)
 		}
 		ticketsAdmin := api.Group("/tickets/admin")
+		ticketsAdmin.Use(acl(models.AccessScopeAdmin))
 		ticketsAdmin.Use(middleware.AuthMiddleware())
 		ticketsAdmin.Use(middleware.AdminMiddleware())
+		ticketsAdmin.Use(middleware.RequirePermission(models.PermTickets))
 		{
 			ticketsAdmin.GET("/all", handlers.GetAdminTickets)
 			ticketsAdmin.GET("/statistics", handlers.GetAdminTicketStatistics)
@@ -212,15 +294,17 @@ func SetupRouter() *gin.Engine {
 		}
 
 		devices := api.Group("/devices")
+		devices.Use(acl(models.AccessScopeUser))
 		devices.Use(middleware.AuthMiddleware())
 		{
 			devices.GET("", handlers.GetDevices)
 			devices.DELETE("/:id", handlers.DeleteDevice)
 		}
 
-		api.GET("/invites/validate/:code", handlers.ValidateInviteCode)
+		api.GET("/invites/validate/:code", acl(models.AccessScopeUser), handlers.ValidateInviteCode)
 
 		invites := api.Group("/invites")
+		invites.Use(acl(models.AccessScopeUser))
 		invites.Use(middleware.AuthMiddleware())
 		{
 			invites.GET("", handlers.GetInviteCodes)
@@ -233,39 +317,48 @@ func SetupRouter() *gin.Engine {
 		}
 
 		recharge := api.Group("/recharge")
+		recharge.Use(acl(models.AccessScopeUser))
 		recharge.Use(middleware.AuthMiddleware())
 		{
 			recharge.GET("", handlers.GetRechargeRecords)
 			recharge.GET("/status/:orderNo", handlers.GetRechargeStatusByNo)
-			rechargeAdmin := recharge.Group("/admin")
-			rechargeAdmin.Use(middleware.AdminMiddleware())
-			{
-				rechargeAdmin.GET("", handlers.GetAdminRechargeRecords)
-			}
 			recharge.GET("/:id", handlers.GetRechargeRecord)
 			recharge.POST("", handlers.CreateRecharge)
 			recharge.POST("/:id/cancel", handlers.CancelRecharge)
 		}
+		rechargeAdmin := api.Group("/recharge/admin")
+		rechargeAdmin.Use(acl(models.AccessScopeAdmin))
+		rechargeAdmin.Use(middleware.AuthMiddleware())
+		rechargeAdmin.Use(middleware.AdminMiddleware())
+		rechargeAdmin.Use(middleware.RequirePermission(models.PermOrders))
+		{
+			rechargeAdmin.GET("", handlers.GetAdminRechargeRecords)
+		}
 
 		config := api.Group("/config")
+		config.Use(acl(models.AccessScopeUser))
 		{
 			config.GET("", handlers.GetSystemConfigs)
 			config.GET("/:key", handlers.GetSystemConfig)
 		}
 
-		api.GET("/software-config", handlers.GetSoftwareConfig)
+		api.GET("/software-config", acl(models.AccessScopeUser), handlers.GetSoftwareConfig)
 
-		api.GET("/mobile-config", handlers.GetMobileConfig)
+		api.GET("/mobile-config", acl(models.AccessScopeUser), handlers.GetMobileConfig)
 		softwareConfig := api.Group("/software-config")
+		softwareConfig.Use(acl(models.AccessScopeAdmin))
 		softwareConfig.Use(middleware.AuthMiddleware())
 		softwareConfig.Use(middleware.AdminMiddleware())
+		softwareConfig.Use(middleware.RequirePermission(models.PermSettings))
 		{
 			softwareConfig.PUT("", handlers.UpdateSoftwareConfig)
 		}
 
 		paymentConfig := api.Group("/payment-config")
+		paymentConfig.Use(acl(models.AccessScopeAdmin))
 		paymentConfig.Use(middleware.AuthMiddleware())
 		paymentConfig.Use(middleware.AdminMiddleware())
+		paymentConfig.Use(middleware.RequirePermission(models.PermPaymentsConfig))
 		{
 			paymentConfig.GET("", handlers.GetPaymentConfig)
 			paymentConfig.POST("", handlers.CreatePaymentConfig)
@@ -273,13 +366,16 @@ func SetupRouter() *gin.Engine {
 		}
 
 		settings := api.Group("/settings")
+		settings.Use(acl(models.AccessScopeUser))
 		{
 			settings.GET("/public-settings", handlers.GetPublicSettings)
 		}
 
 		statistics := api.Group("/statistics")
+		statistics.Use(acl(models.AccessScopeAdmin))
 		statistics.Use(middleware.AuthMiddleware())
 		statistics.Use(middleware.AdminMiddleware())
+		statistics.Use(middleware.RequirePermission(models.PermDashboard))
 		{
 			statistics.GET("", handlers.GetStatistics)
 			statistics.GET("/revenue", handlers.GetRevenueChart)
@@ -290,98 +386,142 @@ func SetupRouter() *gin.Engine {
 		}
 
 		admin := api.Group("/admin")
+		admin.Use(acl(models.AccessScopeAdmin))
 		admin.Use(middleware.AuthMiddleware())
 		admin.Use(middleware.AdminMiddleware())
+		// 每个后台接口声明所需权限，未分配角色的管理员拥有全部权限
+		perm := middleware.RequirePermission
 		{
-			admin.GET("/dashboard", handlers.GetDashboard)
-			admin.GET("/stats", handlers.GetDashboard)
-			admin.GET("/users/recent", handlers.GetRecentUsers)
-			admin.GET("/orders/recent", handlers.GetRecentOrders)
-			admin.GET("/users/abnormal", handlers.GetAbnormalUsers)
-			admin.POST("/users/abnormal/:id/mark-normal", handlers.MarkUserNormal)
-
-			admin.GET("/users", handlers.GetUsers)
-			admin.POST("/users", handlers.CreateUser)
-			admin.GET("/users/:id", handlers.GetUser)
-			admin.GET("/users/:id/details", handlers.GetUserDetails)
-			admin.PUT("/users/:id", handlers.UpdateUser)
-			admin.PUT("/users/:id/status", handlers.UpdateUserStatus)
-			admin.POST("/users/:id/unlock-login", handlers.UnlockUserLogin)
-			admin.DELETE("/users/:id", handlers.DeleteUser)
-			admin.POST("/users/:id/reset-password", handlers.ResetPassword)
-			admin.POST("/users/:id/login-as", handlers.LoginAsUser)
-			admin.POST("/users/batch-delete", handlers.BatchDeleteUsers)
-			admin.POST("/users/batch-enable", handlers.BatchEnableUsers)
-			admin.POST("/users/batch-disable", handlers.BatchDisableUsers)
-			admin.POST("/users/batch-send-subscription-email", handlers.BatchSendSubEmail)
-			admin.POST("/users/batch-expire-reminder", handlers.BatchSendExpireReminder)
-
-			admin.GET("/orders", handlers.GetAdminOrders)
-			admin.PUT("/orders/:id", handlers.UpdateAdminOrder)
-			admin.DELETE("/orders/:id", handlers.DeleteAdminOrder)
-			admin.GET("/orders/export", handlers.ExportOrders)
-			admin.GET("/orders/statistics", handlers.GetOrderStatistics)
-			admin.POST("/orders/bulk-mark-paid", handlers.BulkMarkOrdersPaid)
-			admin.POST("/orders/bulk-cancel", handlers.BulkCancelOrders)
-			admin.POST("/orders/batch-delete", handlers.BatchDeleteOrders)
-
-			admin.GET("/packages", handlers.GetAdminPackages)
-			admin.POST("/packages", handlers.CreatePackage)
-			admin.PUT("/packages/:id", handlers.UpdatePackage)
-			admin.DELETE("/packages/:id", handlers.DeletePackage)
-
-			admin.GET("/nodes", handlers.GetAdminNodes)
-			admin.GET("/nodes/stats", handlers.GetNodeStats)
-			admin.POST("/nodes", handlers.CreateNode)
-			admin.POST("/nodes/import-links", handlers.ImportNodeLinks)
-			admin.PUT("/nodes/:id", handlers.UpdateNode)
-			admin.DELETE("/nodes/:id", handlers.DeleteNode)
-			admin.POST("/nodes/:id/test", handlers.TestNode)
-			admin.POST("/nodes/batch-test", handlers.BatchTestNodes)
-			admin.POST("/nodes/batch-delete", handlers.BatchDeleteNodes)
-			admin.POST("/nodes/import-from-file", handlers.ImportFromFile)
-
-			admin.GET("/custom-nodes", handlers.GetCustomNodes)
-			admin.GET("/custom-nodes/:id/users", handlers.GetCustomNodeUsers)
-			admin.POST("/custom-nodes", handlers.CreateCustomNode)
-			admin.POST("/custom-nodes/import-links", handlers.ImportCustomNodeLinks)
-			admin.POST("/custom-nodes/batch-delete", handlers.BatchDeleteCustomNodes)
-			admin.POST("/custom-nodes/batch-assign", handlers.BatchAssignCustomNodes)
-			admin.POST("/custom-nodes/batch-test", handlers.BatchTestCustomNodes)
-			admin.POST("/custom-nodes/:id/test", handlers.TestCustomNode)
-			admin.GET("/custom-nodes/:id/link", handlers.GetCustomNodeLink)
-			admin.PUT("/custom-nodes/:id", handlers.UpdateCustomNode)
-			admin.DELETE("/custom-nodes/:id", handlers.DeleteCustomNode)
-
-			admin.GET("/users/:id/custom-nodes", handlers.GetUserCustomNodes)
-			admin.POST("/users/:id/custom-nodes", handlers.AssignCustomNodeToUser)
-			admin.DELETE("/users/:id/custom-nodes/:node_id", handlers.UnassignCustomNodeFromUser)
-
-			admin.PUT("/tickets/:id/status", handlers.UpdateTicketStatus)
-
-			admin.GET("/devices/stats", handlers.GetDeviceStats)
-
-			admin.GET("/statistics", handlers.GetStatistics)
-			admin.GET("/statistics/user-trend", handlers.GetUserTrend)
-			admin.GET("/statistics/revenue-trend", handlers.GetRevenueTrend)
-			admin.GET("/statistics/regions", handlers.GetRegionStats)
-
-			admin.GET("/settings", handlers.GetAdminSettings)
-			admin.PUT("/settings/general", handlers.UpdateGeneralSettings)
-			admin.PUT("/settings/registration", handlers.UpdateRegistrationSettings)
-			admin.PUT("/settings/notification", handlers.UpdateNotificationSettings)
-			admin.PUT("/settings/announcement", handlers.UpdateAnnouncementSettings)
-			admin.PUT("/settings/security", handlers.UpdateSecuritySettings)
-			admin.PUT("/settings/theme", handlers.UpdateThemeSettings)
-			admin.PUT("/settings/invite", handlers.UpdateInviteSettings)
-			admin.PUT("/settings/admin-notification", handlers.UpdateAdminNotificationSystemSettings)
-			admin.POST("/settings/admin-notification/test/email", handlers.TestAdminEmailNotification)
-			admin.POST("/settings/admin-notification/test/telegram", handlers.TestAdminTelegramNotification)
-			admin.POST("/settings/admin-notification/test/bark", handlers.TestAdminBarkNotification)
-			admin.PUT("/settings/node_health", handlers.UpdateNodeHealthSettings)
-			admin.GET("/settings/geoip/status", handlers.GetGeoIPStatus)
-			admin.POST("/settings/geoip/update", handlers.UpdateGeoIPDatabase)
-
+			admin.GET("/dashboard", perm(models.PermDashboard), handlers.GetDashboard)
+			admin.GET("/stats", perm(models.PermDashboard), handlers.GetDashboard)
+			admin.GET("/users/recent", perm(models.PermDashboard), handlers.GetRecentUsers)
+			admin.GET("/orders/recent", perm(models.PermDashboard), handlers.GetRecentOrders)
+			admin.GET("/users/abnormal", perm(models.PermUsersRead), handlers.GetAbnormalUsers)
+			admin.POST("/users/abnormal/:id/mark-normal", perm(models.PermUsersWrite), handlers.MarkUserNormal)
+
+			admin.GET("/users", perm(models.PermUsersRead), handlers.GetUsers)
+			admin.POST("/users", perm(models.PermUsersWrite), handlers.CreateUser)
+			admin.GET("/users/:id", perm(models.PermUsersRead), handlers.GetUser)
+			admin.GET("/users/:id/details", perm(models.PermUsersRead), handlers.GetUserDetails)
+			admin.PUT("/users/:id", perm(models.PermUsersWrite), handlers.UpdateUser)
+			admin.PUT("/users/:id/status", perm(models.PermUsersWrite), handlers.UpdateUserStatus)
+			admin.POST("/users/:id/unlock-login", perm(models.PermUsersWrite), handlers.UnlockUserLogin)
+			admin.POST("/users/:id/reset-2fa", perm(models.PermUsersWrite), handlers.AdminResetTwoFactor)
+			admin.DELETE("/users/:id", perm(models.PermUsersWrite), handlers.DeleteUser)
+			admin.POST("/users/:id/reset-password", perm(models.PermUsersWrite), handlers.ResetPassword)
+			admin.POST("/users/:id/login-as", perm(models.PermUsersWrite), handlers.LoginAsUser)
+			admin.GET("/users/:id/sessions", perm(models.PermUsersRead), handlers.GetUserSessions)
+			admin.POST("/users/:id/logout", perm(models.PermUsersWrite), handlers.ForceLogoutUser)
+			admin.PUT("/users/:id/role", perm(models.PermRoles), handlers.AssignUserRole)
+			admin.POST("/users/batch-delete", perm(models.PermUsersWrite), handlers.BatchDeleteUsers)
+			admin.POST("/users/batch-enable", perm(models.PermUsersWrite), handlers.BatchEnableUsers)
+			admin.POST("/users/batch-disable", perm(models.PermUsersWrite), handlers.BatchDisableUsers)
+			admin.POST("/users/batch-send-subscription-email", perm(models.PermUsersWrite), handlers.BatchSendSubEmail)
+			admin.POST("/users/batch-expire-reminder", perm(models.PermUsersWrite), handlers.BatchSendExpireReminder)
+
+			admin.GET("/orders", perm(models.PermOrders), handlers.GetAdminOrders)
+			admin.PUT("/orders/:id", perm(models.PermOrders), handlers.UpdateAdminOrder)
+			admin.DELETE("/orders/:id", perm(models.PermOrders), handlers.DeleteAdminOrder)
+			admin.GET("/orders/export", perm(models.PermOrders), handlers.ExportOrders)
+			admin.GET("/orders/statistics", perm(models.PermOrders), handlers.GetOrderStatistics)
+			admin.POST("/orders/bulk-mark-paid", perm(models.PermOrders), handlers.BulkMarkOrdersPaid)
+			admin.POST("/orders/bulk-cancel", perm(models.PermOrders), handlers.BulkCancelOrders)
+			admin.POST("/orders/batch-delete", perm(models.PermOrders), handlers.BatchDeleteOrders)
+
+			admin.GET("/packages", perm(models.PermOrders), handlers.GetAdminPackages)
+			admin.POST("/packages", perm(models.PermOrders), handlers.CreatePackage)
+			admin.PUT("/packages/:id", perm(models.PermOrders), handlers.UpdatePackage)
+			admin.DELETE("/packages/:id", perm(models.PermOrders), handlers.DeletePackage)
+
+			admin.GET("/nodes", perm(models.PermNodes), handlers.GetAdminNodes)
+			admin.GET("/nodes/stats", perm(models.PermNodes), handlers.GetNodeStats)
+			admin.POST("/nodes", perm(models.PermNodes), handlers.CreateNode)
+			admin.POST("/nodes/import-links", perm(models.PermNodes), handlers.ImportNodeLinks)
+			admin.POST("/nodes/lint-links", perm(models.PermNodes), handlers.LintNodeLinks)
+			admin.PUT("/nodes/:id", perm(models.PermNodes), handlers.UpdateNode)
+			admin.DELETE("/nodes/:id", perm(models.PermNodes), handlers.DeleteNode)
+			admin.POST("/nodes/:id/test", perm(models.PermNodes), handlers.TestNode)
+			admin.POST("/nodes/batch-test", perm(models.PermNodes), handlers.BatchTestNodes)
+			admin.POST("/nodes/batch-delete", perm(models.PermNodes), handlers.BatchDeleteNodes)
+			admin.POST("/nodes/import-from-file", perm(models.PermNodes), handlers.ImportFromFile)
+
+			admin.GET("/custom-nodes", perm(models.PermNodes), handlers.GetCustomNodes)
+			admin.GET("/custom-nodes/:id/users", perm(models.PermNodes), handlers.GetCustomNodeUsers)
+			admin.POST("/custom-nodes", perm(models.PermNodes), handlers.CreateCustomNode)
+			admin.POST("/custom-nodes/import-links", perm(models.PermNodes), handlers.ImportCustomNodeLinks)
+			admin.POST("/custom-nodes/batch-delete", perm(models.PermNodes), handlers.BatchDeleteCustomNodes)
+			admin.POST("/custom-nodes/batch-assign", perm(models.PermNodes), handlers.BatchAssignCustomNodes)
+			admin.POST("/custom-nodes/batch-test", perm(models.PermNodes), handlers.BatchTestCustomNodes)
+			admin.POST("/custom-nodes/:id/test", perm(models.PermNodes), handlers.TestCustomNode)
+			admin.GET("/custom-nodes/:id/link", perm(models.PermNodes), handlers.GetCustomNodeLink)
+			admin.GET("/custom-nodes/:id/server-config", perm(models.PermNodes), handlers.DownloadCustomNodeServerConfig)
+			admin.GET("/custom-nodes/:id/reality-keys", perm(models.PermNodes), handlers.GetCustomNodeRealityKeys)
+			admin.POST("/custom-nodes/:id/reality-keys/rotate", perm(models.PermNodes), handlers.RotateCustomNodeRealityKeys)
+			admin.POST("/custom-nodes/:id/reality-keys/end-grace", perm(models.PermNodes), handlers.EndCustomNodeRealityGrace)
+			admin.POST("/custom-nodes/:id/backend-token", perm(models.PermNodes), handlers.IssueCustomNodeBackendToken)
+			admin.PUT("/custom-nodes/:id", perm(models.PermNodes), handlers.UpdateCustomNode)
+			admin.DELETE("/custom-nodes/:id", perm(models.PermNodes), handlers.DeleteCustomNode)
+
+			admin.GET("/node-panels", perm(models.PermNodes), handlers.GetNodePanels)
+			admin.POST("/node-panels", perm(models.PermNodes), handlers.CreateNodePanel)
+			admin.POST("/node-panels/sync", perm(models.PermNodes), handlers.SyncNodePanels)
+			admin.PUT("/node-panels/:id", perm(models.PermNodes), handlers.UpdateNodePanel)
+			admin.DELETE("/node-panels/:id", perm(models.PermNodes), handlers.DeleteNodePanel)
+			admin.POST("/node-panels/:id/test", perm(models.PermNodes), handlers.TestNodePanel)
+
+			admin.GET("/users/:id/custom-nodes", perm(models.PermNodes), handlers.GetUserCustomNodes)
+			admin.POST("/users/:id/custom-nodes", perm(models.PermNodes), handlers.AssignCustomNodeToUser)
+			admin.DELETE("/users/:id/custom-nodes/:node_id", perm(models.PermNodes), handlers.UnassignCustomNodeFromUser)
+
+			admin.PUT("/tickets/:id/status", perm(models.PermTickets), handlers.UpdateTicketStatus)
+
+			admin.GET("/devices/stats", perm(models.PermDashboard), handlers.GetDeviceStats)
+			admin.GET("/email-domains/disposable", perm(models.PermSettings), handlers.GetDisposableDomains)
+			admin.PUT("/email-domains/disposable", perm(models.PermSettings), handlers.UpdateDisposableDomains)
+			admin.POST("/email-domains/test", perm(models.PermSettings), handlers.TestEmailDomain)
+
+			admin.GET("/access-rules", perm(models.PermSettings), handlers.GetAccessRules)
+			admin.POST("/access-rules", perm(models.PermSettings), handlers.CreateAccessRule)
+			admin.POST("/access-rules/test", perm(models.PermSettings), handlers.TestAccessRule)
+			admin.PUT("/access-rules/:id", perm(models.PermSettings), handlers.UpdateAccessRule)
+			admin.DELETE("/access-rules/:id", perm(models.PermSettings), handlers.DeleteAccessRule)
+			admin.GET("/ua-rules", perm(models.PermNodes), handlers.GetUARules)
+			admin.PUT("/ua-rules", perm(models.PermNodes), handlers.UpdateUARules)
+			admin.POST("/ua-rules/reload", perm(models.PermNodes), handlers.ReloadUARules)
+			admin.POST("/ua-rules/test", perm(models.PermNodes), handlers.TestUARules)
+
+			admin.GET("/statistics", perm(models.PermDashboard), handlers.GetStatistics)
+			admin.GET("/statistics/user-trend", perm(models.PermDashboard), handlers.GetUserTrend)
+			admin.GET("/statistics/revenue-trend", perm(models.PermDashboard), handlers.GetRevenueTrend)
+			admin.GET("/statistics/regions", perm(models.PermDashboard), handlers.GetRegionStats)
+
+			admin.GET("/settings", perm(models.PermSettings), handlers.GetAdminSettings)
+			admin.PUT("/settings/general", perm(models.PermSettings), handlers.UpdateGeneralSettings)
+			admin.PUT("/settings/registration", perm(models.PermSettings), handlers.UpdateRegistrationSettings)
+			admin.PUT("/settings/notification", perm(models.PermSettings), handlers.UpdateNotificationSettings)
+			admin.PUT("/settings/announcement", perm(models.PermSettings), handlers.UpdateAnnouncementSettings)
+			admin.PUT("/settings/security", perm(models.PermSettings), handlers.UpdateSecuritySettings)
+			admin.PUT("/settings/theme", perm(models.PermSettings), handlers.UpdateThemeSettings)
+			admin.PUT("/settings/invite", perm(models.PermSettings), handlers.UpdateInviteSettings)
+			admin.PUT("/settings/admin-notification", perm(models.PermSettings), handlers.UpdateAdminNotificationSystemSettings)
+			admin.POST("/settings/admin-notification/test/email", perm(models.PermSettings), handlers.TestAdminEmailNotification)
+			admin.POST("/settings/admin-notification/test/telegram", perm(models.PermSettings), handlers.TestAdminTelegramNotification)
+			admin.POST("/settings/admin-notification/test/bark", perm(models.PermSettings), handlers.TestAdminBarkNotification)
+			admin.PUT("/settings/node_health", perm(models.PermNodes), handlers.UpdateNodeHealthSettings)
+			admin.PUT("/settings/oauth", perm(models.PermSettings), handlers.UpdateOAuthSettings)
+			admin.GET("/settings/geoip/status", perm(models.PermSettings), handlers.GetGeoIPStatus)
+			admin.POST("/settings/geoip/update", perm(models.PermSettings), handlers.UpdateGeoIPDatabase)
+
+			admin.GET("/roles", perm(models.PermRoles), handlers.GetRoles)
+			admin.POST("/roles", perm(models.PermRoles), handlers.CreateRole)
+			admin.PUT("/roles/:id", perm(models.PermRoles), handlers.UpdateRole)
+			admin.DELETE("/roles/:id", perm(models.PermRoles), handlers.DeleteRole)
+
+			// 管理员自己的资料与安全设置，无需额外权限，也不接受 API 密钥
+			admin.GET("/permissions", handlers.GetAdminPermissions)
+			admin.GET("/api-keys", handlers.GetAPIKeys)
+			admin.POST("/api-keys", handlers.CreateAPIKey)
+			admin.DELETE("/api-keys/:id", handlers.RevokeAPIKey)
 			admin.GET("/profile", handlers.GetAdminProfile)
 			admin.PUT("/profile", handlers.UpdateAdminProfile)
 			admin.POST("/change-password", handlers.ChangePassword)
@@ -391,72 +531,77 @@ func SetupRouter() *gin.Engine {
 			admin.GET("/notification-settings", handlers.GetNotificationSettings)
 			admin.PUT("/notification-settings", handlers.UpdateAdminNotificationSettings)
 
-			admin.GET("/subscriptions", handlers.GetAdminSubscriptions)
-			admin.PUT("/subscriptions/:id", handlers.UpdateSubscription)
-			admin.POST("/subscriptions/:id/reset", handlers.ResetSubscription)
-			admin.POST("/subscriptions/:id/extend", handlers.ExtendSubscription)
-			admin.GET("/subscriptions/:id/devices", handlers.GetSubscriptionDevices)
-			admin.POST("/subscriptions/user/:id/reset-all", handlers.ResetUserSubscription)
-			admin.POST("/subscriptions/user/:id/send-email", handlers.SendSubscriptionEmail)
-			admin.DELETE("/subscriptions/user/:id/delete-all", handlers.ClearUserDevices)
-			admin.DELETE("/devices/:id", handlers.RemoveDevice)
-			admin.POST("/devices/batch-delete", handlers.BatchDeleteDevices)
-			admin.GET("/subscriptions/export", handlers.ExportSubscriptions)
-			admin.POST("/subscriptions/batch-clear-devices", handlers.BatchClearDevices)
-			admin.POST("/subscriptions/batch-delete", handlers.BatchDeleteSubscriptions)
-			admin.POST("/subscriptions/batch-enable", handlers.BatchEnableSubscriptions)
-			admin.POST("/subscriptions/batch-disable", handlers.BatchDisableSubscriptions)
-			admin.POST("/subscriptions/batch-reset", handlers.BatchResetSubscriptions)
-			admin.POST("/subscriptions/batch-send-email", handlers.BatchSendAdminSubEmail)
-			admin.GET("/subscriptions/expiring", handlers.GetExpiringSubscriptions)
-
-			admin.GET("/config-update/status", handlers.GetConfigUpdateStatus)
-			admin.GET("/config-update/config", handlers.GetConfigUpdateConfig)
-			admin.PUT("/config-update/config", handlers.UpdateConfigUpdateConfig)
-			admin.POST("/config-update/start", handlers.StartConfigUpdate)
-			admin.POST("/config-update/stop", handlers.StopConfigUpdate)
-			admin.POST("/config-update/test", handlers.TestConfigUpdate)
-			admin.GET("/config-update/files", handlers.GetConfigUpdateFiles)
-			admin.GET("/config-update/logs", handlers.GetConfigUpdateLogs)
-			admin.POST("/config-update/logs/clear", handlers.ClearConfigUpdateLogs)
-
-			admin.GET("/invites", handlers.GetAdminInvites)
-			admin.GET("/invite-relations", handlers.GetAdminInviteRelations)
-			admin.GET("/invite-statistics", handlers.GetAdminInviteStatistics)
-
-			admin.GET("/user-levels", handlers.GetAdminUserLevels)
-			admin.POST("/user-levels", handlers.CreateUserLevel)
-			admin.PUT("/user-levels/:id", handlers.UpdateUserLevel)
-
-			admin.GET("/email-queue", handlers.GetAdminEmailQueue)
-			admin.GET("/email-queue/statistics", handlers.GetEmailQueueStatistics)
-			admin.GET("/email-queue/:id", handlers.GetEmailQueueDetail)
-			admin.DELETE("/email-queue/:id", handlers.DeleteEmailFromQueue)
-			admin.POST("/email-queue/:id/retry", handlers.RetryEmailFromQueue)
-			admin.POST("/email-queue/clear", handlers.ClearEmailQueue)
-
-			admin.GET("/email-config", handlers.GetAdminEmailConfig)
-			admin.POST("/email-config", handlers.UpdateEmailConfig)
-			admin.GET("/configs", handlers.GetSystemConfigs)
-			admin.POST("/configs", handlers.CreateSystemConfig)
-			admin.PUT("/configs/:key", handlers.UpdateSystemConfig)
-
-			admin.POST("/upload", handlers.UploadFile)
-
-			admin.POST("/config-update", handlers.UpdateSubscriptionConfig)
-
-			admin.GET("/monitoring/system", handlers.GetSystemInfo)
-			admin.GET("/monitoring/database", handlers.GetDatabaseStats)
-
-			admin.POST("/backup", handlers.CreateBackup)
-			admin.GET("/backups", handlers.ListBackups)
-
-			admin.GET("/logs/audit", handlers.GetAuditLogs)
-			admin.GET("/logs/login-attempts", handlers.GetLoginAttempts)
-			admin.GET("/system-logs", handlers.GetSystemLogs)
-			admin.GET("/logs-stats", handlers.GetLogsStats)
-			admin.GET("/export-logs", handlers.ExportLogs)
-			admin.POST("/clear-logs", handlers.ClearLogs)
+			admin.GET("/subscriptions", perm(models.PermUsersRead), handlers.GetAdminSubscriptions)
+			admin.PUT("/subscriptions/:id", perm(models.PermUsersWrite), handlers.UpdateSubscription)
+			admin.POST("/subscriptions/:id/reset", perm(models.PermUsersWrite), handlers.ResetSubscription)
+			admin.POST("/subscriptions/:id/extend", perm(models.PermUsersWrite), handlers.ExtendSubscription)
+			admin.GET("/subscriptions/:id/devices", perm(models.PermUsersRead), handlers.GetSubscriptionDevices)
+			admin.GET("/subscriptions/:id/sharing", perm(models.PermUsersRead), handlers.GetSubscriptionSharingReport)
+			admin.POST("/subscriptions/user/:id/reset-all", perm(models.PermUsersWrite), handlers.ResetUserSubscription)
+			admin.POST("/subscriptions/user/:id/send-email", perm(models.PermUsersWrite), handlers.SendSubscriptionEmail)
+			admin.DELETE("/subscriptions/user/:id/delete-all", perm(models.PermUsersWrite), handlers.ClearUserDevices)
+			admin.DELETE("/devices/:id", perm(models.PermUsersWrite), handlers.RemoveDevice)
+			admin.POST("/devices/:id/approve", perm(models.PermUsersWrite), handlers.AdminApproveDevice)
+			admin.POST("/devices/:id/deny", perm(models.PermUsersWrite), handlers.AdminDenyDevice)
+			admin.POST("/devices/batch-delete", perm(models.PermUsersWrite), handlers.BatchDeleteDevices)
+			admin.GET("/subscriptions/export", perm(models.PermUsersWrite), handlers.ExportSubscriptions)
+			admin.POST("/subscriptions/batch-clear-devices", perm(models.PermUsersWrite), handlers.BatchClearDevices)
+			admin.POST("/subscriptions/batch-delete", perm(models.PermUsersWrite), handlers.BatchDeleteSubscriptions)
+			admin.POST("/subscriptions/batch-enable", perm(models.PermUsersWrite), handlers.BatchEnableSubscriptions)
+			admin.POST("/subscriptions/batch-disable", perm(models.PermUsersWrite), handlers.BatchDisableSubscriptions)
+			admin.POST("/subscriptions/batch-reset", perm(models.PermUsersWrite), handlers.BatchResetSubscriptions)
+			admin.POST("/subscriptions/batch-send-email", perm(models.PermUsersWrite), handlers.BatchSendAdminSubEmail)
+			admin.GET("/subscriptions/expiring", perm(models.PermUsersRead), handlers.GetExpiringSubscriptions)
+
+			admin.GET("/config-update/status", perm(models.PermNodes), handlers.GetConfigUpdateStatus)
+			admin.GET("/config-update/config", perm(models.PermNodes), handlers.GetConfigUpdateConfig)
+			admin.PUT("/config-update/config", perm(models.PermNodes), handlers.UpdateConfigUpdateConfig)
+			admin.POST("/config-update/start", perm(models.PermNodes), handlers.StartConfigUpdate)
+			admin.POST("/config-update/stop", perm(models.PermNodes), handlers.StopConfigUpdate)
+			admin.POST("/config-update/test", perm(models.PermNodes), handlers.TestConfigUpdate)
+			admin.GET("/config-update/files", perm(models.PermNodes), handlers.GetConfigUpdateFiles)
+			admin.GET("/config-update/logs", perm(models.PermNodes), handlers.GetConfigUpdateLogs)
+			admin.POST("/config-update/logs/clear", perm(models.PermNodes), handlers.ClearConfigUpdateLogs)
+
+			admin.GET("/invites", perm(models.PermUsersRead), handlers.GetAdminInvites)
+			admin.GET("/invite-relations", perm(models.PermUsersRead), handlers.GetAdminInviteRelations)
+			admin.GET("/invite-statistics", perm(models.PermUsersRead), handlers.GetAdminInviteStatistics)
+
+			admin.GET("/user-levels", perm(models.PermUsersRead), handlers.GetAdminUserLevels)
+			admin.POST("/user-levels", perm(models.PermUsersWrite), handlers.CreateUserLevel)
+			admin.PUT("/user-levels/:id", perm(models.PermUsersWrite), handlers.UpdateUserLevel)
+
+			admin.GET("/email-queue", perm(models.PermSettings), handlers.GetAdminEmailQueue)
+			admin.GET("/email-queue/statistics", perm(models.PermSettings), handlers.GetEmailQueueStatistics)
+			admin.GET("/email-queue/:id", perm(models.PermSettings), handlers.GetEmailQueueDetail)
+			admin.DELETE("/email-queue/:id", perm(models.PermSettings), handlers.DeleteEmailFromQueue)
+			admin.POST("/email-queue/:id/retry", perm(models.PermSettings), handlers.RetryEmailFromQueue)
+			admin.POST("/email-queue/clear", perm(models.PermSettings), handlers.ClearEmailQueue)
+
+			admin.GET("/email-config", perm(models.PermSettings), handlers.GetAdminEmailConfig)
+			admin.POST("/email-config", perm(models.PermSettings), handlers.UpdateEmailConfig)
+			admin.GET("/configs", perm(models.PermSettings), handlers.GetSystemConfigs)
+			admin.POST("/configs", perm(models.PermSettings), handlers.CreateSystemConfig)
+			admin.PUT("/configs/:key", perm(models.PermSettings), handlers.UpdateSystemConfig)
+
+			admin.POST("/upload", perm(models.PermSettings), handlers.UploadFile)
+
+			admin.POST("/config-update", perm(models.PermNodes), handlers.UpdateSubscriptionConfig)
+
+			admin.GET("/monitoring/system", perm(models.PermSettings), handlers.GetSystemInfo)
+			admin.GET("/monitoring/database", perm(models.PermSettings), handlers.GetDatabaseStats)
+
+			admin.POST("/backup", perm(models.PermSettings), handlers.CreateBackup)
+			admin.GET("/backups", perm(models.PermSettings), handlers.ListBackups)
+
+			admin.GET("/logs/audit", perm(models.PermLogs), handlers.GetAuditLogs)
+			admin.GET("/logs/audit/verify", perm(models.PermLogs), handlers.VerifyAuditLogs)
+			admin.GET("/logs/audit/anchors", perm(models.PermLogs), handlers.GetAuditLogAnchors)
+			admin.GET("/logs/login-attempts", perm(models.PermLogs), handlers.GetLoginAttempts)
+			admin.GET("/system-logs", perm(models.PermLogs), handlers.GetSystemLogs)
+			admin.GET("/logs-stats", perm(models.PermLogs), handlers.GetLogsStats)
+			admin.GET("/export-logs", perm(models.PermLogs), handlers.ExportLogs)
+			admin.POST("/clear-logs", perm(models.PermLogs), handlers.ClearLogs)
 		}
 	}
 
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// argon2Params argon2id 参数，内存单位为 KiB
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	saltLen int
+	keyLen  uint32
+}
+
+// defaultArgon2Params 参考 OWASP 推荐的最低配置（19 MiB、2 次迭代、单线程）
+var defaultArgon2Params = argon2Params{memory: 19 * 1024, time: 2, threads: 1, saltLen: 16, keyLen: 32}
+
+// hashArgon2id 生成 PHC 格式的哈希：$argon2id$v=19$m=19456,t=2,p=1$salt$hash
+func hashArgon2id(password string, p argon2Params) (string, error) {
+	salt := make([]byte, p.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, p.keyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func parseArgon2id(encoded string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, fmt.Errorf("不是 argon2id 哈希")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("不支持的 argon2 版本")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, fmt.Errorf("argon2 参数错误: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, err
+	}
+	p.saltLen, p.keyLen = len(salt), uint32(len(key))
+	return p, salt, key, nil
+}
+
+func verifyArgon2id(password, encoded string) bool {
+	p, salt, key, err := parseArgon2id(encoded)
+	if err != nil || p.threads == 0 || p.keyLen == 0 {
+		return false
+	}
+	actual := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, p.keyLen)
+	return subtle.ConstantTimeCompare(actual, key) == 1
+}
+
+// NeedsRehash bcrypt 哈希或 argon2id 参数低于当前配置时需要重新哈希
+func NeedsRehash(encoded string) bool {
+	if !strings.HasPrefix(encoded, argon2idPrefix) {
+		return true
+	}
+	p, _, _, err := parseArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	d := defaultArgon2Params
+	return p.memory < d.memory || p.time < d.time || p.threads < d.threads || p.keyLen < d.keyLen
+}
@@ -11,30 +11,32 @@ import (
 	"gorm.io/gorm"
 )
 
+// VerifyPassword 校验密码，同时支持 argon2id 与旧版 bcrypt 哈希
 func VerifyPassword(plainPassword, hashedPassword string) bool {
 	if hashedPassword == "" {
 		return false
 	}
 
+	if strings.HasPrefix(hashedPassword, argon2idPrefix) {
+		return verifyArgon2id(plainPassword, hashedPassword)
+	}
+
 	if len(hashedPassword) < 7 ||
 		(hashedPassword[:4] != "$2a$" && hashedPassword[:4] != "$2b$" && hashedPassword[:4] != "$2y$") {
 		return false
 	}
 
+	// bcrypt 只使用前 72 字节，旧哈希生成时已截断
+	if len(plainPassword) > 72 {
+		plainPassword = plainPassword[:72]
+	}
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainPassword))
 	return err == nil
 }
 
+// HashPassword 使用 argon2id 生成密码哈希
 func HashPassword(password string) (string, error) {
-	if len(password) > 72 {
-		password = password[:72]
-	}
-
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashed), nil
+	return hashArgon2id(password, defaultArgon2Params)
 }
 
 func ValidatePasswordStrength(password string, minLength int) (bool, string) {
@@ -104,5 +106,26 @@ func AuthenticateUser(db *gorm.DB, email, password string) (*models.User, error)
 		return nil, errors.New("用户不存在或密码错误")
 	}
 
+	UpgradePasswordHash(db, &user, password)
 	return &user, nil
 }
+
+// UpgradePasswordHash 登录成功后将 bcrypt 或参数过时的哈希升级为当前的 argon2id 参数，
+// 失败时保留旧哈希，不影响本次登录
+func UpgradePasswordHash(db *gorm.DB, user *models.User, password string) bool {
+	if !NeedsRehash(user.Password) {
+		return false
+	}
+	hashed, err := HashPassword(password)
+	if err != nil {
+		return false
+	}
+	result := db.Model(&models.User{}).
+		Where("id = ? AND password = ?", user.ID, user.Password).
+		Update("password", hashed)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	user.Password = hashed
+	return true
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrBreachCheckUnavailable 泄露密码库读取失败，调用方可选择放行
+var ErrBreachCheckUnavailable = errors.New("泄露密码库不可用")
+
+var (
+	breachDir   string
+	breachDirMu sync.RWMutex
+)
+
+// SetBreachedPasswordDir 设置本地泄露密码库目录，为空时不检查。
+// 目录结构与 Have I Been Pwned 的 range 接口一致：按 SHA-1 前 5 位分文件
+// （ABCDE.txt 或 ABCDE），每行为 "后 35 位:出现次数"
+func SetBreachedPasswordDir(dir string) {
+	breachDirMu.Lock()
+	defer breachDirMu.Unlock()
+	breachDir = strings.TrimSpace(dir)
+}
+
+func breachedPasswordDir() string {
+	breachDirMu.RLock()
+	defer breachDirMu.RUnlock()
+	return breachDir
+}
+
+// BreachedPasswordCount 查询密码在泄露库中出现的次数；未配置密码库时返回 0。
+// 只按哈希前缀读取对应的分片文件，不需要加载整个密码库
+func BreachedPasswordCount(password string) (int, error) {
+	dir := breachedPasswordDir()
+	if dir == "" {
+		return 0, nil
+	}
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := digest[:5], digest[5:]
+
+	f, err := os.Open(filepath.Join(dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(dir, prefix))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		// 分片不存在说明该前缀下没有泄露记录
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrBreachCheckUnavailable, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		hash, count, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(hash, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil || n < 1 {
+			n = 1
+		}
+		return n, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrBreachCheckUnavailable, err)
+	}
+	return 0, nil
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cboard-go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// maxPasswordHistory 历史密码检查上限，每条都要做一次哈希校验
+const maxPasswordHistory = 24
+
+// PasswordPolicy 密码策略，长度取自注册设置，其余取自安全设置
+type PasswordPolicy struct {
+	MinLength        int
+	MinClasses       int  // 大写、小写、数字、特殊字符中至少包含的种类
+	DisallowPersonal bool // 不能包含用户名或邮箱账号
+	HistoryCount     int  // 不能与最近 N 个密码相同（含当前密码），0 为不限制
+	BreachCheck      bool // 检查本地泄露密码库
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{MinLength: 8, MinClasses: 3, DisallowPersonal: true, HistoryCount: 3, BreachCheck: true}
+}
+
+// LoadPasswordPolicy 读取密码策略，未配置的项使用默认值
+func LoadPasswordPolicy(db *gorm.DB) PasswordPolicy {
+	p := DefaultPasswordPolicy()
+	var configs []models.SystemConfig
+	db.Where("(category = ? AND key = ?) OR (category = ? AND key LIKE ?)",
+		"registration", "min_password_length", "security", "password_%").Find(&configs)
+
+	for _, c := range configs {
+		v := strings.TrimSpace(c.Value)
+		switch c.Key {
+		case "min_password_length":
+			if n, err := strconv.Atoi(v); err == nil && n >= 6 {
+				p.MinLength = n
+			}
+		case "password_min_classes":
+			if n, err := strconv.Atoi(v); err == nil && n >= 0 && n <= 4 {
+				p.MinClasses = n
+			}
+		case "password_disallow_personal":
+			p.DisallowPersonal = v != "false"
+		case "password_history_count":
+			if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+				p.HistoryCount = min(n, maxPasswordHistory)
+			}
+		case "password_breach_check":
+			p.BreachCheck = v != "false"
+		}
+	}
+	return p
+}
+
+func passwordClasses(password string) int {
+	var upper, lower, digit, special bool
+	for _, char := range password {
+		switch {
+		case char >= 'A' && char <= 'Z':
+			upper = true
+		case char >= 'a' && char <= 'z':
+			lower = true
+		case char >= '0' && char <= '9':
+			digit = true
+		default:
+			special = true
+		}
+	}
+	n := 0
+	for _, ok := range []bool{upper, lower, digit, special} {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Validate 校验新密码是否符合策略。泄露库不可用时返回 ErrBreachCheckUnavailable，
+// 此时其余规则均已通过
+func (p PasswordPolicy) Validate(password, username, email string) error {
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("密码长度至少%d位", p.MinLength)
+	}
+	if passwordClasses(password) < p.MinClasses {
+		return fmt.Errorf("密码必须包含大写字母、小写字母、数字和特殊字符中的至少%d种", p.MinClasses)
+	}
+
+	lower := strings.ToLower(password)
+	weakPasswords := []string{
+		"password", "123456", "123456789", "qwerty", "abc123",
+		"password123", "admin", "root", "user", "test",
+		"12345678", "password1", "qwerty123", "admin123",
+	}
+	for _, weak := range weakPasswords {
+		if lower == weak {
+			return errors.New("密码过于简单，请使用更复杂的密码")
+		}
+	}
+
+	if p.DisallowPersonal {
+		local, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+		for _, part := range []string{strings.ToLower(strings.TrimSpace(username)), local} {
+			// 过短的用户名容易误伤正常密码
+			if len([]rune(part)) >= 3 && strings.Contains(lower, part) {
+				return errors.New("密码不能包含用户名或邮箱账号")
+			}
+		}
+	}
+
+	if p.BreachCheck {
+		count, err := BreachedPasswordCount(password)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return errors.New("该密码已出现在公开泄露的密码库中，请更换其他密码")
+		}
+	}
+	return nil
+}
+
+// CheckHistory 新密码不能与当前密码及最近使用过的密码相同
+func (p PasswordPolicy) CheckHistory(db *gorm.DB, user *models.User, password string) error {
+	if p.HistoryCount <= 0 || user == nil || user.ID == 0 {
+		return nil
+	}
+	if VerifyPassword(password, user.Password) {
+		return errors.New("新密码不能与当前密码相同")
+	}
+	if p.HistoryCount == 1 {
+		return nil
+	}
+	var history []models.PasswordHistory
+	db.Where("user_id = ?", user.ID).Order("id DESC").Limit(p.HistoryCount - 1).Find(&history)
+	for _, h := range history {
+		if VerifyPassword(password, h.PasswordHash) {
+			return fmt.Errorf("不能使用最近%d次用过的密码", p.HistoryCount)
+		}
+	}
+	return nil
+}
+
+// RecordPasswordHistory 修改密码前保存旧哈希，keep 为需要保留的历史条数（不含当前密码）
+func RecordPasswordHistory(db *gorm.DB, userID uint, oldHash string, keep int) error {
+	if oldHash == "" || keep <= 0 {
+		return nil
+	}
+	if err := db.Create(&models.PasswordHistory{UserID: userID, PasswordHash: oldHash}).Error; err != nil {
+		return err
+	}
+	var ids []uint
+	db.Model(&models.PasswordHistory{}).Where("user_id = ?", userID).Order("id DESC").Pluck("id", &ids)
+	if len(ids) > keep {
+		return db.Where("id IN ?", ids[keep:]).Delete(&models.PasswordHistory{}).Error
+	}
+	return nil
+}
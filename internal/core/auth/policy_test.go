@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cboard-go/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newPolicyTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.SystemConfig{}, &models.PasswordHistory{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestUpgradeBcryptHash(t *testing.T) {
+	db := newPolicyTestDB(t)
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("Legacy#Pass1"), 10)
+	user := models.User{Username: "legacy", Email: "legacy@example.com", Password: string(legacy)}
+	db.Create(&user)
+
+	if !NeedsRehash(user.Password) {
+		t.Fatal("bcrypt hash should need rehash")
+	}
+	got, err := AuthenticateUser(db, "legacy@example.com", "Legacy#Pass1")
+	if err != nil {
+		t.Fatalf("legacy bcrypt login failed: %v", err)
+	}
+	if !strings.HasPrefix(got.Password, argon2idPrefix) || NeedsRehash(got.Password) {
+		t.Fatalf("hash not upgraded: %s", got.Password)
+	}
+	var stored models.User
+	db.First(&stored, user.ID)
+	if stored.Password != got.Password || !VerifyPassword("Legacy#Pass1", stored.Password) {
+		t.Error("upgraded hash not persisted")
+	}
+	if UpgradePasswordHash(db, &stored, "Legacy#Pass1") {
+		t.Error("current argon2id hash should not be rehashed again")
+	}
+
+	weak, _ := hashArgon2id("Legacy#Pass1", argon2Params{memory: 8 * 1024, time: 1, threads: 1, saltLen: 16, keyLen: 32})
+	if !VerifyPassword("Legacy#Pass1", weak) || !NeedsRehash(weak) {
+		t.Error("hash with outdated parameters should verify and need rehash")
+	}
+}
+
+func writeBreachCorpus(t *testing.T, passwords ...string) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, p := range passwords {
+		sum := sha1.Sum([]byte(p))
+		digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+		line := digest[5:] + ":42\r\n"
+		f, err := os.OpenFile(filepath.Join(dir, digest[:5]+".txt"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString("0000000000000000000000000000000000A:1\r\n" + line)
+		f.Close()
+	}
+	SetBreachedPasswordDir(dir)
+	t.Cleanup(func() { SetBreachedPasswordDir("") })
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	writeBreachCorpus(t, "Summer2024!")
+	p := DefaultPasswordPolicy()
+
+	cases := []struct {
+		password string
+		ok       bool
+	}{
+		{"Str0ng#Passw0rd", true},
+		{"Sh0rt!", false},
+		{"alllowercase", false},
+		{"Alice#2024xyz", false},   // 包含用户名
+		{"My-Wonderland-9", false}, // 包含邮箱账号
+		{"Summer2024!", false},     // 出现在泄露库
+	}
+	for _, tc := range cases {
+		err := p.Validate(tc.password, "Alice", "wonderland@example.com")
+		if (err == nil) != tc.ok {
+			t.Errorf("Validate(%q) = %v, want ok=%v", tc.password, err, tc.ok)
+		}
+	}
+
+	p.BreachCheck = false
+	if err := p.Validate("Summer2024!", "bob", "bob@example.com"); err != nil {
+		t.Errorf("breach check disabled: %v", err)
+	}
+
+	if n, err := BreachedPasswordCount("Summer2024!"); err != nil || n != 42 {
+		t.Errorf("BreachedPasswordCount = %d, %v", n, err)
+	}
+}
+
+func TestPasswordHistory(t *testing.T) {
+	db := newPolicyTestDB(t)
+	p := DefaultPasswordPolicy() // 最近 3 个密码
+	hash, _ := HashPassword("First#Pass1")
+	user := models.User{Username: "hist", Email: "hist@example.com", Password: hash}
+	db.Create(&user)
+
+	change := func(password string) error {
+		if err := p.CheckHistory(db, &user, password); err != nil {
+			return err
+		}
+		if err := RecordPasswordHistory(db, user.ID, user.Password, p.HistoryCount-1); err != nil {
+			t.Fatal(err)
+		}
+		user.Password, _ = HashPassword(password)
+		return nil
+	}
+
+	if err := change("First#Pass1"); err == nil {
+		t.Error("reusing the current password should fail")
+	}
+	for _, pw := range []string{"Second#Pass2", "Third#Pass3"} {
+		if err := change(pw); err != nil {
+			t.Fatalf("change to %s: %v", pw, err)
+		}
+	}
+	if err := change("First#Pass1"); err == nil {
+		t.Error("password used 2 changes ago should be rejected")
+	}
+	if err := change("Fourth#Pass4"); err != nil {
+		t.Fatal(err)
+	}
+	// First 已超出最近 3 个密码的范围
+	if err := change("First#Pass1"); err != nil {
+		t.Errorf("old password outside history window should be allowed: %v", err)
+	}
+
+	var count int64
+	db.Model(&models.PasswordHistory{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != int64(p.HistoryCount-1) {
+		t.Errorf("history should be pruned to %d entries, got %d", p.HistoryCount-1, count)
+	}
+}
+
+func TestBreachCorpusUnavailable(t *testing.T) {
+	dir := t.TempDir()
+	sum := sha1.Sum([]byte("whatever"))
+	prefix := strings.ToUpper(hex.EncodeToString(sum[:]))[:5]
+	// 分片是目录时无法读取
+	os.Mkdir(filepath.Join(dir, prefix+".txt"), 0o755)
+	SetBreachedPasswordDir(dir)
+	defer SetBreachedPasswordDir("")
+
+	if _, err := BreachedPasswordCount("whatever"); !errors.Is(err, ErrBreachCheckUnavailable) {
+		t.Errorf("expected ErrBreachCheckUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 的 SHA1 测试向量（取后 6 位）
+func TestTOTPCodeRFC6238(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for ts, want := range cases {
+		got, err := TOTPCode(secret, TOTPCounter(time.Unix(ts, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("T=%d: got %s, want %s", ts, got, want)
+		}
+	}
+}
+
+func TestVerifyTOTPSkewAndReplay(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	prev, _ := TOTPCode(secret, TOTPCounter(now)-1)
+
+	counter, ok := VerifyTOTP(secret, prev, now, 0)
+	if !ok || counter != TOTPCounter(now)-1 {
+		t.Fatalf("previous step should be accepted within skew")
+	}
+	if _, ok := VerifyTOTP(secret, prev, now, counter); ok {
+		t.Fatal("a used code must not be accepted again")
+	}
+
+	old, _ := TOTPCode(secret, TOTPCounter(now)-3)
+	if _, ok := VerifyTOTP(secret, old, now, 0); ok {
+		t.Fatal("code outside the skew window must be rejected")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("expected %d codes, got %d", RecoveryCodeCount, len(codes))
+	}
+	seen := make(map[string]bool)
+	for _, c := range codes {
+		if seen[c] {
+			t.Fatalf("duplicate recovery code %s", c)
+		}
+		seen[c] = true
+	}
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))+" ") {
+		t.Fatal("recovery code hash should ignore case, dashes and spaces")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("CBoard", "user@example.com", "ABCDEF")
+	if !strings.HasPrefix(uri, "otpauth://totp/CBoard:user@example.com?") || !strings.Contains(uri, "secret=ABCDEF") {
+		t.Fatalf("unexpected uri %s", uri)
+	}
+}
@@ -57,6 +57,11 @@ type Config struct {
 	AliyunSMSSignName          string
 	AliyunSMSTemplateCode      string
 	DeviceUpgradePricePerMonth float64 // 设备升级价格（每月）
+	StateStore                 string  // 限流与 CSRF 状态存储：memory、database、redis
+	RedisURL                   string
+	BreachedPasswordsDir       string   // 本地泄露密码库目录（HIBP range 文件格式），为空时不检查
+	SecretsMasterKey           string   // 支付密钥、SMTP 密码等敏感配置的加密主密钥
+	SecretsPreviousKeys        []string // 轮换前使用过的主密钥，仅用于解密
 }
 
 var AppConfig *Config
@@ -132,6 +137,11 @@ func LoadConfig() (*Config, error) {
 		AliyunSMSSignName:          getString("ALIYUN_SMS_SIGN_NAME", ""),
 		AliyunSMSTemplateCode:      getString("ALIYUN_SMS_TEMPLATE_CODE", ""),
 		DeviceUpgradePricePerMonth: getFloat64("DEVICE_UPGRADE_PRICE_PER_MONTH", 10.0),
+		StateStore:                 getString("STATE_STORE", "memory"),
+		RedisURL:                   getString("REDIS_URL", ""),
+		BreachedPasswordsDir:       getString("BREACHED_PASSWORDS_DIR", ""),
+		SecretsMasterKey:           getString("SECRETS_MASTER_KEY", ""),
+		SecretsPreviousKeys:        getStringSlice("SECRETS_PREVIOUS_KEYS", nil),
 	}
 
 	if err := validateConfig(config); err != nil {
@@ -196,6 +196,8 @@ func AutoMigrate() error {
 		&models.Subscription{},
 		&models.Device{},
 		&models.SubscriptionReset{},
+		&models.SubscriptionFetch{},
+		&models.SharingScore{},
 		&models.Order{},
 		&models.Package{},
 		&models.PaymentTransaction{},
@@ -205,6 +207,8 @@ func AutoMigrate() error {
 		&models.SystemConfig{},
 		&models.CustomNode{},
 		&models.UserCustomNode{},
+		&models.NodePanel{},
+		&models.RealityKey{},
 		&models.Notification{},
 		&models.EmailQueue{},
 		&models.EmailTemplate{},
@@ -221,7 +225,21 @@ func AutoMigrate() error {
 		&models.VerificationCode{},
 		&models.UserActivity{},
 		&models.LoginHistory{},
+		&models.RecoveryCode{},
+		&models.WebAuthnCredential{},
+		&models.OAuthIdentity{},
+		&models.UserSession{},
+		&models.Role{},
+		&models.APIKey{},
+		&models.KVEntry{},
+		&models.PasswordHistory{},
+		&models.AccessRule{},
+		&models.LoginRiskEvent{},
+		&models.DataExport{},
+		&models.AccountDeletionRequest{},
 		&models.AuditLog{},
+		&models.AuditLogAnchor{},
+		&models.AuditChainLock{},
 		&models.TokenBlacklist{},
 	)
 
@@ -234,6 +252,7 @@ func AutoMigrate() error {
 	}
 
 	initDefaultPackages()
+	initDefaultRoles()
 
 	log.Println("数据库迁移成功")
 	return nil
@@ -291,6 +310,19 @@ func initDefaultPackages() {
 	}
 }
 
+func initDefaultRoles() {
+	var count int64
+	DB.Model(&models.Role{}).Count(&count)
+	if count > 0 {
+		return
+	}
+	support := models.Role{Name: "客服", Description: "处理工单，查看用户与订阅", IsSystem: true}
+	support.SetPermissions([]string{models.PermTickets, models.PermUsersRead})
+	if err := DB.Create(&support).Error; err != nil {
+		log.Printf("创建默认角色失败: %v", err)
+	}
+}
+
 func GetDB() *gorm.DB {
 	return DB
 }
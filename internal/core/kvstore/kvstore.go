@@ -0,0 +1,89 @@
+package kvstore
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Store 限流计数、CSRF 令牌等短期状态的存储。
+// 单实例可用内存，多实例部署需使用数据库或 Redis 共享状态
+type Store interface {
+	// Get 读取未过期的值，计数器返回十进制字符串
+	Get(key string) (value string, expiresAt time.Time, found bool, err error)
+	Set(key, value string, ttl time.Duration) error
+	// Incr 计数加一；键不存在或已过期时从 1 开始并在 window 后过期，后续递增不延长过期时间
+	Incr(key string, window time.Duration) (count int64, expiresAt time.Time, err error)
+	Delete(keys ...string) error
+}
+
+const (
+	KindMemory   = "memory"
+	KindDatabase = "database"
+	KindRedis    = "redis"
+)
+
+var (
+	defaultStore Store = NewMemoryStore()
+	mu           sync.RWMutex
+)
+
+// Default 当前使用的存储，未配置时为进程内存
+func Default() Store {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultStore
+}
+
+func SetDefault(s Store) {
+	mu.Lock()
+	defer mu.Unlock()
+	defaultStore = s
+}
+
+// Take 取出一次性的值（授权 state、验证会话等）。
+// 多个实例同时取同一个键时通过计数保证只有一个成功
+func Take(s Store, key string) (string, bool, error) {
+	value, expiresAt, found, err := s.Get(key)
+	if err != nil || !found {
+		return "", false, err
+	}
+	ttl := time.Until(expiresAt)
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	n, _, err := s.Incr(key+":taken", ttl)
+	if err != nil {
+		return "", false, err
+	}
+	if n > 1 {
+		return "", false, nil
+	}
+	if err := s.Delete(key); err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// Open 按配置创建存储
+func Open(kind, redisURL string, db *gorm.DB) (Store, error) {
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "", KindMemory:
+		return NewMemoryStore(), nil
+	case KindDatabase, "db", "sql":
+		if db == nil {
+			return nil, fmt.Errorf("数据库未初始化")
+		}
+		return NewSQLStore(db), nil
+	case KindRedis:
+		if redisURL == "" {
+			return nil, fmt.Errorf("未配置 REDIS_URL")
+		}
+		return NewRedisStore(redisURL)
+	default:
+		return nil, fmt.Errorf("不支持的状态存储类型: %s", kind)
+	}
+}
@@ -0,0 +1,293 @@
+package kvstore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cboard-go/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeRedis 本地 RESP 服务，实现存储用到的命令，行为与 Redis 一致
+type fakeRedis struct {
+	mu       sync.Mutex
+	values   map[string]string
+	expiry   map[string]time.Time
+	password string
+	ln       net.Listener
+}
+
+func startFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{values: map[string]string{}, expiry: map[string]time.Time{}, password: password, ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		if cmd == "AUTH" {
+			if args[len(args)-1] == f.password {
+				authed = true
+				io.WriteString(conn, "+OK\r\n")
+			} else {
+				io.WriteString(conn, "-WRONGPASS invalid password\r\n")
+			}
+			continue
+		}
+		if !authed {
+			io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		io.WriteString(conn, f.exec(cmd, args[1:]))
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (f *fakeRedis) exec(cmd string, args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for k, exp := range f.expiry {
+		if !time.Now().Before(exp) {
+			delete(f.values, k)
+			delete(f.expiry, k)
+		}
+	}
+	switch cmd {
+	case "PING":
+		return "+PONG\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		v, ok := f.values[args[0]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case "SET":
+		px := len(args) == 4 && strings.ToUpper(args[2]) == "PX"
+		ms, _ := strconv.Atoi(args[len(args)-1])
+		if px && ms <= 0 {
+			return "-ERR invalid expire time in 'set' command\r\n"
+		}
+		f.values[args[0]] = args[1]
+		delete(f.expiry, args[0])
+		if px {
+			f.expiry[args[0]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return "+OK\r\n"
+	case "INCR":
+		n, err := strconv.ParseInt(f.values[args[0]], 10, 64)
+		if _, exists := f.values[args[0]]; exists && err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		n++
+		f.values[args[0]] = strconv.FormatInt(n, 10)
+		return fmt.Sprintf(":%d\r\n", n)
+	case "PTTL":
+		if _, ok := f.values[args[0]]; !ok {
+			return ":-2\r\n"
+		}
+		exp, ok := f.expiry[args[0]]
+		if !ok {
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", time.Until(exp).Milliseconds())
+	case "PEXPIRE":
+		if _, ok := f.values[args[0]]; !ok {
+			return ":0\r\n"
+		}
+		ms, _ := strconv.Atoi(args[1])
+		f.expiry[args[0]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return ":1\r\n"
+	case "DEL":
+		n := 0
+		for _, k := range args {
+			if _, ok := f.values[k]; ok {
+				n++
+			}
+			delete(f.values, k)
+			delete(f.expiry, k)
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	}
+	return "-ERR unknown command '" + cmd + "'\r\n"
+}
+
+func newSQLTestStore(t *testing.T) *SQLStore {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&models.KVEntry{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return NewSQLStore(db)
+}
+
+func backends(t *testing.T) map[string]Store {
+	fake := startFakeRedis(t, "s3cret")
+	redisStore, err := NewRedisStore("redis://:s3cret@" + fake.ln.Addr().String() + "/1")
+	if err != nil {
+		t.Fatalf("connect fake redis: %v", err)
+	}
+	return map[string]Store{
+		KindMemory:   NewMemoryStore(),
+		KindDatabase: newSQLTestStore(t),
+		KindRedis:    redisStore,
+	}
+}
+
+func TestStoreBackends(t *testing.T) {
+	for name, store := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, _, found, err := store.Get("missing"); err != nil || found {
+				t.Fatalf("missing key: found=%v err=%v", found, err)
+			}
+
+			if err := store.Set("csrf:abc", "token-1", time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			v, exp, found, err := store.Get("csrf:abc")
+			if err != nil || !found || v != "token-1" {
+				t.Fatalf("get = %q %v %v", v, found, err)
+			}
+			if d := time.Until(exp); d < 59*time.Minute || d > time.Hour+time.Second {
+				t.Errorf("unexpected expiry in %v", d)
+			}
+
+			var last time.Time
+			for i := int64(1); i <= 3; i++ {
+				n, exp, err := store.Incr("rl:login:1.2.3.4", time.Minute)
+				if err != nil || n != i {
+					t.Fatalf("incr #%d = %d, %v", i, n, err)
+				}
+				if i > 1 && exp.Sub(last).Abs() > time.Second {
+					t.Errorf("window must not slide: %v -> %v", last, exp)
+				}
+				last = exp
+			}
+			if v, _, _, _ := store.Get("rl:login:1.2.3.4"); v != "3" {
+				t.Errorf("counter read back as %q", v)
+			}
+
+			if err := store.Delete("rl:login:1.2.3.4", "csrf:abc"); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, found, _ := store.Get("csrf:abc"); found {
+				t.Error("deleted key still present")
+			}
+			if n, _, _ := store.Incr("rl:login:1.2.3.4", time.Minute); n != 1 {
+				t.Errorf("counter should restart after delete, got %d", n)
+			}
+
+			store.Set("state:1", "payload", time.Minute)
+			if v, ok, err := Take(store, "state:1"); err != nil || !ok || v != "payload" {
+				t.Fatalf("take = %q %v %v", v, ok, err)
+			}
+			if _, ok, _ := Take(store, "state:1"); ok {
+				t.Error("value must only be taken once")
+			}
+
+			// 过期后从 1 重新计数
+			store.Incr("short", 50*time.Millisecond)
+			store.Incr("short", 50*time.Millisecond)
+			time.Sleep(80 * time.Millisecond)
+			if n, _, _ := store.Incr("short", time.Minute); n != 1 {
+				t.Errorf("expired counter should restart, got %d", n)
+			}
+			store.Set("gone", "x", 30*time.Millisecond)
+			time.Sleep(50 * time.Millisecond)
+			if _, _, found, _ := store.Get("gone"); found {
+				t.Error("expired value still returned")
+			}
+			for _, ttl := range []time.Duration{0, 500 * time.Microsecond} {
+				if err := store.Set("instant", "x", ttl); err != nil {
+					t.Fatalf("set with ttl %v: %v", ttl, err)
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			if _, _, found, _ := store.Get("instant"); found {
+				t.Error("value with sub-millisecond ttl should expire immediately")
+			}
+		})
+	}
+}
+
+func TestRedisAuthFailure(t *testing.T) {
+	fake := startFakeRedis(t, "s3cret")
+	if _, err := NewRedisStore("redis://:wrong@" + fake.ln.Addr().String()); err == nil {
+		t.Fatal("wrong password should fail to connect")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if s, err := Open("", "", nil); err != nil || s == nil {
+		t.Fatalf("default should be memory store: %v", err)
+	}
+	if _, err := Open("database", "", nil); err == nil {
+		t.Error("database store without db should fail")
+	}
+	if _, err := Open("redis", "", nil); err == nil {
+		t.Error("redis store without url should fail")
+	}
+	if _, err := Open("memcached", "", nil); err == nil {
+		t.Error("unknown kind should fail")
+	}
+}
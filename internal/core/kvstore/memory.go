@@ -0,0 +1,93 @@
+package kvstore
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	value     string
+	counter   int64
+	isCounter bool
+	expiresAt time.Time
+}
+
+// MemoryStore 进程内存存储，重启后清空，不能在多个实例间共享
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{entries: make(map[string]*memoryEntry)}
+	go s.cleanup()
+	return s
+}
+
+func (s *MemoryStore) cleanup() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		now := time.Now()
+		for key, e := range s.entries {
+			if !now.Before(e.expiresAt) {
+				delete(s.entries, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// live 未过期的条目，调用方需持有锁
+func (s *MemoryStore) live(key string, now time.Time) *memoryEntry {
+	e, ok := s.entries[key]
+	if !ok || !now.Before(e.expiresAt) {
+		return nil
+	}
+	return e
+}
+
+func (s *MemoryStore) Get(key string) (string, time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.live(key, time.Now())
+	if e == nil {
+		return "", time.Time{}, false, nil
+	}
+	if e.isCounter {
+		return strconv.FormatInt(e.counter, 10), e.expiresAt, true, nil
+	}
+	return e.value, e.expiresAt, true, nil
+}
+
+func (s *MemoryStore) Set(key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = &memoryEntry{value: value, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Incr(key string, window time.Duration) (int64, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	e := s.live(key, now)
+	if e == nil || !e.isCounter {
+		e = &memoryEntry{isCounter: true, expiresAt: now.Add(window)}
+		s.entries[key] = e
+	}
+	e.counter++
+	return e.counter, e.expiresAt, nil
+}
+
+func (s *MemoryStore) Delete(keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
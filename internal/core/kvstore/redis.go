@@ -0,0 +1,295 @@
+package kvstore
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	redisKeyPrefix   = "cboard:"
+	redisPoolSize    = 8
+	redisDialTimeout = 5 * time.Second
+	redisIOTimeout   = 3 * time.Second
+)
+
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// RedisStore 基于 RESP 协议的最小客户端，只实现本存储需要的命令，
+// 兼容 Redis、KeyDB、Valkey 等服务
+type RedisStore struct {
+	addr     string
+	useTLS   bool
+	username string
+	password string
+	db       int
+	pool     chan *redisConn
+}
+
+// NewRedisStore 解析 redis://[user:password@]host:port[/db]，rediss:// 使用 TLS
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("REDIS_URL 格式错误: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("REDIS_URL 仅支持 redis:// 或 rediss://")
+	}
+	s := &RedisStore{
+		addr:   u.Host,
+		useTLS: u.Scheme == "rediss",
+		pool:   make(chan *redisConn, redisPoolSize),
+	}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			s.username, s.password = u.User.Username(), password
+		} else {
+			// redis://password@host 视为只有密码
+			s.password = u.User.Username()
+		}
+	}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if s.db, err = strconv.Atoi(path); err != nil {
+			return nil, fmt.Errorf("REDIS_URL 数据库编号错误: %s", path)
+		}
+	}
+	if _, err := s.do("PING"); err != nil {
+		return nil, fmt.Errorf("连接 Redis 失败: %w", err)
+	}
+	return s, nil
+}
+
+func (s *RedisStore) dial() (*redisConn, error) {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: redisDialTimeout}
+	if s.useTLS {
+		host, _, _ := net.SplitHostPort(s.addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", s.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+	if s.password != "" {
+		args := []string{"AUTH", s.password}
+		if s.username != "" {
+			args = []string{"AUTH", s.username, s.password}
+		}
+		if _, err := c.roundTrip([][]string{args}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if s.db != 0 {
+		if _, err := c.roundTrip([][]string{{"SELECT", strconv.Itoa(s.db)}}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (s *RedisStore) get() (*redisConn, error) {
+	select {
+	case c := <-s.pool:
+		return c, nil
+	default:
+		return s.dial()
+	}
+}
+
+func (s *RedisStore) put(c *redisConn) {
+	select {
+	case s.pool <- c:
+	default:
+		c.conn.Close()
+	}
+}
+
+// pipeline 一次发送多条命令并按顺序读取回复
+func (s *RedisStore) pipeline(cmds ...[]string) ([]interface{}, error) {
+	c, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	replies, err := c.roundTrip(cmds)
+	var re redisError
+	if err != nil && !errors.As(err, &re) {
+		// 网络错误时丢弃连接
+		c.conn.Close()
+		return nil, err
+	}
+	s.put(c)
+	return replies, err
+}
+
+func (s *RedisStore) do(args ...string) (interface{}, error) {
+	replies, err := s.pipeline(args)
+	if err != nil {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+func (c *redisConn) roundTrip(cmds [][]string) ([]interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(redisIOTimeout))
+	var buf strings.Builder
+	for _, args := range cmds {
+		fmt.Fprintf(&buf, "*%d\r\n", len(args))
+		for _, a := range args {
+			fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(a), a)
+		}
+	}
+	if _, err := io.WriteString(c.conn, buf.String()); err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, 0, len(cmds))
+	var firstErr error
+	for range cmds {
+		reply, err := readReply(c.r)
+		var re redisError
+		if err != nil && !errors.As(err, &re) {
+			return nil, err
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		replies = append(replies, reply)
+	}
+	return replies, firstErr
+}
+
+// readReply 解析一条 RESP 回复：字符串、错误、整数、批量字符串、数组
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: 空回复")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil // 键不存在
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		items := make([]interface{}, 0, max(n, 0))
+		for i := 0; i < n; i++ {
+			item, err := readReply(r)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: 无法解析的回复 %q", line)
+	}
+}
+
+func ttlExpiry(reply interface{}, now time.Time) (time.Time, bool) {
+	ms, ok := reply.(int64)
+	if !ok || ms < 0 {
+		return time.Time{}, false
+	}
+	return now.Add(time.Duration(ms) * time.Millisecond), true
+}
+
+func (s *RedisStore) Get(key string) (string, time.Time, bool, error) {
+	now := time.Now()
+	replies, err := s.pipeline([]string{"GET", redisKeyPrefix + key}, []string{"PTTL", redisKeyPrefix + key})
+	if err != nil {
+		return "", time.Time{}, false, err
+	}
+	value, ok := replies[0].(string)
+	if !ok {
+		return "", time.Time{}, false, nil
+	}
+	expiresAt, _ := ttlExpiry(replies[1], now)
+	return value, expiresAt, true, nil
+}
+
+func (s *RedisStore) Set(key, value string, ttl time.Duration) error {
+	// Redis 拒绝 PX 0，不足 1ms 的过期时间按 1ms 处理，与其他存储一样视为立即过期
+	ms := ttl.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	_, err := s.do("SET", redisKeyPrefix+key, value, "PX", strconv.FormatInt(ms, 10))
+	return err
+}
+
+func (s *RedisStore) Incr(key string, window time.Duration) (int64, time.Time, error) {
+	now := time.Now()
+	k := redisKeyPrefix + key
+	replies, err := s.pipeline([]string{"INCR", k}, []string{"PTTL", k})
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	count, ok := replies[0].(int64)
+	if !ok {
+		return 0, time.Time{}, fmt.Errorf("redis: INCR 返回了非整数")
+	}
+	expiresAt, ok := ttlExpiry(replies[1], now)
+	if !ok {
+		// 新建的计数器（或上次设置过期时间失败）补上过期时间
+		if _, err := s.do("PEXPIRE", k, strconv.FormatInt(window.Milliseconds(), 10)); err != nil {
+			return 0, time.Time{}, err
+		}
+		expiresAt = now.Add(window)
+	}
+	return count, expiresAt, nil
+}
+
+func (s *RedisStore) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	args := []string{"DEL"}
+	for _, key := range keys {
+		args = append(args, redisKeyPrefix+key)
+	}
+	_, err := s.do(args...)
+	return err
+}
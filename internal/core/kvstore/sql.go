@@ -0,0 +1,103 @@
+package kvstore
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"cboard-go/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SQLStore 使用业务数据库的 kv_entries 表，多个实例共享同一数据库即可共享状态
+type SQLStore struct {
+	db *gorm.DB
+}
+
+func NewSQLStore(db *gorm.DB) *SQLStore {
+	s := &SQLStore{db: db}
+	go s.cleanup()
+	return s
+}
+
+func (s *SQLStore) cleanup() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.db.Where("expires_at <= ?", time.Now().UTC()).Delete(&models.KVEntry{})
+	}
+}
+
+func (s *SQLStore) Get(key string) (string, time.Time, bool, error) {
+	var e models.KVEntry
+	err := s.db.Where("store_key = ? AND expires_at > ?", key, time.Now().UTC()).First(&e).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", time.Time{}, false, nil
+	}
+	if err != nil {
+		return "", time.Time{}, false, err
+	}
+	if e.Value == "" && e.Counter > 0 {
+		return strconv.FormatInt(e.Counter, 10), e.ExpiresAt, true, nil
+	}
+	return e.Value, e.ExpiresAt, true, nil
+}
+
+func (s *SQLStore) Set(key, value string, ttl time.Duration) error {
+	e := models.KVEntry{StoreKey: key, Value: value, ExpiresAt: time.Now().UTC().Add(ttl)}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "store_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "counter", "expires_at"}),
+	}).Create(&e).Error
+}
+
+// Incr 先尝试对未过期的计数加一；没有则插入，已过期则重置。
+// 每一步都是单条带条件的语句，多个实例并发时不会丢失计数
+func (s *SQLStore) Incr(key string, window time.Duration) (int64, time.Time, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		now := time.Now().UTC()
+		result := s.db.Model(&models.KVEntry{}).
+			Where("store_key = ? AND expires_at > ?", key, now).
+			Update("counter", gorm.Expr("counter + 1"))
+		if result.Error != nil {
+			return 0, time.Time{}, result.Error
+		}
+		if result.RowsAffected == 0 {
+			fresh := map[string]interface{}{"value": "", "counter": 1, "expires_at": now.Add(window)}
+			result = s.db.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&models.KVEntry{StoreKey: key, Counter: 1, ExpiresAt: now.Add(window)})
+			if result.Error != nil {
+				return 0, time.Time{}, result.Error
+			}
+			if result.RowsAffected == 0 {
+				result = s.db.Model(&models.KVEntry{}).
+					Where("store_key = ? AND expires_at <= ?", key, now).
+					Updates(fresh)
+				if result.Error != nil {
+					return 0, time.Time{}, result.Error
+				}
+				if result.RowsAffected == 0 {
+					// 其他实例刚刚插入或重置，重新递增
+					continue
+				}
+			}
+		}
+		var e models.KVEntry
+		if err := s.db.Where("store_key = ?", key).First(&e).Error; err != nil {
+			return 0, time.Time{}, err
+		}
+		return e.Counter, e.ExpiresAt, nil
+	}
+	return 0, time.Time{}, fmt.Errorf("计数更新冲突: %s", key)
+}
+
+func (s *SQLStore) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.db.Where("store_key IN ?", keys).Delete(&models.KVEntry{}).Error
+}
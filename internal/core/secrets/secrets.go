@@ -0,0 +1,239 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// 支付密钥、SMTP 密码等敏感配置的信封加密：每个值使用随机数据密钥（DEK）加密，
+// DEK 再由主密钥派生的密钥加密（KEK）后与密文一起保存。
+// 格式 enc:v1:<主密钥ID>:<加密后的DEK>:<密文>，主密钥ID 用于轮换后找到解密所需的旧密钥
+
+const prefix = "enc:v1:"
+
+// MinKeyLength 主密钥最短长度
+const MinKeyLength = 16
+
+// maskPrefix 脱敏值的前缀，管理端原样提交时表示未修改
+const maskPrefix = "******"
+
+var (
+	ErrNoMasterKey = errors.New("未配置 SECRETS_MASTER_KEY，无法解密已加密的配置")
+	ErrUnknownKey  = errors.New("找不到加密该配置的主密钥，请将旧密钥加入 SECRETS_PREVIOUS_KEYS")
+	ErrMalformed   = errors.New("加密配置格式错误")
+)
+
+type keyring struct {
+	currentID string
+	keys      map[string][]byte
+}
+
+var (
+	mu   sync.RWMutex
+	ring *keyring
+)
+
+func deriveKey(master string) (string, []byte) {
+	key := sha256.Sum256([]byte(master))
+	id := sha256.Sum256(key[:])
+	return hex.EncodeToString(id[:4]), key[:]
+}
+
+// Configure 设置当前主密钥与轮换前的旧密钥。master 为空时不加密，已有明文配置照常读取
+func Configure(master string, previous []string) error {
+	master = strings.TrimSpace(master)
+	if master == "" {
+		mu.Lock()
+		ring = nil
+		mu.Unlock()
+		return nil
+	}
+	if len(master) < MinKeyLength {
+		return fmt.Errorf("SECRETS_MASTER_KEY 长度不能少于 %d 个字符", MinKeyLength)
+	}
+
+	r := &keyring{keys: make(map[string][]byte)}
+	id, key := deriveKey(master)
+	r.currentID = id
+	r.keys[id] = key
+	for _, old := range previous {
+		if old = strings.TrimSpace(old); old != "" {
+			oldID, oldKey := deriveKey(old)
+			if _, exists := r.keys[oldID]; !exists {
+				r.keys[oldID] = oldKey
+			}
+		}
+	}
+
+	mu.Lock()
+	ring = r
+	mu.Unlock()
+	return nil
+}
+
+// Enabled 是否已配置主密钥
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return ring != nil
+}
+
+// SealGCM 使用 AES-GCM 加密，返回 nonce 与密文拼接后的结果
+func SealGCM(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("创建AES cipher失败: %w", err)
+	}
+	aesGCM, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("创建GCM失败: %w", err)
+	}
+	nonce := make([]byte, aesGCM.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("生成nonce失败: %w", err)
+	}
+	return aesGCM.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// OpenGCM 解密 SealGCM 的结果
+func OpenGCM(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("创建AES cipher失败: %w", err)
+	}
+	aesGCM, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("创建GCM失败: %w", err)
+	}
+	nonceSize := aesGCM.NonceSize()
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("密文太短")
+	}
+	plaintext, err := aesGCM.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("解密失败: %w", err)
+	}
+	return plaintext, nil
+}
+
+// IsEncrypted 是否为本包加密的值
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt 加密敏感值。空值、已加密的值原样返回；未配置主密钥时返回明文
+func Encrypt(plaintext string) (string, error) {
+	if plaintext == "" || IsEncrypted(plaintext) {
+		return plaintext, nil
+	}
+	mu.RLock()
+	r := ring
+	mu.RUnlock()
+	if r == nil {
+		return plaintext, nil
+	}
+
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return "", fmt.Errorf("生成数据密钥失败: %w", err)
+	}
+	ciphertext, err := SealGCM(dek, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := SealGCM(r.keys[r.currentID], dek)
+	if err != nil {
+		return "", err
+	}
+	return prefix + r.currentID + ":" + base64.StdEncoding.EncodeToString(wrapped) + ":" +
+		base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+func parse(value string) (id string, wrapped, ciphertext []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, ErrMalformed
+	}
+	if wrapped, err = base64.StdEncoding.DecodeString(parts[1]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	if ciphertext, err = base64.StdEncoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	return parts[0], wrapped, ciphertext, nil
+}
+
+// Decrypt 解密敏感值，未加密的历史明文原样返回
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	id, wrapped, ciphertext, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	mu.RLock()
+	r := ring
+	mu.RUnlock()
+	if r == nil {
+		return "", ErrNoMasterKey
+	}
+	kek, ok := r.keys[id]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+	dek, err := OpenGCM(kek, wrapped)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := OpenGCM(dek, ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation 值是否需要用当前主密钥重新加密（明文或由旧密钥加密）
+func NeedsRotation(value string) bool {
+	if value == "" {
+		return false
+	}
+	mu.RLock()
+	r := ring
+	mu.RUnlock()
+	if r == nil {
+		return false
+	}
+	if !IsEncrypted(value) {
+		return true
+	}
+	id, _, _, err := parse(value)
+	return err == nil && id != r.currentID
+}
+
+// Mask 管理端展示用的脱敏值，只保留末 4 位
+func Mask(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	r := []rune(value)
+	if len(r) < 12 {
+		return maskPrefix
+	}
+	return maskPrefix + string(r[len(r)-4:])
+}
+
+// IsMasked 提交的值是否为 Mask 生成的脱敏值
+func IsMasked(value string) bool {
+	return strings.HasPrefix(value, maskPrefix)
+}
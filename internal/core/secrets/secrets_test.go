@@ -0,0 +1,87 @@
+package secrets
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	if err := Configure("current-master-key-0001", nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Configure("", nil) })
+
+	enc, err := Encrypt("smtp-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(enc) || strings.Contains(enc, "smtp-password") {
+		t.Fatalf("not encrypted: %s", enc)
+	}
+	other, _ := Encrypt("smtp-password")
+	if other == enc {
+		t.Fatal("each value should use a fresh data key")
+	}
+	if again, _ := Encrypt(enc); again != enc {
+		t.Fatal("encrypted value should not be encrypted twice")
+	}
+	if plain, err := Decrypt(enc); err != nil || plain != "smtp-password" {
+		t.Fatalf("decrypt: %q %v", plain, err)
+	}
+	// 历史明文原样返回
+	if plain, err := Decrypt("legacy"); err != nil || plain != "legacy" {
+		t.Fatalf("legacy: %q %v", plain, err)
+	}
+	if empty, _ := Encrypt(""); empty != "" {
+		t.Fatal("empty value should stay empty")
+	}
+
+	tampered := enc[:len(enc)-4] + "AAA="
+	if _, err := Decrypt(tampered); err == nil {
+		t.Fatal("tampered value should not decrypt")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	t.Cleanup(func() { Configure("", nil) })
+	Configure("old-master-key-00001", nil)
+	old, _ := Encrypt("alipay-private-key")
+
+	Configure("new-master-key-00001", nil)
+	if _, err := Decrypt(old); err != ErrUnknownKey {
+		t.Fatalf("old key not configured: %v", err)
+	}
+
+	Configure("new-master-key-00001", []string{"old-master-key-00001"})
+	if plain, err := Decrypt(old); err != nil || plain != "alipay-private-key" {
+		t.Fatalf("decrypt with previous key: %q %v", plain, err)
+	}
+	if !NeedsRotation(old) || !NeedsRotation("plaintext") {
+		t.Fatal("old and plaintext values need rotation")
+	}
+	rotated, _ := Encrypt("alipay-private-key")
+	if NeedsRotation(rotated) {
+		t.Fatal("value encrypted with current key needs no rotation")
+	}
+
+	Configure("", nil)
+	if _, err := Decrypt(rotated); err != ErrNoMasterKey {
+		t.Fatalf("without master key: %v", err)
+	}
+	if plain, _ := Encrypt("x"); plain != "x" {
+		t.Fatal("without master key values are stored as is")
+	}
+	if err := Configure("short", nil); err == nil {
+		t.Fatal("short master key should be rejected")
+	}
+}
+
+func TestMask(t *testing.T) {
+	if Mask("") != "" || Mask("short") != "******" {
+		t.Fatal("mask short values")
+	}
+	masked := Mask("sk_live_1234567890abcd\n")
+	if masked != "******abcd" || !IsMasked(masked) || IsMasked("sk_live_1234") {
+		t.Fatalf("mask: %s", masked)
+	}
+}
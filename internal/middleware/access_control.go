@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/core/kvstore"
+	"cboard-go/internal/services/ipaccess"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessLogInterval 同一 IP 命中同一条拒绝规则时，安全日志的最小记录间隔
+const accessLogInterval = 10 * time.Minute
+
+// AccessControlMiddleware 按 IP、国家、ASN 规则限制访问，scope 为路由组对应的作用范围。
+// 规则读取失败时放行
+func AccessControlMiddleware(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := utils.GetRealClientIP(c)
+		if ip == "" {
+			ip = c.ClientIP()
+		}
+
+		decision, err := ipaccess.Evaluate(database.GetDB(), scope, ip)
+		if err != nil {
+			utils.LogError("AccessControlMiddleware: 读取访问规则失败", err, map[string]interface{}{"scope": scope})
+		}
+		if decision.Allowed {
+			c.Next()
+			return
+		}
+
+		rule := decision.Rule
+		logKey := fmt.Sprintf("access:logged:%d:%s", rule.ID, ip)
+		if n, _, err := kvstore.Default().Incr(logKey, accessLogInterval); err != nil || n == 1 {
+			utils.CreateSecurityLog(c, "access_denied", "MEDIUM",
+				fmt.Sprintf("访问被拒绝: IP %s 命中规则 #%d (%s %s)", ip, rule.ID, rule.Type, rule.Value),
+				map[string]interface{}{
+					"ip":      ip,
+					"scope":   scope,
+					"path":    c.Request.URL.Path,
+					"rule_id": rule.ID,
+					"type":    rule.Type,
+					"value":   rule.Value,
+					"country": decision.Country,
+					"asn":     decision.ASN,
+				})
+		}
+
+		utils.ErrorResponse(c, http.StatusForbidden, "当前网络或地区无法访问该服务", nil)
+		c.Abort()
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// permissionHandlerName RequirePermission 生成的处理函数名称，用于判断路由是否声明了权限
+var permissionHandlerName = runtime.FuncForPC(reflect.ValueOf(RequirePermission("")).Pointer()).Name()
+
+// hasPermissionCheck API 密钥只能访问声明了权限的后台接口，个人资料、改密等接口一律拒绝
+func hasPermissionCheck(c *gin.Context) bool {
+	for _, name := range c.HandlerNames() {
+		if name == permissionHandlerName {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentAPIKey 本次请求使用的 API 密钥，使用登录令牌时返回 false
+func CurrentAPIKey(c *gin.Context) (*models.APIKey, bool) {
+	v, ok := c.Get("api_key")
+	if !ok {
+		return nil, false
+	}
+	key, ok := v.(*models.APIKey)
+	return key, ok
+}
+
+// authenticateAPIKey 由 AuthMiddleware 调用，校验个人访问令牌
+func authenticateAPIKey(c *gin.Context, db *gorm.DB, token string) {
+	var key models.APIKey
+	if err := db.Where("key_hash = ?", utils.HashToken(token)).First(&key).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "无效的 API 密钥", nil)
+		c.Abort()
+		return
+	}
+	now := utils.GetBeijingTime()
+	if !key.IsUsable(now) {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "API 密钥已过期或已撤销", nil)
+		c.Abort()
+		return
+	}
+	ip := utils.GetRealClientIP(c)
+	if !key.AllowsIP(ip) {
+		utils.CreateSecurityLog(c, "api_key_ip_denied", "MEDIUM",
+			fmt.Sprintf("API 密钥 %s (%s) 来自未授权 IP: %s", key.Name, key.Prefix, ip),
+			map[string]interface{}{"api_key_id": key.ID, "user_id": key.UserID, "ip": ip})
+		utils.ErrorResponse(c, http.StatusForbidden, "当前 IP 不允许使用该 API 密钥", nil)
+		c.Abort()
+		return
+	}
+	if !hasPermissionCheck(c) {
+		utils.ErrorResponse(c, http.StatusForbidden, "API 密钥只能用于后台管理接口", nil)
+		c.Abort()
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, key.UserID).Error; err != nil || !user.IsActive || !user.IsAdmin {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "API 密钥所属账号不可用", nil)
+		c.Abort()
+		return
+	}
+
+	models.TouchAPIKey(db, key.ID, ip, now)
+	c.Set("api_key", &key)
+	c.Set("user", &user)
+	c.Set("user_id", user.ID)
+	c.Set("is_admin", user.IsAdmin)
+	c.Next()
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func apiKeyRouter() *gin.Engine {
+	r := gin.New()
+	admin := r.Group("/admin", AuthMiddleware(), AdminMiddleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	admin.GET("/users", RequirePermission(models.PermUsersRead), ok)
+	admin.DELETE("/users/:id", RequirePermission(models.PermUsersWrite), ok)
+	admin.POST("/change-password", ok)
+	return r
+}
+
+func requestWithKey(r *gin.Engine, method, path, token, ip string) int {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Real-IP", ip)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	db := setupRBAC(t)
+	admin := models.User{Username: "ops", Email: "ops@example.com", Password: "x", IsActive: true, IsAdmin: true}
+	db.Create(&admin)
+
+	const token = models.APIKeyPrefix + "0123456789abcdef"
+	expires := utils.GetBeijingTime().Add(time.Hour)
+	key := models.APIKey{
+		UserID:     admin.ID,
+		Name:       "ops script",
+		KeyHash:    utils.HashToken(token),
+		Scopes:     models.PermUsersRead,
+		AllowedIPs: "10.0.0.0/8",
+		ExpiresAt:  &expires,
+	}
+	db.Create(&key)
+	r := apiKeyRouter()
+
+	if code := requestWithKey(r, http.MethodGet, "/admin/users", token, "10.1.2.3"); code != http.StatusOK {
+		t.Fatalf("scoped request should pass, got %d", code)
+	}
+	var stored models.APIKey
+	db.First(&stored, key.ID)
+	if stored.LastUsedAt == nil || stored.LastUsedIP != "10.1.2.3" {
+		t.Errorf("last use not recorded: %+v", stored)
+	}
+
+	if code := requestWithKey(r, http.MethodDelete, "/admin/users/5", token, "10.1.2.3"); code != http.StatusForbidden {
+		t.Errorf("scope outside the key must be denied, got %d", code)
+	}
+	if code := requestWithKey(r, http.MethodPost, "/admin/change-password", token, "10.1.2.3"); code != http.StatusForbidden {
+		t.Errorf("routes without a permission annotation must reject API keys, got %d", code)
+	}
+	if code := requestWithKey(r, http.MethodGet, "/admin/users", token, "192.168.1.1"); code != http.StatusForbidden {
+		t.Errorf("request from outside the allowed CIDR must be denied, got %d", code)
+	}
+	if code := requestWithKey(r, http.MethodGet, "/admin/users", models.APIKeyPrefix+"wrong", "10.1.2.3"); code != http.StatusUnauthorized {
+		t.Errorf("unknown key must be rejected, got %d", code)
+	}
+
+	db.Model(&key).Update("revoked_at", utils.GetBeijingTime())
+	if code := requestWithKey(r, http.MethodGet, "/admin/users", token, "10.1.2.3"); code != http.StatusUnauthorized {
+		t.Errorf("revoked key must stop working immediately, got %d", code)
+	}
+}
@@ -30,6 +30,10 @@ func AuthMiddleware() gin.HandlerFunc {
 		token := parts[1]
 
 		db := database.GetDB()
+		if strings.HasPrefix(token, models.APIKeyPrefix) {
+			authenticateAPIKey(c, db, token)
+			return
+		}
 		tokenHash := utils.HashToken(token)
 		if models.IsTokenBlacklisted(db, tokenHash) {
 			utils.ErrorResponse(c, http.StatusUnauthorized, "令牌已失效，请重新登录", nil)
@@ -50,6 +54,17 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if claims.SessionID != "" {
+			now := utils.GetBeijingTime()
+			if !models.IsSessionActive(db, claims.SessionID, now) {
+				utils.ErrorResponse(c, http.StatusUnauthorized, "登录会话已失效，请重新登录", nil)
+				c.Abort()
+				return
+			}
+			models.TouchSession(db, claims.SessionID, utils.GetRealClientIP(c), now)
+			c.Set("session_id", claims.SessionID)
+		}
+
 		var user models.User
 		if err := db.First(&user, claims.UserID).Error; err != nil {
 			utils.ErrorResponse(c, http.StatusUnauthorized, "用户不存在", err)
@@ -134,6 +149,11 @@ func TryAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if claims.SessionID != "" && !models.IsSessionActive(db, claims.SessionID, utils.GetBeijingTime()) {
+			c.Next()
+			return
+		}
+
 		var user models.User
 		if err := db.First(&user, claims.UserID).Error; err != nil {
 			c.Next()
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/services/captcha"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// captchaBodyLimit 从请求体读取 captcha_token 时最多读取的字节数
+const captchaBodyLimit = 64 << 10
+
+// captchaToken 优先读取 X-Captcha-Token 请求头，其次读取 JSON 请求体中的 captcha_token，
+// 读取后恢复请求体供后续处理函数绑定
+func captchaToken(c *gin.Context) string {
+	if token := c.GetHeader("X-Captcha-Token"); token != "" {
+		return token
+	}
+	if c.Request.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, captchaBodyLimit))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	if err != nil {
+		return ""
+	}
+	var payload struct {
+		CaptchaToken string `json:"captcha_token"`
+	}
+	if json.Unmarshal(body, &payload) != nil {
+		return ""
+	}
+	return payload.CaptchaToken
+}
+
+// CaptchaRequired 当前请求是否需要人机验证。自适应模式下，已被标记或
+// 命中撞库检测的 IP 才需要验证
+func CaptchaRequired(c *gin.Context, settings *captcha.Settings, ip string) bool {
+	if !settings.Enabled() {
+		return false
+	}
+	if settings.Mode == captcha.ModeAlways {
+		return true
+	}
+	if captcha.IsSuspicious(ip) {
+		return true
+	}
+	if suspicious, reason := utils.CheckBruteForcePattern(c, ""); suspicious {
+		if err := captcha.MarkSuspicious(ip); err != nil {
+			utils.LogError("CaptchaRequired: 标记可疑 IP 失败", err, map[string]interface{}{"ip": ip, "reason": reason})
+		}
+		return true
+	}
+	return false
+}
+
+func abortCaptcha(c *gin.Context, settings *captcha.Settings, message string) {
+	c.AbortWithStatusJSON(http.StatusForbidden, utils.ResponseBase{
+		Success: false,
+		Message: message,
+		Data: gin.H{
+			"captcha_required": true,
+			"provider":         settings.ProviderName(),
+			"site_key":         settings.SiteKey,
+		},
+	})
+}
+
+// CaptchaMiddleware 按安全设置校验人机验证，用于注册、登录和发送验证码接口。
+// 配置读取失败或第三方服务不可用时放行，避免影响正常登录
+func CaptchaMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings, err := captcha.LoadSettings(database.GetDB())
+		if err != nil {
+			utils.LogError("CaptchaMiddleware: 人机验证配置无效", err, nil)
+		}
+		ip := utils.GetRealClientIP(c)
+		if ip == "" {
+			ip = c.ClientIP()
+		}
+		if !CaptchaRequired(c, settings, ip) {
+			c.Next()
+			return
+		}
+
+		token := captchaToken(c)
+		if token == "" {
+			abortCaptcha(c, settings, captcha.ErrRequired.Error())
+			return
+		}
+		if err := settings.Provider.Verify(c.Request.Context(), token, ip); err != nil {
+			if !errors.Is(err, captcha.ErrInvalid) && !errors.Is(err, captcha.ErrRequired) {
+				utils.LogError("CaptchaMiddleware: 人机验证服务不可用", err, map[string]interface{}{
+					"provider": settings.ProviderName(),
+				})
+				c.Next()
+				return
+			}
+			utils.CreateSecurityLog(c, "captcha_failed", "MEDIUM",
+				fmt.Sprintf("人机验证失败: IP %s", ip),
+				map[string]interface{}{
+					"ip":       ip,
+					"path":     c.Request.URL.Path,
+					"provider": settings.ProviderName(),
+					"reason":   err.Error(),
+				})
+			abortCaptcha(c, settings, captcha.ErrInvalid.Error())
+			return
+		}
+
+		c.Next()
+	}
+}
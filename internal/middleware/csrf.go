@@ -2,26 +2,25 @@ package middleware
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
 
+	"cboard-go/internal/core/kvstore"
 	"cboard-go/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-type CSRFManager struct {
-	tokens    map[string]*CSRFToken
-	mu        sync.RWMutex
-	secretKey string
-}
+// csrfTokenTTL CSRF 令牌有效期
+const csrfTokenTTL = 24 * time.Hour
 
-type CSRFToken struct {
-	Token     string
-	ExpiresAt time.Time
+// CSRFManager CSRF 令牌保存在 kvstore 中，多实例部署时各实例共享
+type CSRFManager struct {
+	store kvstore.Store // 为空时使用 kvstore.Default()
 }
 
 var csrfManager *CSRFManager
@@ -29,35 +28,16 @@ var csrfOnce sync.Once
 
 func GetCSRFManager() *CSRFManager {
 	csrfOnce.Do(func() {
-		csrfManager = &CSRFManager{
-			tokens:    make(map[string]*CSRFToken),
-			secretKey: generateSecretKey(),
-		}
-		go csrfManager.cleanup()
+		csrfManager = &CSRFManager{}
 	})
 	return csrfManager
 }
 
-func generateSecretKey() string {
-	b := make([]byte, 32)
-	rand.Read(b)
-	return base64.URLEncoding.EncodeToString(b)
-}
-
-func (cm *CSRFManager) cleanup() {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		cm.mu.Lock()
-		now := time.Now()
-		for key, token := range cm.tokens {
-			if now.After(token.ExpiresAt) {
-				delete(cm.tokens, key)
-			}
-		}
-		cm.mu.Unlock()
+func (cm *CSRFManager) backend() kvstore.Store {
+	if cm.store != nil {
+		return cm.store
 	}
+	return kvstore.Default()
 }
 
 func (cm *CSRFManager) GenerateToken(sessionID string) (string, error) {
@@ -67,31 +47,20 @@ func (cm *CSRFManager) GenerateToken(sessionID string) (string, error) {
 	}
 	token := base64.URLEncoding.EncodeToString(b)
 
-	cm.mu.Lock()
-	defer cm.mu.Unlock()
-
-	cm.tokens[sessionID] = &CSRFToken{
-		Token:     token,
-		ExpiresAt: time.Now().Add(24 * time.Hour),
+	if err := cm.backend().Set("csrf:"+sessionID, token, csrfTokenTTL); err != nil {
+		return "", err
 	}
 
 	return token, nil
 }
 
 func (cm *CSRFManager) ValidateToken(sessionID, token string) bool {
-	cm.mu.RLock()
-	defer cm.mu.RUnlock()
-
-	storedToken, exists := cm.tokens[sessionID]
-	if !exists {
-		return false
-	}
-
-	if time.Now().After(storedToken.ExpiresAt) {
+	storedToken, _, found, err := cm.backend().Get("csrf:" + sessionID)
+	if err != nil || !found || token == "" {
 		return false
 	}
 
-	return storedToken.Token == token
+	return subtle.ConstantTimeCompare([]byte(storedToken), []byte(token)) == 1
 }
 
 func getSessionID(c *gin.Context) string {
@@ -3,148 +3,126 @@ package middleware
 import (
 	"fmt"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 
+	"cboard-go/internal/core/kvstore"
+	"cboard-go/internal/services/captcha"
 	"cboard-go/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
+// lockDuration 超出限制后的锁定时长
+const lockDuration = 15 * time.Minute
+
+// RateLimiter 固定窗口限流，超出次数后锁定一段时间。
+// 计数保存在 kvstore 中，多实例部署时配置数据库或 Redis 存储即可共享
 type RateLimiter struct {
-	visitors map[string]*Visitor
-	mu       sync.RWMutex
-	rate     int           // 允许的请求次数
-	window   time.Duration // 时间窗口
+	name   string
+	rate   int           // 允许的请求次数
+	window time.Duration // 时间窗口
+	store  kvstore.Store // 为空时使用 kvstore.Default()
 }
 
-type Visitor struct {
-	Count    int
-	ResetAt  time.Time
-	Locked   bool
-	LockedAt time.Time
+func NewRateLimiter(name string, rate int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		name:   name,
+		rate:   rate,
+		window: window,
+	}
 }
 
-func NewRateLimiter(rate int, window time.Duration) *RateLimiter {
-	rl := &RateLimiter{
-		visitors: make(map[string]*Visitor),
-		rate:     rate,
-		window:   window,
+func (rl *RateLimiter) backend() kvstore.Store {
+	if rl.store != nil {
+		return rl.store
 	}
+	return kvstore.Default()
+}
 
-	go rl.cleanup()
-
-	return rl
+func (rl *RateLimiter) countKey(key string) string {
+	return "ratelimit:" + rl.name + ":count:" + key
 }
 
-func (rl *RateLimiter) cleanup() {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
+func (rl *RateLimiter) lockKey(key string) string {
+	return "ratelimit:" + rl.name + ":lock:" + key
+}
 
-	for range ticker.C {
-		rl.mu.Lock()
-		now := time.Now()
-		for key, visitor := range rl.visitors {
-			if !visitor.Locked && now.After(visitor.ResetAt.Add(rl.window)) {
-				delete(rl.visitors, key)
-			}
-		}
-		rl.mu.Unlock()
+func (rl *RateLimiter) lockedUntil(store kvstore.Store, key string) (time.Time, bool) {
+	_, expiresAt, found, err := store.Get(rl.lockKey(key))
+	if err != nil {
+		utils.LogError("RateLimiter: 读取锁定状态失败", err, map[string]interface{}{"limiter": rl.name})
+		return time.Time{}, false
 	}
+	return expiresAt, found
 }
 
+// Allow 计数加一并判断是否放行。存储不可用时放行，避免因缓存故障导致无法登录
 func (rl *RateLimiter) Allow(key string) (allowed bool, resetAt time.Time, locked bool) {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
+	store := rl.backend()
 	now := time.Now()
-	visitor, exists := rl.visitors[key]
-
-	if !exists {
-		rl.visitors[key] = &Visitor{
-			Count:   1,
-			ResetAt: now.Add(rl.window),
-		}
-		return true, now.Add(rl.window), false
-	}
 
-	if visitor.Locked {
-		if now.After(visitor.LockedAt.Add(15 * time.Minute)) {
-			visitor.Locked = false
-			visitor.Count = 0
-			visitor.ResetAt = now.Add(rl.window)
-			return true, visitor.ResetAt, false
-		}
-		return false, visitor.LockedAt.Add(15 * time.Minute), true
+	if until, isLocked := rl.lockedUntil(store, key); isLocked {
+		return false, until, true
 	}
 
-	if now.After(visitor.ResetAt) {
-		visitor.Count = 1
-		visitor.ResetAt = now.Add(rl.window)
-		return true, visitor.ResetAt, false
+	count, resetAt, err := store.Incr(rl.countKey(key), rl.window)
+	if err != nil {
+		utils.LogError("RateLimiter: 更新计数失败", err, map[string]interface{}{"limiter": rl.name})
+		return true, now.Add(rl.window), false
 	}
 
-	if visitor.Count >= rl.rate {
-		visitor.Locked = true
-		visitor.LockedAt = now
-		return false, visitor.LockedAt.Add(15 * time.Minute), true
+	if count > int64(rl.rate) {
+		if err := store.Set(rl.lockKey(key), "1", lockDuration); err != nil {
+			utils.LogError("RateLimiter: 写入锁定状态失败", err, map[string]interface{}{"limiter": rl.name})
+		}
+		_ = store.Delete(rl.countKey(key))
+		return false, now.Add(lockDuration), true
 	}
 
-	visitor.Count++
-	return true, visitor.ResetAt, false
+	return true, resetAt, false
 }
 
+// Check 只读取状态，不计数
 func (rl *RateLimiter) Check(key string) (allowed bool, resetAt time.Time, locked bool) {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
+	store := rl.backend()
 	now := time.Now()
-	visitor, exists := rl.visitors[key]
 
-	if !exists {
-		return true, now.Add(rl.window), false
-	}
-
-	if visitor.Locked {
-		if now.After(visitor.LockedAt.Add(15 * time.Minute)) {
-			visitor.Locked = false
-			visitor.Count = 0
-			visitor.ResetAt = now.Add(rl.window)
-			return true, visitor.ResetAt, false
-		}
-		return false, visitor.LockedAt.Add(15 * time.Minute), true
+	if until, isLocked := rl.lockedUntil(store, key); isLocked {
+		return false, until, true
 	}
 
-	if now.After(visitor.ResetAt) {
+	value, expiresAt, found, err := store.Get(rl.countKey(key))
+	if err != nil || !found {
 		return true, now.Add(rl.window), false
 	}
 
-	if visitor.Count >= rl.rate {
-		return false, visitor.ResetAt, false
+	if count, _ := strconv.ParseInt(value, 10, 64); count >= int64(rl.rate) {
+		return false, expiresAt, false
 	}
 
-	return true, visitor.ResetAt, false
+	return true, expiresAt, false
 }
 
 func (rl *RateLimiter) Reset(key string) {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	now := time.Now()
-	visitor, exists := rl.visitors[key]
+	if err := rl.backend().Delete(rl.countKey(key), rl.lockKey(key)); err != nil {
+		utils.LogError("RateLimiter: 重置失败", err, map[string]interface{}{"limiter": rl.name})
+	}
+}
 
-	if exists {
-		visitor.Locked = false
-		visitor.Count = 0
-		visitor.ResetAt = now.Add(rl.window)
+// markCaptchaSuspect 触发限流的 IP 在自适应模式下需要完成人机验证
+func markCaptchaSuspect(ip string) {
+	if err := captcha.MarkSuspicious(ip); err != nil {
+		utils.LogError("RateLimiter: 标记可疑 IP 失败", err, map[string]interface{}{"ip": ip})
 	}
 }
 
 var (
-	loginRateLimiter    = NewRateLimiter(5, 15*time.Minute)  // 登录：15分钟内最多5次
-	registerRateLimiter = NewRateLimiter(3, 1*time.Hour)     // 注册：1小时内最多3次
-	verifyCodeLimiter   = NewRateLimiter(5, 1*time.Hour)     // 验证码：1小时内最多5次
-	generalRateLimiter  = NewRateLimiter(100, 1*time.Minute) // 通用：1分钟内最多100次
+	loginRateLimiter    = NewRateLimiter("login", 5, 15*time.Minute)    // 登录：15分钟内最多5次
+	registerRateLimiter = NewRateLimiter("register", 3, 1*time.Hour)    // 注册：1小时内最多3次
+	verifyCodeLimiter   = NewRateLimiter("verify_code", 5, 1*time.Hour) // 验证码：1小时内最多5次
+	generalRateLimiter  = NewRateLimiter("general", 100, 1*time.Minute) // 通用：1分钟内最多100次
+	captchaLimiter      = NewRateLimiter("captcha", 30, 1*time.Minute)  // 验证码题目：1分钟内最多30次
 )
 
 func RateLimitMiddleware(limiter *RateLimiter) gin.HandlerFunc {
@@ -190,6 +168,7 @@ func LoginRateLimitMiddleware() gin.HandlerFunc {
 		allowed, resetAt, locked := loginRateLimiter.Check(key)
 
 		if !allowed {
+			markCaptchaSuspect(key)
 			if locked {
 				utils.CreateSecurityLog(c, "ip_blocked", "HIGH",
 					fmt.Sprintf("IP被封禁: %s (登录失败次数过多，已锁定15分钟)", key),
@@ -252,6 +231,7 @@ func RegisterRateLimitMiddleware() gin.HandlerFunc {
 		allowed, resetAt, locked := registerRateLimiter.Allow(key)
 
 		if !allowed {
+			markCaptchaSuspect(key)
 			if locked {
 				utils.ErrorResponse(c, http.StatusTooManyRequests, "注册请求过于频繁，账户已被临时锁定，请稍后再试", nil)
 			} else {
@@ -281,6 +261,7 @@ func VerifyCodeRateLimitMiddleware() gin.HandlerFunc {
 		allowed, resetAt, locked := verifyCodeLimiter.Allow(key)
 
 		if !allowed {
+			markCaptchaSuspect(key)
 			if locked {
 				utils.ErrorResponse(c, http.StatusTooManyRequests, "验证码发送过于频繁，已被临时锁定，请稍后再试", nil)
 			} else {
@@ -299,3 +280,7 @@ func VerifyCodeRateLimitMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+func CaptchaChallengeRateLimitMiddleware() gin.HandlerFunc {
+	return RateLimitMiddleware(captchaLimiter)
+}
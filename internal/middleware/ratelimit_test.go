@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"cboard-go/internal/core/kvstore"
+)
+
+// 两个副本使用同一存储时共享计数与锁定状态
+func TestRateLimiterSharedAcrossReplicas(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	a := &RateLimiter{name: "login", rate: 3, window: time.Minute, store: store}
+	b := &RateLimiter{name: "login", rate: 3, window: time.Minute, store: store}
+
+	for i := 0; i < 3; i++ {
+		limiter := a
+		if i%2 == 1 {
+			limiter = b
+		}
+		if allowed, _, _ := limiter.Allow("1.2.3.4"); !allowed {
+			t.Fatalf("attempt %d should be allowed", i+1)
+		}
+	}
+	if allowed, _, _ := b.Check("1.2.3.4"); allowed {
+		t.Fatal("limit reached on the other replica should be visible")
+	}
+	if allowed, until, locked := a.Allow("1.2.3.4"); allowed || !locked || time.Until(until) < 14*time.Minute {
+		t.Fatalf("fourth attempt should lock: allowed=%v locked=%v until=%v", allowed, locked, until)
+	}
+	if _, _, locked := b.Check("1.2.3.4"); !locked {
+		t.Fatal("lock should be shared")
+	}
+	if allowed, _, _ := b.Allow("5.6.7.8"); !allowed {
+		t.Fatal("other clients are unaffected")
+	}
+
+	a.Reset("1.2.3.4")
+	if allowed, _, locked := b.Allow("1.2.3.4"); !allowed || locked {
+		t.Fatal("reset should clear the lock everywhere")
+	}
+}
+
+func TestCSRFTokenSharedAcrossReplicas(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	a, b := &CSRFManager{store: store}, &CSRFManager{store: store}
+	token, err := a.GenerateToken("session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.ValidateToken("session-1", token) {
+		t.Fatal("token issued by one replica should validate on another")
+	}
+	if b.ValidateToken("session-2", token) || b.ValidateToken("session-1", "forged") {
+		t.Fatal("token must be bound to its session")
+	}
+}
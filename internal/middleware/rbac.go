@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminRole 当前管理员的角色，超级管理员返回 nil。结果缓存在请求上下文中
+func adminRole(c *gin.Context, user *models.User) (*models.Role, error) {
+	if !user.RoleID.Valid {
+		return nil, nil
+	}
+	if cached, ok := c.Get("admin_role"); ok {
+		return cached.(*models.Role), nil
+	}
+	var role models.Role
+	if err := database.GetDB().First(&role, user.RoleID.Int64).Error; err != nil {
+		return nil, err
+	}
+	c.Set("admin_role", &role)
+	return &role, nil
+}
+
+// IsSuperAdmin 未分配角色的管理员；通过 API 密钥访问时不视为超级管理员
+func IsSuperAdmin(c *gin.Context) bool {
+	if _, usingKey := CurrentAPIKey(c); usingKey {
+		return false
+	}
+	user, ok := GetCurrentUser(c)
+	return ok && user.IsAdmin && !user.RoleID.Valid
+}
+
+// AdminPermissions 当前管理员拥有的权限
+func AdminPermissions(c *gin.Context) []string {
+	user, ok := GetCurrentUser(c)
+	if !ok || !user.IsAdmin {
+		return []string{}
+	}
+	role, err := adminRole(c, user)
+	if err != nil {
+		return []string{}
+	}
+	granted := []string{}
+	key, usingKey := CurrentAPIKey(c)
+	for _, p := range models.Permissions {
+		if (role == nil || role.HasPermission(p.Key)) && (!usingKey || key.HasScope(p.Key)) {
+			granted = append(granted, p.Key)
+		}
+	}
+	return granted
+}
+
+// HasPermission 当前管理员是否拥有指定权限；使用 API 密钥时还需在密钥的授权范围内
+func HasPermission(c *gin.Context, perm string) bool {
+	user, ok := GetCurrentUser(c)
+	if !ok || !user.IsAdmin {
+		return false
+	}
+	role, err := adminRole(c, user)
+	if err != nil {
+		return false
+	}
+	if key, ok := CurrentAPIKey(c); ok && !key.HasScope(perm) {
+		return false
+	}
+	return role == nil || role.HasPermission(perm)
+}
+
+// RequirePermission 后台接口的权限声明，需在 AdminMiddleware 之后使用。
+// 被拒绝的访问写入审计日志
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if HasPermission(c, perm) {
+			c.Next()
+			return
+		}
+		label := perm
+		for _, p := range models.Permissions {
+			if p.Key == perm {
+				label = p.Label
+			}
+		}
+		var userID uint
+		username := ""
+		if user, ok := GetCurrentUser(c); ok {
+			userID, username = user.ID, user.Username
+		}
+		utils.SetResponseStatus(c, http.StatusForbidden)
+		utils.CreateAuditLogSimple(c, "permission_denied", "permission", userID,
+			fmt.Sprintf("权限不足: %s 访问 %s %s，需要「%s」(%s) 权限", username, c.Request.Method, c.FullPath(), label, perm))
+		utils.ErrorResponse(c, http.StatusForbidden, fmt.Sprintf("权限不足，需要「%s」权限", label), nil)
+		c.Abort()
+	}
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupRBAC(t *testing.T) *gorm.DB {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:rbac?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Role{}, &models.APIKey{}, &models.AuditLog{}, &models.AuditLogAnchor{}, &models.AuditChainLock{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	database.DB = db
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+		database.DB = nil
+	})
+	return db
+}
+
+// call 以指定用户身份访问受 perm 保护的接口
+func call(user *models.User, perm string) int {
+	r := gin.New()
+	r.GET("/admin/users", func(c *gin.Context) {
+		c.Set("user", user)
+		c.Set("user_id", user.ID)
+	}, RequirePermission(perm), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/users", nil))
+	return w.Code
+}
+
+func TestRequirePermission(t *testing.T) {
+	db := setupRBAC(t)
+	support := models.Role{Name: "客服"}
+	support.SetPermissions([]string{models.PermTickets, models.PermUsersRead})
+	db.Create(&support)
+
+	super := &models.User{ID: 1, Username: "root", IsAdmin: true}
+	staff := &models.User{ID: 2, Username: "staff", IsAdmin: true, RoleID: sql.NullInt64{Int64: int64(support.ID), Valid: true}}
+	plain := &models.User{ID: 3, Username: "user"}
+
+	if code := call(super, models.PermPaymentsConfig); code != http.StatusOK {
+		t.Errorf("super admin should have every permission, got %d", code)
+	}
+	if code := call(staff, models.PermUsersRead); code != http.StatusOK {
+		t.Errorf("staff should be allowed users:read, got %d", code)
+	}
+	if code := call(staff, models.PermUsersWrite); code != http.StatusForbidden {
+		t.Errorf("staff must not get users:write, got %d", code)
+	}
+	if code := call(plain, models.PermTickets); code != http.StatusForbidden {
+		t.Errorf("non-admin must be rejected, got %d", code)
+	}
+
+	// 拒绝记录异步写入审计日志
+	var count int64
+	for i := 0; i < 50 && count < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		db.Model(&models.AuditLog{}).Where("action_type = ?", "permission_denied").Count(&count)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 permission_denied audit logs, got %d", count)
+	}
+}
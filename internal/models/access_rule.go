@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// 访问控制规则的作用范围
+const (
+	AccessScopeAll       = "all"
+	AccessScopeAuth      = "auth"      // 登录、注册、找回密码等
+	AccessScopeUser      = "user"      // 用户端 API
+	AccessScopeAdmin     = "admin"     // 后台管理 API
+	AccessScopeSubscribe = "subscribe" // 订阅拉取
+)
+
+// 规则匹配类型
+const (
+	AccessRuleCIDR    = "cidr"
+	AccessRuleCountry = "country"
+	AccessRuleASN     = "asn"
+)
+
+// AccessRule IP / 国家 / ASN 访问控制规则，同一范围内按 Priority 从小到大依次匹配，
+// 第一条命中的规则决定放行或拒绝，都未命中时放行
+type AccessRule struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Scope     string    `gorm:"type:varchar(20);index;not null" json:"scope"`
+	Action    string    `gorm:"type:varchar(10);not null" json:"action"` // allow、deny
+	Type      string    `gorm:"type:varchar(20);not null" json:"type"`
+	Value     string    `gorm:"type:text;not null" json:"value"` // 逗号分隔，* 匹配所有
+	Priority  int       `gorm:"default:100" json:"priority"`
+	Enabled   bool      `gorm:"default:true" json:"enabled"`
+	Note      string    `gorm:"type:varchar(255)" json:"note"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (AccessRule) TableName() string {
+	return "access_rules"
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix 个人访问令牌的固定前缀，用于和 JWT 区分
+const APIKeyPrefix = "cbk_"
+
+// APIKey 管理员创建的个人访问令牌，只保存哈希
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(16)" json:"prefix"` // 令牌前几位，便于识别
+	KeyHash    string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	Scopes     string     `gorm:"type:text" json:"-"`           // 逗号分隔的权限
+	AllowedIPs string     `gorm:"type:text" json:"allowed_ips"` // 逗号分隔的 IP 或 CIDR，为空不限制
+	ExpiresAt  *time.Time `gorm:"index" json:"expires_at"`      // 为空表示永不过期
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `gorm:"type:varchar(45)" json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+func (k *APIKey) ScopeList() []string {
+	list := []string{}
+	for _, s := range strings.Split(k.Scopes, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func (k *APIKey) HasScope(perm string) bool {
+	for _, s := range k.ScopeList() {
+		if s == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUsable 未撤销且未过期
+func (k *APIKey) IsUsable(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// AllowsIP 校验来源 IP 是否在允许列表内
+func (k *APIKey) AllowsIP(ip string) bool {
+	if strings.TrimSpace(k.AllowedIPs) == "" {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range strings.Split(k.AllowedIPs, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(addr) {
+				return true
+			}
+		} else if other := net.ParseIP(entry); other != nil && other.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// TouchAPIKey 记录最近使用时间与 IP，一分钟内只写一次
+func TouchAPIKey(db *gorm.DB, id uint, ip string, now time.Time) {
+	db.Model(&APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, now.Add(-time.Minute)).
+		Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ip})
+}
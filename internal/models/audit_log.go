@@ -22,6 +22,9 @@ type AuditLog struct {
 	BeforeData        sql.NullString `gorm:"type:json" json:"before_data,omitempty"`
 	AfterData         sql.NullString `gorm:"type:json" json:"after_data,omitempty"`
 	CreatedAt         time.Time      `gorm:"autoCreateTime;index" json:"created_at"`
+	// 哈希链：Hash 覆盖本条内容与 PrevHash，任何修改或删除都会使链条断开
+	PrevHash string `gorm:"type:varchar(64)" json:"prev_hash,omitempty"`
+	Hash     string `gorm:"type:varchar(64);index" json:"hash,omitempty"`
 
 	User User `gorm:"foreignKey:UserID" json:"-"`
 }
@@ -29,3 +32,32 @@ type AuditLog struct {
 func (AuditLog) TableName() string {
 	return "audit_logs"
 }
+
+// AuditLogAnchor 归档锚点：记录被归档区间首尾的哈希，使剩余日志仍能接续校验
+type AuditLogAnchor struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	FirstID     uint      `json:"first_id"`
+	LastID      uint      `json:"last_id"`
+	Count       int64     `json:"count"`
+	PrevHash    string    `gorm:"type:varchar(64)" json:"prev_hash"` // 区间第一条记录的 PrevHash
+	LastHash    string    `gorm:"type:varchar(64)" json:"last_hash"`
+	ArchiveFile string    `gorm:"type:varchar(255)" json:"archive_file"`
+	FileSHA256  string    `gorm:"column:file_sha256;type:varchar(64)" json:"file_sha256"`
+	CreatedBy   *uint     `json:"created_by,omitempty"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (AuditLogAnchor) TableName() string {
+	return "audit_log_anchors"
+}
+
+// AuditChainLock 哈希链追加锁：只有一行，追加日志前在事务中更新这一行，
+// 多实例同时追加时由数据库行锁保证依次读取链尾
+type AuditChainLock struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (AuditChainLock) TableName() string {
+	return "audit_chain_locks"
+}
@@ -1,7 +1,12 @@
 package models
 
 import (
+	"fmt"
 	"time"
+
+	"cboard-go/internal/core/secrets"
+
+	"gorm.io/gorm"
 )
 
 type SystemConfig struct {
@@ -22,6 +27,51 @@ func (SystemConfig) TableName() string {
 	return "system_configs"
 }
 
+// secretSystemConfigs 加密保存的系统配置项（分类 -> 键）
+var secretSystemConfigs = map[string][]string{
+	"email":    {"smtp_password", "email_password"},
+	"oauth":    {"github_client_secret", "google_client_secret", "oidc_client_secret"},
+	"security": {"captcha_secret_key"},
+}
+
+// IsSecretSystemConfig 配置项是否为加密保存的密钥
+func IsSecretSystemConfig(category, key string) bool {
+	for _, k := range secretSystemConfigs[category] {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *SystemConfig) BeforeSave(tx *gorm.DB) error {
+	if !IsSecretSystemConfig(c.Category, c.Key) {
+		return nil
+	}
+	value, err := secrets.Encrypt(c.Value)
+	if err != nil {
+		return fmt.Errorf("加密配置 %s.%s 失败: %w", c.Category, c.Key, err)
+	}
+	c.Value = value
+	return nil
+}
+
+func (c *SystemConfig) AfterSave(tx *gorm.DB) error {
+	return c.AfterFind(tx)
+}
+
+func (c *SystemConfig) AfterFind(tx *gorm.DB) error {
+	if !IsSecretSystemConfig(c.Category, c.Key) {
+		return nil
+	}
+	value, err := secrets.Decrypt(c.Value)
+	if err != nil {
+		return fmt.Errorf("解密配置 %s.%s 失败: %w", c.Category, c.Key, err)
+	}
+	c.Value = value
+	return nil
+}
+
 type Announcement struct {
 	ID          uint       `gorm:"primaryKey" json:"id"`
 	Title       string     `gorm:"type:varchar(200);not null" json:"title"`
@@ -18,6 +18,10 @@ type CustomNode struct {
 	LastTest         *time.Time `json:"last_test,omitempty"`      // 最后测试时间
 	ExpireTime       *time.Time `json:"expire_time,omitempty"`
 	FollowUserExpire bool       `gorm:"default:false" json:"follow_user_expire"`
+	PanelID          *uint      `gorm:"index" json:"panel_id,omitempty"`                  // 关联的外部面板
+	PanelInbound     string     `gorm:"type:varchar(100)" json:"panel_inbound,omitempty"` // 3x-ui 入站ID / Marzban 入站标签
+	ServerOpts       string     `gorm:"type:text" json:"server_opts"`                     // 自建节点服务端配置（证书路径、Reality 等）
+	BackendTokenHash string     `gorm:"type:varchar(64)" json:"-"`                        // 节点后端通信密钥的哈希，明文只在签发时返回一次
 	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt        time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
 }
@@ -51,13 +55,20 @@ func (CustomNode) TableName() string {
 }
 
 type UserCustomNode struct {
-	ID           uint       `gorm:"primaryKey" json:"id"`
-	UserID       uint       `gorm:"index:idx_user_node;not null" json:"user_id"`
-	CustomNodeID uint       `gorm:"index:idx_user_node;not null" json:"custom_node_id"`
-	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
-	User         User       `gorm:"foreignKey:UserID" json:"-"`
-	CustomNode   CustomNode `gorm:"foreignKey:CustomNodeID" json:"custom_node,omitempty"`
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	UserID         uint       `gorm:"index:idx_user_node;not null" json:"user_id"`
+	CustomNodeID   uint       `gorm:"index:idx_user_node;not null" json:"custom_node_id"`
+	UUID           string     `gorm:"type:varchar(64)" json:"uuid"` // 该用户专属 UUID
+	Password       string     `gorm:"type:varchar(128)" json:"-"`   // 该用户专属密码，仅在生成节点链接/配置时使用
+	RemoteClientID string     `gorm:"type:varchar(128)" json:"remote_client_id"`
+	RemoteStatus   string     `gorm:"type:varchar(20)" json:"remote_status"` // active, disabled, error
+	Upload         int64      `gorm:"default:0" json:"upload"`
+	Download       int64      `gorm:"default:0" json:"download"`
+	UsageSyncedAt  *time.Time `json:"usage_synced_at,omitempty"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	User           User       `gorm:"foreignKey:UserID" json:"-"`
+	CustomNode     CustomNode `gorm:"foreignKey:CustomNodeID" json:"custom_node,omitempty"`
 }
 
 func (UserCustomNode) TableName() string {
@@ -10,6 +10,7 @@ type Device struct {
 	SubscriptionID    uint       `gorm:"index;not null" json:"subscription_id"`
 	DeviceFingerprint string     `gorm:"type:varchar(255);not null" json:"device_fingerprint"`
 	DeviceHash        *string    `gorm:"type:varchar(255)" json:"device_hash,omitempty"`
+	SubToken          *string    `gorm:"type:varchar(64);uniqueIndex" json:"-"` // 设备专属订阅令牌，为空表示按指纹识别的旧设备
 	DeviceUA          *string    `gorm:"type:varchar(255)" json:"device_ua,omitempty"`
 	DeviceName        *string    `gorm:"type:varchar(100)" json:"device_name,omitempty"`
 	DeviceType        *string    `gorm:"type:varchar(50)" json:"device_type,omitempty"`
@@ -24,6 +25,9 @@ type Device struct {
 	SubscriptionType  *string    `gorm:"type:varchar(20);index" json:"subscription_type,omitempty"` // 订阅类型: clash, v2ray, ssr
 	IsActive          bool       `gorm:"default:true;index" json:"is_active"`
 	IsAllowed         bool       `gorm:"default:true" json:"is_allowed"`
+	ApprovalStatus    string     `gorm:"type:varchar(20);default:approved" json:"approval_status"` // pending, approved, denied
+	ApprovalToken     *string    `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+	GraceUntil        *time.Time `json:"grace_until,omitempty"` // 超出设备上限时的宽限截止时间
 	FirstSeen         *time.Time `json:"first_seen,omitempty"`
 	LastAccess        time.Time  `gorm:"autoCreateTime" json:"last_access"`
 	LastSeen          *time.Time `json:"last_seen,omitempty"`
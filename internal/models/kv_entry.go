@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// KVEntry 数据库共享状态存储（限流计数、CSRF 令牌），用于多实例部署
+type KVEntry struct {
+	StoreKey  string    `gorm:"column:store_key;type:varchar(191);primaryKey"`
+	Value     string    `gorm:"type:text"`
+	Counter   int64     `gorm:"default:0;not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+func (KVEntry) TableName() string {
+	return "kv_entries"
+}
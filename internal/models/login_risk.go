@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// LoginRiskEvent 风险登录记录：发送过提醒邮件或要求了邮箱验证码的登录
+type LoginRiskEvent struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	SessionID  string     `gorm:"type:varchar(64);index" json:"session_id,omitempty"`
+	IPAddress  string     `gorm:"type:varchar(45)" json:"ip_address"`
+	Location   string     `gorm:"type:varchar(100)" json:"location"`
+	DeviceName string     `gorm:"type:varchar(100)" json:"device_name"`
+	Score      int        `json:"score"`
+	Signals    string     `gorm:"type:varchar(255)" json:"signals"` // 逗号分隔
+	Action     string     `gorm:"type:varchar(20)" json:"action"`   // alert、step_up
+	RevokeHash *string    `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (LoginRiskEvent) TableName() string {
+	return "login_risk_events"
+}
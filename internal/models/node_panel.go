@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// NodePanel 外部节点面板（3x-ui / Marzban）连接信息
+type NodePanel struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	Type       string     `gorm:"type:varchar(20);not null" json:"type"` // xui, marzban
+	BaseURL    string     `gorm:"type:varchar(255);not null" json:"base_url"`
+	Username   string     `gorm:"type:varchar(100)" json:"username"`
+	Password   string     `gorm:"type:text" json:"-"` // AES 加密存储
+	IsActive   bool       `gorm:"default:true" json:"is_active"`
+	LastSyncAt *time.Time `json:"last_sync_at,omitempty"`
+	LastError  string     `gorm:"type:text" json:"last_error"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (NodePanel) TableName() string {
+	return "node_panels"
+}
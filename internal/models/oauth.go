@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// OAuthIdentity 用户绑定的第三方登录账号（GitHub、Google、OIDC）
+type OAuthIdentity struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"index;not null" json:"user_id"`
+	Provider    string     `gorm:"type:varchar(50);uniqueIndex:idx_oauth_provider_subject;not null" json:"provider"`
+	Subject     string     `gorm:"type:varchar(255);uniqueIndex:idx_oauth_provider_subject;not null" json:"-"`
+	Email       string     `gorm:"type:varchar(255)" json:"email"`
+	Name        string     `gorm:"type:varchar(255)" json:"name"`
+	AvatarURL   string     `gorm:"type:varchar(500)" json:"avatar_url"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (OAuthIdentity) TableName() string {
+	return "oauth_identities"
+}
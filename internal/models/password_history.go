@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// PasswordHistory 用户曾经使用过的密码哈希，用于禁止重复使用最近的密码
+type PasswordHistory struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       uint      `gorm:"index;not null" json:"user_id"`
+	PasswordHash string    `gorm:"type:varchar(255);not null" json:"-"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (PasswordHistory) TableName() string {
+	return "password_histories"
+}
@@ -1,9 +1,15 @@
 package models
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"time"
+
+	"cboard-go/internal/core/secrets"
+
+	"gorm.io/gorm"
 )
 
 type PaymentConfig struct {
@@ -36,6 +42,77 @@ func (PaymentConfig) TableName() string {
 	return "payment_configs"
 }
 
+// PaymentSecretConfigKeys ConfigJSON 中按密钥处理（加密保存、管理端脱敏）的字段
+var PaymentSecretConfigKeys = []string{"merchant_private_key", "private_key", "key", "api_key", "api_v3_key", "secret", "secret_key"}
+
+// SecretFields 需要加密保存的字段
+func (p *PaymentConfig) SecretFields() []*sql.NullString {
+	return []*sql.NullString{&p.MerchantPrivateKey, &p.WechatAPIKey, &p.PaypalSecret, &p.StripeSecretKey}
+}
+
+func (p *PaymentConfig) transformSecrets(fn func(string) (string, error)) error {
+	for _, field := range p.SecretFields() {
+		if !field.Valid || field.String == "" {
+			continue
+		}
+		value, err := fn(field.String)
+		if err != nil {
+			return err
+		}
+		field.String = value
+	}
+
+	if !p.ConfigJSON.Valid || p.ConfigJSON.String == "" {
+		return nil
+	}
+	var data map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(p.ConfigJSON.String)))
+	decoder.UseNumber()
+	if decoder.Decode(&data) != nil {
+		return nil
+	}
+	changed := false
+	for _, key := range PaymentSecretConfigKeys {
+		if str, ok := data[key].(string); ok && str != "" {
+			value, err := fn(str)
+			if err != nil {
+				return err
+			}
+			if value != str {
+				data[key] = value
+				changed = true
+			}
+		}
+	}
+	if changed {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		p.ConfigJSON.String = string(encoded)
+	}
+	return nil
+}
+
+// BeforeSave 密钥加密后写入数据库，AfterSave/AfterFind 解密，业务代码读到的始终是明文
+func (p *PaymentConfig) BeforeSave(tx *gorm.DB) error {
+	if err := p.transformSecrets(secrets.Encrypt); err != nil {
+		return fmt.Errorf("加密支付配置失败: %w", err)
+	}
+	return nil
+}
+
+func (p *PaymentConfig) AfterSave(tx *gorm.DB) error {
+	return p.AfterFind(tx)
+}
+
+func (p *PaymentConfig) AfterFind(tx *gorm.DB) error {
+	if err := p.transformSecrets(secrets.Decrypt); err != nil {
+		return fmt.Errorf("解密支付配置 #%d 失败: %w", p.ID, err)
+	}
+	return nil
+}
+
 func (p *PaymentConfig) GetConfig() map[string]interface{} {
 	config := map[string]interface{}{
 		"pay_type":   p.PayType,
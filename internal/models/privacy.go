@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// 数据导出状态
+const (
+	DataExportPending    = "pending"
+	DataExportProcessing = "processing"
+	DataExportReady      = "ready"
+	DataExportFailed     = "failed"
+	DataExportExpired    = "expired"
+)
+
+// DataExport 用户申请的个人数据导出，文件通过带有效期的链接下载
+type DataExport struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"index;not null" json:"user_id"`
+	Status      string     `gorm:"type:varchar(20);default:pending;index" json:"status"`
+	FileName    string     `gorm:"type:varchar(255)" json:"file_name,omitempty"`
+	FileSize    int64      `json:"file_size"`
+	TokenHash   *string    `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+	Error       string     `gorm:"type:varchar(255)" json:"error,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (DataExport) TableName() string {
+	return "data_exports"
+}
+
+// 注销申请状态
+const (
+	DeletionPending   = "pending"
+	DeletionCancelled = "cancelled"
+	DeletionCompleted = "completed"
+)
+
+// AccountDeletionRequest 用户自助注销申请，冷静期结束后执行匿名化
+type AccountDeletionRequest struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"index;not null" json:"user_id"`
+	Status      string     `gorm:"type:varchar(20);default:pending;index" json:"status"`
+	Reason      string     `gorm:"type:varchar(500)" json:"reason,omitempty"`
+	ScheduledAt time.Time  `gorm:"index" json:"scheduled_at"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (AccountDeletionRequest) TableName() string {
+	return "account_deletion_requests"
+}
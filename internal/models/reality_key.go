@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// RealityKey 专线节点的 Reality 密钥对
+type RealityKey struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	CustomNodeID uint       `gorm:"index;not null" json:"custom_node_id"`
+	PrivateKey   string     `gorm:"type:text;not null" json:"-"` // AES 加密存储
+	PublicKey    string     `gorm:"type:varchar(64);not null" json:"public_key"`
+	ShortIDs     string     `gorm:"type:text" json:"short_ids"`                    // JSON 数组
+	Status       string     `gorm:"type:varchar(20);default:active" json:"status"` // active, grace, retired
+	GraceUntil   *time.Time `json:"grace_until,omitempty"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (RealityKey) TableName() string {
+	return "reality_keys"
+}
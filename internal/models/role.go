@@ -0,0 +1,86 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// 后台权限
+const (
+	PermDashboard      = "dashboard"
+	PermTickets        = "tickets"
+	PermUsersRead      = "users:read"
+	PermUsersWrite     = "users:write"
+	PermOrders         = "orders"
+	PermPaymentsConfig = "payments-config"
+	PermNodes          = "nodes"
+	PermSettings       = "settings"
+	PermLogs           = "logs"
+	PermRoles          = "roles"
+)
+
+type PermissionInfo struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+}
+
+// Permissions 全部可分配的权限，供角色编辑页展示
+var Permissions = []PermissionInfo{
+	{PermDashboard, "仪表盘与统计"},
+	{PermTickets, "工单处理"},
+	{PermUsersRead, "查看用户与订阅"},
+	{PermUsersWrite, "管理用户与订阅"},
+	{PermOrders, "订单、套餐与优惠券"},
+	{PermPaymentsConfig, "支付配置"},
+	{PermNodes, "节点管理"},
+	{PermSettings, "系统设置"},
+	{PermLogs, "日志查看"},
+	{PermRoles, "查看角色与权限（增删改和分配仅限超级管理员）"},
+}
+
+func IsValidPermission(perm string) bool {
+	for _, p := range Permissions {
+		if p.Key == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Role 后台角色。未分配角色的管理员视为超级管理员，拥有全部权限
+type Role struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"`
+	Description string    `gorm:"type:varchar(255)" json:"description"`
+	Permissions string    `gorm:"type:text" json:"-"` // 逗号分隔
+	IsSystem    bool      `gorm:"default:false" json:"is_system"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (Role) TableName() string {
+	return "roles"
+}
+
+func (r *Role) PermissionList() []string {
+	list := []string{}
+	for _, p := range strings.Split(r.Permissions, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+func (r *Role) SetPermissions(perms []string) {
+	r.Permissions = strings.Join(perms, ",")
+}
+
+func (r *Role) HasPermission(perm string) bool {
+	for _, p := range r.PermissionList() {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
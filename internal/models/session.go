@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserSession 登录会话，一个会话对应一条刷新令牌轮换链
+type UserSession struct {
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	UserID           uint       `gorm:"index;not null" json:"user_id"`
+	SessionID        string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"session_id"`
+	RefreshTokenHash string     `gorm:"type:varchar(64);not null" json:"-"` // 当前有效刷新令牌的 jti 哈希
+	PreviousHash     string     `gorm:"type:varchar(64)" json:"-"`          // 上一个刷新令牌，用于并发刷新的宽限判断
+	RotatedAt        *time.Time `json:"-"`
+	DeviceName       string     `gorm:"type:varchar(100)" json:"device_name"`
+	UserAgent        string     `gorm:"type:text" json:"user_agent"`
+	IPAddress        string     `gorm:"type:varchar(45)" json:"ip_address"`
+	Location         string     `gorm:"type:varchar(100)" json:"location"`
+	LoginMethod      string     `gorm:"type:varchar(30)" json:"login_method"`
+	LastSeenAt       time.Time  `json:"last_seen_at"`
+	ExpiresAt        time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	RevokeReason     string     `gorm:"type:varchar(50)" json:"revoke_reason,omitempty"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (UserSession) TableName() string {
+	return "user_sessions"
+}
+
+// IsSessionActive 会话未被撤销且未过期
+func IsSessionActive(db *gorm.DB, sessionID string, now time.Time) bool {
+	var count int64
+	db.Model(&UserSession{}).
+		Where("session_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, now).
+		Count(&count)
+	return count > 0
+}
+
+// TouchSession 更新最后活跃时间，一分钟内只写一次
+func TouchSession(db *gorm.DB, sessionID, ip string, now time.Time) {
+	db.Model(&UserSession{}).
+		Where("session_id = ? AND last_seen_at < ?", sessionID, now.Add(-time.Minute)).
+		Updates(map[string]interface{}{"last_seen_at": now, "ip_address": ip})
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// SubscriptionFetch 订阅拉取记录，用于共享检测
+type SubscriptionFetch struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint      `gorm:"index;not null" json:"subscription_id"`
+	UserID         uint      `gorm:"index;not null" json:"user_id"`
+	Token          string    `gorm:"type:varchar(100);index" json:"-"`
+	IPAddress      string    `gorm:"type:varchar(45)" json:"ip_address"`
+	UserAgent      string    `gorm:"type:text" json:"user_agent"`
+	CountryCode    string    `gorm:"type:varchar(8)" json:"country_code"`
+	City           string    `gorm:"type:varchar(100)" json:"city"`
+	Latitude       float64   `json:"latitude"`
+	Longitude      float64   `json:"longitude"`
+	ASN            uint      `json:"asn"`
+	ASOrg          string    `gorm:"type:varchar(255)" json:"as_org"`
+	CreatedAt      time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+func (SubscriptionFetch) TableName() string {
+	return "subscription_fetches"
+}
+
+// SharingScore 订阅共享检测的最新结果
+type SharingScore struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint       `gorm:"uniqueIndex;not null" json:"subscription_id"`
+	UserID         uint       `gorm:"index;not null" json:"user_id"`
+	Score          int        `gorm:"index" json:"score"`
+	Window         string     `gorm:"type:varchar(20)" json:"window"`
+	FetchCount     int        `json:"fetch_count"`
+	Evidence       string     `gorm:"type:text" json:"evidence"`
+	AutoResetAt    *time.Time `json:"auto_reset_at,omitempty"`
+	AnalyzedAt     time.Time  `gorm:"index" json:"analyzed_at"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (SharingScore) TableName() string {
+	return "sharing_scores"
+}
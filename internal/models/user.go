@@ -13,6 +13,7 @@ type User struct {
 	IsActive   bool           `gorm:"default:true" json:"is_active"`
 	IsVerified bool           `gorm:"default:false" json:"is_verified"`
 	IsAdmin    bool           `gorm:"default:false" json:"is_admin"`
+	RoleID     sql.NullInt64  `gorm:"index" json:"role_id,omitempty"` // 后台角色，为空时管理员拥有全部权限
 	Nickname   sql.NullString `gorm:"type:varchar(50)" json:"nickname,omitempty"`
 	Avatar     sql.NullString `gorm:"type:varchar(255)" json:"avatar,omitempty"`
 	CreatedAt  time.Time      `gorm:"autoCreateTime" json:"created_at"`
@@ -36,6 +37,13 @@ type User struct {
 	DataSharing bool `gorm:"default:true" json:"data_sharing"`
 	Analytics   bool `gorm:"default:true" json:"analytics"`
 
+	RequireDeviceApproval bool `gorm:"default:false" json:"require_device_approval"` // 新设备需经用户审批后才能获取订阅
+
+	TwoFactorEnabled  bool           `gorm:"default:false" json:"two_factor_enabled"`
+	TOTPSecret        sql.NullString `gorm:"type:varchar(128)" json:"-"` // AES 加密保存
+	TOTPPendingSecret sql.NullString `gorm:"type:varchar(128)" json:"-"` // 绑定流程中尚未确认的密钥，AES 加密保存
+	TOTPLastCounter   int64          `gorm:"default:0" json:"-"`         // 最近一次使用的时间步长，防止验证码重放
+
 	Balance float64 `gorm:"type:decimal(10,2);default:0;not null" json:"balance"`
 
 	InvitedBy         sql.NullInt64  `gorm:"index" json:"invited_by,omitempty"`
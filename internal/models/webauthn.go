@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// WebAuthnCredential 用户绑定的通行密钥（WebAuthn 凭据），一个用户可绑定多个验证器
+type WebAuthnCredential struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	UserID          uint       `gorm:"index;not null" json:"user_id"`
+	Name            string     `gorm:"type:varchar(100);not null" json:"name"`
+	CredentialID    string     `gorm:"type:varchar(512);uniqueIndex;not null" json:"credential_id"` // base64url
+	PublicKey       []byte     `gorm:"not null" json:"-"`
+	AttestationType string     `gorm:"type:varchar(50)" json:"attestation_type"`
+	AAGUID          string     `gorm:"type:varchar(36)" json:"aaguid"`
+	SignCount       uint32     `gorm:"default:0" json:"sign_count"`
+	CloneWarning    bool       `gorm:"default:false" json:"clone_warning"`
+	Flags           uint8      `gorm:"default:0" json:"-"`
+	BackupEligible  bool       `gorm:"default:false" json:"backup_eligible"`
+	BackupState     bool       `gorm:"default:false" json:"backup_state"`
+	Transports      string     `gorm:"type:varchar(255)" json:"transports"`
+	LastUsedAt      *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
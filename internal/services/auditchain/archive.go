@@ -0,0 +1,171 @@
+package auditchain
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"cboard-go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrNothingToArchive 指定时间之前没有日志
+var ErrNothingToArchive = errors.New("没有需要归档的日志")
+
+var (
+	archiveMu  sync.RWMutex
+	archiveDir string
+)
+
+// SetArchiveDir 设置归档文件目录，未设置时拒绝归档
+func SetArchiveDir(dir string) {
+	archiveMu.Lock()
+	archiveDir = dir
+	archiveMu.Unlock()
+}
+
+// ArchiveDir 当前归档目录
+func ArchiveDir() string {
+	archiveMu.RLock()
+	defer archiveMu.RUnlock()
+	return archiveDir
+}
+
+// Archive 将创建时间早于 before 的日志写入 gzip 压缩的 JSON Lines 文件并从表中删除，
+// 同时记录锚点，剩余日志从锚点继续校验。归档区间总是链条的前缀
+func Archive(db *gorm.DB, before time.Time, createdBy *uint) (*models.AuditLogAnchor, error) {
+	dir := ArchiveDir()
+	if dir == "" {
+		return nil, fmt.Errorf("未配置审计日志归档目录")
+	}
+
+	// 归档期间暂停追加，保证锚点与表中剩余日志首尾相接
+	appendMu.Lock()
+	defer appendMu.Unlock()
+
+	var lastID uint
+	if err := db.Model(&models.AuditLog{}).Where("created_at < ?", before).
+		Select("COALESCE(MAX(id), 0)").Scan(&lastID).Error; err != nil {
+		return nil, err
+	}
+	if lastID == 0 {
+		return nil, ErrNothingToArchive
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("创建归档目录失败: %w", err)
+	}
+	name := fmt.Sprintf("audit-%s-%d.jsonl.gz", time.Now().Format("20060102-150405"), lastID)
+	path := filepath.Join(dir, name)
+	anchor, err := writeArchive(db, path, lastID)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	anchor.CreatedBy = createdBy
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := lockChain(tx); err != nil {
+			return err
+		}
+		if err := tx.Create(anchor).Error; err != nil {
+			return err
+		}
+		return tx.Where("id <= ?", lastID).Delete(&models.AuditLog{}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("保存归档锚点失败（归档文件已保留: %s）: %w", path, err)
+	}
+	return anchor, nil
+}
+
+func writeArchive(db *gorm.DB, path string, lastID uint) (*models.AuditLogAnchor, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("创建归档文件失败: %w", err)
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(file, hasher))
+	enc := json.NewEncoder(gz)
+	anchor := &models.AuditLogAnchor{ArchiveFile: filepath.Base(path)}
+
+	var batch []models.AuditLog
+	err = db.Where("id <= ?", lastID).Order("id ASC").FindInBatches(&batch, 1000, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			entry := &batch[i]
+			if anchor.Count == 0 {
+				anchor.FirstID = entry.ID
+				anchor.PrevHash = entry.PrevHash
+			}
+			if err := enc.Encode(entry); err != nil {
+				return err
+			}
+			anchor.Count++
+			anchor.LastID = entry.ID
+			anchor.LastHash = entry.Hash
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("写入归档文件失败: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("写入归档文件失败: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return nil, fmt.Errorf("写入归档文件失败: %w", err)
+	}
+	anchor.FileSHA256 = hex.EncodeToString(hasher.Sum(nil))
+	return anchor, nil
+}
+
+// VerifyArchive 校验归档文件：文件摘要、内部链条以及与锚点记录的首尾哈希
+func VerifyArchive(dir string, anchor *models.AuditLogAnchor) (*Report, error) {
+	data, err := os.ReadFile(filepath.Join(dir, filepath.Base(anchor.ArchiveFile)))
+	if err != nil {
+		return nil, fmt.Errorf("读取归档文件失败: %w", err)
+	}
+	report := &Report{Issues: []Issue{}, Anchors: 1}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != anchor.FileSHA256 {
+		report.addIssue(anchor.FirstID, "modified", "归档文件摘要与锚点记录不符")
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解压归档文件失败: %w", err)
+	}
+	walker := &chainWalker{report: report, expected: anchor.PrevHash, known: true, started: anchor.PrevHash != ""}
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	var count int64
+	for scanner.Scan() {
+		var entry models.AuditLog
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("解析归档记录失败: %w", err)
+		}
+		walker.check(&entry)
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取归档文件失败: %w", err)
+	}
+	if count != anchor.Count || report.HeadHash != anchor.LastHash {
+		report.addIssue(anchor.LastID, "broken_link", "归档文件的记录数或链尾哈希与锚点不符")
+	}
+	report.Valid = report.IssueCount == 0
+	return report, nil
+}
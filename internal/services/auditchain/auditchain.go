@@ -0,0 +1,256 @@
+package auditchain
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"cboard-go/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxIssues 校验报告中最多列出的问题数
+const maxIssues = 100
+
+// 同一进程内串行追加，多实例部署时由事务中对 audit_chain_locks 的行锁保证顺序
+var appendMu sync.Mutex
+
+// chainLockID 追加锁所在的行
+const chainLockID = 1
+
+// 参与哈希的字段，顺序固定；新增字段只能追加在末尾且为空时不输出，否则旧记录校验失败
+type entryContent struct {
+	PrevHash          string          `json:"prev_hash"`
+	UserID            *int64          `json:"user_id"`
+	ActionType        string          `json:"action_type"`
+	ResourceType      *string         `json:"resource_type"`
+	ResourceID        *int64          `json:"resource_id"`
+	ActionDescription *string         `json:"action_description"`
+	IPAddress         *string         `json:"ip_address"`
+	UserAgent         *string         `json:"user_agent"`
+	Location          *string         `json:"location"`
+	RequestMethod     *string         `json:"request_method"`
+	RequestPath       *string         `json:"request_path"`
+	RequestParams     json.RawMessage `json:"request_params"`
+	ResponseStatus    *int64          `json:"response_status"`
+	BeforeData        json.RawMessage `json:"before_data"`
+	AfterData         json.RawMessage `json:"after_data"`
+	CreatedAt         int64           `json:"created_at"`
+}
+
+func nullString(v sql.NullString) *string {
+	if !v.Valid {
+		return nil
+	}
+	return &v.String
+}
+
+func nullInt(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Int64
+}
+
+// canonicalJSON 统一 JSON 字段的格式。MySQL 的 json 类型和 PostgreSQL 会重排键、去掉空白，
+// 直接对原文计算哈希会导致读回后校验失败
+func canonicalJSON(v sql.NullString) json.RawMessage {
+	if !v.Valid {
+		return json.RawMessage("null")
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(v.String), &decoded); err == nil {
+		if data, err := json.Marshal(decoded); err == nil {
+			return data
+		}
+	}
+	data, _ := json.Marshal(v.String)
+	return data
+}
+
+// ComputeHash 计算日志记录的哈希，覆盖内容与上一条记录的哈希
+func ComputeHash(entry *models.AuditLog) string {
+	content := entryContent{
+		PrevHash:          entry.PrevHash,
+		UserID:            nullInt(entry.UserID),
+		ActionType:        entry.ActionType,
+		ResourceType:      nullString(entry.ResourceType),
+		ResourceID:        nullInt(entry.ResourceID),
+		ActionDescription: nullString(entry.ActionDescription),
+		IPAddress:         nullString(entry.IPAddress),
+		UserAgent:         nullString(entry.UserAgent),
+		Location:          nullString(entry.Location),
+		RequestMethod:     nullString(entry.RequestMethod),
+		RequestPath:       nullString(entry.RequestPath),
+		RequestParams:     canonicalJSON(entry.RequestParams),
+		ResponseStatus:    nullInt(entry.ResponseStatus),
+		BeforeData:        canonicalJSON(entry.BeforeData),
+		AfterData:         canonicalJSON(entry.AfterData),
+		CreatedAt:         entry.CreatedAt.Unix(),
+	}
+	data, _ := json.Marshal(content)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// lockChain 在事务中更新追加锁所在的行，直到事务结束其他实例的追加都会等待。
+// 不能依赖对链尾 SELECT ... FOR UPDATE：PostgreSQL READ COMMITTED 下两个事务可能读到同一链尾而分叉，
+// SQLite 则直接忽略该子句；先写再读也让 SQLite 的事务一开始就取得写锁
+func lockChain(tx *gorm.DB) error {
+	touch := func() (int64, error) {
+		result := tx.Model(&models.AuditChainLock{}).Where("id = ?", chainLockID).Update("updated_at", time.Now())
+		return result.RowsAffected, result.Error
+	}
+	if n, err := touch(); err != nil || n > 0 {
+		return err
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.AuditChainLock{ID: chainLockID}).Error; err != nil {
+		return err
+	}
+	_, err := touch()
+	return err
+}
+
+// headHash 链尾哈希：最后一条日志的哈希，日志已全部归档时取最后一个锚点
+func headHash(tx *gorm.DB) (string, error) {
+	var last models.AuditLog
+	err := tx.Select("id", "hash").Order("id DESC").Limit(1).Find(&last).Error
+	if err != nil {
+		return "", err
+	}
+	if last.ID != 0 {
+		return last.Hash, nil
+	}
+	var anchor models.AuditLogAnchor
+	if err := tx.Order("id DESC").Limit(1).Find(&anchor).Error; err != nil {
+		return "", err
+	}
+	return anchor.LastHash, nil
+}
+
+// Append 将日志接到链尾并写入。创建时间截断到秒，避免数据库精度不同导致哈希不一致
+func Append(db *gorm.DB, entry *models.AuditLog) error {
+	appendMu.Lock()
+	defer appendMu.Unlock()
+	return appendEntry(db, entry)
+}
+
+func appendEntry(db *gorm.DB, entry *models.AuditLog) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := lockChain(tx); err != nil {
+			return err
+		}
+		prev, err := headHash(tx)
+		if err != nil {
+			return err
+		}
+		if entry.CreatedAt.IsZero() {
+			entry.CreatedAt = time.Now()
+		}
+		entry.CreatedAt = entry.CreatedAt.Truncate(time.Second)
+		entry.PrevHash = prev
+		entry.Hash = ComputeHash(entry)
+		return tx.Create(entry).Error
+	})
+}
+
+// Issue 校验发现的问题
+type Issue struct {
+	ID     uint   `json:"id"`
+	Kind   string `json:"kind"` // modified、broken_link、unsealed、anchor_mismatch
+	Detail string `json:"detail"`
+}
+
+// Report 哈希链校验结果
+type Report struct {
+	Valid      bool    `json:"valid"`
+	Checked    int64   `json:"checked"`
+	Legacy     int64   `json:"legacy"` // 启用哈希链之前的记录，无法校验
+	Anchors    int     `json:"anchors"`
+	FirstID    uint    `json:"first_id,omitempty"`
+	LastID     uint    `json:"last_id,omitempty"`
+	HeadHash   string  `json:"head_hash"`
+	IssueCount int     `json:"issue_count"`
+	Issues     []Issue `json:"issues"`
+}
+
+func (r *Report) addIssue(id uint, kind, detail string) {
+	r.IssueCount++
+	if len(r.Issues) < maxIssues {
+		r.Issues = append(r.Issues, Issue{ID: id, Kind: kind, Detail: detail})
+	}
+}
+
+// chainWalker 依次检查记录的哈希与链接
+type chainWalker struct {
+	report   *Report
+	expected string
+	known    bool // expected 是否可信；遇到未签名记录后无法判断下一条的链接
+	started  bool
+}
+
+func (w *chainWalker) check(entry *models.AuditLog) {
+	r := w.report
+	if entry.Hash == "" {
+		if !w.started {
+			r.Legacy++
+			return
+		}
+		r.addIssue(entry.ID, "unsealed", "记录缺少哈希，可能被篡改")
+		w.known = false
+		return
+	}
+	w.started = true
+	r.Checked++
+	if r.FirstID == 0 {
+		r.FirstID = entry.ID
+	}
+	r.LastID = entry.ID
+	if w.known && entry.PrevHash != w.expected {
+		r.addIssue(entry.ID, "broken_link", "与上一条记录不连续，中间可能有记录被删除或插入")
+	}
+	if ComputeHash(entry) != entry.Hash {
+		r.addIssue(entry.ID, "modified", "记录内容与哈希不符，可能被修改")
+	}
+	w.expected, w.known = entry.Hash, true
+	r.HeadHash = entry.Hash
+}
+
+// Verify 从最后一个归档锚点开始遍历日志表，报告缺失与被修改的记录
+func Verify(db *gorm.DB) (*Report, error) {
+	report := &Report{Issues: []Issue{}}
+
+	var anchors []models.AuditLogAnchor
+	if err := db.Order("id ASC").Find(&anchors).Error; err != nil {
+		return nil, err
+	}
+	report.Anchors = len(anchors)
+	walker := &chainWalker{report: report, known: true}
+	for i, a := range anchors {
+		if i > 0 && a.PrevHash != anchors[i-1].LastHash {
+			report.addIssue(a.FirstID, "anchor_mismatch", fmt.Sprintf("归档锚点 #%d 与上一个锚点不连续", a.ID))
+		}
+		walker.expected = a.LastHash
+		walker.started = walker.started || a.LastHash != ""
+		report.HeadHash = a.LastHash
+	}
+
+	var batch []models.AuditLog
+	err := db.Model(&models.AuditLog{}).Order("id ASC").FindInBatches(&batch, 1000, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			walker.check(&batch[i])
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	report.Valid = report.IssueCount == 0
+	return report, nil
+}
@@ -0,0 +1,186 @@
+package auditchain
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"cboard-go/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.AuditLog{}, &models.AuditLogAnchor{}, &models.AuditChainLock{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func appendN(t *testing.T, db *gorm.DB, n int) []models.AuditLog {
+	var logs []models.AuditLog
+	for i := 0; i < n; i++ {
+		entry := models.AuditLog{
+			UserID:            sql.NullInt64{Int64: 1, Valid: true},
+			ActionType:        "update_user",
+			ResourceType:      sql.NullString{String: "user", Valid: true},
+			ActionDescription: sql.NullString{String: fmt.Sprintf("第 %d 条", i), Valid: true},
+			BeforeData:        sql.NullString{String: `{"b": 1, "a": [1, 2]}`, Valid: true},
+		}
+		if err := Append(db, &entry); err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, entry)
+	}
+	return logs
+}
+
+func issueKinds(r *Report) map[uint]string {
+	kinds := make(map[uint]string)
+	for _, issue := range r.Issues {
+		kinds[issue.ID] = issue.Kind
+	}
+	return kinds
+}
+
+func TestVerifyChain(t *testing.T) {
+	db := setupDB(t)
+	// 启用哈希链之前的历史记录
+	db.Create(&models.AuditLog{ActionType: "legacy"})
+	logs := appendN(t, db, 5)
+
+	report, err := Verify(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid || report.Checked != 5 || report.Legacy != 1 || report.HeadHash != logs[4].Hash {
+		t.Fatalf("intact chain: %+v", report)
+	}
+
+	// 修改内容
+	db.Model(&models.AuditLog{}).Where("id = ?", logs[1].ID).Update("action_description", "篡改")
+	// 删除中间记录
+	db.Delete(&models.AuditLog{}, logs[3].ID)
+
+	report, _ = Verify(db)
+	kinds := issueKinds(report)
+	if report.Valid || kinds[logs[1].ID] != "modified" || kinds[logs[4].ID] != "broken_link" || report.IssueCount != 2 {
+		t.Fatalf("tampered chain: %+v", report)
+	}
+
+	// 抹掉哈希伪装成历史记录
+	db.Model(&models.AuditLog{}).Where("id = ?", logs[2].ID).Updates(map[string]interface{}{"hash": "", "prev_hash": ""})
+	report, _ = Verify(db)
+	if kinds := issueKinds(report); kinds[logs[2].ID] != "unsealed" {
+		t.Fatalf("unsealed entry not reported: %+v", report)
+	}
+}
+
+// 两个连接模拟两个实例同时追加，链条不能分叉
+func TestAppendFromInstances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.db")
+	open := func() *gorm.DB {
+		db, err := gorm.Open(sqlite.Open(path+"?_busy_timeout=10000"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+	first, second := open(), open()
+	if err := first.AutoMigrate(&models.AuditLog{}, &models.AuditLogAnchor{}, &models.AuditChainLock{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for _, db := range []*gorm.DB{first, second} {
+		wg.Add(1)
+		go func(db *gorm.DB) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				// 跳过进程内互斥锁，只依赖数据库锁
+				errs <- appendEntry(db, &models.AuditLog{ActionType: "update_user"})
+			}
+		}(db)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := Verify(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid || report.Checked != 40 {
+		t.Fatalf("concurrent appends: %+v", report)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	db := setupDB(t)
+	dir := t.TempDir()
+	SetArchiveDir(dir)
+	t.Cleanup(func() { SetArchiveDir("") })
+
+	logs := appendN(t, db, 4)
+	anchor, err := Archive(db, time.Now().Add(time.Hour), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anchor.Count != 4 || anchor.LastID != logs[3].ID || anchor.LastHash != logs[3].Hash {
+		t.Fatalf("anchor: %+v", anchor)
+	}
+	var remaining int64
+	db.Model(&models.AuditLog{}).Count(&remaining)
+	if remaining != 0 {
+		t.Fatalf("archived logs still in table: %d", remaining)
+	}
+	if _, err := Archive(db, time.Now().Add(time.Hour), nil); err != ErrNothingToArchive {
+		t.Fatalf("empty archive: %v", err)
+	}
+
+	// 归档后的新日志从锚点接续
+	next := appendN(t, db, 2)
+	if next[0].PrevHash != anchor.LastHash {
+		t.Fatal("new entry should link to the archive anchor")
+	}
+	report, _ := Verify(db)
+	if !report.Valid || report.Checked != 2 || report.Anchors != 1 {
+		t.Fatalf("chain after archive: %+v", report)
+	}
+
+	archived, err := VerifyArchive(dir, anchor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !archived.Valid || archived.Checked != 4 {
+		t.Fatalf("archive file: %+v", archived)
+	}
+
+	// 锚点被改动后剩余日志无法接续
+	db.Model(anchor).Update("last_hash", "0000")
+	if report, _ := Verify(db); report.Valid {
+		t.Fatal("tampered anchor not detected")
+	}
+}
+
+func TestArchiveRequiresDir(t *testing.T) {
+	db := setupDB(t)
+	appendN(t, db, 1)
+	if _, err := Archive(db, time.Now().Add(time.Hour), nil); err == nil {
+		t.Fatal("archive without a directory should fail")
+	}
+}
@@ -0,0 +1,271 @@
+package captcha
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"cboard-go/internal/core/kvstore"
+)
+
+const (
+	challengeTTL = 5 * time.Minute
+	imageWidth   = 150
+	imageHeight  = 50
+)
+
+// Challenge 自建验证码题目，Image 为 data URI 格式的 PNG 图片
+type Challenge struct {
+	ID        string `json:"captcha_id"`
+	Image     string `json:"image"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+// Builtin 自建算术图片验证码，答案保存在 kvstore 中，多实例部署时需使用共享存储。
+// 前端提交的 token 格式为 "captcha_id:答案"
+type Builtin struct {
+	store kvstore.Store // 为空时使用 kvstore.Default()
+}
+
+func NewBuiltin(store kvstore.Store) *Builtin {
+	return &Builtin{store: store}
+}
+
+func (b *Builtin) backend() kvstore.Store {
+	if b.store != nil {
+		return b.store
+	}
+	return kvstore.Default()
+}
+
+func (b *Builtin) Name() string { return ProviderBuiltin }
+
+func challengeKey(id string) string {
+	return "captcha:challenge:" + id
+}
+
+func usedKey(id string) string {
+	return "captcha:used:" + id
+}
+
+func randInt(n int) int {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0
+	}
+	return int(v.Int64())
+}
+
+// question 生成算术题，减法保证结果不为负数
+func question() (string, int) {
+	a, b := randInt(20)+1, randInt(9)+1
+	switch randInt(3) {
+	case 0:
+		return fmt.Sprintf("%d+%d=?", a, b), a + b
+	case 1:
+		if a < b {
+			a, b = b, a
+		}
+		return fmt.Sprintf("%d-%d=?", a, b), a - b
+	default:
+		a = randInt(9) + 1
+		return fmt.Sprintf("%d×%d=?", a, b), a * b
+	}
+}
+
+// NewChallenge 生成一道新题目
+func (b *Builtin) NewChallenge() (*Challenge, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(buf)
+	text, answer := question()
+	img, err := renderPNG(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.backend().Set(challengeKey(id), strconv.Itoa(answer), challengeTTL); err != nil {
+		return nil, err
+	}
+	return &Challenge{
+		ID:        id,
+		Image:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(img),
+		ExpiresIn: int(challengeTTL.Seconds()),
+	}, nil
+}
+
+// Verify 校验答案，每道题只能提交一次，答错需重新获取
+func (b *Builtin) Verify(_ context.Context, token, _ string) error {
+	id, answer, ok := strings.Cut(strings.TrimSpace(token), ":")
+	if !ok || id == "" {
+		return ErrRequired
+	}
+	store := b.backend()
+	expected, _, found, err := store.Get(challengeKey(id))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: 验证码已过期", ErrInvalid)
+	}
+	// 多个实例同时提交同一道题时只有第一个生效
+	if n, _, err := store.Incr(usedKey(id), challengeTTL); err != nil {
+		return err
+	} else if n > 1 {
+		return fmt.Errorf("%w: 验证码已使用", ErrInvalid)
+	}
+	_ = store.Delete(challengeKey(id))
+	if strings.TrimSpace(answer) != expected {
+		return fmt.Errorf("%w: 答案错误", ErrInvalid)
+	}
+	return nil
+}
+
+// glyphs 5x7 点阵字形，渲染时放大并做旋转和扭曲，题目不会以文字形式出现在图片数据中
+var glyphs = map[rune][7]string{
+	'0': {"01110", "10001", "10011", "10101", "11001", "10001", "01110"},
+	'1': {"00100", "01100", "00100", "00100", "00100", "00100", "01110"},
+	'2': {"01110", "10001", "00001", "00010", "00100", "01000", "11111"},
+	'3': {"11110", "00001", "00001", "01110", "00001", "00001", "11110"},
+	'4': {"00010", "00110", "01010", "10010", "11111", "00010", "00010"},
+	'5': {"11111", "10000", "11110", "00001", "00001", "10001", "01110"},
+	'6': {"00110", "01000", "10000", "11110", "10001", "10001", "01110"},
+	'7': {"11111", "00001", "00010", "00100", "01000", "01000", "01000"},
+	'8': {"01110", "10001", "10001", "01110", "10001", "10001", "01110"},
+	'9': {"01110", "10001", "10001", "01111", "00001", "00010", "01100"},
+	'+': {"00000", "00100", "00100", "11111", "00100", "00100", "00000"},
+	'-': {"00000", "00000", "00000", "11111", "00000", "00000", "00000"},
+	'×': {"00000", "10001", "01010", "00100", "01010", "10001", "00000"},
+	'=': {"00000", "00000", "11111", "00000", "11111", "00000", "00000"},
+	'?': {"01110", "10001", "00001", "00010", "00100", "00000", "00100"},
+}
+
+var inkColors = []color.RGBA{
+	{0x1f, 0x29, 0x37, 0xff}, {0x1d, 0x4e, 0xd8, 0xff}, {0xb9, 0x1c, 0x1c, 0xff},
+	{0x04, 0x78, 0x57, 0xff}, {0x7c, 0x3a, 0xed, 0xff}, {0xb4, 0x53, 0x09, 0xff},
+}
+
+func randFloat(min, max float64) float64 {
+	return min + (max-min)*float64(randInt(10000))/10000
+}
+
+func randColor() color.RGBA {
+	return inkColors[randInt(len(inkColors))]
+}
+
+// drawGlyph 以 (cx, cy) 为中心绘制放大、旋转后的字形
+func drawGlyph(img *image.RGBA, ch rune, cx, cy, scale, angle float64, c color.RGBA) {
+	g, ok := glyphs[ch]
+	if !ok {
+		return
+	}
+	sin, cos := math.Sin(angle), math.Cos(angle)
+	w, h := 5*scale, 7*scale
+	r := int(math.Hypot(w, h)/2) + 1
+	for y := int(cy) - r; y <= int(cy)+r; y++ {
+		for x := int(cx) - r; x <= int(cx)+r; x++ {
+			// 反向旋转回字形坐标后取点
+			dx, dy := float64(x)-cx, float64(y)-cy
+			gx := (dx*cos+dy*sin)/scale + 2.5
+			gy := (-dx*sin+dy*cos)/scale + 3.5
+			col, row := int(math.Floor(gx)), int(math.Floor(gy))
+			if gx < 0 || gy < 0 || col > 4 || row > 6 || g[row][col] != '1' {
+				continue
+			}
+			if image.Pt(x, y).In(img.Bounds()) {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
+
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx, dy := math.Abs(float64(x1-x0)), -math.Abs(float64(y1-y0))
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		if image.Pt(x0, y0).In(img.Bounds()) {
+			img.SetRGBA(x0, y0, c)
+		}
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * e; e2 >= dy {
+			e += dy
+			x0 += sx
+		} else {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+// warp 正弦波扭曲整幅图片
+func warp(src *image.RGBA, bg color.RGBA) *image.RGBA {
+	dst := image.NewRGBA(src.Bounds())
+	ax, ay := randFloat(2, 4), randFloat(1.5, 3)
+	px, py := randFloat(18, 30), randFloat(40, 70)
+	phx, phy := randFloat(0, 2*math.Pi), randFloat(0, 2*math.Pi)
+	for y := 0; y < imageHeight; y++ {
+		for x := 0; x < imageWidth; x++ {
+			sx := x + int(ax*math.Sin(2*math.Pi*float64(y)/px+phx))
+			sy := y + int(ay*math.Sin(2*math.Pi*float64(x)/py+phy))
+			if image.Pt(sx, sy).In(src.Bounds()) {
+				dst.SetRGBA(x, y, src.RGBAAt(sx, sy))
+			} else {
+				dst.SetRGBA(x, y, bg)
+			}
+		}
+	}
+	return dst
+}
+
+// renderPNG 绘制题目图片：点阵字形随机缩放、偏移和旋转，整体波形扭曲并叠加干扰线和噪点
+func renderPNG(text string) ([]byte, error) {
+	bg := color.RGBA{0xf3, 0xf4, 0xf6, 0xff}
+	img := image.NewRGBA(image.Rect(0, 0, imageWidth, imageHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: bg}, image.Point{}, draw.Src)
+
+	for i := 0; i < 4; i++ {
+		drawLine(img, randInt(imageWidth), randInt(imageHeight), randInt(imageWidth), randInt(imageHeight), randColor())
+	}
+	chars := []rune(text)
+	step := float64(imageWidth-20) / float64(len(chars))
+	for i, ch := range chars {
+		cx := 10 + step*(float64(i)+0.5) + randFloat(-2, 2)
+		cy := float64(imageHeight)/2 + randFloat(-5, 5)
+		drawGlyph(img, ch, cx, cy, randFloat(3.2, 4), randFloat(-0.35, 0.35), randColor())
+	}
+	img = warp(img, bg)
+	for i := 0; i < 3; i++ {
+		drawLine(img, 0, randInt(imageHeight), imageWidth-1, randInt(imageHeight), randColor())
+	}
+	for i := 0; i < 120; i++ {
+		img.SetRGBA(randInt(imageWidth), randInt(imageHeight), randColor())
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,172 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"cboard-go/internal/core/kvstore"
+	"cboard-go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ProviderNone      = "none"
+	ProviderTurnstile = "turnstile"
+	ProviderHCaptcha  = "hcaptcha"
+	ProviderBuiltin   = "builtin"
+
+	// ModeOff 不校验；ModeAlways 每次请求都校验；ModeAdaptive 仅对可疑 IP 校验
+	ModeOff      = "off"
+	ModeAlways   = "always"
+	ModeAdaptive = "adaptive"
+
+	turnstileVerifyURL = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+	hcaptchaVerifyURL  = "https://api.hcaptcha.com/siteverify"
+
+	// suspectTTL 被标记为可疑的 IP 在此时间内需要完成人机验证
+	suspectTTL = 1 * time.Hour
+)
+
+var (
+	ErrRequired = errors.New("请完成人机验证")
+	ErrInvalid  = errors.New("人机验证失败，请重试")
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Provider 人机验证服务，token 为前端完成验证后得到的凭证
+type Provider interface {
+	Name() string
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+// siteVerifyProvider Turnstile 与 hCaptcha 使用相同的 siteverify 协议
+type siteVerifyProvider struct {
+	name      string
+	verifyURL string
+	secret    string
+}
+
+func Turnstile(secret string) Provider {
+	return &siteVerifyProvider{name: ProviderTurnstile, verifyURL: turnstileVerifyURL, secret: secret}
+}
+
+func HCaptcha(secret string) Provider {
+	return &siteVerifyProvider{name: ProviderHCaptcha, verifyURL: hcaptchaVerifyURL, secret: secret}
+}
+
+func (p *siteVerifyProvider) Name() string { return p.name }
+
+func (p *siteVerifyProvider) Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return ErrRequired
+	}
+	form := url.Values{"secret": {p.secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求 %s 校验接口失败: %w", p.name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s 校验接口返回 HTTP %d", p.name, resp.StatusCode)
+	}
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("解析 %s 校验结果失败: %w", p.name, err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%w: %s", ErrInvalid, strings.Join(result.ErrorCodes, ","))
+	}
+	return nil
+}
+
+// Settings security 分类下的人机验证配置
+type Settings struct {
+	Mode     string
+	SiteKey  string
+	Provider Provider
+}
+
+// Enabled 是否需要校验；配置不完整时视为关闭
+func (s *Settings) Enabled() bool {
+	return s != nil && s.Mode != ModeOff && s.Provider != nil
+}
+
+// ProviderName 当前服务名称，未启用时为 none
+func (s *Settings) ProviderName() string {
+	if s == nil || s.Provider == nil {
+		return ProviderNone
+	}
+	return s.Provider.Name()
+}
+
+// LoadSettings 读取人机验证配置；第三方服务缺少密钥时返回错误且不启用
+func LoadSettings(db *gorm.DB) (*Settings, error) {
+	var configs []models.SystemConfig
+	if err := db.Where("category = ? AND key LIKE ?", "security", "captcha_%").Find(&configs).Error; err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, len(configs))
+	for _, c := range configs {
+		m[c.Key] = strings.TrimSpace(c.Value)
+	}
+
+	s := &Settings{Mode: ModeOff, SiteKey: m["captcha_site_key"]}
+	switch m["captcha_mode"] {
+	case ModeAlways, ModeAdaptive:
+		s.Mode = m["captcha_mode"]
+	}
+
+	switch m["captcha_provider"] {
+	case ProviderTurnstile, ProviderHCaptcha:
+		if m["captcha_secret_key"] == "" || s.SiteKey == "" {
+			return s, fmt.Errorf("%s 未配置站点密钥或服务端密钥", m["captcha_provider"])
+		}
+		if m["captcha_provider"] == ProviderTurnstile {
+			s.Provider = Turnstile(m["captcha_secret_key"])
+		} else {
+			s.Provider = HCaptcha(m["captcha_secret_key"])
+		}
+	case ProviderBuiltin:
+		s.Provider = NewBuiltin(nil)
+	}
+	return s, nil
+}
+
+func suspectKey(ip string) string {
+	return "captcha:suspect:" + ip
+}
+
+// MarkSuspicious 标记 IP，自适应模式下该 IP 在一段时间内需要完成人机验证
+func MarkSuspicious(ip string) error {
+	if ip == "" {
+		return nil
+	}
+	return kvstore.Default().Set(suspectKey(ip), "1", suspectTTL)
+}
+
+func IsSuspicious(ip string) bool {
+	if ip == "" {
+		return false
+	}
+	_, _, found, err := kvstore.Default().Get(suspectKey(ip))
+	return err == nil && found
+}
@@ -0,0 +1,137 @@
+package captcha
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cboard-go/internal/core/kvstore"
+	"cboard-go/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestSiteVerify(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("secret") != "server-secret" || r.PostForm.Get("remoteip") != "203.0.113.9" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("response") == "good" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error-codes": []string{"invalid-input-response"}})
+	}))
+	defer srv.Close()
+
+	for _, p := range []*siteVerifyProvider{
+		Turnstile("server-secret").(*siteVerifyProvider),
+		HCaptcha("server-secret").(*siteVerifyProvider),
+	} {
+		p.verifyURL = srv.URL
+		if err := p.Verify(context.Background(), "good", "203.0.113.9"); err != nil {
+			t.Errorf("%s: valid token rejected: %v", p.name, err)
+		}
+		if err := p.Verify(context.Background(), "bad", "203.0.113.9"); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: invalid token should fail with ErrInvalid, got %v", p.name, err)
+		}
+		if err := p.Verify(context.Background(), "", "203.0.113.9"); !errors.Is(err, ErrRequired) {
+			t.Errorf("%s: empty token should fail with ErrRequired, got %v", p.name, err)
+		}
+	}
+
+	// 校验接口异常不属于验证失败，由调用方决定是否放行
+	down := Turnstile("server-secret").(*siteVerifyProvider)
+	down.verifyURL = srv.URL
+	if err := down.Verify(context.Background(), "good", "198.51.100.1"); err == nil || errors.Is(err, ErrInvalid) {
+		t.Errorf("unavailable service should return a non-ErrInvalid error, got %v", err)
+	}
+}
+
+func TestBuiltinChallenge(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	b := NewBuiltin(store)
+
+	ch, err := b.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ch.Image, "data:image/png;base64,"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil || img.Bounds().Dx() != imageWidth || img.Bounds().Dy() != imageHeight {
+		t.Fatalf("image should be a base64 png: %v", err)
+	}
+	answer, _, _, _ := store.Get(challengeKey(ch.ID))
+
+	if err := b.Verify(context.Background(), ch.ID+":"+answer, ""); err != nil {
+		t.Fatalf("correct answer rejected: %v", err)
+	}
+	if err := b.Verify(context.Background(), ch.ID+":"+answer, ""); !errors.Is(err, ErrInvalid) {
+		t.Errorf("challenge must be single use, got %v", err)
+	}
+
+	// 答错后题目作废，不能继续猜
+	ch, _ = b.NewChallenge()
+	answer, _, _, _ = store.Get(challengeKey(ch.ID))
+	if err := b.Verify(context.Background(), ch.ID+":wrong", ""); !errors.Is(err, ErrInvalid) {
+		t.Errorf("wrong answer should fail, got %v", err)
+	}
+	if err := b.Verify(context.Background(), ch.ID+":"+answer, ""); !errors.Is(err, ErrInvalid) {
+		t.Errorf("challenge must be discarded after a wrong answer, got %v", err)
+	}
+
+	if err := b.Verify(context.Background(), "no-separator", ""); !errors.Is(err, ErrRequired) {
+		t.Errorf("malformed token should fail with ErrRequired, got %v", err)
+	}
+}
+
+func TestLoadSettings(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.SystemConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	set := func(key, value string) {
+		db.Where("category = ? AND key = ?", "security", key).Delete(&models.SystemConfig{})
+		db.Create(&models.SystemConfig{Category: "security", Key: key, Value: value})
+	}
+
+	s, err := LoadSettings(db)
+	if err != nil || s.Enabled() || s.ProviderName() != ProviderNone {
+		t.Fatalf("captcha should be off by default: %+v %v", s, err)
+	}
+
+	set("captcha_mode", ModeAdaptive)
+	set("captcha_provider", ProviderTurnstile)
+	if s, err = LoadSettings(db); err == nil || s.Enabled() {
+		t.Error("turnstile without keys must not be enabled")
+	}
+
+	set("captcha_site_key", "site")
+	set("captcha_secret_key", "secret")
+	if s, err = LoadSettings(db); err != nil || !s.Enabled() || s.ProviderName() != ProviderTurnstile || s.Mode != ModeAdaptive {
+		t.Errorf("turnstile should be enabled: %+v %v", s, err)
+	}
+
+	set("captcha_provider", ProviderBuiltin)
+	set("captcha_mode", "sometimes")
+	if s, _ = LoadSettings(db); s.Enabled() || s.ProviderName() != ProviderBuiltin {
+		t.Errorf("unknown mode should fall back to off: %+v", s)
+	}
+}
@@ -16,6 +16,7 @@ import (
 
 	"cboard-go/internal/core/database"
 	"cboard-go/internal/models"
+	"cboard-go/internal/services/device"
 	"cboard-go/internal/utils"
 
 	"gorm.io/gorm"
@@ -31,6 +32,8 @@ const (
 	StatusDeviceOverLimit                    // 设备超限
 	StatusOldAddress                         // 旧订阅地址
 	StatusNotFound                           // 订阅不存在
+	StatusDevicePending                      // 设备待审批
+	StatusDeviceDenied                       // 设备已被拒绝
 )
 
 var nodeLinkPatterns = []*regexp.Regexp{
@@ -67,8 +70,13 @@ type SubscriptionContext struct {
 	ResetRecord    *models.SubscriptionReset // 如果是旧订阅地址，这里会有记录
 	CurrentDevices int
 	DeviceLimit    int
+	Device         *models.Device // 本次访问对应的设备
+	Admission      *device.Admission
 }
 
+// AdmitFunc 订阅与账户校验通过后才执行的设备准入，过期或被禁用的订阅不会登记设备
+type AdmitFunc func(sub *models.Subscription) *device.Admission
+
 type ConfigUpdateService struct {
 	db            *gorm.DB
 	isRunning     bool
@@ -906,28 +914,14 @@ func (s *ConfigUpdateService) fetchProxiesForUser(user models.User, sub models.S
 	processedNodes := make(map[string]bool)
 	now := utils.GetBeijingTime()
 	isOrdExpired := !sub.ExpireTime.IsZero() && sub.ExpireTime.Before(now)
-	var specialExpireTime time.Time
-	hasSpecialExpireTime := false
-	if user.SpecialNodeExpiresAt.Valid {
-		specialExpireTime = utils.ToBeijingTime(user.SpecialNodeExpiresAt.Time)
-		hasSpecialExpireTime = true
-	} else if user.SpecialNodeSubscriptionType != "special_only" && !sub.ExpireTime.IsZero() {
-		specialExpireTime = utils.ToBeijingTime(sub.ExpireTime)
-		hasSpecialExpireTime = true
-	}
-	isSpecialExpired := hasSpecialExpireTime && specialExpireTime.Before(now)
-	var customNodes []models.CustomNode
-	if err := s.db.Joins("JOIN user_custom_nodes ON user_custom_nodes.custom_node_id = custom_nodes.id").
-		Where("user_custom_nodes.user_id = ? AND custom_nodes.is_active = ?", user.ID, true).
-		Find(&customNodes).Error; err == nil {
-		for _, cn := range customNodes {
-			isSpecNodeExpired := false
-			if cn.ExpireTime != nil {
-				isSpecNodeExpired = utils.ToBeijingTime(*cn.ExpireTime).Before(now)
-			} else if cn.FollowUserExpire {
-				isSpecNodeExpired = isSpecialExpired
+	var userNodes []models.UserCustomNode
+	if err := s.db.Preload("CustomNode").Where("user_id = ?", user.ID).Find(&userNodes).Error; err == nil {
+		for i := range userNodes {
+			cn := userNodes[i].CustomNode
+			if cn.ID == 0 || !cn.IsActive {
+				continue
 			}
-			if isSpecNodeExpired || cn.Status == "timeout" {
+			if IsCustomNodeExpired(user, sub, cn, now) || cn.Status == "timeout" {
 				continue
 			}
 			displayName := cn.DisplayName
@@ -938,6 +932,12 @@ func (s *ConfigUpdateService) fetchProxiesForUser(user models.User, sub models.S
 				var proxyNode ProxyNode
 				if err := json.Unmarshal([]byte(cn.Config), &proxyNode); err == nil {
 					proxyNode.Name = displayName
+					// 补全专属凭据失败时跳过该节点，不能下发节点配置中的共享凭据
+					if err := EnsureUserNodeCredentials(s.db, &userNodes[i]); err != nil {
+						s.log("ERROR", fmt.Sprintf("生成专线节点凭据失败: 用户 %d, 节点 %s, 错误: %v", user.ID, cn.Name, err))
+						continue
+					}
+					ApplyUserCredentials(&proxyNode, userNodes[i].UUID, userNodes[i].Password)
 					proxies = append(proxies, &proxyNode)
 					key := s.generateNodeDedupKey(proxyNode.Type, proxyNode.Server, proxyNode.Port)
 					processedNodes[key] = true
@@ -966,6 +966,23 @@ func (s *ConfigUpdateService) fetchProxiesForUser(user models.User, sub models.S
 	return proxies, nil
 }
 
+// IsCustomNodeExpired 判断专线节点对该用户是否已过期（节点自身到期时间或跟随用户到期）
+func IsCustomNodeExpired(user models.User, sub models.Subscription, cn models.CustomNode, now time.Time) bool {
+	if cn.ExpireTime != nil {
+		return utils.ToBeijingTime(*cn.ExpireTime).Before(now)
+	}
+	if !cn.FollowUserExpire {
+		return false
+	}
+	if user.SpecialNodeExpiresAt.Valid {
+		return utils.ToBeijingTime(user.SpecialNodeExpiresAt.Time).Before(now)
+	}
+	if user.SpecialNodeSubscriptionType != "special_only" && !sub.ExpireTime.IsZero() {
+		return utils.ToBeijingTime(sub.ExpireTime).Before(now)
+	}
+	return false
+}
+
 func (s *ConfigUpdateService) parseNodeToProxies(node *models.Node) ([]*ProxyNode, error) {
 	if node.Config != nil && *node.Config != "" {
 		var configProxy ProxyNode
@@ -977,19 +994,25 @@ func (s *ConfigUpdateService) parseNodeToProxies(node *models.Node) ([]*ProxyNod
 	return nil, fmt.Errorf("节点配置为空")
 }
 
-func (s *ConfigUpdateService) getSubscriptionContext(token string, clientIP string, userAgent string) *SubscriptionContext {
+func (s *ConfigUpdateService) getSubscriptionContext(token string, admit AdmitFunc) *SubscriptionContext {
 	ctx := &SubscriptionContext{Status: StatusNotFound}
 	var sub models.Subscription
 	if err := s.db.Where("subscription_url = ?", token).First(&sub).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return ctx
+		}
+		if d, err := device.NewDeviceManager().FindDeviceByToken(token); err == nil {
+			if s.db.First(&sub, d.SubscriptionID).Error != nil {
+				return ctx
+			}
+		} else {
 			var reset models.SubscriptionReset
 			if err := s.db.Where("old_subscription_url = ?", token).First(&reset).Error; err == nil {
 				ctx.Status = StatusOldAddress
 				ctx.ResetRecord = &reset
-				return ctx
 			}
+			return ctx
 		}
-		return ctx
 	}
 	ctx.Subscription = sub
 	var user models.User
@@ -1017,20 +1040,34 @@ func (s *ConfigUpdateService) getSubscriptionContext(token string, clientIP stri
 			return ctx
 		}
 	}
-	var currentDevices int64
-	s.db.Model(&models.Device{}).Where("subscription_id = ? AND is_active = ?", sub.ID, true).Count(&currentDevices)
-	ctx.CurrentDevices = int(currentDevices)
 	ctx.DeviceLimit = sub.DeviceLimit
-	if sub.DeviceLimit == 0 {
+	var admission *device.Admission
+	if admit != nil {
+		admission = admit(&sub)
+	}
+	if admission == nil || !admission.Allowed {
+		// 设备是否放行统一由准入服务决定，未经准入的访问按设备超限处理
+		if admission != nil {
+			ctx.CurrentDevices = admission.CurrentDevices
+		}
 		ctx.Status = StatusDeviceOverLimit
 		return ctx
 	}
-	if sub.DeviceLimit > 0 && int(currentDevices) >= sub.DeviceLimit {
-		var device models.Device
-		if err := s.db.Where("subscription_id = ? AND ip_address = ? AND user_agent = ?", sub.ID, clientIP, userAgent).First(&device).Error; err != nil {
-			ctx.Status = StatusDeviceOverLimit
-			return ctx
+	ctx.Admission = admission
+	ctx.Device = admission.Device
+	ctx.CurrentDevices = admission.CurrentDevices
+	current := admission.Device
+	if current != nil && !current.IsAllowed {
+		if current.ApprovalStatus == device.ApprovalDenied {
+			ctx.Status = StatusDeviceDenied
+		} else {
+			ctx.Status = StatusDevicePending
 		}
+		return ctx
+	}
+	if current == nil && user.RequireDeviceApproval {
+		ctx.Status = StatusDevicePending
+		return ctx
 	}
 	ctx.Status = StatusNormal
 	return ctx
@@ -1045,16 +1082,16 @@ func (s *ConfigUpdateService) UpdateSubscriptionConfig(subscriptionURL string) e
 	return nil
 }
 
-func (s *ConfigUpdateService) GenerateClashConfig(token string, clientIP string, userAgent string) (string, error) {
-	nodes, err := s.prepareExportNodes(token, clientIP, userAgent)
+func (s *ConfigUpdateService) GenerateClashConfig(token string, admit AdmitFunc) (string, error) {
+	nodes, err := s.prepareExportNodes(token, admit)
 	if err != nil {
 		return "", err
 	}
 	return s.generateClashYAML(nodes), nil
 }
 
-func (s *ConfigUpdateService) GenerateUniversalConfig(token string, clientIP string, userAgent string, format string) (string, error) {
-	nodes, err := s.prepareExportNodes(token, clientIP, userAgent)
+func (s *ConfigUpdateService) GenerateUniversalConfig(token string, format string, admit AdmitFunc) (string, error) {
+	nodes, err := s.prepareExportNodes(token, admit)
 	if err != nil {
 		return "", err
 	}
@@ -1075,10 +1112,10 @@ func (s *ConfigUpdateService) GenerateUniversalConfig(token string, clientIP str
 	return base64.StdEncoding.EncodeToString([]byte(strings.Join(links, "\n"))), nil
 }
 
-func (s *ConfigUpdateService) prepareExportNodes(token, clientIP, userAgent string) ([]*ProxyNode, error) {
+func (s *ConfigUpdateService) prepareExportNodes(token string, admit AdmitFunc) ([]*ProxyNode, error) {
 	s.refreshSystemConfig()
 
-	ctx := s.getSubscriptionContext(token, clientIP, userAgent)
+	ctx := s.getSubscriptionContext(token, admit)
 
 	if ctx.Status != StatusNormal {
 		return s.generateErrorNodes(ctx.Status, ctx), nil
@@ -1167,6 +1204,10 @@ func (s *ConfigUpdateService) addInfoNodes(proxies []*ProxyNode, ctx *Subscripti
 		s.createMessageNode(fmt.Sprintf("📱 设备: %d/%d", ctx.CurrentDevices, ctx.DeviceLimit)),
 	}
 
+	if ctx.Device != nil && ctx.Device.GraceUntil != nil {
+		infoNodes = append(infoNodes, s.createMessageNode(fmt.Sprintf("⚠️ 设备超限，宽限至 %s", ctx.Device.GraceUntil.Format("01-02 15:04"))))
+	}
+
 	if s.supportQQ != "" {
 		infoNodes = append(infoNodes, s.createMessageNode(fmt.Sprintf("💬 客服QQ: %s", s.supportQQ)))
 	}
@@ -1196,6 +1237,12 @@ func (s *ConfigUpdateService) generateErrorNodes(status SubscriptionStatus, ctx
 	case StatusNotFound:
 		reason = "订阅不存在"
 		solution = "请检查订阅链接是否正确，或重新复制"
+	case StatusDevicePending:
+		reason = "新设备待审批"
+		solution = "请在邮件或官网设备管理中允许该设备后重新更新订阅"
+	case StatusDeviceDenied:
+		reason = "设备已被拒绝"
+		solution = "该设备已被拒绝，如有疑问请在官网设备管理中处理"
 	default:
 		reason = "账户异常"
 		solution = "检测到账户异常，请联系管理员"
@@ -1478,17 +1525,36 @@ func (s *ConfigUpdateService) vmessToLink(proxy *ProxyNode) string {
 		data["tls"] = "tls"
 	}
 
-	if proxy.Options != nil {
-		if wsOpts, ok := proxy.Options["ws-opts"].(map[string]interface{}); ok {
-			if path, ok := wsOpts["path"].(string); ok {
-				data["path"] = path
+	if opts := TransportOptsFromMap(proxy.Options); opts != nil {
+		if opts.WSOpts != nil {
+			if opts.WSOpts.Path != "" {
+				data["path"] = opts.WSOpts.Path
 			}
-			if headers, ok := wsOpts["headers"].(map[string]interface{}); ok {
-				if host, ok := headers["Host"].(string); ok {
-					data["host"] = host
-				}
+			if host := opts.WSOpts.Headers["Host"]; host != "" {
+				data["host"] = host
+			}
+			if opts.WSOpts.V2rayHTTPUpgrade {
+				data["net"] = "httpupgrade"
 			}
 		}
+		if opts.GRPCOpts != nil {
+			data["path"] = opts.GRPCOpts.GRPCServiceName
+		}
+		if opts.H2Opts != nil {
+			data["path"] = opts.H2Opts.Path
+			if len(opts.H2Opts.Host) > 0 {
+				data["host"] = opts.H2Opts.Host[0]
+			}
+		}
+		if proxy.TLS && opts.SNI != "" {
+			data["sni"] = opts.SNI
+		}
+		if opts.SkipCertVerify {
+			data["allowInsecure"] = true
+		}
+		if aid, ok := opts.Other["alterId"]; ok {
+			data["aid"] = aid
+		}
 	}
 
 	jsonData, _ := json.Marshal(data)
@@ -1505,12 +1571,44 @@ func (s *ConfigUpdateService) vlessToLink(proxy *ProxyNode) string {
 	}
 
 	q := url.Values{}
+	q.Set("encryption", "none")
 	if proxy.Network != "" {
 		q.Set("type", proxy.Network)
 	}
-	if proxy.TLS {
+	opts := TransportOptsFromMap(proxy.Options)
+	if opts != nil && opts.RealityOpts != nil {
+		q.Set("security", "reality")
+		if opts.RealityOpts.PublicKey != "" {
+			q.Set("pbk", opts.RealityOpts.PublicKey)
+		}
+		if opts.RealityOpts.ShortID != "" {
+			q.Set("sid", opts.RealityOpts.ShortID)
+		}
+	} else if proxy.TLS {
 		q.Set("security", "tls")
 	}
+	if opts != nil {
+		if proxy.TLS && opts.SNI != "" {
+			q.Set("sni", opts.SNI)
+		}
+		if opts.ClientFingerprint != "" {
+			q.Set("fp", opts.ClientFingerprint)
+		}
+		if flow, ok := opts.Other["flow"].(string); ok && flow != "" {
+			q.Set("flow", flow)
+		}
+		if opts.WSOpts != nil {
+			if opts.WSOpts.Path != "" {
+				q.Set("path", opts.WSOpts.Path)
+			}
+			if host := opts.WSOpts.Headers["Host"]; host != "" {
+				q.Set("host", host)
+			}
+		}
+		if opts.GRPCOpts != nil && opts.GRPCOpts.GRPCServiceName != "" {
+			q.Set("serviceName", opts.GRPCOpts.GRPCServiceName)
+		}
+	}
 
 	u.RawQuery = q.Encode()
 	return u.String()
@@ -1523,6 +1621,35 @@ func (s *ConfigUpdateService) trojanToLink(proxy *ProxyNode) string {
 		Host:     fmt.Sprintf("%s:%d", proxy.Server, proxy.Port),
 		Fragment: proxy.Name,
 	}
+
+	q := url.Values{}
+	if proxy.Network != "" && proxy.Network != "tcp" {
+		q.Set("type", proxy.Network)
+	}
+	if opts := TransportOptsFromMap(proxy.Options); opts != nil {
+		if opts.SNI != "" {
+			q.Set("sni", opts.SNI)
+		}
+		if opts.SkipCertVerify {
+			q.Set("allowInsecure", "1")
+		}
+		if opts.ClientFingerprint != "" {
+			q.Set("fp", opts.ClientFingerprint)
+		}
+		if opts.WSOpts != nil {
+			if opts.WSOpts.Path != "" {
+				q.Set("path", opts.WSOpts.Path)
+			}
+			if host := opts.WSOpts.Headers["Host"]; host != "" {
+				q.Set("host", host)
+			}
+		}
+		if opts.GRPCOpts != nil && opts.GRPCOpts.GRPCServiceName != "" {
+			q.Set("serviceName", opts.GRPCOpts.GRPCServiceName)
+		}
+	}
+
+	u.RawQuery = q.Encode()
 	return u.String()
 }
 
@@ -0,0 +1,315 @@
+package config_update
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	LintEmptyLink         = "empty_link"
+	LintUnknownScheme     = "unknown_scheme"
+	LintBadBase64         = "bad_base64"
+	LintBadJSON           = "bad_json"
+	LintBadURL            = "bad_url"
+	LintMissingServer     = "missing_server"
+	LintMissingPort       = "missing_port"
+	LintInvalidPort       = "invalid_port"
+	LintMissingCredential = "missing_credential"
+	LintUnknownTransport  = "unknown_transport"
+	LintMissingRealityKey = "missing_reality_key"
+	LintParseError        = "parse_error"
+
+	LintInsecureSkipVerify = "insecure_skip_verify"
+	LintMissingSNI         = "missing_sni"
+	LintMissingName        = "missing_name"
+	LintWeakCipher         = "weak_cipher"
+	LintLegacyAlterID      = "legacy_alter_id"
+)
+
+type LintIssue struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type LinkLintResult struct {
+	Index      int         `json:"index"`
+	Link       string      `json:"link"`
+	Protocol   string      `json:"protocol,omitempty"`
+	Valid      bool        `json:"valid"`
+	Node       *ProxyNode  `json:"node,omitempty"`
+	Errors     []LintIssue `json:"errors"`
+	Warnings   []LintIssue `json:"warnings"`
+	Normalized string      `json:"normalized,omitempty"`
+}
+
+var lintSchemes = map[string]string{
+	"vmess":       "vmess",
+	"vless":       "vless",
+	"trojan":      "trojan",
+	"ss":          "ss",
+	"ssr":         "ssr",
+	"hysteria":    "hysteria",
+	"hysteria2":   "hysteria2",
+	"tuic":        "tuic",
+	"naive":       "naive",
+	"naive+https": "naive",
+	"anytls":      "anytls",
+}
+
+var knownTransports = map[string]bool{
+	"": true, "tcp": true, "udp": true, "ws": true, "grpc": true, "h2": true, "http": true,
+	"httpupgrade": true, "xhttp": true, "splithttp": true, "kcp": true, "quic": true,
+}
+
+var weakCiphers = map[string]bool{
+	"none": true, "plain": true, "table": true, "rc4": true, "rc4-md5": true,
+	"aes-128-cfb": true, "aes-192-cfb": true, "aes-256-cfb": true,
+	"aes-128-ctr": true, "aes-192-ctr": true, "aes-256-ctr": true,
+	"bf-cfb": true, "camellia-128-cfb": true, "camellia-256-cfb": true,
+	"chacha20": true, "chacha20-ietf": true, "salsa20": true,
+}
+
+func (r *LinkLintResult) addError(code, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, LintIssue{Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *LinkLintResult) addWarning(code, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, LintIssue{Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// LintNodeLinks 逐条检查节点分享链接
+func LintNodeLinks(links []string) []*LinkLintResult {
+	results := make([]*LinkLintResult, 0, len(links))
+	for i, link := range links {
+		result := LintNodeLink(link)
+		result.Index = i
+		results = append(results, result)
+	}
+	return results
+}
+
+// LintNodeLink 检查单条分享链接，返回解析结果、结构化错误/警告以及规范化后的链接
+func LintNodeLink(link string) *LinkLintResult {
+	link = strings.TrimSpace(link)
+	result := &LinkLintResult{Link: link, Errors: []LintIssue{}, Warnings: []LintIssue{}}
+	if link == "" {
+		result.addError(LintEmptyLink, "链接为空")
+		return result
+	}
+
+	idx := strings.Index(link, "://")
+	if idx <= 0 {
+		result.addError(LintUnknownScheme, "无法识别的链接格式")
+		return result
+	}
+	protocol, ok := lintSchemes[strings.ToLower(link[:idx])]
+	if !ok {
+		result.addError(LintUnknownScheme, "不支持的协议: %s", link[:idx])
+		return result
+	}
+	result.Protocol = protocol
+
+	query := lintPrecheck(result, link, protocol)
+	if len(result.Errors) > 0 {
+		return result
+	}
+
+	node, err := ParseNodeLink(link)
+	if err != nil {
+		result.addError(LintParseError, "解析失败: %v", err)
+		return result
+	}
+	result.Node = node
+	lintNode(result, node, query)
+
+	if len(result.Errors) == 0 {
+		result.Valid = true
+		result.Normalized = (&ConfigUpdateService{}).NodeToLink(node)
+	}
+	return result
+}
+
+// lintPrecheck 在解析前检查编码、地址和端口，返回链接中原始的参数用于后续检查
+func lintPrecheck(result *LinkLintResult, link, protocol string) map[string]string {
+	query := make(map[string]string)
+	body := link[strings.Index(link, "://")+3:]
+	withoutFragment := body
+	if idx := strings.Index(withoutFragment, "#"); idx != -1 {
+		withoutFragment = withoutFragment[:idx]
+	}
+
+	switch protocol {
+	case "vmess":
+		decoded, err := DecodeBase64(withoutFragment)
+		if err != nil {
+			result.addError(LintBadBase64, "VMess 内容 Base64 解码失败")
+			return query
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(decoded), &data); err != nil {
+			result.addError(LintBadJSON, "VMess 内容不是有效的 JSON")
+			return query
+		}
+		for k, v := range data {
+			query[strings.ToLower(k)] = fmt.Sprintf("%v", v)
+		}
+		lintPort(result, query["port"])
+		return query
+	case "ssr":
+		decoded, err := DecodeBase64(withoutFragment)
+		if err != nil {
+			result.addError(LintBadBase64, "SSR 内容 Base64 解码失败")
+			return query
+		}
+		parts := strings.Split(strings.SplitN(decoded, "/?", 2)[0], ":")
+		if len(parts) < 6 {
+			result.addError(LintBadURL, "SSR 内容字段不完整")
+			return query
+		}
+		lintPort(result, parts[len(parts)-5])
+		return query
+	case "ss":
+		if !strings.Contains(withoutFragment, "@") {
+			encoded := withoutFragment
+			if idx := strings.Index(encoded, "?"); idx != -1 {
+				encoded = encoded[:idx]
+			}
+			decoded, err := DecodeBase64(encoded)
+			if err != nil {
+				result.addError(LintBadBase64, "SS 内容 Base64 解码失败")
+				return query
+			}
+			at := strings.LastIndex(decoded, "@")
+			if at == -1 {
+				result.addError(LintMissingServer, "SS 链接缺少服务器地址")
+				return query
+			}
+			lintHostPort(result, decoded[at+1:])
+			return query
+		}
+		userInfo := withoutFragment[:strings.LastIndex(withoutFragment, "@")]
+		if unescaped, err := url.PathUnescape(userInfo); err == nil {
+			userInfo = unescaped
+		}
+		if !strings.Contains(userInfo, ":") {
+			if _, err := DecodeBase64(userInfo); err != nil {
+				result.addError(LintBadBase64, "SS 认证信息 Base64 解码失败")
+				return query
+			}
+		}
+	}
+
+	if protocol == "naive" {
+		link = "https://" + body
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		result.addError(LintBadURL, "链接格式错误: %v", err)
+		return query
+	}
+	for k, v := range parsed.Query() {
+		if len(v) > 0 {
+			query[strings.ToLower(k)] = v[0]
+		}
+	}
+	if parsed.Hostname() == "" {
+		result.addError(LintMissingServer, "缺少服务器地址")
+		return query
+	}
+	lintPort(result, parsed.Port())
+	return query
+}
+
+func lintHostPort(result *LinkLintResult, hostPort string) {
+	if idx := strings.IndexAny(hostPort, "/?"); idx != -1 {
+		hostPort = hostPort[:idx]
+	}
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		if strings.TrimSpace(hostPort) == "" {
+			result.addError(LintMissingServer, "缺少服务器地址")
+		} else {
+			result.addError(LintMissingPort, "缺少端口")
+		}
+		return
+	}
+	if host == "" {
+		result.addError(LintMissingServer, "缺少服务器地址")
+		return
+	}
+	lintPort(result, port)
+}
+
+func lintPort(result *LinkLintResult, port string) {
+	port = strings.TrimSpace(port)
+	if port == "" || port == "<nil>" {
+		result.addError(LintMissingPort, "缺少端口")
+		return
+	}
+	n, err := strconv.ParseFloat(port, 64)
+	if err != nil || n != float64(int(n)) || n <= 0 || n > 65535 {
+		result.addError(LintInvalidPort, "无效的端口: %s", port)
+	}
+}
+
+func lintNode(result *LinkLintResult, node *ProxyNode, query map[string]string) {
+	if node.Server == "" {
+		result.addError(LintMissingServer, "缺少服务器地址")
+	}
+	if node.Port <= 0 {
+		result.addError(LintMissingPort, "缺少端口")
+	} else if node.Port > 65535 {
+		result.addError(LintInvalidPort, "无效的端口: %d", node.Port)
+	}
+
+	switch node.Type {
+	case "vmess", "vless":
+		if node.UUID == "" {
+			result.addError(LintMissingCredential, "缺少 UUID")
+		}
+	case "trojan", "hysteria2", "ss", "ssr":
+		if node.Password == "" {
+			result.addError(LintMissingCredential, "缺少密码")
+		}
+	case "tuic":
+		if node.UUID == "" || node.Password == "" {
+			result.addError(LintMissingCredential, "缺少 UUID 或密码")
+		}
+	case "anytls":
+		if node.UUID == "" {
+			result.addError(LintMissingCredential, "缺少密码")
+		}
+	}
+
+	network := strings.ToLower(node.Network)
+	if !knownTransports[network] {
+		result.addError(LintUnknownTransport, "未知的传输方式: %s", node.Network)
+	}
+
+	opts := TransportOptsFromMap(node.Options)
+	if query["security"] == "reality" && (opts == nil || opts.RealityOpts == nil || opts.RealityOpts.PublicKey == "") {
+		result.addError(LintMissingRealityKey, "Reality 节点缺少公钥 (pbk)")
+	}
+
+	if opts != nil && opts.SkipCertVerify {
+		result.addWarning(LintInsecureSkipVerify, "已开启跳过证书验证，存在中间人攻击风险")
+	}
+	if node.TLS && query["sni"] == "" && query["peer"] == "" && query["servername"] == "" {
+		result.addWarning(LintMissingSNI, "启用了 TLS 但未指定 SNI，将使用服务器地址 %s", node.Server)
+	}
+	if (node.Type == "ss" || node.Type == "ssr") && weakCiphers[strings.ToLower(node.Cipher)] {
+		result.addWarning(LintWeakCipher, "加密方式 %s 已不安全，建议使用 AEAD 或 2022 加密", node.Cipher)
+	}
+	if node.Type == "vmess" {
+		if aid, ok := node.Options["alterId"].(int); ok && aid > 0 {
+			result.addWarning(LintLegacyAlterID, "alterId=%d 已弃用，建议使用 0 (VMessAEAD)", aid)
+		}
+	}
+	if !strings.Contains(result.Link, "#") && query["ps"] == "" && query["remarks"] == "" {
+		result.addWarning(LintMissingName, "链接未包含节点名称")
+	}
+}
@@ -0,0 +1,85 @@
+package config_update
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func hasIssue(issues []LintIssue, code string) bool {
+	for _, issue := range issues {
+		if issue.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLintNodeLink(t *testing.T) {
+	vmessJSON := `{"v":"2","ps":"hk","add":"a.example.com","port":"443","id":"11111111-1111-1111-1111-111111111111","aid":"0","net":"ws","path":"/ws","host":"a.example.com","tls":"tls","sni":"a.example.com"}`
+	testCases := []struct {
+		name      string
+		link      string
+		wantValid bool
+		wantError string
+		wantWarn  string
+	}{
+		{"空链接", "  ", false, LintEmptyLink, ""},
+		{"未知协议", "foo://bar", false, LintUnknownScheme, ""},
+		{"VMess 非法 Base64", "vmess://!!!not-base64", false, LintBadBase64, ""},
+		{"VMess 非法 JSON", "vmess://" + base64.StdEncoding.EncodeToString([]byte("not json")), false, LintBadJSON, ""},
+		{"VMess 有效", "vmess://" + base64.StdEncoding.EncodeToString([]byte(vmessJSON)), true, "", ""},
+		{"缺少端口", "trojan://pass@a.example.com?sni=a.example.com#t", false, LintMissingPort, ""},
+		{"未知传输", "vless://11111111-1111-1111-1111-111111111111@a.example.com:443?type=foo&security=tls&sni=a.example.com#v", false, LintUnknownTransport, ""},
+		{"Reality 缺少公钥", "vless://11111111-1111-1111-1111-111111111111@a.example.com:443?security=reality&sni=www.example.com#v", false, LintMissingRealityKey, ""},
+		{"跳过证书验证", "trojan://pass@a.example.com:443?sni=a.example.com&allowInsecure=1#t", true, "", LintInsecureSkipVerify},
+		{"缺少 SNI", "trojan://pass@a.example.com:443#t", true, "", LintMissingSNI},
+		{"SS 非法 Base64", "ss://!!!@a.example.com:8388#s", false, LintBadBase64, ""},
+		{"SS 弱加密", "ss://" + base64.RawURLEncoding.EncodeToString([]byte("rc4-md5:pass")) + "@a.example.com:8388#s", true, "", LintWeakCipher},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := LintNodeLink(tc.link)
+			if result.Valid != tc.wantValid {
+				t.Fatalf("Valid = %v, want %v, errors: %+v", result.Valid, tc.wantValid, result.Errors)
+			}
+			if tc.wantError != "" && !hasIssue(result.Errors, tc.wantError) {
+				t.Errorf("缺少错误 %s, got %+v", tc.wantError, result.Errors)
+			}
+			if tc.wantWarn != "" && !hasIssue(result.Warnings, tc.wantWarn) {
+				t.Errorf("缺少警告 %s, got %+v", tc.wantWarn, result.Warnings)
+			}
+			if result.Valid && result.Normalized == "" {
+				t.Error("有效链接应返回规范化链接")
+			}
+		})
+	}
+}
+
+func TestLintNodeLinkNormalizedRoundTrip(t *testing.T) {
+	link := "vless://11111111-1111-1111-1111-111111111111@a.example.com:443?type=grpc&serviceName=svc&security=reality&pbk=PUBKEY&sid=abcd&sni=www.example.com&fp=chrome&flow=xtls-rprx-vision#v"
+	first := LintNodeLink(link)
+	if !first.Valid {
+		t.Fatalf("期望有效, errors: %+v", first.Errors)
+	}
+	for _, want := range []string{"pbk=PUBKEY", "sid=abcd", "serviceName=svc", "sni=www.example.com"} {
+		if !strings.Contains(first.Normalized, want) {
+			t.Errorf("规范化链接缺少 %s: %s", want, first.Normalized)
+		}
+	}
+	second := LintNodeLink(first.Normalized)
+	if !second.Valid || second.Normalized != first.Normalized {
+		t.Errorf("规范化链接不稳定: %s -> %s", first.Normalized, second.Normalized)
+	}
+}
+
+func TestLintNodeLinksIndex(t *testing.T) {
+	results := LintNodeLinks([]string{"foo://bar", "trojan://pass@a.example.com:443?sni=a.example.com#t"})
+	if len(results) != 2 || results[0].Index != 0 || results[1].Index != 1 {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if results[0].Valid || !results[1].Valid {
+		t.Errorf("Valid = %v, %v", results[0].Valid, results[1].Valid)
+	}
+}
@@ -0,0 +1,109 @@
+package config_update
+
+import (
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// GenerateNodeCredentials 为专线分配生成独立的 UUID 和密码
+func GenerateNodeCredentials() (string, string, error) {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		return "", "", fmt.Errorf("生成节点凭据失败: %w", err)
+	}
+	return utils.GenerateUUID(), hex.EncodeToString(b), nil
+}
+
+// EnsureUserNodeCredentials 为缺少凭据的旧分配记录补全凭据
+func EnsureUserNodeCredentials(db *gorm.DB, userNode *models.UserCustomNode) error {
+	if userNode.UUID != "" && userNode.Password != "" {
+		return nil
+	}
+	uuid, password, err := GenerateNodeCredentials()
+	if err != nil {
+		return err
+	}
+	userNode.UUID, userNode.Password = uuid, password
+	return db.Model(&models.UserCustomNode{}).Where("id = ?", userNode.ID).
+		Updates(map[string]interface{}{"uuid": userNode.UUID, "password": userNode.Password}).Error
+}
+
+// RegenerateUserNodeCredentials 重新生成用户所有专线的凭据（订阅重置时调用）
+func RegenerateUserNodeCredentials(db *gorm.DB, userID uint) error {
+	var userNodes []models.UserCustomNode
+	if err := db.Where("user_id = ?", userID).Find(&userNodes).Error; err != nil {
+		return err
+	}
+	for _, un := range userNodes {
+		uuid, password, err := GenerateNodeCredentials()
+		if err != nil {
+			return err
+		}
+		if err := db.Model(&models.UserCustomNode{}).Where("id = ?", un.ID).
+			Updates(map[string]interface{}{"uuid": uuid, "password": password}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyUserCredentials 用分配记录中的凭据替换节点配置里的共享凭据
+func ApplyUserCredentials(node *ProxyNode, uuid, password string) {
+	if uuid == "" && password == "" {
+		return
+	}
+	switch strings.ToLower(node.Type) {
+	case "vmess", "vless":
+		node.UUID = uuid
+	case "tuic", "naive":
+		node.UUID = uuid
+		node.Password = password
+	case "ss":
+		node.Password = ssUserPassword(node.Cipher, node.Password, password)
+	case "trojan", "hysteria2", "http", "socks5":
+		node.Password = password
+	case "anytls":
+		node.UUID = password
+	case "hysteria":
+		if node.Options == nil {
+			node.Options = make(map[string]interface{})
+		}
+		node.Options["auth"] = password
+	}
+}
+
+// ssUserPassword SS2022 多用户格式为 "服务端PSK:用户PSK"，用户PSK长度需与加密方式一致
+func ssUserPassword(cipher, serverPassword, password string) string {
+	if !strings.HasPrefix(cipher, "2022-blake3-") {
+		return password
+	}
+	keyLen := 32
+	if strings.Contains(cipher, "aes-128") {
+		keyLen = 16
+	}
+	sum := sha256.Sum256([]byte(password))
+	userKey := base64.StdEncoding.EncodeToString(sum[:keyLen])
+	serverKey := serverPassword
+	if idx := strings.Index(serverKey, ":"); idx >= 0 {
+		serverKey = serverKey[:idx]
+	}
+	return serverKey + ":" + userKey
+}
+
+// SSUserKey 返回节点后端使用的 SS2022 用户PSK
+func SSUserKey(cipher, password string) string {
+	full := ssUserPassword(cipher, "", password)
+	if idx := strings.Index(full, ":"); idx >= 0 {
+		return full[idx+1:]
+	}
+	return full
+}
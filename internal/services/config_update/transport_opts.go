@@ -120,6 +120,10 @@ func TransportOptsFromMap(m map[string]interface{}) *TransportOpts {
 					opts.WSOpts.Headers[k] = s
 				}
 			}
+		} else if headers, ok := wsOpts["headers"].(map[string]string); ok {
+			for k, v := range headers {
+				opts.WSOpts.Headers[k] = v
+			}
 		}
 		if v2ray, ok := wsOpts["v2ray-http-upgrade"].(bool); ok && v2ray {
 			opts.WSOpts.V2rayHTTPUpgrade = true
@@ -138,7 +142,9 @@ func TransportOptsFromMap(m map[string]interface{}) *TransportOpts {
 		if path, ok := h2Opts["path"].(string); ok {
 			opts.H2Opts.Path = path
 		}
-		if host, ok := h2Opts["host"].([]interface{}); ok {
+		if host, ok := h2Opts["host"].([]string); ok {
+			opts.H2Opts.Host = host
+		} else if host, ok := h2Opts["host"].([]interface{}); ok {
 			opts.H2Opts.Host = make([]string, 0, len(host))
 			for _, h := range host {
 				if s, ok := h.(string); ok {
@@ -0,0 +1,193 @@
+package device
+
+import (
+	"time"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/email"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// 设备超限策略
+const (
+	OverflowReject   = "reject"
+	OverflowEvictLRU = "evict_lru"
+	OverflowGrace    = "grace"
+)
+
+// 准入结果
+const (
+	DecisionAdmitted     = "admitted"
+	DecisionRejected     = "rejected"
+	DecisionEvicted      = "evicted"
+	DecisionGrace        = "grace"
+	DecisionGraceExpired = "grace_expired"
+)
+
+// ValidOverflowPolicy 校验套餐的设备超限策略
+func ValidOverflowPolicy(policy string) bool {
+	return policy == OverflowReject || policy == OverflowEvictLRU || policy == OverflowGrace
+}
+
+type Admission struct {
+	Allowed        bool
+	Decision       string
+	Device         *models.Device // 本次访问对应的设备，浏览器等未记录的访问为 nil
+	Evicted        *models.Device
+	CurrentDevices int
+	DeviceLimit    int
+}
+
+// AdmissionService 统一决定一次订阅访问能否占用设备名额，Clash 与通用订阅共用
+type AdmissionService struct {
+	db *gorm.DB
+	dm *DeviceManager
+}
+
+func NewAdmissionService() *AdmissionService {
+	return &AdmissionService{
+		db: database.GetDB(),
+		dm: NewDeviceManager(),
+	}
+}
+
+// Admit 记录设备访问并按套餐策略决定是否放行；tokenDevice 为通过设备令牌访问时对应的设备
+func (s *AdmissionService) Admit(sub *models.Subscription, tokenDevice *models.Device, userAgent, ipAddress, subscriptionType string) *Admission {
+	a := &Admission{DeviceLimit: sub.DeviceLimit}
+	if sub.DeviceLimit == 0 {
+		return s.finish(a, sub, false, DecisionRejected)
+	}
+
+	if tokenDevice != nil {
+		if err := s.dm.RecordTokenAccess(tokenDevice, userAgent, ipAddress, subscriptionType); err != nil {
+			utils.LogWarn("Admit: 记录设备令牌访问失败 device=%d: %v", tokenDevice.ID, err)
+		}
+		a.Device = tokenDevice
+		if !s.dm.TokenWithinLimit(tokenDevice, sub.DeviceLimit) {
+			return s.finish(a, sub, false, DecisionRejected)
+		}
+		return s.finish(a, sub, true, DecisionAdmitted)
+	}
+
+	count := s.dm.countActiveDevices(sub.ID)
+	if existing := s.findLegacyDevice(sub, userAgent, ipAddress); existing != nil {
+		d, err := s.dm.RecordDeviceAccess(sub.ID, sub.UserID, userAgent, ipAddress, subscriptionType)
+		if err != nil || d == nil {
+			d = existing
+		}
+		a.Device = d
+		if d.GraceUntil != nil {
+			if sub.DeviceLimit < 0 || count <= int64(sub.DeviceLimit) {
+				s.db.Model(d).Update("grace_until", nil)
+				d.GraceUntil = nil
+			} else if utils.GetBeijingTime().After(*d.GraceUntil) {
+				return s.finish(a, sub, false, DecisionGraceExpired)
+			}
+		}
+		return s.finish(a, sub, true, DecisionAdmitted)
+	}
+
+	if sub.DeviceLimit < 0 || count < int64(sub.DeviceLimit) {
+		a.Device, _ = s.dm.RecordDeviceAccess(sub.ID, sub.UserID, userAgent, ipAddress, subscriptionType)
+		return s.finish(a, sub, true, DecisionAdmitted)
+	}
+
+	policy, graceHours := s.policyFor(sub)
+	switch policy {
+	case OverflowEvictLRU:
+		// 待审批的设备不占用名额，也不会被移除
+		var victim models.Device
+		if err := s.db.Where("subscription_id = ? AND is_active = ? AND sub_token IS NULL AND (approval_status IS NULL OR approval_status <> ?)",
+			sub.ID, true, ApprovalPending).
+			Order("last_access ASC").First(&victim).Error; err != nil {
+			return s.finish(a, sub, false, DecisionRejected)
+		}
+		if err := s.db.Delete(&victim).Error; err != nil {
+			utils.LogWarn("Admit: 移除最久未使用设备失败 device=%d: %v", victim.ID, err)
+			return s.finish(a, sub, false, DecisionRejected)
+		}
+		a.Evicted = &victim
+		a.Device, _ = s.dm.RecordDeviceAccess(sub.ID, sub.UserID, userAgent, ipAddress, subscriptionType)
+		return s.finish(a, sub, true, DecisionEvicted)
+	case OverflowGrace:
+		d, err := s.dm.RecordDeviceAccess(sub.ID, sub.UserID, userAgent, ipAddress, subscriptionType)
+		if err != nil || d == nil {
+			// 浏览器等不记录设备的访问无法跟踪宽限期，直接拒绝
+			return s.finish(a, sub, false, DecisionRejected)
+		}
+		graceUntil := utils.GetBeijingTime().Add(time.Duration(graceHours) * time.Hour)
+		s.db.Model(d).Update("grace_until", graceUntil)
+		d.GraceUntil = &graceUntil
+		a.Device = d
+		go s.notifyGrace(*sub, *d)
+		return s.finish(a, sub, true, DecisionGrace)
+	default:
+		return s.finish(a, sub, false, DecisionRejected)
+	}
+}
+
+func (s *AdmissionService) finish(a *Admission, sub *models.Subscription, allowed bool, decision string) *Admission {
+	a.Allowed = allowed
+	a.Decision = decision
+	a.CurrentDevices = int(s.dm.countActiveDevices(sub.ID))
+	if a.Evicted != nil {
+		s.dm.syncDeviceCount(sub.ID)
+	}
+	return a
+}
+
+// findLegacyDevice 按 UA+IP 指纹查找已知设备，指纹变化时回退到同 UA 的最近设备
+func (s *AdmissionService) findLegacyDevice(sub *models.Subscription, userAgent, ipAddress string) *models.Device {
+	if d, err := s.dm.FindDeviceByFingerprint(sub.ID, userAgent, ipAddress); err == nil {
+		return d
+	}
+
+	var sameUADevice models.Device
+	if err := s.db.Where("subscription_id = ? AND user_agent = ? AND is_active = ? AND sub_token IS NULL", sub.ID, userAgent, true).
+		Order("last_access DESC").
+		First(&sameUADevice).Error; err != nil {
+		return nil
+	}
+	hash := s.dm.GenerateDeviceHash(userAgent, ipAddress, "")
+	sameUADevice.IPAddress = &ipAddress
+	sameUADevice.DeviceHash = &hash
+	sameUADevice.LastAccess = utils.GetBeijingTime()
+	if err := s.db.Save(&sameUADevice).Error; err != nil {
+		return nil
+	}
+	return &sameUADevice
+}
+
+// policyFor 读取订阅所属套餐的超限策略，无套餐时默认拒绝
+func (s *AdmissionService) policyFor(sub *models.Subscription) (string, int) {
+	if sub.PackageID == nil {
+		return OverflowReject, 0
+	}
+	var pkg models.Package
+	if err := s.db.Select("id", "overflow_policy", "overflow_grace_hours").First(&pkg, *sub.PackageID).Error; err != nil {
+		return OverflowReject, 0
+	}
+	if !ValidOverflowPolicy(pkg.OverflowPolicy) {
+		return OverflowReject, 0
+	}
+	graceHours := pkg.OverflowGraceHours
+	if graceHours <= 0 {
+		graceHours = 24
+	}
+	return pkg.OverflowPolicy, graceHours
+}
+
+func (s *AdmissionService) notifyGrace(sub models.Subscription, d models.Device) {
+	var user models.User
+	if err := s.db.First(&user, sub.UserID).Error; err != nil || !user.EmailNotifications {
+		return
+	}
+	content := email.NewEmailTemplateBuilder().GetDeviceOverLimitTemplate(user.Username, utils.GetStringValue(d.DeviceName),
+		d.GraceUntil.Format("2006-01-02 15:04:05"), int(s.dm.countActiveDevices(sub.ID)), sub.DeviceLimit)
+	if err := email.NewEmailService().QueueEmail(user.Email, "设备数量超出限制", content, "device_over_limit"); err != nil {
+		utils.LogWarn("notifyGrace: 邮件入队失败 user=%d: %v", user.ID, err)
+	}
+}
@@ -0,0 +1,161 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"cboard-go/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newAdmissionTestService(t *testing.T, policy string) (*AdmissionService, *models.Subscription) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Package{}, &models.Subscription{}, &models.Device{}, &models.EmailQueue{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	user := models.User{Username: "u", Email: "u@example.com", Password: "x", EmailNotifications: false}
+	db.Create(&user)
+	pkg := models.Package{Name: "p", Price: 1, DurationDays: 30, DeviceLimit: 2, OverflowPolicy: policy, OverflowGraceHours: 1}
+	db.Create(&pkg)
+	pkgID := int64(pkg.ID)
+	sub := models.Subscription{UserID: user.ID, PackageID: &pkgID, SubscriptionURL: "sub", DeviceLimit: 2, ExpireTime: time.Now().Add(time.Hour)}
+	db.Create(&sub)
+	db.Model(&user).Update("email_notifications", false)
+
+	dm := &DeviceManager{db: db}
+	return &AdmissionService{db: db, dm: dm}, &sub
+}
+
+var admissionTestUAs = []string{"clash-verge/v1.3.8", "Shadowrocket/1.0 CFNetwork iOS", "v2rayN/6.23"}
+
+func TestAdmitReject(t *testing.T) {
+	s, sub := newAdmissionTestService(t, OverflowReject)
+	for i := 0; i < 2; i++ {
+		if a := s.Admit(sub, nil, admissionTestUAs[i], "1.1.1.1", "clash"); !a.Allowed {
+			t.Fatalf("device %d should be admitted, got %s", i, a.Decision)
+		}
+	}
+	a := s.Admit(sub, nil, admissionTestUAs[2], "1.1.1.1", "clash")
+	if a.Allowed || a.Decision != DecisionRejected {
+		t.Fatalf("third device should be rejected, got %+v", a)
+	}
+	if a := s.Admit(sub, nil, admissionTestUAs[0], "1.1.1.1", "clash"); !a.Allowed {
+		t.Errorf("known device should still be admitted, got %s", a.Decision)
+	}
+}
+
+func TestAdmitEvictLRU(t *testing.T) {
+	s, sub := newAdmissionTestService(t, OverflowEvictLRU)
+	first := s.Admit(sub, nil, admissionTestUAs[0], "1.1.1.1", "clash")
+	s.db.Model(first.Device).Update("last_access", time.Now().Add(-time.Hour))
+	s.Admit(sub, nil, admissionTestUAs[1], "1.1.1.1", "clash")
+
+	a := s.Admit(sub, nil, admissionTestUAs[2], "1.1.1.1", "clash")
+	if !a.Allowed || a.Decision != DecisionEvicted {
+		t.Fatalf("expected eviction, got %+v", a)
+	}
+	if a.Evicted == nil || a.Evicted.ID != first.Device.ID {
+		t.Errorf("least recently used device should be evicted, got %+v", a.Evicted)
+	}
+	if a.CurrentDevices != 2 {
+		t.Errorf("CurrentDevices = %d, want 2", a.CurrentDevices)
+	}
+}
+
+func TestAdmitGrace(t *testing.T) {
+	s, sub := newAdmissionTestService(t, OverflowGrace)
+	s.Admit(sub, nil, admissionTestUAs[0], "1.1.1.1", "clash")
+	s.Admit(sub, nil, admissionTestUAs[1], "1.1.1.1", "clash")
+
+	a := s.Admit(sub, nil, admissionTestUAs[2], "1.1.1.1", "clash")
+	if !a.Allowed || a.Decision != DecisionGrace || a.Device.GraceUntil == nil {
+		t.Fatalf("expected grace admission, got %+v", a)
+	}
+
+	s.db.Model(a.Device).Update("grace_until", time.Now().Add(-time.Minute))
+	if a := s.Admit(sub, nil, admissionTestUAs[2], "1.1.1.1", "clash"); a.Allowed || a.Decision != DecisionGraceExpired {
+		t.Fatalf("expected grace expired, got %+v", a)
+	}
+}
+
+func TestAdmitDeviceToken(t *testing.T) {
+	s, sub := newAdmissionTestService(t, OverflowReject)
+	tokens := make([]*models.Device, 0, 2)
+	for i := 0; i < 2; i++ {
+		d, err := s.dm.CreateDeviceToken(sub, "phone")
+		if err != nil {
+			t.Fatalf("CreateDeviceToken: %v", err)
+		}
+		tokens = append(tokens, d)
+	}
+	if _, err := s.dm.CreateDeviceToken(sub, "extra"); err != ErrDeviceTokenLimit {
+		t.Fatalf("expected ErrDeviceTokenLimit, got %v", err)
+	}
+
+	// 令牌设备换网络后仍识别为同一设备
+	for _, ip := range []string{"1.1.1.1", "2.2.2.2"} {
+		if a := s.Admit(sub, tokens[0], admissionTestUAs[0], ip, "clash"); !a.Allowed {
+			t.Fatalf("token device should be admitted from %s, got %s", ip, a.Decision)
+		}
+	}
+
+	sub.DeviceLimit = 1
+	if a := s.Admit(sub, tokens[1], admissionTestUAs[1], "1.1.1.1", "clash"); a.Allowed {
+		t.Errorf("token beyond lowered limit should be rejected")
+	}
+}
+
+func TestCreateDeviceTokenCountsAllDevices(t *testing.T) {
+	s, sub := newAdmissionTestService(t, OverflowReject)
+	if a := s.Admit(sub, nil, admissionTestUAs[0], "1.1.1.1", "clash"); !a.Allowed {
+		t.Fatalf("device should be admitted, got %s", a.Decision)
+	}
+	if _, err := s.dm.CreateDeviceToken(sub, "phone"); err != nil {
+		t.Fatalf("CreateDeviceToken: %v", err)
+	}
+	// 旧订阅地址的设备同样占用名额
+	if _, err := s.dm.CreateDeviceToken(sub, "extra"); err != ErrDeviceTokenLimit {
+		t.Fatalf("expected ErrDeviceTokenLimit, got %v", err)
+	}
+}
+
+func TestPendingDeviceHoldsNoSlot(t *testing.T) {
+	s, sub := newAdmissionTestService(t, OverflowEvictLRU)
+	pending := s.Admit(sub, nil, admissionTestUAs[0], "1.1.1.1", "clash").Device
+	s.db.Model(pending).Updates(map[string]interface{}{
+		"approval_status": ApprovalPending, "is_allowed": false, "last_access": time.Now().Add(-2 * time.Hour),
+	})
+	s.db.First(pending, pending.ID)
+
+	// 待审批设备不占用名额
+	for i := 1; i < 3; i++ {
+		if a := s.Admit(sub, nil, admissionTestUAs[i], "1.1.1.1", "clash"); a.Decision != DecisionAdmitted {
+			t.Fatalf("device %d should be admitted, got %s", i, a.Decision)
+		}
+	}
+	// 超限移除时跳过待审批设备
+	a := s.Admit(sub, nil, "Stash/2.4.0", "1.1.1.1", "clash")
+	if a.Decision != DecisionEvicted || a.Evicted == nil || a.Evicted.ID == pending.ID {
+		t.Fatalf("pending device must not be evicted, got %+v", a)
+	}
+
+	if err := s.dm.ApproveDevice(pending); err != ErrApprovalDeviceLimit {
+		t.Fatalf("expected ErrApprovalDeviceLimit, got %v", err)
+	}
+	s.db.Delete(a.Device)
+	if err := s.dm.ApproveDevice(pending); err != nil {
+		t.Fatalf("ApproveDevice: %v", err)
+	}
+	var current models.Subscription
+	s.db.First(&current, sub.ID)
+	if current.CurrentDevices != 2 {
+		t.Errorf("CurrentDevices = %d, want 2", current.CurrentDevices)
+	}
+}
@@ -0,0 +1,148 @@
+package device
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/email"
+	"cboard-go/internal/utils"
+)
+
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalDenied   = "denied"
+)
+
+var (
+	ErrApprovalTokenInvalid = errors.New("审批链接无效或已处理")
+	ErrApprovalDeviceLimit  = errors.New("设备数量已达上限，请先移除不用的设备再允许新设备")
+)
+
+// requiresApproval 用户是否开启了新设备审批
+func (dm *DeviceManager) requiresApproval(userID uint) bool {
+	var user models.User
+	if err := dm.db.Select("id", "require_device_approval").First(&user, userID).Error; err != nil {
+		return false
+	}
+	return user.RequireDeviceApproval
+}
+
+// FindDeviceByFingerprint 按 UA+IP 指纹查找旧订阅地址访问的设备
+func (dm *DeviceManager) FindDeviceByFingerprint(subscriptionID uint, userAgent, ipAddress string) (*models.Device, error) {
+	hash := dm.GenerateDeviceHash(userAgent, ipAddress, "")
+	var d models.Device
+	if err := dm.db.Where("device_hash = ? AND subscription_id = ?", hash, subscriptionID).First(&d).Error; err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// requestApproval 将新设备标记为待审批，并通过站内信和邮件通知用户
+func (dm *DeviceManager) requestApproval(d *models.Device) {
+	token := utils.GenerateSubscriptionURL()
+	d.IsAllowed = false
+	d.ApprovalStatus = ApprovalPending
+	d.ApprovalToken = &token
+	if err := dm.db.Model(d).Updates(map[string]interface{}{
+		"is_allowed":      false,
+		"approval_status": ApprovalPending,
+		"approval_token":  token,
+	}).Error; err != nil {
+		utils.LogWarn("requestApproval: 标记设备待审批失败 device=%d: %v", d.ID, err)
+		return
+	}
+	go dm.notifyApproval(*d, token)
+}
+
+func (dm *DeviceManager) notifyApproval(d models.Device, token string) {
+	var user models.User
+	if d.UserID == nil || dm.db.First(&user, *d.UserID).Error != nil {
+		return
+	}
+
+	deviceName := utils.GetStringValue(d.DeviceName)
+	ipAddress := utils.GetStringValue(d.IPAddress)
+	accessTime := d.LastAccess.Format("2006-01-02 15:04:05")
+
+	dm.db.Create(&models.Notification{
+		UserID:   sql.NullInt64{Int64: int64(user.ID), Valid: true},
+		Title:    "新设备待审批",
+		Content:  fmt.Sprintf("设备「%s」(IP: %s) 于 %s 尝试获取订阅，请在设备管理中审批。", deviceName, ipAddress, accessTime),
+		Type:     "device",
+		IsActive: true,
+	})
+
+	if !user.EmailNotifications {
+		return
+	}
+	builder := email.NewEmailTemplateBuilder()
+	approvalURL := fmt.Sprintf("%s/api/v1/device-approval/%s", builder.GetBaseURL(), token)
+	content := builder.GetDeviceApprovalTemplate(user.Username, deviceName, ipAddress, accessTime,
+		approvalURL+"?action=approve", approvalURL+"?action=deny")
+	if err := email.NewEmailService().QueueEmail(user.Email, "新设备待审批", content, "device_approval"); err != nil {
+		utils.LogWarn("notifyApproval: 邮件入队失败 user=%d: %v", user.ID, err)
+	}
+}
+
+// FindDeviceByApprovalToken 按邮件中的审批令牌查找待审批设备
+func (dm *DeviceManager) FindDeviceByApprovalToken(token string) (*models.Device, error) {
+	if token == "" {
+		return nil, ErrApprovalTokenInvalid
+	}
+	var d models.Device
+	if err := dm.db.Where("approval_token = ? AND approval_status = ?", token, ApprovalPending).First(&d).Error; err != nil {
+		return nil, ErrApprovalTokenInvalid
+	}
+	return &d, nil
+}
+
+// ApproveDevice 允许设备获取订阅，设备数量已达订阅上限时拒绝
+func (dm *DeviceManager) ApproveDevice(d *models.Device) error {
+	var sub models.Subscription
+	if err := dm.db.Select("id", "device_limit").First(&sub, d.SubscriptionID).Error; err != nil {
+		return err
+	}
+	if sub.DeviceLimit == 0 {
+		return ErrDeviceLimitZero
+	}
+	// 待审批或已停用的设备此前不占用名额
+	counted := d.IsActive && d.ApprovalStatus != ApprovalPending
+	if sub.DeviceLimit > 0 && !counted && dm.countActiveDevices(sub.ID) >= int64(sub.DeviceLimit) {
+		return ErrApprovalDeviceLimit
+	}
+	d.IsAllowed = true
+	d.IsActive = true
+	d.ApprovalStatus = ApprovalApproved
+	d.ApprovalToken = nil
+	if err := dm.db.Model(d).Updates(map[string]interface{}{
+		"is_allowed":      true,
+		"is_active":       true,
+		"approval_status": ApprovalApproved,
+		"approval_token":  nil,
+	}).Error; err != nil {
+		return err
+	}
+	dm.syncDeviceCount(d.SubscriptionID)
+	return nil
+}
+
+// DenyDevice 拒绝设备，被拒绝的设备不再占用设备名额
+func (dm *DeviceManager) DenyDevice(d *models.Device) error {
+	d.IsAllowed = false
+	d.IsActive = false
+	d.ApprovalStatus = ApprovalDenied
+	d.ApprovalToken = nil
+	if err := dm.db.Model(d).Updates(map[string]interface{}{
+		"is_allowed":      false,
+		"is_active":       false,
+		"approval_status": ApprovalDenied,
+		"approval_token":  nil,
+	}).Error; err != nil {
+		return err
+	}
+	dm.syncDeviceCount(d.SubscriptionID)
+	return nil
+}
@@ -0,0 +1,117 @@
+package device
+
+import (
+	"errors"
+	"strings"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+)
+
+// TokenDeviceFingerprint 设备令牌类设备的指纹占位值，这类设备不参与 UA+IP 指纹匹配
+const TokenDeviceFingerprint = "sub_token"
+
+var (
+	ErrDeviceLimitZero    = errors.New("设备数量限制为0，无法添加设备")
+	ErrDeviceTokenLimit   = errors.New("设备数量已达上限，请先移除不用的设备")
+	ErrDeviceTokenInvalid = errors.New("设备令牌不存在或已吊销")
+)
+
+// CreateDeviceToken 为订阅签发一个命名的设备订阅令牌，令牌设备与旧订阅地址的设备共用设备数量上限
+func (dm *DeviceManager) CreateDeviceToken(sub *models.Subscription, name string) (*models.Device, error) {
+	if sub.DeviceLimit == 0 {
+		return nil, ErrDeviceLimitZero
+	}
+	if sub.DeviceLimit > 0 && dm.countActiveDevices(sub.ID) >= int64(sub.DeviceLimit) {
+		return nil, ErrDeviceTokenLimit
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "未命名设备"
+	}
+	token := utils.GenerateSubscriptionURL()
+	userID := int64(sub.UserID)
+	now := utils.GetBeijingTime()
+	d := models.Device{
+		UserID:            &userID,
+		SubscriptionID:    sub.ID,
+		DeviceFingerprint: TokenDeviceFingerprint,
+		SubToken:          &token,
+		DeviceName:        &name,
+		IsActive:          true,
+		IsAllowed:         true,
+		FirstSeen:         &now,
+		LastAccess:        now,
+	}
+	if err := dm.db.Create(&d).Error; err != nil {
+		return nil, err
+	}
+	dm.syncDeviceCount(sub.ID)
+	return &d, nil
+}
+
+// FindDeviceByToken 按设备订阅令牌查找设备
+func (dm *DeviceManager) FindDeviceByToken(token string) (*models.Device, error) {
+	if token == "" {
+		return nil, ErrDeviceTokenInvalid
+	}
+	var d models.Device
+	if err := dm.db.Where("sub_token = ? AND is_active = ?", token, true).First(&d).Error; err != nil {
+		return nil, ErrDeviceTokenInvalid
+	}
+	return &d, nil
+}
+
+// TokenWithinLimit 限额调低后，只有最早签发的 DeviceLimit 个令牌仍然有效
+func (dm *DeviceManager) TokenWithinLimit(d *models.Device, deviceLimit int) bool {
+	if deviceLimit < 0 {
+		return true
+	}
+	if deviceLimit == 0 {
+		return false
+	}
+	var ids []uint
+	dm.db.Model(&models.Device{}).
+		Where("subscription_id = ? AND sub_token IS NOT NULL AND is_active = ?", d.SubscriptionID, true).
+		Order("id ASC").Limit(deviceLimit).Pluck("id", &ids)
+	for _, id := range ids {
+		if id == d.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordTokenAccess 记录通过设备令牌的订阅访问
+func (dm *DeviceManager) RecordTokenAccess(d *models.Device, userAgent, ipAddress, subscriptionType string) error {
+	dm.refreshDeviceInfo(d, dm.ParseUserAgent(userAgent), userAgent, ipAddress, subscriptionType)
+	return dm.db.Save(d).Error
+}
+
+// RevokeDeviceToken 吊销设备令牌，对应的订阅地址立即失效
+func (dm *DeviceManager) RevokeDeviceToken(subscriptionID, deviceID uint) error {
+	res := dm.db.Where("id = ? AND subscription_id = ? AND sub_token IS NOT NULL", deviceID, subscriptionID).
+		Delete(&models.Device{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrDeviceTokenInvalid
+	}
+	dm.syncDeviceCount(subscriptionID)
+	return nil
+}
+
+// countActiveDevices 统计占用名额的设备，待审批的设备不占用名额
+func (dm *DeviceManager) countActiveDevices(subscriptionID uint) int64 {
+	var count int64
+	dm.db.Model(&models.Device{}).
+		Where("subscription_id = ? AND is_active = ? AND (approval_status IS NULL OR approval_status <> ?)", subscriptionID, true, ApprovalPending).
+		Count(&count)
+	return count
+}
+
+func (dm *DeviceManager) syncDeviceCount(subscriptionID uint) {
+	dm.db.Model(&models.Subscription{}).Where("id = ?", subscriptionID).Update("current_devices", dm.countActiveDevices(subscriptionID))
+}
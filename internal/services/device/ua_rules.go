@@ -0,0 +1,436 @@
+package device
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed ua_rules.json
+var defaultUARulesJSON []byte
+
+// 规则文件修改时间的检查间隔，用于热加载
+const uaRulesCheckInterval = 5 * time.Second
+
+type UARules struct {
+	Version         string         `json:"version"`
+	Software        []SoftwareRule `json:"software"`
+	OS              []OSRule       `json:"os"`
+	Devices         []DeviceRule   `json:"devices"`
+	Brands          []BrandRule    `json:"brands"`
+	VersionPatterns []string       `json:"version_patterns"`
+}
+
+// SoftwareRule 按顺序匹配，第一条命中的规则决定客户端名称；OS/Brand/Type 用于 UA 中缺少系统信息时推断
+type SoftwareRule struct {
+	Name    string `json:"name"`
+	Match   string `json:"match"`
+	Require string `json:"require,omitempty"`
+	Version string `json:"version,omitempty"`
+	OS      string `json:"os,omitempty"`
+	Brand   string `json:"brand,omitempty"`
+	Type    string `json:"type,omitempty"`
+}
+
+// OSRule 的版本正则中各分组以 "." 连接
+type OSRule struct {
+	Name     string   `json:"name"`
+	Match    string   `json:"match"`
+	Versions []string `json:"versions,omitempty"`
+	Type     string   `json:"type,omitempty"`
+}
+
+// DeviceRule 的 Model 支持 $1 形式的分组引用，Models 按完整匹配文本查表
+type DeviceRule struct {
+	Match  string            `json:"match"`
+	Model  string            `json:"model,omitempty"`
+	Brand  string            `json:"brand,omitempty"`
+	Type   string            `json:"type,omitempty"`
+	OS     string            `json:"os,omitempty"`
+	Models map[string]string `json:"models,omitempty"`
+}
+
+type BrandRule struct {
+	Brand string `json:"brand"`
+	Match string `json:"match"`
+}
+
+type compiledSoftware struct {
+	SoftwareRule
+	match, require, version *regexp.Regexp
+}
+
+type compiledOS struct {
+	OSRule
+	match    *regexp.Regexp
+	versions []*regexp.Regexp
+}
+
+type compiledDevice struct {
+	DeviceRule
+	match *regexp.Regexp
+}
+
+type compiledBrand struct {
+	BrandRule
+	match *regexp.Regexp
+}
+
+type uaRuleSet struct {
+	rules    *UARules
+	software []compiledSoftware
+	os       []compiledOS
+	osTypes  map[string]string
+	devices  []compiledDevice
+	brands   []compiledBrand
+	versions []*regexp.Regexp
+}
+
+var (
+	uaRulesLock    sync.RWMutex
+	uaRulesCurrent *uaRuleSet
+	uaRulesPath    string
+	uaRulesModTime time.Time
+	uaRulesChecked time.Time
+	uaRulesLoadErr error
+)
+
+// ParseUARules 解析并校验规则文件内容
+func ParseUARules(data []byte) (*UARules, error) {
+	var rules UARules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("规则文件不是有效的 JSON: %w", err)
+	}
+	if _, err := compileUARules(&rules); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+func compileUARules(rules *UARules) (*uaRuleSet, error) {
+	set := &uaRuleSet{rules: rules, osTypes: make(map[string]string)}
+	compile := func(section string, index int, pattern string) (*regexp.Regexp, error) {
+		if pattern == "" {
+			return nil, nil
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s 第 %d 条规则正则错误: %v", section, index+1, err)
+		}
+		return re, nil
+	}
+
+	for i, r := range rules.Software {
+		if r.Name == "" || r.Match == "" {
+			return nil, fmt.Errorf("software 第 %d 条规则缺少 name 或 match", i+1)
+		}
+		c := compiledSoftware{SoftwareRule: r}
+		var err error
+		if c.match, err = compile("software", i, r.Match); err != nil {
+			return nil, err
+		}
+		if c.require, err = compile("software", i, r.Require); err != nil {
+			return nil, err
+		}
+		if c.version, err = compile("software", i, r.Version); err != nil {
+			return nil, err
+		}
+		set.software = append(set.software, c)
+	}
+
+	for i, r := range rules.OS {
+		if r.Name == "" || r.Match == "" {
+			return nil, fmt.Errorf("os 第 %d 条规则缺少 name 或 match", i+1)
+		}
+		c := compiledOS{OSRule: r}
+		var err error
+		if c.match, err = compile("os", i, r.Match); err != nil {
+			return nil, err
+		}
+		for _, v := range r.Versions {
+			re, err := compile("os", i, v)
+			if err != nil {
+				return nil, err
+			}
+			c.versions = append(c.versions, re)
+		}
+		set.os = append(set.os, c)
+		if _, exists := set.osTypes[r.Name]; !exists {
+			set.osTypes[r.Name] = r.Type
+		}
+	}
+
+	for i, r := range rules.Devices {
+		if r.Match == "" {
+			return nil, fmt.Errorf("devices 第 %d 条规则缺少 match", i+1)
+		}
+		re, err := compile("devices", i, r.Match)
+		if err != nil {
+			return nil, err
+		}
+		set.devices = append(set.devices, compiledDevice{DeviceRule: r, match: re})
+	}
+
+	for i, r := range rules.Brands {
+		if r.Brand == "" || r.Match == "" {
+			return nil, fmt.Errorf("brands 第 %d 条规则缺少 brand 或 match", i+1)
+		}
+		re, err := compile("brands", i, r.Match)
+		if err != nil {
+			return nil, err
+		}
+		set.brands = append(set.brands, compiledBrand{BrandRule: r, match: re})
+	}
+
+	for i, p := range rules.VersionPatterns {
+		re, err := compile("version_patterns", i, p)
+		if err != nil {
+			return nil, err
+		}
+		if re != nil {
+			set.versions = append(set.versions, re)
+		}
+	}
+	return set, nil
+}
+
+// InitUARules 设置规则文件路径并加载；文件不存在时使用内置规则
+func InitUARules(path string) error {
+	uaRulesLock.Lock()
+	uaRulesPath = path
+	uaRulesLock.Unlock()
+	return ReloadUARules()
+}
+
+// ReloadUARules 重新读取规则文件，解析失败时保留当前规则
+func ReloadUARules() error {
+	uaRulesLock.Lock()
+	defer uaRulesLock.Unlock()
+	return reloadUARulesLocked()
+}
+
+func reloadUARulesLocked() error {
+	uaRulesChecked = time.Now()
+	data := defaultUARulesJSON
+	var modTime time.Time
+	if uaRulesPath != "" {
+		if stat, err := os.Stat(uaRulesPath); err == nil {
+			fileData, err := os.ReadFile(uaRulesPath)
+			if err != nil {
+				uaRulesLoadErr = fmt.Errorf("读取 UA 规则文件失败: %w", err)
+				return uaRulesLoadErr
+			}
+			data = fileData
+			modTime = stat.ModTime()
+		}
+	}
+
+	rules, err := ParseUARules(data)
+	if err == nil {
+		var set *uaRuleSet
+		if set, err = compileUARules(rules); err == nil {
+			uaRulesCurrent = set
+			uaRulesModTime = modTime
+			uaRulesLoadErr = nil
+			return nil
+		}
+	}
+	uaRulesModTime = modTime
+	uaRulesLoadErr = err
+	if uaRulesCurrent == nil {
+		rules, _ := ParseUARules(defaultUARulesJSON)
+		uaRulesCurrent, _ = compileUARules(rules)
+	}
+	return err
+}
+
+// SaveUARules 校验并写入规则文件，随后立即生效
+func SaveUARules(data []byte) (*UARules, error) {
+	rules, err := ParseUARules(data)
+	if err != nil {
+		return nil, err
+	}
+	formatted, _ := json.MarshalIndent(rules, "", "  ")
+
+	uaRulesLock.Lock()
+	defer uaRulesLock.Unlock()
+	if uaRulesPath == "" {
+		return nil, fmt.Errorf("未配置 UA 规则文件路径")
+	}
+	if err := os.MkdirAll(filepath.Dir(uaRulesPath), 0755); err != nil {
+		return nil, fmt.Errorf("创建规则目录失败: %w", err)
+	}
+	tmp := uaRulesPath + ".tmp"
+	if err := os.WriteFile(tmp, formatted, 0644); err != nil {
+		return nil, fmt.Errorf("写入规则文件失败: %w", err)
+	}
+	if err := os.Rename(tmp, uaRulesPath); err != nil {
+		return nil, fmt.Errorf("写入规则文件失败: %w", err)
+	}
+	return rules, reloadUARulesLocked()
+}
+
+type UARulesStatus struct {
+	Path      string    `json:"path"`
+	Custom    bool      `json:"custom"`
+	Version   string    `json:"version"`
+	ModTime   time.Time `json:"mod_time,omitempty"`
+	LoadError string    `json:"load_error,omitempty"`
+}
+
+// CurrentUARules 返回当前生效的规则及加载状态
+func CurrentUARules() (*UARules, UARulesStatus) {
+	set := currentUARuleSet()
+	uaRulesLock.RLock()
+	defer uaRulesLock.RUnlock()
+	status := UARulesStatus{
+		Path:    uaRulesPath,
+		Custom:  !uaRulesModTime.IsZero(),
+		Version: set.rules.Version,
+		ModTime: uaRulesModTime,
+	}
+	if uaRulesLoadErr != nil {
+		status.LoadError = uaRulesLoadErr.Error()
+	}
+	return set.rules, status
+}
+
+// currentUARuleSet 返回当前规则，规则文件有修改时自动重新加载
+func currentUARuleSet() *uaRuleSet {
+	uaRulesLock.RLock()
+	set := uaRulesCurrent
+	stale := set == nil || time.Since(uaRulesChecked) > uaRulesCheckInterval
+	uaRulesLock.RUnlock()
+	if !stale {
+		return set
+	}
+
+	uaRulesLock.Lock()
+	defer uaRulesLock.Unlock()
+	if uaRulesCurrent == nil {
+		reloadUARulesLocked()
+		return uaRulesCurrent
+	}
+	if time.Since(uaRulesChecked) <= uaRulesCheckInterval {
+		return uaRulesCurrent
+	}
+	uaRulesChecked = time.Now()
+	var modTime time.Time
+	if uaRulesPath != "" {
+		if stat, err := os.Stat(uaRulesPath); err == nil {
+			modTime = stat.ModTime()
+		}
+	}
+	if !modTime.Equal(uaRulesModTime) {
+		reloadUARulesLocked()
+	}
+	return uaRulesCurrent
+}
+
+func (s *uaRuleSet) parse(userAgent string) *DeviceInfo {
+	info := &DeviceInfo{
+		SoftwareName: "Unknown",
+		OSName:       "Unknown",
+		DeviceType:   "unknown",
+		DeviceName:   "Unknown Device",
+	}
+	if userAgent == "" {
+		return info
+	}
+
+	var software *compiledSoftware
+	for i := range s.software {
+		r := &s.software[i]
+		if r.match.MatchString(userAgent) && (r.require == nil || r.require.MatchString(userAgent)) {
+			software = r
+			info.SoftwareName = r.Name
+			break
+		}
+	}
+
+	osType := ""
+	for _, r := range s.os {
+		if !r.match.MatchString(userAgent) {
+			continue
+		}
+		info.OSName = r.Name
+		osType = r.Type
+		for _, re := range r.versions {
+			if match := re.FindStringSubmatch(userAgent); len(match) > 1 {
+				parts := []string{}
+				for _, p := range match[1:] {
+					if p != "" {
+						parts = append(parts, p)
+					}
+				}
+				info.OSVersion = strings.ReplaceAll(strings.Join(parts, "."), "_", ".")
+				break
+			}
+		}
+		break
+	}
+	if info.OSName == "Unknown" && software != nil && software.OS != "" {
+		info.OSName = software.OS
+		osType = s.osTypes[software.OS]
+	}
+
+	deviceType := ""
+	for _, r := range s.devices {
+		if r.OS != "" && r.OS != info.OSName {
+			continue
+		}
+		loc := r.match.FindStringSubmatchIndex(userAgent)
+		if loc == nil {
+			continue
+		}
+		if model, ok := r.Models[userAgent[loc[0]:loc[1]]]; ok {
+			info.DeviceModel = model
+		} else if r.Model != "" {
+			info.DeviceModel = strings.TrimSpace(string(r.match.ExpandString(nil, r.Model, userAgent, loc)))
+		}
+		info.DeviceBrand = r.Brand
+		deviceType = r.Type
+		break
+	}
+	if info.DeviceBrand == "" && info.DeviceModel != "" {
+		for _, r := range s.brands {
+			if r.match.MatchString(info.DeviceModel) {
+				info.DeviceBrand = r.Brand
+				break
+			}
+		}
+	}
+	if info.DeviceBrand == "" && info.DeviceModel == "" && software != nil {
+		info.DeviceBrand = software.Brand
+	}
+
+	if software != nil && software.version != nil {
+		if match := software.version.FindStringSubmatch(userAgent); len(match) > 1 {
+			info.SoftwareVersion = match[1]
+		}
+	}
+	if info.SoftwareVersion == "" {
+		for _, re := range s.versions {
+			if match := re.FindStringSubmatch(userAgent); len(match) > 1 {
+				info.SoftwareVersion = match[1]
+				break
+			}
+		}
+	}
+
+	switch {
+	case deviceType != "":
+		info.DeviceType = deviceType
+	case osType != "":
+		info.DeviceType = osType
+	case software != nil && software.Type != "":
+		info.DeviceType = software.Type
+	}
+	return info
+}
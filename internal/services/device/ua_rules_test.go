@@ -0,0 +1,95 @@
+package device
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type uaCorpusCase struct {
+	UA        string `json:"ua"`
+	Software  string `json:"software"`
+	Version   string `json:"version"`
+	OS        string `json:"os"`
+	OSVersion string `json:"os_version"`
+	Brand     string `json:"brand"`
+	Model     string `json:"model"`
+	Type      string `json:"type"`
+}
+
+func TestUARulesCorpus(t *testing.T) {
+	data, err := os.ReadFile("testdata/ua_corpus.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []uaCorpusCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := ParseUARules(defaultUARulesJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := compileUARules(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range cases {
+		info := set.parse(tc.UA)
+		got := uaCorpusCase{
+			UA:        tc.UA,
+			Software:  info.SoftwareName,
+			Version:   info.SoftwareVersion,
+			OS:        info.OSName,
+			OSVersion: info.OSVersion,
+			Brand:     info.DeviceBrand,
+			Model:     info.DeviceModel,
+			Type:      info.DeviceType,
+		}
+		if got != tc {
+			t.Errorf("UA %q\n got  %+v\n want %+v", tc.UA, got, tc)
+		}
+	}
+}
+
+func TestParseUARulesRejectsBadRegex(t *testing.T) {
+	_, err := ParseUARules([]byte(`{"software":[{"name":"X","match":"(unclosed"}]}`))
+	if err == nil {
+		t.Fatal("expected error for invalid regex")
+	}
+}
+
+func TestUARulesHotReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ua_rules.json")
+	if err := InitUARules(path); err != nil {
+		t.Fatal(err)
+	}
+	defer InitUARules("")
+
+	dm := &DeviceManager{}
+	if name := dm.ParseUserAgent("NewClient/1.0").SoftwareName; name != "Unknown" {
+		t.Fatalf("expected Unknown before rule added, got %s", name)
+	}
+
+	custom := `{"version":"test","software":[{"name":"New Client","match":"(?i)newclient/","os":"Android"}],"os":[{"name":"Android","match":"(?i)android","type":"mobile"}]}`
+	if err := os.WriteFile(path, []byte(custom), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟外部编辑：让修改时间与上次加载不同，并跳过检查间隔
+	os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	uaRulesLock.Lock()
+	uaRulesChecked = time.Time{}
+	uaRulesLock.Unlock()
+
+	info := dm.ParseUserAgent("NewClient/1.0")
+	if info.SoftwareName != "New Client" || info.OSName != "Android" || info.DeviceType != "mobile" {
+		t.Fatalf("rule file change not picked up: %+v", info)
+	}
+	if _, status := CurrentUARules(); !status.Custom || status.Version != "test" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
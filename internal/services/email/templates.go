@@ -512,6 +512,113 @@ func (b *EmailTemplateBuilder) GetSubscriptionResetTemplate(username, universalU
 	return b.GetBaseTemplate(title, content, "请及时更新您的客户端配置")
 }
 
+func (b *EmailTemplateBuilder) GetDeviceApprovalTemplate(username, deviceName, ipAddress, accessTime, approveURL, denyURL string) string {
+	title := "新设备待审批"
+	content := fmt.Sprintf(`<h2>检测到新设备获取订阅</h2>
+            <p>亲爱的 %s，</p>
+            <p>您已开启新设备审批，以下设备正在尝试获取您的订阅，审批通过前该设备只能看到提示节点。</p>
+            <div class="info-box">
+                <h3>📱 设备信息</h3>
+                <table class="info-table">
+                    <tr><th>设备名称</th><td><strong>%s</strong></td></tr>
+                    <tr><th>IP 地址</th><td>%s</td></tr>
+                    <tr><th>访问时间</th><td>%s</td></tr>
+                </table>
+            </div>
+            <div style="text-align: center; margin: 30px 0;">
+                <a href="%s" class="btn">允许该设备</a>
+                <a href="%s" class="btn" style="background: #e74c3c;">拒绝该设备</a>
+            </div>
+            <div class="warning-box">
+                <h3>⚠️ 安全提醒</h3>
+                <ul>
+                    <li>如果这不是您本人的设备，请拒绝并重置订阅地址</li>
+                    <li>您也可以登录官网在设备管理中审批</li>
+                </ul>
+            </div>`, username, deviceName, ipAddress, accessTime, approveURL, denyURL)
+
+	return b.GetBaseTemplate(title, content, "保护您的账户安全")
+}
+
+func (b *EmailTemplateBuilder) GetLoginAlertTemplate(username, deviceName, ipAddress, location, loginTime, reasons, revokeURL string) string {
+	title := "新的登录提醒"
+	if location == "" {
+		location = "未知"
+	}
+	content := fmt.Sprintf(`<h2>是您本人登录吗？</h2>
+            <p>亲爱的 %s，</p>
+            <p>您的账户刚刚在一个不常用的环境中登录：</p>
+            <div class="info-box">
+                <table class="info-table">
+                    <tr><th>设备</th><td><strong>%s</strong></td></tr>
+                    <tr><th>IP 地址</th><td>%s</td></tr>
+                    <tr><th>位置</th><td>%s</td></tr>
+                    <tr><th>登录时间</th><td>%s</td></tr>
+                    <tr><th>提醒原因</th><td>%s</td></tr>
+                </table>
+            </div>
+            <p>如果是您本人操作，请忽略此邮件。</p>
+            <div style="text-align: center; margin: 30px 0;">
+                <a href="%s" class="btn" style="background: #e74c3c;">不是我，退出该登录</a>
+            </div>
+            <div class="warning-box">
+                <h3>⚠️ 安全提醒</h3>
+                <ul>
+                    <li>退出该登录后，请立即修改密码</li>
+                    <li>建议开启两步验证以保护账户安全</li>
+                </ul>
+            </div>`, template.HTMLEscapeString(username), template.HTMLEscapeString(deviceName), template.HTMLEscapeString(ipAddress),
+		template.HTMLEscapeString(location), loginTime, template.HTMLEscapeString(reasons), revokeURL)
+
+	return b.GetBaseTemplate(title, content, "保护您的账户安全")
+}
+
+func (b *EmailTemplateBuilder) GetLoginStepUpTemplate(username, verificationCode, ipAddress, location string) string {
+	title := "登录验证码"
+	if location == "" {
+		location = "未知"
+	}
+	content := fmt.Sprintf(`<h2>🔐 登录验证码</h2>
+            <p>亲爱的 %s，</p>
+            <p>我们检测到一次来自不常用环境的登录（IP：%s，位置：%s），请输入以下验证码完成登录：</p>
+            <div style="text-align: center; margin: 30px 0;">
+                <div style="display: inline-block; background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); padding: 20px 40px; border-radius: 8px; box-shadow: 0 4px 15px rgba(102, 126, 234, 0.4);">
+                    <div style="font-size: 32px; font-weight: bold; color: #ffffff; letter-spacing: 8px; font-family: 'Courier New', monospace;">%s</div>
+                </div>
+            </div>
+            <div class="warning-box">
+                <p><strong>⚠️ 安全提示：</strong></p>
+                <p>验证码 10 分钟内有效。如果这不是您本人的操作，说明您的密码可能已泄露，请立即修改密码。</p>
+            </div>`, template.HTMLEscapeString(username), template.HTMLEscapeString(ipAddress), template.HTMLEscapeString(location), verificationCode)
+
+	return b.GetBaseTemplate(title, content, "保护您的账户安全")
+}
+
+func (b *EmailTemplateBuilder) GetDeviceOverLimitTemplate(username, deviceName, graceUntil string, currentDevices, deviceLimit int) string {
+	title := "设备数量超出限制"
+	content := fmt.Sprintf(`<h2>设备数量已超出套餐限制</h2>
+            <p>亲爱的 %s，</p>
+            <p>新设备「%s」获取了您的订阅，当前设备数已超出套餐限制，该设备暂时处于宽限期。</p>
+            <div class="info-box">
+                <table class="info-table">
+                    <tr><th>当前设备</th><td><strong>%d / %d</strong></td></tr>
+                    <tr><th>宽限截止</th><td style="color: #e74c3c; font-weight: bold;">%s</td></tr>
+                </table>
+            </div>
+            <div class="warning-box">
+                <h3>⚠️ 请及时处理</h3>
+                <ul>
+                    <li>宽限期结束后，超出限制的设备将无法获取订阅</li>
+                    <li>请登录官网删除不再使用的设备，或升级设备数量</li>
+                </ul>
+            </div>
+            <div style="text-align: center; margin: 30px 0;">
+                <a href="%s/dashboard" class="btn">管理设备</a>
+            </div>`, username, deviceName, currentDevices, deviceLimit, graceUntil, b.getBaseURL())
+
+	return b.GetBaseTemplate(title, content, "此邮件由系统自动发送，请勿回复。")
+}
+
 func (b *EmailTemplateBuilder) GetAccountDeletionTemplate(username, deletionDate, reason, dataRetentionPeriod string) string {
 	title := "账号删除确认"
 	content := fmt.Sprintf(`<h2>账号删除确认</h2>
@@ -537,6 +644,53 @@ func (b *EmailTemplateBuilder) GetAccountDeletionTemplate(username, deletionDate
 	return b.GetBaseTemplate(title, content, "感谢您曾经选择我们的服务")
 }
 
+func (b *EmailTemplateBuilder) GetAccountDeletionScheduledTemplate(username, requestTime, scheduledTime string, coolingOffDays int) string {
+	title := "账号注销申请已提交"
+	loginURL := fmt.Sprintf("%s/login", b.getBaseURL())
+	content := fmt.Sprintf(`<h2>账号注销申请已提交</h2>
+            <p>亲爱的 %s，</p>
+            <p>我们收到了您的账号注销申请，注销将在 <strong>%d 天</strong>冷静期结束后执行。</p>
+            <div class="info-box">
+                <table class="info-table">
+                    <tr><th>申请时间</th><td>%s</td></tr>
+                    <tr><th>预计注销时间</th><td><strong>%s</strong></td></tr>
+                </table>
+            </div>
+            <div class="warning-box">
+                <h3>⚠️ 注销后</h3>
+                <ul>
+                    <li>订阅、设备、登录记录、工单等个人数据将被删除，无法恢复</li>
+                    <li>订单与支付记录按财务要求匿名保留，不再与您的身份关联</li>
+                    <li>账户余额与未到期的套餐将一并作废</li>
+                </ul>
+            </div>
+            <p>如需保留账号，请在冷静期内登录并在个人设置中撤销注销申请。如果这不是您本人的操作，请立即登录撤销并修改密码。</p>
+            <div style="text-align: center; margin: 30px 0;">
+                <a href="%s" class="btn">登录撤销</a>
+            </div>`, template.HTMLEscapeString(username), coolingOffDays, requestTime, scheduledTime, loginURL)
+
+	return b.GetBaseTemplate(title, content, "保护您的账户安全")
+}
+
+func (b *EmailTemplateBuilder) GetDataExportReadyTemplate(username, downloadURL, expireTime string) string {
+	title := "个人数据导出已完成"
+	content := fmt.Sprintf(`<h2>📦 个人数据导出已完成</h2>
+            <p>亲爱的 %s，</p>
+            <p>您申请的个人数据导出已生成，压缩包内包含账户资料、订阅、订单、支付、设备、登录记录、工单和通知，每类数据均提供 JSON 与 CSV 两种格式。</p>
+            <div style="text-align: center; margin: 30px 0;">
+                <a href="%s" class="btn">下载数据</a>
+            </div>
+            <div class="warning-box">
+                <h3>⚠️ 注意</h3>
+                <ul>
+                    <li>下载链接有效期至 <strong>%s</strong>，过期后文件将被删除</li>
+                    <li>压缩包包含您的个人信息，请勿转发此邮件</li>
+                </ul>
+            </div>`, template.HTMLEscapeString(username), downloadURL, expireTime)
+
+	return b.GetBaseTemplate(title, content, "此邮件由系统自动发送，请勿回复。")
+}
+
 func (b *EmailTemplateBuilder) GetAccountDeletionWarningTemplate(username, email, lastLogin string, daysUntilDeletion int) string {
 	title := "账号删除提醒"
 	baseURL := b.getBaseURL()
@@ -0,0 +1,246 @@
+package emaildomain
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed disposable_domains.txt
+var defaultDisposableList []byte
+
+// DefaultDisposableListURL 社区维护的一次性邮箱域名列表
+const DefaultDisposableListURL = "https://raw.githubusercontent.com/disposable-email-domains/disposable-email-domains/main/disposable_email_blocklist.conf"
+
+// maxDisposableListSize 下载列表的大小上限
+const maxDisposableListSize = 16 << 20
+
+var (
+	disposableLock    sync.RWMutex
+	disposablePath    string
+	disposableDomains map[string]struct{}
+	disposableModTime time.Time
+	disposableLoadErr error
+)
+
+// disposableListHosts 允许下载列表的来源，避免管理接口被用来请求内网或任意地址
+var disposableListHosts = []string{"raw.githubusercontent.com", "cdn.jsdelivr.net"}
+
+var downloadClient = &http.Client{
+	Timeout: 30 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return fmt.Errorf("重定向次数过多")
+		}
+		return checkDisposableListURL(req.URL)
+	},
+}
+
+// checkDisposableListURL 列表地址必须为 https 且主机在白名单内
+func checkDisposableListURL(u *url.URL) error {
+	if u.Scheme != "https" || (u.Port() != "" && u.Port() != "443") {
+		return fmt.Errorf("仅支持 https 地址")
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range disposableListHosts {
+		if host == h {
+			return nil
+		}
+	}
+	return fmt.Errorf("不允许的列表来源 %s，仅支持 %s", host, strings.Join(disposableListHosts, ", "))
+}
+
+// ParseDisposableList 解析域名列表，每行一个域名，忽略空行和 # 注释
+func ParseDisposableList(data []byte) (map[string]struct{}, error) {
+	domains := make(map[string]struct{})
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = strings.TrimSpace(text[:i])
+		}
+		if text == "" {
+			continue
+		}
+		domain := normalizeDomain(text)
+		if !validDomain(domain) {
+			return nil, fmt.Errorf("第 %d 行不是有效的域名: %s", line, text)
+		}
+		domains[domain] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("域名列表为空")
+	}
+	return domains, nil
+}
+
+// InitDisposableDomains 设置列表文件路径并加载；文件不存在时使用内置列表
+func InitDisposableDomains(path string) error {
+	disposableLock.Lock()
+	disposablePath = path
+	disposableLock.Unlock()
+	return ReloadDisposableDomains()
+}
+
+// ReloadDisposableDomains 重新读取列表文件，解析失败时保留当前列表
+func ReloadDisposableDomains() error {
+	disposableLock.Lock()
+	defer disposableLock.Unlock()
+	return reloadDisposableLocked()
+}
+
+func reloadDisposableLocked() error {
+	data := defaultDisposableList
+	var modTime time.Time
+	if disposablePath != "" {
+		if stat, err := os.Stat(disposablePath); err == nil {
+			fileData, err := os.ReadFile(disposablePath)
+			if err != nil {
+				disposableLoadErr = fmt.Errorf("读取一次性邮箱列表失败: %w", err)
+				return disposableLoadErr
+			}
+			data = fileData
+			modTime = stat.ModTime()
+		}
+	}
+
+	domains, err := ParseDisposableList(data)
+	if err != nil {
+		disposableLoadErr = err
+		if disposableDomains == nil {
+			disposableDomains, _ = ParseDisposableList(defaultDisposableList)
+		}
+		return err
+	}
+	disposableDomains = domains
+	disposableModTime = modTime
+	disposableLoadErr = nil
+	return nil
+}
+
+// SaveDisposableDomains 校验并写入列表文件，随后立即生效
+func SaveDisposableDomains(data []byte) (int, error) {
+	domains, err := ParseDisposableList(data)
+	if err != nil {
+		return 0, err
+	}
+
+	disposableLock.Lock()
+	defer disposableLock.Unlock()
+	if disposablePath == "" {
+		return 0, fmt.Errorf("未配置一次性邮箱列表文件路径")
+	}
+	if err := os.MkdirAll(filepath.Dir(disposablePath), 0755); err != nil {
+		return 0, fmt.Errorf("创建列表目录失败: %w", err)
+	}
+	tmp := disposablePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return 0, fmt.Errorf("写入列表文件失败: %w", err)
+	}
+	if err := os.Rename(tmp, disposablePath); err != nil {
+		return 0, fmt.Errorf("写入列表文件失败: %w", err)
+	}
+	return len(domains), reloadDisposableLocked()
+}
+
+// DownloadDisposableDomains 从白名单内的 https 地址下载列表并保存
+func DownloadDisposableDomains(ctx context.Context, listURL string) (int, error) {
+	if listURL == "" {
+		listURL = DefaultDisposableListURL
+	}
+	u, err := url.Parse(listURL)
+	if err != nil {
+		return 0, fmt.Errorf("列表地址格式错误: %w", err)
+	}
+	if err := checkDisposableListURL(u); err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("下载列表失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("下载列表失败: HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDisposableListSize+1))
+	if err != nil {
+		return 0, fmt.Errorf("下载列表失败: %w", err)
+	}
+	if len(data) > maxDisposableListSize {
+		return 0, fmt.Errorf("列表文件过大")
+	}
+	return SaveDisposableDomains(data)
+}
+
+type DisposableStatus struct {
+	Path      string    `json:"path"`
+	Custom    bool      `json:"custom"`
+	Count     int       `json:"count"`
+	ModTime   time.Time `json:"mod_time,omitempty"`
+	LoadError string    `json:"load_error,omitempty"`
+}
+
+// CurrentDisposableStatus 当前生效的列表信息
+func CurrentDisposableStatus() DisposableStatus {
+	disposableLock.Lock()
+	defer disposableLock.Unlock()
+	if disposableDomains == nil {
+		reloadDisposableLocked()
+	}
+	status := DisposableStatus{
+		Path:    disposablePath,
+		Custom:  !disposableModTime.IsZero(),
+		Count:   len(disposableDomains),
+		ModTime: disposableModTime,
+	}
+	if disposableLoadErr != nil {
+		status.LoadError = disposableLoadErr.Error()
+	}
+	return status
+}
+
+// IsDisposable 域名或其上级域名在一次性邮箱列表中
+func IsDisposable(domain string) bool {
+	disposableLock.RLock()
+	domains := disposableDomains
+	disposableLock.RUnlock()
+	if domains == nil {
+		disposableLock.Lock()
+		if disposableDomains == nil {
+			reloadDisposableLocked()
+		}
+		domains = disposableDomains
+		disposableLock.Unlock()
+	}
+
+	domain = normalizeDomain(domain)
+	for domain != "" {
+		if _, ok := domains[domain]; ok {
+			return true
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found || !strings.Contains(parent, ".") {
+			break
+		}
+		domain = parent
+	}
+	return false
+}
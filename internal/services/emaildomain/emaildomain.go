@@ -0,0 +1,210 @@
+package emaildomain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"cboard-go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidEmail  = errors.New("邮箱格式不正确")
+	ErrNotAllowed    = errors.New("不支持使用该邮箱域名注册，请更换邮箱")
+	ErrDenied        = errors.New("该邮箱域名已被禁止使用，请更换邮箱")
+	ErrDisposable    = errors.New("不支持使用临时邮箱，请更换常用邮箱")
+	ErrNoMailService = errors.New("该邮箱域名无法接收邮件，请检查邮箱地址")
+)
+
+// mxLookupTimeout MX 查询超时，超时视为无法判断并放行
+const mxLookupTimeout = 3 * time.Second
+
+// Resolver 查询 MX 记录，*net.Resolver 满足该接口，测试时可替换
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+// DefaultResolver 系统 DNS 解析器
+var DefaultResolver Resolver = net.DefaultResolver
+
+// Policy registration 分类下的邮箱域名策略
+type Policy struct {
+	AllowList       []string // 非空时只允许列表中的域名，支持 *.example.com 通配
+	DenyList        []string
+	BlockDisposable bool
+	CheckMX         bool
+	Resolver        Resolver // 为空时使用 DefaultResolver
+}
+
+// Rejection 被拒绝的原因，Err 为对应的哨兵错误
+type Rejection struct {
+	Domain string
+	Rule   string // allowlist、denylist、disposable、mx
+	Err    error
+}
+
+func (r *Rejection) Error() string { return r.Err.Error() }
+func (r *Rejection) Unwrap() error { return r.Err }
+
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+func validDomain(domain string) bool {
+	if len(domain) < 3 || len(domain) > 253 || !strings.Contains(domain, ".") {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, ch := range label {
+			if !(ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' || ch == '-' || ch == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Domain 提取邮箱的域名部分
+func Domain(email string) (string, error) {
+	at := strings.LastIndexByte(email, '@')
+	if at <= 0 || at == len(email)-1 {
+		return "", ErrInvalidEmail
+	}
+	domain := normalizeDomain(email[at+1:])
+	if !validDomain(domain) {
+		return "", ErrInvalidEmail
+	}
+	return domain, nil
+}
+
+// splitList 兼容 JSON 数组和逗号、换行分隔的字符串
+func splitList(value string) []string {
+	value = strings.TrimSpace(value)
+	var items []string
+	if strings.HasPrefix(value, "[") {
+		if json.Unmarshal([]byte(value), &items) != nil {
+			items = nil
+		}
+	}
+	if items == nil {
+		items = strings.FieldsFunc(value, func(r rune) bool {
+			return r == ',' || r == '\n' || r == '\r' || r == ' ' || r == ';'
+		})
+	}
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = normalizeDomain(strings.TrimPrefix(strings.TrimSpace(item), "@")); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// LoadPolicy 读取邮箱域名策略
+func LoadPolicy(db *gorm.DB) *Policy {
+	p := &Policy{BlockDisposable: true}
+	var configs []models.SystemConfig
+	db.Where("category = ? AND key IN ?", "registration",
+		[]string{"email_domain_allowlist", "email_domain_denylist", "block_disposable_email", "email_mx_check"}).
+		Find(&configs)
+	for _, c := range configs {
+		switch c.Key {
+		case "email_domain_allowlist":
+			p.AllowList = splitList(c.Value)
+		case "email_domain_denylist":
+			p.DenyList = splitList(c.Value)
+		case "block_disposable_email":
+			p.BlockDisposable = strings.TrimSpace(c.Value) != "false"
+		case "email_mx_check":
+			p.CheckMX = strings.TrimSpace(c.Value) == "true"
+		}
+	}
+	return p
+}
+
+// MatchDomain 判断域名是否匹配规则：example.com 只匹配自身，
+// *.example.com 匹配所有子域名，其余通配符按 path.Match 规则处理
+func MatchDomain(pattern, domain string) bool {
+	pattern, domain = normalizeDomain(pattern), normalizeDomain(domain)
+	if pattern == "" || domain == "" {
+		return false
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		return pattern == domain
+	}
+	ok, err := path.Match(pattern, domain)
+	return err == nil && ok
+}
+
+func matchAny(patterns []string, domain string) bool {
+	for _, p := range patterns {
+		if MatchDomain(p, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check 按策略校验邮箱。白名单中的域名跳过黑名单与一次性邮箱检查；
+// MX 查询失败（超时、DNS 故障）时放行，只有明确不存在邮件服务时才拒绝
+func (p *Policy) Check(ctx context.Context, email string) error {
+	domain, err := Domain(email)
+	if err != nil {
+		return err
+	}
+	reject := func(rule string, err error) error {
+		return &Rejection{Domain: domain, Rule: rule, Err: err}
+	}
+
+	allowed := matchAny(p.AllowList, domain)
+	if len(p.AllowList) > 0 && !allowed {
+		return reject("allowlist", ErrNotAllowed)
+	}
+	if !allowed {
+		if matchAny(p.DenyList, domain) {
+			return reject("denylist", ErrDenied)
+		}
+		if p.BlockDisposable && IsDisposable(domain) {
+			return reject("disposable", ErrDisposable)
+		}
+	}
+
+	if p.CheckMX && !hasMailService(ctx, p.resolver(), domain) {
+		return reject("mx", ErrNoMailService)
+	}
+	return nil
+}
+
+func (p *Policy) resolver() Resolver {
+	if p.Resolver != nil {
+		return p.Resolver
+	}
+	return DefaultResolver
+}
+
+func hasMailService(ctx context.Context, r Resolver, domain string) bool {
+	ctx, cancel := context.WithTimeout(ctx, mxLookupTimeout)
+	defer cancel()
+	records, err := r.LookupMX(ctx, domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		// 仅在域名不存在时拒绝，其余错误无法判断
+		return !(errors.As(err, &dnsErr) && dnsErr.IsNotFound)
+	}
+	for _, mx := range records {
+		// RFC 7505 空 MX 记录表示该域名不接收邮件
+		if host := strings.TrimSuffix(mx.Host, "."); host != "" {
+			return true
+		}
+	}
+	return false
+}
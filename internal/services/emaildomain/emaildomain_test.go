@@ -0,0 +1,158 @@
+package emaildomain
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type fakeResolver map[string][]*net.MX
+
+func (f fakeResolver) LookupMX(_ context.Context, name string) ([]*net.MX, error) {
+	switch name {
+	case "timeout.example":
+		return nil, &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true}
+	}
+	records, ok := f[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+func TestMatchDomain(t *testing.T) {
+	cases := []struct {
+		pattern, domain string
+		want            bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "mail.example.com", false},
+		{"*.example.com", "mail.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.edu", "cs.mit.edu", true},
+		{"Example.COM.", "example.com", true},
+		{"qq.com", "foxmail.com", false},
+	}
+	for _, tc := range cases {
+		if got := MatchDomain(tc.pattern, tc.domain); got != tc.want {
+			t.Errorf("MatchDomain(%q, %q) = %v, want %v", tc.pattern, tc.domain, got, tc.want)
+		}
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	resolver := fakeResolver{
+		"gmail.com":       {{Host: "gmail-smtp-in.l.google.com.", Pref: 5}},
+		"corp.example":    {{Host: "mx.corp.example.", Pref: 10}},
+		"nullmx.example":  {{Host: ".", Pref: 0}},
+		"mailinator.com":  {{Host: "mail.mailinator.com.", Pref: 10}},
+		"partner.example": {{Host: "mx.partner.example.", Pref: 10}},
+	}
+
+	p := &Policy{BlockDisposable: true, DenyList: []string{"*.spam.example", "bad.example"}, Resolver: resolver}
+	cases := []struct {
+		email string
+		want  error
+	}{
+		{"user@gmail.com", nil},
+		{"not-an-email", ErrInvalidEmail},
+		{"user@bad.example", ErrDenied},
+		{"user@x.spam.example", ErrDenied},
+		{"user@mailinator.com", ErrDisposable},
+		{"user@inbox.mailinator.com", ErrDisposable}, // 一次性域名的子域名
+	}
+	for _, tc := range cases {
+		if err := p.Check(context.Background(), tc.email); !errors.Is(err, tc.want) {
+			t.Errorf("Check(%q) = %v, want %v", tc.email, err, tc.want)
+		}
+	}
+
+	// 白名单：只允许列表中的域名，且白名单优先于一次性邮箱检查
+	p = &Policy{AllowList: []string{"*.example", "mailinator.com"}, BlockDisposable: true, Resolver: resolver}
+	if err := p.Check(context.Background(), "user@gmail.com"); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("domain outside allowlist: %v", err)
+	}
+	if err := p.Check(context.Background(), "user@mailinator.com"); err != nil {
+		t.Errorf("allowlisted domain rejected: %v", err)
+	}
+
+	// MX 校验：域名不存在或空 MX 时拒绝，DNS 超时时放行
+	p = &Policy{CheckMX: true, Resolver: resolver}
+	for email, want := range map[string]error{
+		"user@corp.example":    nil,
+		"user@missing.example": ErrNoMailService,
+		"user@nullmx.example":  ErrNoMailService,
+		"user@timeout.example": nil,
+	} {
+		err := p.Check(context.Background(), email)
+		if !errors.Is(err, want) {
+			t.Errorf("MX Check(%q) = %v, want %v", email, err, want)
+		}
+		var rejection *Rejection
+		if want != nil && (!errors.As(err, &rejection) || rejection.Rule != "mx") {
+			t.Errorf("MX rejection should report rule mx: %v", err)
+		}
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	got := splitList(`["@Example.com", " *.edu "]`)
+	if len(got) != 2 || got[0] != "example.com" || got[1] != "*.edu" {
+		t.Errorf("json list parsed as %v", got)
+	}
+	got = splitList("a.com, b.com\nc.com")
+	if len(got) != 3 {
+		t.Errorf("plain list parsed as %v", got)
+	}
+}
+
+func TestDisposableListUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disposable.txt")
+	if err := InitDisposableDomains(path); err != nil {
+		t.Fatalf("missing file should fall back to bundled list: %v", err)
+	}
+	t.Cleanup(func() { InitDisposableDomains("") })
+	if status := CurrentDisposableStatus(); status.Custom || status.Count == 0 {
+		t.Fatalf("bundled list not loaded: %+v", status)
+	}
+
+	if _, err := SaveDisposableDomains([]byte("not a domain!\n")); err == nil {
+		t.Error("invalid list should be rejected")
+	}
+	n, err := SaveDisposableDomains([]byte("# custom\nthrowaway.example\n\nBurner.Example # comment\n"))
+	if err != nil || n != 2 {
+		t.Fatalf("save list: %d %v", n, err)
+	}
+	if !IsDisposable("throwaway.example") || !IsDisposable("burner.example") {
+		t.Error("custom list not applied")
+	}
+	if IsDisposable("mailinator.com") {
+		t.Error("custom list should replace the bundled list")
+	}
+
+	// 文件损坏时保留当前列表
+	os.WriteFile(path, []byte("bad domain!"), 0o644)
+	if err := ReloadDisposableDomains(); err == nil {
+		t.Error("reload of a broken file should fail")
+	}
+	if !IsDisposable("throwaway.example") {
+		t.Error("previous list should be kept after a failed reload")
+	}
+}
+
+func TestDownloadDisposableDomainsRejectsUntrustedURL(t *testing.T) {
+	for _, u := range []string{
+		"http://raw.githubusercontent.com/list.conf",
+		"https://169.254.169.254/latest/meta-data",
+		"https://127.0.0.1/list.conf",
+		"https://raw.githubusercontent.com:8443/list.conf",
+		"https://raw.githubusercontent.com.evil.example/list.conf",
+	} {
+		if _, err := DownloadDisposableDomains(context.Background(), u); err == nil {
+			t.Errorf("%s should be rejected", u)
+		}
+	}
+}
@@ -217,6 +217,7 @@ func Close() {
 		geoipDB = nil
 	}
 	geoipEnabled = false
+	closeASN()
 }
 
 func GetLocationFromIPW(ipAddress string) (*LocationInfo, error) {
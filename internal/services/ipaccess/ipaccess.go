@@ -0,0 +1,277 @@
+package ipaccess
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/geoip"
+
+	"gorm.io/gorm"
+)
+
+// cacheTTL 规则缓存时间，其他实例修改规则后最多延迟这么久生效
+const cacheTTL = 30 * time.Second
+
+var validScopes = map[string]bool{
+	models.AccessScopeAll:       true,
+	models.AccessScopeAuth:      true,
+	models.AccessScopeUser:      true,
+	models.AccessScopeAdmin:     true,
+	models.AccessScopeSubscribe: true,
+}
+
+// 地理位置查询，测试时可替换
+var (
+	lookupCountry = func(ip string) string {
+		if loc, err := geoip.GetLocation(ip); err == nil {
+			return strings.ToUpper(loc.CountryCode)
+		}
+		return ""
+	}
+	lookupASN = func(ip string) uint {
+		if info, err := geoip.GetASN(ip); err == nil {
+			return info.Number
+		}
+		return 0
+	}
+)
+
+// Decision 访问判定结果，Rule 为空表示没有命中任何规则
+type Decision struct {
+	Allowed bool               `json:"allowed"`
+	Bypass  bool               `json:"bypass"`
+	Rule    *models.AccessRule `json:"rule,omitempty"`
+	Country string             `json:"country,omitempty"`
+	ASN     uint               `json:"asn,omitempty"`
+}
+
+type compiledRule struct {
+	rule      models.AccessRule
+	any       bool
+	networks  []*net.IPNet
+	countries map[string]bool
+	asns      map[uint]bool
+}
+
+type ruleSet struct {
+	byScope  map[string][]*compiledRule
+	bypass   []*net.IPNet
+	loadedAt time.Time
+}
+
+var (
+	cacheMu sync.Mutex
+	cached  *ruleSet
+)
+
+// Invalidate 清除规则缓存，本实例修改规则后立即生效
+func Invalidate() {
+	cacheMu.Lock()
+	cached = nil
+	cacheMu.Unlock()
+}
+
+func splitValues(value string) []string {
+	var values []string
+	for _, v := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r' || r == ' ' || r == ';'
+	}) {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// ParseNetworks 解析 IP 或 CIDR 列表，单个 IP 视为 /32 或 /128
+func ParseNetworks(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, v := range splitValues(value) {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的 IP 地址: %s", v)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 CIDR: %s", v)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Validate 校验规则是否可用，保存前调用
+func Validate(rule models.AccessRule) error {
+	_, err := compile(rule)
+	return err
+}
+
+// compile 校验规则并预解析匹配值
+func compile(rule models.AccessRule) (*compiledRule, error) {
+	if !validScopes[rule.Scope] {
+		return nil, fmt.Errorf("无效的作用范围: %s", rule.Scope)
+	}
+	if rule.Action != "allow" && rule.Action != "deny" {
+		return nil, fmt.Errorf("动作只能是 allow 或 deny")
+	}
+	values := splitValues(rule.Value)
+	if len(values) == 0 {
+		return nil, fmt.Errorf("匹配值不能为空")
+	}
+	cr := &compiledRule{rule: rule}
+	if len(values) == 1 && values[0] == "*" {
+		cr.any = true
+		return cr, nil
+	}
+
+	switch rule.Type {
+	case models.AccessRuleCIDR:
+		networks, err := ParseNetworks(rule.Value)
+		if err != nil {
+			return nil, err
+		}
+		cr.networks = networks
+	case models.AccessRuleCountry:
+		cr.countries = make(map[string]bool, len(values))
+		for _, v := range values {
+			if len(v) != 2 {
+				return nil, fmt.Errorf("国家代码应为两位 ISO 代码: %s", v)
+			}
+			cr.countries[strings.ToUpper(v)] = true
+		}
+	case models.AccessRuleASN:
+		cr.asns = make(map[uint]bool, len(values))
+		for _, v := range values {
+			n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(v), "AS"), 10, 32)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("无效的 ASN: %s", v)
+			}
+			cr.asns[uint(n)] = true
+		}
+	default:
+		return nil, fmt.Errorf("无效的规则类型: %s", rule.Type)
+	}
+	return cr, nil
+}
+
+func load(db *gorm.DB) (*ruleSet, error) {
+	var rules []models.AccessRule
+	if err := db.Where("enabled = ?", true).Order("priority ASC, id ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	set := &ruleSet{byScope: make(map[string][]*compiledRule), loadedAt: time.Now()}
+	for _, r := range rules {
+		cr, err := compile(r)
+		if err != nil {
+			// 无效规则在保存时已被拒绝，这里跳过被手工改坏的数据
+			continue
+		}
+		set.byScope[r.Scope] = append(set.byScope[r.Scope], cr)
+	}
+
+	var bypass models.SystemConfig
+	if db.Where("category = ? AND key = ?", "security", "access_bypass_ips").First(&bypass).Error == nil {
+		value := bypass.Value
+		var list []string
+		if strings.HasPrefix(strings.TrimSpace(value), "[") && json.Unmarshal([]byte(value), &list) == nil {
+			value = strings.Join(list, ",")
+		}
+		set.bypass, _ = ParseNetworks(value)
+	}
+	return set, nil
+}
+
+func rules(db *gorm.DB) (*ruleSet, error) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if cached != nil && time.Since(cached.loadedAt) < cacheTTL {
+		return cached, nil
+	}
+	set, err := load(db)
+	if err != nil {
+		if cached != nil {
+			return cached, nil
+		}
+		return nil, err
+	}
+	cached = set
+	return set, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate 按作用范围判定访问。先匹配 all 范围的规则，再匹配指定范围的规则；
+// 来源 IP 在管理员放行名单中时跳过所有规则
+func Evaluate(db *gorm.DB, scope, ipAddress string) (Decision, error) {
+	set, err := rules(db)
+	if err != nil {
+		return Decision{Allowed: true}, err
+	}
+	return set.evaluate(scope, ipAddress), nil
+}
+
+func (s *ruleSet) evaluate(scope, ipAddress string) Decision {
+	ipAddress = strings.TrimPrefix(ipAddress, "::ffff:")
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return Decision{Allowed: true}
+	}
+	if containsIP(s.bypass, ip) {
+		return Decision{Allowed: true, Bypass: true}
+	}
+
+	d := Decision{Allowed: true}
+	var countryLoaded, asnLoaded bool
+	candidates := append(append([]*compiledRule{}, s.byScope[models.AccessScopeAll]...), s.byScope[scope]...)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].rule.Priority < candidates[j].rule.Priority
+	})
+
+	for _, cr := range candidates {
+		matched := cr.any
+		switch {
+		case matched:
+		case cr.networks != nil:
+			matched = containsIP(cr.networks, ip)
+		case cr.countries != nil:
+			if !countryLoaded {
+				d.Country, countryLoaded = lookupCountry(ipAddress), true
+			}
+			matched = d.Country != "" && cr.countries[d.Country]
+		case cr.asns != nil:
+			if !asnLoaded {
+				d.ASN, asnLoaded = lookupASN(ipAddress), true
+			}
+			matched = d.ASN != 0 && cr.asns[d.ASN]
+		}
+		if matched {
+			rule := cr.rule
+			d.Rule = &rule
+			d.Allowed = rule.Action == "allow"
+			return d
+		}
+	}
+	return d
+}
@@ -0,0 +1,137 @@
+package ipaccess
+
+import (
+	"testing"
+
+	"cboard-go/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func stubLookups(t *testing.T, countries map[string]string, asns map[string]uint) {
+	oldCountry, oldASN := lookupCountry, lookupASN
+	lookupCountry = func(ip string) string { return countries[ip] }
+	lookupASN = func(ip string) uint { return asns[ip] }
+	t.Cleanup(func() { lookupCountry, lookupASN = oldCountry, oldASN })
+}
+
+func setupDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.AccessRule{}, &models.SystemConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	Invalidate()
+	t.Cleanup(Invalidate)
+	return db
+}
+
+func TestValidate(t *testing.T) {
+	valid := []models.AccessRule{
+		{Scope: "all", Action: "deny", Type: "cidr", Value: "10.0.0.0/8, 192.168.1.1, 2001:db8::/32"},
+		{Scope: "admin", Action: "allow", Type: "country", Value: "cn,HK"},
+		{Scope: "auth", Action: "deny", Type: "asn", Value: "AS13335 15169"},
+		{Scope: "subscribe", Action: "deny", Type: "country", Value: "*"},
+	}
+	for _, r := range valid {
+		if err := Validate(r); err != nil {
+			t.Errorf("Validate(%+v) = %v", r, err)
+		}
+	}
+	invalid := []models.AccessRule{
+		{Scope: "public", Action: "deny", Type: "cidr", Value: "10.0.0.0/8"},
+		{Scope: "all", Action: "block", Type: "cidr", Value: "10.0.0.0/8"},
+		{Scope: "all", Action: "deny", Type: "city", Value: "Beijing"},
+		{Scope: "all", Action: "deny", Type: "cidr", Value: "10.0.0.0/33"},
+		{Scope: "all", Action: "deny", Type: "country", Value: "CHN"},
+		{Scope: "all", Action: "deny", Type: "asn", Value: "ASX"},
+		{Scope: "all", Action: "deny", Type: "cidr", Value: " , "},
+	}
+	for _, r := range invalid {
+		if err := Validate(r); err == nil {
+			t.Errorf("Validate(%+v) should fail", r)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	stubLookups(t,
+		map[string]string{"1.1.1.1": "US", "2.2.2.2": "CN", "3.3.3.3": "CN"},
+		map[string]uint{"3.3.3.3": 64500})
+	db := setupDB(t)
+
+	rules := []models.AccessRule{
+		// admin：只允许内网和 CN，其余拒绝
+		{Scope: "admin", Action: "allow", Type: "cidr", Value: "10.0.0.0/8", Priority: 10, Enabled: true},
+		{Scope: "admin", Action: "allow", Type: "country", Value: "CN", Priority: 20, Enabled: true},
+		{Scope: "admin", Action: "deny", Type: "cidr", Value: "*", Priority: 100, Enabled: true},
+		// all：拒绝某个 ASN，优先级高于 admin 的国家放行
+		{Scope: "all", Action: "deny", Type: "asn", Value: "AS64500", Priority: 15, Enabled: true},
+		// 停用的规则不生效
+		{Scope: "all", Action: "deny", Type: "country", Value: "US", Priority: 1, Enabled: true},
+	}
+	for i := range rules {
+		if err := db.Create(&rules[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Model(&rules[4]).Update("enabled", false)
+
+	cases := []struct {
+		scope, ip string
+		allowed   bool
+		ruleID    uint
+	}{
+		{"admin", "10.1.2.3", true, rules[0].ID},
+		{"admin", "2.2.2.2", true, rules[1].ID},
+		{"admin", "3.3.3.3", false, rules[3].ID},
+		{"admin", "1.1.1.1", false, rules[2].ID},
+		{"user", "1.1.1.1", true, 0},
+		{"user", "3.3.3.3", false, rules[3].ID},
+		{"admin", "not-an-ip", true, 0},
+	}
+	for _, tc := range cases {
+		d, err := Evaluate(db, tc.scope, tc.ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ruleID uint
+		if d.Rule != nil {
+			ruleID = d.Rule.ID
+		}
+		if d.Allowed != tc.allowed || ruleID != tc.ruleID {
+			t.Errorf("Evaluate(%s, %s) = allowed %v rule %d, want %v rule %d", tc.scope, tc.ip, d.Allowed, ruleID, tc.allowed, tc.ruleID)
+		}
+	}
+}
+
+func TestBypass(t *testing.T) {
+	stubLookups(t, nil, nil)
+	db := setupDB(t)
+	db.Create(&models.AccessRule{Scope: "all", Action: "deny", Type: "cidr", Value: "*", Priority: 1, Enabled: true})
+	db.Create(&models.SystemConfig{Category: "security", Key: "access_bypass_ips", Value: `["203.0.113.0/24","2001:db8::1"]`})
+
+	if d, _ := Evaluate(db, "admin", "203.0.113.7"); !d.Allowed || !d.Bypass {
+		t.Errorf("bypass network should skip rules: %+v", d)
+	}
+	if d, _ := Evaluate(db, "admin", "2001:db8::1"); !d.Allowed || !d.Bypass {
+		t.Errorf("bypass ipv6 should skip rules: %+v", d)
+	}
+	if d, _ := Evaluate(db, "admin", "198.51.100.1"); d.Allowed {
+		t.Errorf("non-bypass address should be denied: %+v", d)
+	}
+
+	// 缓存期内修改规则需要 Invalidate 才能立即生效
+	db.Where("1 = 1").Delete(&models.AccessRule{})
+	if d, _ := Evaluate(db, "admin", "198.51.100.1"); d.Allowed {
+		t.Error("rules should be cached until invalidated")
+	}
+	Invalidate()
+	if d, _ := Evaluate(db, "admin", "198.51.100.1"); !d.Allowed {
+		t.Error("deleted rule still applied after Invalidate")
+	}
+}
@@ -0,0 +1,283 @@
+package loginrisk
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/geoip"
+	"cboard-go/internal/services/session"
+
+	"gorm.io/gorm"
+)
+
+// 风险信号
+const (
+	SignalNewCountry       = "new_country"
+	SignalNewCity          = "new_city"
+	SignalNewDevice        = "new_device"
+	SignalImpossibleTravel = "impossible_travel"
+)
+
+var signalScores = map[string]int{
+	SignalNewCountry:       40,
+	SignalNewCity:          15,
+	SignalNewDevice:        25,
+	SignalImpossibleTravel: 60,
+}
+
+const (
+	historyWindow = 90 * 24 * time.Hour
+	historyLimit  = 50
+	// minTravelKm GeoIP 城市级定位误差较大，距离小于该值时不判断异地跳跃
+	minTravelKm = 500
+)
+
+// 地理位置查询，测试时可替换
+var lookupLocation = func(ip string) *geoip.LocationInfo {
+	loc, err := geoip.GetLocation(ip)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
+// Settings security 分类下的登录风险配置
+type Settings struct {
+	Enabled     bool
+	AlertScore  int     // 达到该分数时发送"是否本人登录"邮件
+	StepUp      bool    // 是否对高风险登录要求邮箱验证码
+	StepUpScore int     // 达到该分数时要求邮箱验证码
+	MaxSpeedKmh float64 // 两次登录之间超过该移动速度视为异地跳跃
+}
+
+func DefaultSettings() Settings {
+	return Settings{Enabled: true, AlertScore: 40, StepUp: false, StepUpScore: 70, MaxSpeedKmh: 1000}
+}
+
+// LoadSettings 读取登录风险配置，未配置的项使用默认值
+func LoadSettings(db *gorm.DB) Settings {
+	s := DefaultSettings()
+	var configs []models.SystemConfig
+	db.Where("category = ? AND key IN ?", "security",
+		[]string{"login_risk_enabled", "login_risk_alert_score", "login_risk_step_up", "login_risk_step_up_score", "login_risk_max_speed"}).
+		Find(&configs)
+	for _, c := range configs {
+		value := strings.TrimSpace(c.Value)
+		switch c.Key {
+		case "login_risk_enabled":
+			s.Enabled = value != "false"
+		case "login_risk_step_up":
+			s.StepUp = value == "true"
+		case "login_risk_alert_score":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				s.AlertScore = n
+			}
+		case "login_risk_step_up_score":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				s.StepUpScore = n
+			}
+		case "login_risk_max_speed":
+			if n, err := strconv.ParseFloat(value, 64); err == nil && n > 0 {
+				s.MaxSpeedKmh = n
+			}
+		}
+	}
+	return s
+}
+
+// Assessment 一次登录的风险评估结果
+type Assessment struct {
+	Score       int                 `json:"score"`
+	Signals     []string            `json:"signals"`
+	Location    *geoip.LocationInfo `json:"location,omitempty"`
+	Fingerprint string              `json:"fingerprint"`
+	DeviceName  string              `json:"device_name"`
+	SpeedKmh    float64             `json:"speed_kmh,omitempty"`
+}
+
+func (a *Assessment) add(signal string) {
+	a.Signals = append(a.Signals, signal)
+	a.Score += signalScores[signal]
+}
+
+// Has 是否包含指定信号
+func (a *Assessment) Has(signal string) bool {
+	for _, s := range a.Signals {
+		if s == signal {
+			return true
+		}
+	}
+	return false
+}
+
+// Reasons 信号的中文说明，用于邮件与日志
+func (a *Assessment) Reasons() []string {
+	reasons := make([]string, 0, len(a.Signals))
+	for _, s := range a.Signals {
+		switch s {
+		case SignalNewCountry:
+			reasons = append(reasons, "首次在该国家或地区登录")
+		case SignalNewCity:
+			reasons = append(reasons, "首次在该城市登录")
+		case SignalNewDevice:
+			reasons = append(reasons, "首次使用该设备登录")
+		case SignalImpossibleTravel:
+			reasons = append(reasons, fmt.Sprintf("与上次登录地点相距过远（约 %.0f km/h）", a.SpeedKmh))
+		}
+	}
+	return reasons
+}
+
+// LocationString 登录地点，如 "日本, 东京"
+func (a *Assessment) LocationString() string {
+	if a.Location == nil {
+		return ""
+	}
+	if a.Location.City != "" {
+		return a.Location.Country + ", " + a.Location.City
+	}
+	return a.Location.Country
+}
+
+// ShouldAlert 是否需要发送登录提醒
+func (s Settings) ShouldAlert(a *Assessment) bool {
+	return s.Enabled && a.Score > 0 && a.Score >= s.AlertScore
+}
+
+// RequireStepUp 是否需要邮箱验证码二次验证
+func (s Settings) RequireStepUp(a *Assessment) bool {
+	return s.Enabled && s.StepUp && a.Score > 0 && a.Score >= s.StepUpScore
+}
+
+// Fingerprint 由 UA 归纳出的设备指纹（浏览器 + 系统），浏览器小版本升级不会改变指纹
+func Fingerprint(userAgent string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(session.DeviceName(userAgent))))
+	return hex.EncodeToString(sum[:16])
+}
+
+// parseLocation 解析登录历史中的位置，兼容 JSON 与 "国家, 城市" 两种格式
+func parseLocation(v sql.NullString) *geoip.LocationInfo {
+	if !v.Valid || v.String == "" {
+		return nil
+	}
+	var loc geoip.LocationInfo
+	if strings.HasPrefix(v.String, "{") {
+		if json.Unmarshal([]byte(v.String), &loc) != nil {
+			return nil
+		}
+	} else {
+		parts := strings.SplitN(v.String, ",", 2)
+		loc.Country = strings.TrimSpace(parts[0])
+		if len(parts) == 2 {
+			loc.City = strings.TrimSpace(parts[1])
+		}
+	}
+	if loc.Country == "" && loc.CountryCode == "" {
+		return nil
+	}
+	return &loc
+}
+
+func countryKeys(loc *geoip.LocationInfo) []string {
+	var keys []string
+	if loc.CountryCode != "" {
+		keys = append(keys, strings.ToUpper(loc.CountryCode))
+	}
+	if loc.Country != "" {
+		keys = append(keys, loc.Country)
+	}
+	return keys
+}
+
+func hasCoordinates(loc *geoip.LocationInfo) bool {
+	return loc != nil && (loc.Latitude != 0 || loc.Longitude != 0)
+}
+
+// distanceKm 两点间的大圆距离
+func distanceKm(a, b *geoip.LocationInfo) float64 {
+	const earthRadius = 6371.0
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Assess 将本次登录与用户近期的成功登录记录比较。没有历史记录（首次登录）时不产生信号；
+// 历史记录缺少位置或设备指纹时跳过对应的判断
+func Assess(db *gorm.DB, settings Settings, userID uint, ip, userAgent string, now time.Time) *Assessment {
+	a := &Assessment{
+		Signals:     []string{},
+		Fingerprint: Fingerprint(userAgent),
+		DeviceName:  session.DeviceName(userAgent),
+		Location:    lookupLocation(ip),
+	}
+
+	var history []models.LoginHistory
+	db.Where("user_id = ? AND login_status = ? AND login_time > ?", userID, "success", now.Add(-historyWindow)).
+		Order("login_time DESC").Limit(historyLimit).Find(&history)
+	if len(history) == 0 {
+		return a
+	}
+
+	countries := make(map[string]bool)
+	cities := make(map[string]bool)
+	fingerprints := make(map[string]bool)
+	var last *geoip.LocationInfo
+	var lastTime time.Time
+	for _, h := range history {
+		if h.DeviceFingerprint.Valid && h.DeviceFingerprint.String != "" {
+			fingerprints[h.DeviceFingerprint.String] = true
+		}
+		loc := parseLocation(h.Location)
+		if loc == nil {
+			continue
+		}
+		for _, k := range countryKeys(loc) {
+			countries[k] = true
+			if loc.City != "" {
+				cities[k+"/"+strings.ToLower(loc.City)] = true
+			}
+		}
+		if last == nil && hasCoordinates(loc) {
+			last, lastTime = loc, h.LoginTime
+		}
+	}
+
+	if len(fingerprints) > 0 && !fingerprints[a.Fingerprint] {
+		a.add(SignalNewDevice)
+	}
+
+	if a.Location == nil || len(countries) == 0 {
+		return a
+	}
+	knownCountry, knownCity := false, false
+	for _, k := range countryKeys(a.Location) {
+		knownCountry = knownCountry || countries[k]
+		knownCity = knownCity || cities[k+"/"+strings.ToLower(a.Location.City)]
+	}
+	if !knownCountry {
+		a.add(SignalNewCountry)
+	} else if a.Location.City != "" && len(cities) > 0 && !knownCity {
+		a.add(SignalNewCity)
+	}
+
+	if hasCoordinates(a.Location) && last != nil {
+		if dist := distanceKm(last, a.Location); dist > minTravelKm {
+			hours := math.Max(now.Sub(lastTime).Hours(), 1.0/60)
+			a.SpeedKmh = dist / hours
+			if a.SpeedKmh > settings.MaxSpeedKmh {
+				a.add(SignalImpossibleTravel)
+			}
+		}
+	}
+	return a
+}
@@ -0,0 +1,126 @@
+package loginrisk
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/geoip"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	chromeWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	safariIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+)
+
+var locations = map[string]*geoip.LocationInfo{
+	"1.1.1.1": {Country: "中国", CountryCode: "CN", City: "上海", Latitude: 31.23, Longitude: 121.47},
+	"2.2.2.2": {Country: "中国", CountryCode: "CN", City: "北京", Latitude: 39.90, Longitude: 116.40},
+	"3.3.3.3": {Country: "美国", CountryCode: "US", City: "纽约", Latitude: 40.71, Longitude: -74.01},
+}
+
+func setupDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.LoginHistory{}, &models.SystemConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	orig := lookupLocation
+	lookupLocation = func(ip string) *geoip.LocationInfo { return locations[ip] }
+	t.Cleanup(func() { lookupLocation = orig })
+	return db
+}
+
+func addHistory(t *testing.T, db *gorm.DB, ip, location, ua string, at time.Time) {
+	h := models.LoginHistory{
+		UserID:            1,
+		LoginTime:         at,
+		IPAddress:         sql.NullString{String: ip, Valid: true},
+		Location:          sql.NullString{String: location, Valid: location != ""},
+		DeviceFingerprint: sql.NullString{String: Fingerprint(ua), Valid: true},
+		LoginStatus:       "success",
+	}
+	if err := db.Create(&h).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAssessFirstLogin(t *testing.T) {
+	db := setupDB(t)
+	a := Assess(db, DefaultSettings(), 1, "3.3.3.3", safariIPhone, time.Now())
+	if a.Score != 0 || len(a.Signals) != 0 {
+		t.Fatalf("first login should have no signals: %+v", a)
+	}
+}
+
+func TestAssessSignals(t *testing.T) {
+	db := setupDB(t)
+	now := time.Now()
+	addHistory(t, db, "1.1.1.1", `{"country":"中国","country_code":"CN","city":"上海","latitude":31.23,"longitude":121.47}`, chromeWindows, now.Add(-48*time.Hour))
+
+	// 同一设备、同一城市
+	if a := Assess(db, DefaultSettings(), 1, "1.1.1.1", chromeWindows, now); len(a.Signals) != 0 {
+		t.Fatalf("known login flagged: %v", a.Signals)
+	}
+
+	// 新城市 + 新设备，但距离上次登录时间足够长
+	a := Assess(db, DefaultSettings(), 1, "2.2.2.2", safariIPhone, now)
+	if !a.Has(SignalNewCity) || !a.Has(SignalNewDevice) || a.Has(SignalNewCountry) || a.Has(SignalImpossibleTravel) {
+		t.Fatalf("new city/device: %v", a.Signals)
+	}
+	if a.Score != 40 {
+		t.Fatalf("score = %d", a.Score)
+	}
+
+	// 一小时前在上海，现在在纽约
+	addHistory(t, db, "1.1.1.1", `{"country":"中国","country_code":"CN","city":"上海","latitude":31.23,"longitude":121.47}`, chromeWindows, now.Add(-time.Hour))
+	a = Assess(db, DefaultSettings(), 1, "3.3.3.3", chromeWindows, now)
+	if !a.Has(SignalNewCountry) || a.Has(SignalNewCity) || a.Has(SignalNewDevice) {
+		t.Fatalf("new country: %v", a.Signals)
+	}
+	if !a.Has(SignalImpossibleTravel) || a.SpeedKmh < 10000 {
+		t.Fatalf("impossible travel not detected: %+v", a)
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	loc := parseLocation(sql.NullString{String: "日本, 东京", Valid: true})
+	if loc == nil || loc.Country != "日本" || loc.City != "东京" {
+		t.Fatalf("plain: %+v", loc)
+	}
+	loc = parseLocation(sql.NullString{String: `{"country":"日本","country_code":"JP"}`, Valid: true})
+	if loc == nil || loc.CountryCode != "JP" || loc.City != "" {
+		t.Fatalf("json: %+v", loc)
+	}
+	if parseLocation(sql.NullString{String: "{broken", Valid: true}) != nil || parseLocation(sql.NullString{}) != nil {
+		t.Fatal("invalid location should be nil")
+	}
+}
+
+func TestSettingsThresholds(t *testing.T) {
+	db := setupDB(t)
+	db.Create(&models.SystemConfig{Category: "security", Key: "login_risk_step_up", Value: "true"})
+	db.Create(&models.SystemConfig{Category: "security", Key: "login_risk_step_up_score", Value: "60"})
+	s := LoadSettings(db)
+	if !s.StepUp || s.StepUpScore != 60 || s.AlertScore != 40 {
+		t.Fatalf("settings: %+v", s)
+	}
+
+	low := &Assessment{Score: 25}
+	mid := &Assessment{Score: 40}
+	high := &Assessment{Score: 65}
+	if s.ShouldAlert(low) || !s.ShouldAlert(mid) || s.RequireStepUp(mid) || !s.RequireStepUp(high) {
+		t.Fatal("thresholds not applied")
+	}
+	s.Enabled = false
+	if s.ShouldAlert(high) || s.RequireStepUp(high) {
+		t.Fatal("disabled settings should not alert")
+	}
+}
@@ -0,0 +1,56 @@
+package node_server
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"cboard-go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	FormatXray    = "xray"
+	FormatSingBox = "singbox"
+)
+
+// BuildServerConfig 根据节点记录和用户列表生成服务端配置
+func BuildServerConfig(node *models.CustomNode, users []NodeUser, keys *RealityKeys, format string) (map[string]interface{}, error) {
+	proxy, err := LoadProxyNode(node)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := ParseServerOptions(node.ServerOpts)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := buildInboundSpec(node, proxy, opts, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatXray, "":
+		return buildXrayConfig(spec, users)
+	case FormatSingBox, "sing-box":
+		return buildSingBoxConfig(spec, users)
+	}
+	return nil, fmt.Errorf("不支持的配置格式: %s", format)
+}
+
+// GenerateServerConfig 生成节点的完整服务端配置 JSON（包含当前所有有效用户）
+func GenerateServerConfig(db *gorm.DB, node *models.CustomNode, format string) ([]byte, error) {
+	users, err := ListNodeUsers(db, node)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := LoadRealityKeys(db, node.ID)
+	if err != nil {
+		return nil, err
+	}
+	config, err := BuildServerConfig(node, users, keys, format)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(config, "", "  ")
+}
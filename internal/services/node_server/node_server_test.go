@@ -0,0 +1,203 @@
+package node_server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/config_update"
+)
+
+func newTestNode(t *testing.T, link, serverOpts string) *models.CustomNode {
+	t.Helper()
+	proxy, err := config_update.ParseNodeLink(link)
+	if err != nil {
+		t.Fatalf("解析链接失败: %v", err)
+	}
+	configJSON, _ := json.Marshal(proxy)
+	return &models.CustomNode{ID: 7, Protocol: proxy.Type, Port: proxy.Port, Config: string(configJSON), ServerOpts: serverOpts}
+}
+
+func firstInbound(t *testing.T, config map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	data, _ := json.Marshal(config)
+	var decoded struct {
+		Inbounds []map[string]interface{} `json:"inbounds"`
+	}
+	json.Unmarshal(data, &decoded)
+	if len(decoded.Inbounds) != 1 {
+		t.Fatalf("应生成 1 个入站，实际为 %d", len(decoded.Inbounds))
+	}
+	return decoded.Inbounds[0]
+}
+
+var testUsers = []NodeUser{
+	{UserID: 1, UUID: "11111111-1111-1111-1111-111111111111", Password: "p1"},
+	{UserID: 2, UUID: "22222222-2222-2222-2222-222222222222", Password: "p2"},
+}
+
+func TestBuildServerConfigVLESSReality(t *testing.T) {
+	node := newTestNode(t,
+		"vless://00000000-0000-0000-0000-000000000000@example.com:443?security=reality&sni=www.microsoft.com&pbk=PUBKEY&sid=abcd&flow=xtls-rprx-vision&type=tcp#test",
+		"")
+	keys := &RealityKeys{Active: &RealityKeyPair{PrivateKey: "PRIVKEY"}}
+	if _, err := BuildServerConfig(node, testUsers, nil, FormatXray); err == nil {
+		t.Error("缺少 Reality 私钥时应返回错误")
+	}
+
+	xray, err := BuildServerConfig(node, testUsers, keys, FormatXray)
+	if err != nil {
+		t.Fatalf("生成 Xray 配置失败: %v", err)
+	}
+	inbound := firstInbound(t, xray)
+	if inbound["protocol"] != "vless" || inbound["port"] != float64(443) || inbound["tag"] != "cboard-7" {
+		t.Errorf("Xray 入站基本信息不正确: %v", inbound)
+	}
+	clients := inbound["settings"].(map[string]interface{})["clients"].([]interface{})
+	if len(clients) != 2 {
+		t.Fatalf("应包含 2 个用户，实际为 %d", len(clients))
+	}
+	first := clients[0].(map[string]interface{})
+	if first["id"] != testUsers[0].UUID || first["flow"] != "xtls-rprx-vision" || first["email"] != "user-1" {
+		t.Errorf("Xray 用户信息不正确: %v", first)
+	}
+	reality := inbound["streamSettings"].(map[string]interface{})["realitySettings"].(map[string]interface{})
+	if reality["privateKey"] != "PRIVKEY" || reality["dest"] != "www.microsoft.com:443" {
+		t.Errorf("Reality 配置不正确: %v", reality)
+	}
+	if ids := reality["shortIds"].([]interface{}); len(ids) != 1 || ids[0] != "abcd" {
+		t.Errorf("Reality short ID 不正确: %v", ids)
+	}
+
+	singbox, err := BuildServerConfig(node, testUsers, keys, FormatSingBox)
+	if err != nil {
+		t.Fatalf("生成 sing-box 配置失败: %v", err)
+	}
+	inbound = firstInbound(t, singbox)
+	tls := inbound["tls"].(map[string]interface{})
+	realitySB := tls["reality"].(map[string]interface{})
+	handshake := realitySB["handshake"].(map[string]interface{})
+	if realitySB["private_key"] != "PRIVKEY" || handshake["server"] != "www.microsoft.com" || handshake["server_port"] != float64(443) {
+		t.Errorf("sing-box Reality 配置不正确: %v", realitySB)
+	}
+	if users := inbound["users"].([]interface{}); len(users) != 2 {
+		t.Errorf("sing-box 应包含 2 个用户，实际为 %d", len(users))
+	}
+}
+
+func TestBuildServerConfigTLSRequiresCertificate(t *testing.T) {
+	link := "trojan://pass@example.com:8443?sni=example.com&type=ws&path=%2Fws#t"
+	node := newTestNode(t, link, "")
+	if _, err := BuildServerConfig(node, testUsers, nil, FormatXray); err == nil {
+		t.Error("缺少证书路径时应返回错误")
+	}
+
+	node = newTestNode(t, link, `{"cert_path":"/etc/ssl/cert.pem","key_path":"/etc/ssl/key.pem","listen_port":10443}`)
+	xray, err := BuildServerConfig(node, testUsers, nil, FormatXray)
+	if err != nil {
+		t.Fatalf("生成 Xray 配置失败: %v", err)
+	}
+	inbound := firstInbound(t, xray)
+	stream := inbound["streamSettings"].(map[string]interface{})
+	if inbound["port"] != float64(10443) || stream["network"] != "ws" || stream["security"] != "tls" {
+		t.Errorf("Trojan 入站配置不正确: %v", inbound)
+	}
+	if stream["wsSettings"].(map[string]interface{})["path"] != "/ws" {
+		t.Errorf("WebSocket 路径不正确: %v", stream["wsSettings"])
+	}
+}
+
+func TestBuildServerConfigShadowsocks2022(t *testing.T) {
+	serverKey := "AAAAAAAAAAAAAAAAAAAAAA=="
+	node := &models.CustomNode{ID: 3, Port: 8388}
+	configJSON, _ := json.Marshal(config_update.ProxyNode{Type: "ss", Server: "example.com", Port: 8388, Cipher: "2022-blake3-aes-128-gcm", Password: serverKey})
+	node.Config = string(configJSON)
+
+	users := []NodeUser{{UserID: 9, Password: "p9", SSKey: config_update.SSUserKey("2022-blake3-aes-128-gcm", "p9")}}
+	singbox, err := BuildServerConfig(node, users, nil, FormatSingBox)
+	if err != nil {
+		t.Fatalf("生成 sing-box 配置失败: %v", err)
+	}
+	inbound := firstInbound(t, singbox)
+	if inbound["password"] != serverKey || inbound["method"] != "2022-blake3-aes-128-gcm" {
+		t.Errorf("SS2022 服务端密钥不正确: %v", inbound)
+	}
+	user := inbound["users"].([]interface{})[0].(map[string]interface{})
+	if user["password"] != users[0].SSKey {
+		t.Errorf("SS2022 用户密钥不正确: %v", user)
+	}
+
+	configJSON, _ = json.Marshal(config_update.ProxyNode{Type: "ss", Server: "example.com", Port: 8388, Cipher: "aes-128-gcm", Password: "x"})
+	node.Config = string(configJSON)
+	if _, err := BuildServerConfig(node, users, nil, FormatSingBox); err == nil {
+		t.Error("sing-box 非 2022 加密方式多用户应返回错误")
+	}
+	if _, err := BuildServerConfig(node, users, nil, FormatXray); err != nil {
+		t.Errorf("Xray 应支持传统加密方式多用户: %v", err)
+	}
+}
+
+func TestBuildServerConfigUnsupportedFormat(t *testing.T) {
+	node := newTestNode(t, "vmess://eyJ2IjoiMiIsInBzIjoidCIsImFkZCI6ImV4YW1wbGUuY29tIiwicG9ydCI6IjgwIiwiaWQiOiIxMTExMTExMS0xMTExLTExMTEtMTExMS0xMTExMTExMTExMTEiLCJhaWQiOiIwIiwibmV0IjoidGNwIn0=", "")
+	if _, err := BuildServerConfig(node, testUsers, nil, "clash"); err == nil {
+		t.Error("不支持的格式应返回错误")
+	}
+}
+
+func TestGenerateRealityKeyPair(t *testing.T) {
+	pair, err := GenerateRealityKeyPair()
+	if err != nil {
+		t.Fatalf("生成密钥对失败: %v", err)
+	}
+	if len(pair.PrivateKey) != 43 || len(pair.PublicKey) != 43 {
+		t.Errorf("密钥长度应为 43，实际为 %d/%d", len(pair.PrivateKey), len(pair.PublicKey))
+	}
+	pub, err := RealityPublicKey(pair.PrivateKey)
+	if err != nil || pub != pair.PublicKey {
+		t.Errorf("由私钥推导的公钥不一致: %s != %s (%v)", pub, pair.PublicKey, err)
+	}
+
+	ids, err := GenerateShortIDs(3)
+	if err != nil || len(ids) != 3 || len(ids[0]) != 16 || ids[0] == ids[1] {
+		t.Errorf("short ID 生成不正确: %v (%v)", ids, err)
+	}
+}
+
+func TestBuildServerConfigRealityGrace(t *testing.T) {
+	node := newTestNode(t,
+		"vless://00000000-0000-0000-0000-000000000000@example.com:443?security=reality&sni=www.microsoft.com&pbk=NEWPUB&sid=aa&type=tcp#test", "")
+	keys := &RealityKeys{
+		Active: &RealityKeyPair{PrivateKey: "NEWPRIV", ShortIDs: []string{"aa"}},
+		Grace:  &RealityKeyPair{PrivateKey: "OLDPRIV", ShortIDs: []string{"bb"}},
+	}
+
+	for _, format := range []string{FormatXray, FormatSingBox} {
+		config, err := BuildServerConfig(node, testUsers, keys, format)
+		if err != nil {
+			t.Fatalf("生成 %s 配置失败: %v", format, err)
+		}
+		data, _ := json.Marshal(config)
+		var decoded struct {
+			Inbounds []map[string]interface{} `json:"inbounds"`
+		}
+		json.Unmarshal(data, &decoded)
+		if len(decoded.Inbounds) != 2 {
+			t.Fatalf("%s 宽限期内应生成 2 个入站，实际为 %d", format, len(decoded.Inbounds))
+		}
+		grace := decoded.Inbounds[1]
+		if grace["listen"] != "127.0.0.1" || grace["tag"] != "cboard-7-grace" {
+			t.Errorf("%s 宽限期入站不正确: %v", format, grace)
+		}
+	}
+
+	xray, _ := BuildServerConfig(node, testUsers, keys, FormatXray)
+	inbounds := xray["inbounds"].([]interface{})
+	primary := inbounds[0].(map[string]interface{})["streamSettings"].(map[string]interface{})["realitySettings"].(map[string]interface{})
+	old := inbounds[1].(map[string]interface{})["streamSettings"].(map[string]interface{})["realitySettings"].(map[string]interface{})
+	if primary["privateKey"] != "NEWPRIV" || primary["dest"] != "127.0.0.1:10443" {
+		t.Errorf("新密钥入站应回落到宽限期入站: %v", primary)
+	}
+	if old["privateKey"] != "OLDPRIV" || old["dest"] != "www.microsoft.com:443" {
+		t.Errorf("宽限期入站应使用旧密钥并回落到真实目标: %v", old)
+	}
+}
@@ -0,0 +1,211 @@
+package node_server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/config_update"
+)
+
+// ServerOptions 自建节点服务端配置（存储于 CustomNode.ServerOpts）
+type ServerOptions struct {
+	Listen             string   `json:"listen,omitempty"`
+	ListenPort         int      `json:"listen_port,omitempty"`
+	CertPath           string   `json:"cert_path,omitempty"`
+	KeyPath            string   `json:"key_path,omitempty"`
+	RealityDest        string   `json:"reality_dest,omitempty"`
+	RealityServerNames []string `json:"reality_server_names,omitempty"`
+	RealityShortIDs    []string `json:"reality_short_ids,omitempty"`
+	RealityGracePort   int      `json:"reality_grace_port,omitempty"` // 密钥轮换宽限期内旧密钥入站的本地端口
+}
+
+func ParseServerOptions(raw string) (*ServerOptions, error) {
+	opts := &ServerOptions{}
+	if strings.TrimSpace(raw) == "" {
+		return opts, nil
+	}
+	if err := json.Unmarshal([]byte(raw), opts); err != nil {
+		return nil, fmt.Errorf("解析服务端配置失败: %w", err)
+	}
+	return opts, nil
+}
+
+// inboundSpec 从节点记录中整理出的入站描述，供各内核生成配置
+type inboundSpec struct {
+	Tag         string
+	Protocol    string
+	Listen      string
+	Port        int
+	Network     string
+	Path        string
+	Host        string
+	ServiceName string
+	Security    string // none, tls, reality
+	SNI         string
+	ALPN        []string
+	CertPath    string
+	KeyPath     string
+	Flow        string
+	Cipher      string
+	ServerKey   string
+	Congestion  string
+
+	Reality      *realityParams
+	GraceReality *realityParams // 宽限期内的旧密钥，通过回落到本地入站继续接受旧客户端
+	GracePort    int
+}
+
+type realityParams struct {
+	Dest        string
+	ServerNames []string
+	PrivateKey  string
+	ShortIDs    []string
+}
+
+func buildInboundSpec(node *models.CustomNode, proxy *config_update.ProxyNode, opts *ServerOptions, keys *RealityKeys) (*inboundSpec, error) {
+	spec := &inboundSpec{
+		Tag:      fmt.Sprintf("cboard-%d", node.ID),
+		Protocol: strings.ToLower(proxy.Type),
+		Listen:   opts.Listen,
+		Port:     proxy.Port,
+		Network:  proxy.Network,
+		Security: "none",
+		Cipher:   proxy.Cipher,
+	}
+	if spec.Protocol == "shadowsocks" {
+		spec.Protocol = "ss"
+	}
+	if opts.ListenPort > 0 {
+		spec.Port = opts.ListenPort
+	}
+	if spec.Port == 0 {
+		return nil, fmt.Errorf("节点端口未设置")
+	}
+	if spec.Network == "" {
+		spec.Network = "tcp"
+	}
+
+	transport := config_update.TransportOptsFromMap(proxy.Options)
+	if transport.WSOpts != nil {
+		spec.Path = transport.WSOpts.Path
+		spec.Host = transport.WSOpts.Headers["Host"]
+		if transport.WSOpts.V2rayHTTPUpgrade {
+			spec.Network = "httpupgrade"
+		}
+	}
+	if transport.H2Opts != nil {
+		spec.Path = transport.H2Opts.Path
+		if len(transport.H2Opts.Host) > 0 {
+			spec.Host = transport.H2Opts.Host[0]
+		}
+	}
+	if transport.GRPCOpts != nil {
+		spec.ServiceName = transport.GRPCOpts.GRPCServiceName
+	}
+	if flow, ok := transport.Other["flow"].(string); ok {
+		spec.Flow = flow
+	}
+	if cc, ok := transport.Other["congestion_control"].(string); ok {
+		spec.Congestion = cc
+	}
+	spec.ALPN = toStringSlice(transport.Other["alpn"])
+	spec.SNI = transport.SNI
+
+	if spec.Protocol == "ss" && strings.HasPrefix(spec.Cipher, "2022-blake3-") {
+		spec.ServerKey = proxy.Password
+		if idx := strings.Index(spec.ServerKey, ":"); idx >= 0 {
+			spec.ServerKey = spec.ServerKey[:idx]
+		}
+	}
+
+	switch {
+	case transport.RealityOpts != nil:
+		spec.Security = "reality"
+		reality := &realityParams{
+			ShortIDs:    opts.RealityShortIDs,
+			ServerNames: opts.RealityServerNames,
+			Dest:        opts.RealityDest,
+		}
+		if keys != nil && keys.Active != nil {
+			reality.PrivateKey = keys.Active.PrivateKey
+			reality.ShortIDs = keys.Active.ShortIDs
+		}
+		if reality.PrivateKey == "" {
+			return nil, fmt.Errorf("缺少 Reality 私钥")
+		}
+		if len(reality.ServerNames) == 0 && spec.SNI != "" {
+			reality.ServerNames = []string{spec.SNI}
+		}
+		if reality.Dest == "" && len(reality.ServerNames) > 0 {
+			reality.Dest = net.JoinHostPort(reality.ServerNames[0], "443")
+		}
+		if reality.Dest == "" {
+			return nil, fmt.Errorf("缺少 Reality 目标地址")
+		}
+		if len(reality.ShortIDs) == 0 {
+			reality.ShortIDs = []string{transport.RealityOpts.ShortID}
+		}
+		spec.Reality = reality
+
+		if keys != nil && keys.Active != nil && keys.Grace != nil {
+			spec.GracePort = opts.RealityGracePort
+			if spec.GracePort == 0 {
+				spec.GracePort = spec.Port + 10000
+				if spec.GracePort > 65535 {
+					spec.GracePort = spec.Port - 10000
+				}
+			}
+			spec.GraceReality = &realityParams{
+				Dest:        reality.Dest,
+				ServerNames: reality.ServerNames,
+				PrivateKey:  keys.Grace.PrivateKey,
+				ShortIDs:    keys.Grace.ShortIDs,
+			}
+			reality.Dest = net.JoinHostPort("127.0.0.1", strconv.Itoa(spec.GracePort))
+		}
+	case proxy.TLS || spec.Protocol == "hysteria2" || spec.Protocol == "tuic" || spec.Protocol == "trojan" || spec.Protocol == "anytls" || spec.Protocol == "naive":
+		spec.Security = "tls"
+		spec.CertPath = opts.CertPath
+		spec.KeyPath = opts.KeyPath
+		if spec.CertPath == "" || spec.KeyPath == "" {
+			return nil, fmt.Errorf("缺少 TLS 证书或私钥路径")
+		}
+	}
+	return spec, nil
+}
+
+func splitHostPort(dest string) (string, int) {
+	host, portStr, err := net.SplitHostPort(dest)
+	if err != nil {
+		return dest, 443
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		port = 443
+	}
+	return host, port
+}
+
+func toStringSlice(v interface{}) []string {
+	switch val := v.(type) {
+	case []string:
+		return val
+	case []interface{}:
+		result := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok && s != "" {
+				result = append(result, s)
+			}
+		}
+		return result
+	case string:
+		if val != "" {
+			return strings.Split(val, ",")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package node_server
+
+import (
+	"crypto/ecdh"
+	crand "crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+type RealityKeyPair struct {
+	PrivateKey string
+	PublicKey  string
+	ShortIDs   []string
+}
+
+// RealityKeys 节点当前生效的密钥，以及轮换宽限期内仍需接受的旧密钥
+type RealityKeys struct {
+	Active *RealityKeyPair
+	Grace  *RealityKeyPair
+}
+
+// GenerateRealityKeyPair 生成 X25519 密钥对（与 xray x25519 输出格式一致）
+func GenerateRealityKeyPair() (*RealityKeyPair, error) {
+	priv, err := ecdh.X25519().GenerateKey(crand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成密钥对失败: %w", err)
+	}
+	return &RealityKeyPair{
+		PrivateKey: base64.RawURLEncoding.EncodeToString(priv.Bytes()),
+		PublicKey:  base64.RawURLEncoding.EncodeToString(priv.PublicKey().Bytes()),
+	}, nil
+}
+
+// RealityPublicKey 由私钥推导公钥
+func RealityPublicKey(privateKey string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(privateKey, "="))
+	if err != nil {
+		return "", fmt.Errorf("私钥格式错误: %w", err)
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return "", fmt.Errorf("私钥格式错误: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(priv.PublicKey().Bytes()), nil
+}
+
+// GenerateShortIDs 生成 Reality short ID（8 字节十六进制）
+func GenerateShortIDs(count int) ([]string, error) {
+	if count <= 0 {
+		count = 1
+	}
+	ids := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		b := make([]byte, 8)
+		if _, err := crand.Read(b); err != nil {
+			return nil, fmt.Errorf("生成 short ID 失败: %w", err)
+		}
+		ids = append(ids, hex.EncodeToString(b))
+	}
+	return ids, nil
+}
+
+func decodeRealityKey(key *models.RealityKey) (*RealityKeyPair, error) {
+	priv, err := utils.DecryptAES(key.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("解密 Reality 私钥失败: %w", err)
+	}
+	pair := &RealityKeyPair{PrivateKey: priv, PublicKey: key.PublicKey}
+	if key.ShortIDs != "" {
+		json.Unmarshal([]byte(key.ShortIDs), &pair.ShortIDs)
+	}
+	return pair, nil
+}
+
+// LoadRealityKeys 读取节点的生效密钥和宽限期密钥，过期的宽限期密钥自动停用
+func LoadRealityKeys(db *gorm.DB, nodeID uint) (*RealityKeys, error) {
+	now := utils.GetBeijingTime()
+	db.Model(&models.RealityKey{}).
+		Where("custom_node_id = ? AND status = ? AND grace_until < ?", nodeID, "grace", now).
+		Update("status", "retired")
+
+	var keys []models.RealityKey
+	if err := db.Where("custom_node_id = ? AND status IN ?", nodeID, []string{"active", "grace"}).
+		Order("id DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	result := &RealityKeys{}
+	for i := range keys {
+		pair, err := decodeRealityKey(&keys[i])
+		if err != nil {
+			return nil, err
+		}
+		if keys[i].Status == "active" && result.Active == nil {
+			result.Active = pair
+		} else if keys[i].Status == "grace" && result.Grace == nil {
+			result.Grace = pair
+		}
+	}
+	return result, nil
+}
+
+// RotateRealityKeys 为节点生成（或导入 importPrivateKey）新的 Reality 密钥，旧密钥进入宽限期，并把公钥写入节点客户端配置
+func RotateRealityKeys(db *gorm.DB, node *models.CustomNode, grace time.Duration, shortIDCount int, importPrivateKey string) (*models.RealityKey, error) {
+	if strings.ToLower(node.Protocol) != "vless" {
+		return nil, fmt.Errorf("仅 VLESS 节点支持 Reality")
+	}
+	proxy, err := LoadProxyNode(node)
+	if err != nil {
+		return nil, err
+	}
+
+	var pair *RealityKeyPair
+	if importPrivateKey != "" {
+		pub, err := RealityPublicKey(importPrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		pair = &RealityKeyPair{PrivateKey: strings.TrimRight(importPrivateKey, "="), PublicKey: pub}
+	} else if pair, err = GenerateRealityKeyPair(); err != nil {
+		return nil, err
+	}
+	if pair.ShortIDs, err = GenerateShortIDs(shortIDCount); err != nil {
+		return nil, err
+	}
+	encrypted, err := utils.EncryptAES(pair.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("加密 Reality 私钥失败: %w", err)
+	}
+	shortIDs, _ := json.Marshal(pair.ShortIDs)
+
+	newKey := &models.RealityKey{
+		CustomNodeID: node.ID,
+		PrivateKey:   encrypted,
+		PublicKey:    pair.PublicKey,
+		ShortIDs:     string(shortIDs),
+		Status:       "active",
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// 之前的宽限期密钥直接停用，只保留最近一个旧密钥
+		if err := tx.Model(&models.RealityKey{}).
+			Where("custom_node_id = ? AND status = ?", node.ID, "grace").
+			Update("status", "retired").Error; err != nil {
+			return err
+		}
+		oldStatus := "retired"
+		var graceUntil *time.Time
+		if grace > 0 {
+			oldStatus = "grace"
+			t := utils.GetBeijingTime().Add(grace)
+			graceUntil = &t
+		}
+		if err := tx.Model(&models.RealityKey{}).
+			Where("custom_node_id = ? AND status = ?", node.ID, "active").
+			Updates(map[string]interface{}{"status": oldStatus, "grace_until": graceUntil}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(newKey).Error; err != nil {
+			return err
+		}
+
+		proxy.TLS = true
+		proxy.Options["reality-opts"] = map[string]interface{}{
+			"public-key": pair.PublicKey,
+			"short-id":   pair.ShortIDs[0],
+		}
+		if _, ok := proxy.Options["client-fingerprint"]; !ok {
+			proxy.Options["client-fingerprint"] = "chrome"
+		}
+		configJSON, err := json.Marshal(proxy)
+		if err != nil {
+			return err
+		}
+		node.Config = string(configJSON)
+		return tx.Model(&models.CustomNode{}).Where("id = ?", node.ID).Update("config", node.Config).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newKey, nil
+}
+
+// EndRealityGrace 立即停用节点所有宽限期密钥
+func EndRealityGrace(db *gorm.DB, nodeID uint) error {
+	return db.Model(&models.RealityKey{}).
+		Where("custom_node_id = ? AND status = ?", nodeID, "grace").
+		Update("status", "retired").Error
+}
@@ -0,0 +1,149 @@
+package node_server
+
+import (
+	"fmt"
+)
+
+func buildSingBoxConfig(spec *inboundSpec, users []NodeUser) (map[string]interface{}, error) {
+	listen := spec.Listen
+	if listen == "" {
+		listen = "::"
+	}
+	inbound, err := buildSingBoxInbound(spec, users, spec.Tag, listen, spec.Port, spec.Reality)
+	if err != nil {
+		return nil, err
+	}
+	inbounds := []interface{}{inbound}
+	if spec.GraceReality != nil {
+		graceInbound, err := buildSingBoxInbound(spec, users, spec.Tag+"-grace", "127.0.0.1", spec.GracePort, spec.GraceReality)
+		if err != nil {
+			return nil, err
+		}
+		inbounds = append(inbounds, graceInbound)
+	}
+
+	return map[string]interface{}{
+		"log":      map[string]interface{}{"level": "warn"},
+		"inbounds": inbounds,
+		"outbounds": []interface{}{
+			map[string]interface{}{"type": "direct", "tag": "direct"},
+		},
+	}, nil
+}
+
+func buildSingBoxInbound(spec *inboundSpec, users []NodeUser, tag, listen string, port int, reality *realityParams) (map[string]interface{}, error) {
+	inbound := map[string]interface{}{"tag": tag}
+	sbUsers := make([]map[string]interface{}, 0, len(users))
+
+	switch spec.Protocol {
+	case "vless":
+		inbound["type"] = "vless"
+		for _, u := range users {
+			item := map[string]interface{}{"name": u.Tag(), "uuid": u.UUID}
+			if spec.Flow != "" && spec.Network == "tcp" {
+				item["flow"] = spec.Flow
+			}
+			sbUsers = append(sbUsers, item)
+		}
+	case "vmess":
+		inbound["type"] = "vmess"
+		for _, u := range users {
+			sbUsers = append(sbUsers, map[string]interface{}{"name": u.Tag(), "uuid": u.UUID, "alterId": 0})
+		}
+	case "trojan", "hysteria2", "anytls":
+		inbound["type"] = spec.Protocol
+		for _, u := range users {
+			sbUsers = append(sbUsers, map[string]interface{}{"name": u.Tag(), "password": u.Password})
+		}
+	case "tuic":
+		inbound["type"] = "tuic"
+		for _, u := range users {
+			sbUsers = append(sbUsers, map[string]interface{}{"name": u.Tag(), "uuid": u.UUID, "password": u.Password})
+		}
+		if spec.Congestion != "" {
+			inbound["congestion_control"] = spec.Congestion
+		}
+	case "naive":
+		inbound["type"] = "naive"
+		for _, u := range users {
+			sbUsers = append(sbUsers, map[string]interface{}{"username": u.UUID, "password": u.Password})
+		}
+	case "ss":
+		if spec.ServerKey == "" {
+			return nil, fmt.Errorf("sing-box 多用户 Shadowsocks 仅支持 2022 加密方式")
+		}
+		inbound["type"] = "shadowsocks"
+		inbound["method"] = spec.Cipher
+		inbound["password"] = spec.ServerKey
+		for _, u := range users {
+			sbUsers = append(sbUsers, map[string]interface{}{"name": u.Tag(), "password": u.SSKey})
+		}
+	default:
+		return nil, fmt.Errorf("sing-box 不支持的协议: %s", spec.Protocol)
+	}
+	inbound["users"] = sbUsers
+
+	inbound["listen"] = listen
+	inbound["listen_port"] = port
+
+	switch spec.Network {
+	case "tcp", "udp", "":
+	case "ws":
+		transport := map[string]interface{}{"type": "ws", "path": defaultPath(spec.Path)}
+		if spec.Host != "" {
+			transport["headers"] = map[string]string{"Host": spec.Host}
+		}
+		inbound["transport"] = transport
+	case "httpupgrade":
+		transport := map[string]interface{}{"type": "httpupgrade", "path": defaultPath(spec.Path)}
+		if spec.Host != "" {
+			transport["host"] = spec.Host
+		}
+		inbound["transport"] = transport
+	case "grpc":
+		inbound["transport"] = map[string]interface{}{"type": "grpc", "service_name": spec.ServiceName}
+	case "h2", "http":
+		transport := map[string]interface{}{"type": "http", "path": defaultPath(spec.Path)}
+		if spec.Host != "" {
+			transport["host"] = []string{spec.Host}
+		}
+		inbound["transport"] = transport
+	default:
+		return nil, fmt.Errorf("sing-box 不支持的传输方式: %s", spec.Network)
+	}
+
+	switch spec.Security {
+	case "tls":
+		tls := map[string]interface{}{
+			"enabled":          true,
+			"certificate_path": spec.CertPath,
+			"key_path":         spec.KeyPath,
+		}
+		if spec.SNI != "" {
+			tls["server_name"] = spec.SNI
+		}
+		if len(spec.ALPN) > 0 {
+			tls["alpn"] = spec.ALPN
+		} else if spec.Protocol == "hysteria2" || spec.Protocol == "tuic" {
+			tls["alpn"] = []string{"h3"}
+		}
+		inbound["tls"] = tls
+	case "reality":
+		host, serverPort := splitHostPort(reality.Dest)
+		tls := map[string]interface{}{
+			"enabled": true,
+			"reality": map[string]interface{}{
+				"enabled":     true,
+				"handshake":   map[string]interface{}{"server": host, "server_port": serverPort},
+				"private_key": reality.PrivateKey,
+				"short_id":    reality.ShortIDs,
+			},
+		}
+		if len(reality.ServerNames) > 0 {
+			tls["server_name"] = reality.ServerNames[0]
+		}
+		inbound["tls"] = tls
+	}
+
+	return inbound, nil
+}
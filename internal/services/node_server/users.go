@@ -0,0 +1,86 @@
+package node_server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/config_update"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// NodeUser 节点上当前有效的用户及其专属凭据
+type NodeUser struct {
+	UserID   uint   `json:"user_id"`
+	Email    string `json:"email"`
+	UUID     string `json:"uuid"`
+	Password string `json:"password"`
+	SSKey    string `json:"ss_key,omitempty"`
+}
+
+// Tag 服务端配置中标识用户的名称（不暴露邮箱）
+func (u NodeUser) Tag() string {
+	return fmt.Sprintf("user-%d", u.UserID)
+}
+
+// LoadProxyNode 解析专线节点的客户端配置
+func LoadProxyNode(node *models.CustomNode) (*config_update.ProxyNode, error) {
+	if node.Config == "" {
+		return nil, fmt.Errorf("节点配置为空")
+	}
+	var proxyNode config_update.ProxyNode
+	if err := json.Unmarshal([]byte(node.Config), &proxyNode); err != nil {
+		return nil, fmt.Errorf("解析节点配置失败: %w", err)
+	}
+	if proxyNode.Options == nil {
+		proxyNode.Options = make(map[string]interface{})
+	}
+	if proxyNode.Port == 0 {
+		proxyNode.Port = node.Port
+	}
+	return &proxyNode, nil
+}
+
+// ListNodeUsers 列出专线节点当前有效（已分配、账户正常、未过期）的用户
+func ListNodeUsers(db *gorm.DB, node *models.CustomNode) ([]NodeUser, error) {
+	var cipher string
+	if proxyNode, err := LoadProxyNode(node); err == nil {
+		cipher = proxyNode.Cipher
+	}
+
+	var userNodes []models.UserCustomNode
+	if err := db.Preload("User").Where("custom_node_id = ?", node.ID).Order("id ASC").Find(&userNodes).Error; err != nil {
+		return nil, err
+	}
+
+	now := utils.GetBeijingTime()
+	users := make([]NodeUser, 0, len(userNodes))
+	for i := range userNodes {
+		un := &userNodes[i]
+		if un.User.ID == 0 || !un.User.IsActive {
+			continue
+		}
+		var sub models.Subscription
+		db.Where("user_id = ?", un.UserID).First(&sub)
+		if config_update.IsCustomNodeExpired(un.User, sub, *node, now) {
+			continue
+		}
+		if err := config_update.EnsureUserNodeCredentials(db, un); err != nil {
+			return nil, err
+		}
+		user := NodeUser{
+			UserID:   un.UserID,
+			Email:    un.User.Email,
+			UUID:     un.UUID,
+			Password: un.Password,
+		}
+		if strings.HasPrefix(cipher, "2022-blake3-") {
+			user.SSKey = config_update.SSUserKey(cipher, un.Password)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
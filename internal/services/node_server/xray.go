@@ -0,0 +1,159 @@
+package node_server
+
+import (
+	"fmt"
+	"strings"
+)
+
+func buildXrayConfig(spec *inboundSpec, users []NodeUser) (map[string]interface{}, error) {
+	listen := spec.Listen
+	if listen == "" {
+		listen = "0.0.0.0"
+	}
+	inbound, err := buildXrayInbound(spec, users, spec.Tag, listen, spec.Port, spec.Reality)
+	if err != nil {
+		return nil, err
+	}
+	inbounds := []interface{}{inbound}
+	if spec.GraceReality != nil {
+		graceInbound, err := buildXrayInbound(spec, users, spec.Tag+"-grace", "127.0.0.1", spec.GracePort, spec.GraceReality)
+		if err != nil {
+			return nil, err
+		}
+		inbounds = append(inbounds, graceInbound)
+	}
+
+	return map[string]interface{}{
+		"log":      map[string]interface{}{"loglevel": "warning"},
+		"inbounds": inbounds,
+		"outbounds": []interface{}{
+			map[string]interface{}{"protocol": "freedom", "tag": "direct"},
+			map[string]interface{}{"protocol": "blackhole", "tag": "block"},
+		},
+	}, nil
+}
+
+func buildXrayInbound(spec *inboundSpec, users []NodeUser, tag, listen string, port int, reality *realityParams) (map[string]interface{}, error) {
+	clients := make([]map[string]interface{}, 0, len(users))
+	settings := map[string]interface{}{}
+	protocol := spec.Protocol
+
+	switch spec.Protocol {
+	case "vless":
+		for _, u := range users {
+			c := map[string]interface{}{"id": u.UUID, "email": u.Tag()}
+			if spec.Flow != "" && spec.Network == "tcp" {
+				c["flow"] = spec.Flow
+			}
+			clients = append(clients, c)
+		}
+		settings["decryption"] = "none"
+	case "vmess":
+		for _, u := range users {
+			clients = append(clients, map[string]interface{}{"id": u.UUID, "email": u.Tag(), "alterId": 0})
+		}
+	case "trojan":
+		for _, u := range users {
+			clients = append(clients, map[string]interface{}{"password": u.Password, "email": u.Tag()})
+		}
+	case "ss":
+		protocol = "shadowsocks"
+		settings["network"] = "tcp,udp"
+		if spec.ServerKey != "" {
+			settings["method"] = spec.Cipher
+			settings["password"] = spec.ServerKey
+			for _, u := range users {
+				clients = append(clients, map[string]interface{}{"password": u.SSKey, "email": u.Tag()})
+			}
+		} else {
+			for _, u := range users {
+				clients = append(clients, map[string]interface{}{"method": spec.Cipher, "password": u.Password, "email": u.Tag()})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("Xray 不支持的协议: %s", spec.Protocol)
+	}
+	settings["clients"] = clients
+
+	stream := map[string]interface{}{}
+	switch spec.Network {
+	case "tcp":
+		stream["network"] = "tcp"
+	case "ws":
+		stream["network"] = "ws"
+		ws := map[string]interface{}{"path": defaultPath(spec.Path)}
+		if spec.Host != "" {
+			ws["headers"] = map[string]string{"Host": spec.Host}
+		}
+		stream["wsSettings"] = ws
+	case "httpupgrade":
+		stream["network"] = "httpupgrade"
+		hu := map[string]interface{}{"path": defaultPath(spec.Path)}
+		if spec.Host != "" {
+			hu["host"] = spec.Host
+		}
+		stream["httpupgradeSettings"] = hu
+	case "grpc":
+		stream["network"] = "grpc"
+		stream["grpcSettings"] = map[string]interface{}{"serviceName": spec.ServiceName}
+	case "h2", "http":
+		stream["network"] = "http"
+		h2 := map[string]interface{}{"path": defaultPath(spec.Path)}
+		if spec.Host != "" {
+			h2["host"] = []string{spec.Host}
+		}
+		stream["httpSettings"] = h2
+	default:
+		return nil, fmt.Errorf("Xray 不支持的传输方式: %s", spec.Network)
+	}
+
+	switch spec.Security {
+	case "tls":
+		tls := map[string]interface{}{
+			"certificates": []map[string]string{{"certificateFile": spec.CertPath, "keyFile": spec.KeyPath}},
+		}
+		if spec.SNI != "" {
+			tls["serverName"] = spec.SNI
+		}
+		if len(spec.ALPN) > 0 {
+			tls["alpn"] = spec.ALPN
+		}
+		stream["security"] = "tls"
+		stream["tlsSettings"] = tls
+	case "reality":
+		stream["security"] = "reality"
+		stream["realitySettings"] = map[string]interface{}{
+			"show":        false,
+			"dest":        reality.Dest,
+			"xver":        0,
+			"serverNames": reality.ServerNames,
+			"privateKey":  reality.PrivateKey,
+			"shortIds":    reality.ShortIDs,
+		}
+	default:
+		stream["security"] = "none"
+	}
+
+	return map[string]interface{}{
+		"tag":            tag,
+		"listen":         listen,
+		"port":           port,
+		"protocol":       protocol,
+		"settings":       settings,
+		"streamSettings": stream,
+		"sniffing": map[string]interface{}{
+			"enabled":      true,
+			"destOverride": []string{"http", "tls", "quic"},
+		},
+	}, nil
+}
+
+func defaultPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+	return path
+}
@@ -0,0 +1,158 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// 签发方公钥缓存一小时，遇到未知 kid 时重新获取（签发方轮换密钥）
+var jwksCache = struct {
+	sync.Mutex
+	m map[string]cachedJWKS
+}{m: make(map[string]cachedJWKS)}
+
+type cachedJWKS struct {
+	keys    map[string]interface{}
+	fetched time.Time
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k *jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的曲线: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("不支持的密钥类型: %s", k.Kty)
+}
+
+func fetchJWKS(ctx context.Context, jwksURL string) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, jwksURL, "", &set); err != nil {
+		return nil, fmt.Errorf("获取签发方公钥失败: %w", err)
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for i := range set.Keys {
+		if set.Keys[i].Use != "" && set.Keys[i].Use != "sig" {
+			continue
+		}
+		if key, err := set.Keys[i].publicKey(); err == nil {
+			keys[set.Keys[i].Kid] = key
+		}
+	}
+	jwksCache.Lock()
+	jwksCache.m[jwksURL] = cachedJWKS{keys: keys, fetched: time.Now()}
+	jwksCache.Unlock()
+	return keys, nil
+}
+
+func signingKey(ctx context.Context, jwksURL, kid string) (interface{}, error) {
+	jwksCache.Lock()
+	cached, ok := jwksCache.m[jwksURL]
+	jwksCache.Unlock()
+	keys := cached.keys
+	if !ok || time.Since(cached.fetched) > time.Hour || keys[kid] == nil {
+		var err error
+		if keys, err = fetchJWKS(ctx, jwksURL); err != nil {
+			return nil, err
+		}
+	}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	// 未带 kid 且签发方只有一个密钥时直接使用
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("找不到 id_token 的签名公钥: kid=%s", kid)
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce string `json:"nonce"`
+}
+
+// verifyIDToken 使用签发方 JWKS 校验 id_token 的签名、签发方、受众与有效期
+func (p *Provider) verifyIDToken(ctx context.Context, raw string) (*idTokenClaims, error) {
+	if p.JWKSURL == "" {
+		return nil, errors.New("签发方未提供 jwks_uri，无法校验 id_token")
+	}
+	var claims idTokenClaims
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	}
+	if p.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(p.Issuer))
+	}
+	_, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return signingKey(ctx, p.JWKSURL, kid)
+	}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("id_token 校验失败: %w", err)
+	}
+	return &claims, nil
+}
@@ -0,0 +1,465 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cboard-go/internal/core/kvstore"
+	"cboard-go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ProviderGitHub = "github"
+	ProviderGoogle = "google"
+	ProviderOIDC   = "oidc"
+
+	googleDiscoveryURL = "https://accounts.google.com/.well-known/openid-configuration"
+
+	stateTTL = 10 * time.Minute
+)
+
+var (
+	ErrProviderNotFound = errors.New("未启用该登录方式")
+	ErrStateNotFound    = errors.New("授权已过期，请重新登录")
+)
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// Identity 第三方账号信息
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+	AvatarURL     string
+}
+
+// Provider OAuth2 / OIDC 登录方式
+type Provider struct {
+	Name         string `json:"name"`
+	DisplayName  string `json:"display_name"`
+	ClientID     string `json:"-"`
+	ClientSecret string `json:"-"`
+	AuthURL      string `json:"-"`
+	TokenURL     string `json:"-"`
+	UserInfoURL  string `json:"-"`
+	// Issuer、JWKSURL 仅 OIDC 使用，用于校验 id_token
+	Issuer  string `json:"-"`
+	JWKSURL string `json:"-"`
+	// EmailsURL 仅 GitHub 使用，用于获取已验证的邮箱
+	EmailsURL string   `json:"-"`
+	Scopes    []string `json:"-"`
+	OIDC      bool     `json:"-"`
+}
+
+// Settings oauth 分类下的配置
+type Settings struct {
+	AutoRegister bool
+	LinkByEmail  bool
+	Providers    []*Provider
+}
+
+func configBool(m map[string]string, key string, def bool) bool {
+	if v, ok := m[key]; ok && v != "" {
+		return v == "true"
+	}
+	return def
+}
+
+// LoadSettings 读取已启用的登录方式；Google 与通用 OIDC 通过发现文档获取端点
+func LoadSettings(db *gorm.DB) (*Settings, error) {
+	var configs []models.SystemConfig
+	if err := db.Where("category = ?", "oauth").Find(&configs).Error; err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, len(configs))
+	for _, c := range configs {
+		m[c.Key] = strings.TrimSpace(c.Value)
+	}
+
+	s := &Settings{
+		AutoRegister: configBool(m, "auto_register", true),
+		LinkByEmail:  configBool(m, "link_by_email", false),
+	}
+	var errs []string
+	if configBool(m, "github_enabled", false) && m["github_client_id"] != "" {
+		s.Providers = append(s.Providers, GitHub(m["github_client_id"], m["github_client_secret"]))
+	}
+	if configBool(m, "google_enabled", false) && m["google_client_id"] != "" {
+		p, err := NewOIDCProvider(ProviderGoogle, "Google", googleDiscoveryURL, m["google_client_id"], m["google_client_secret"], "")
+		if err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			s.Providers = append(s.Providers, p)
+		}
+	}
+	if configBool(m, "oidc_enabled", false) && m["oidc_client_id"] != "" && m["oidc_discovery_url"] != "" {
+		name := m["oidc_display_name"]
+		if name == "" {
+			name = "SSO"
+		}
+		p, err := NewOIDCProvider(ProviderOIDC, name, m["oidc_discovery_url"], m["oidc_client_id"], m["oidc_client_secret"], m["oidc_scopes"])
+		if err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			s.Providers = append(s.Providers, p)
+		}
+	}
+	if len(errs) > 0 {
+		return s, errors.New(strings.Join(errs, "; "))
+	}
+	return s, nil
+}
+
+// Provider 按名称查找已启用的登录方式
+func (s *Settings) Provider(name string) (*Provider, error) {
+	for _, p := range s.Providers {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, ErrProviderNotFound
+}
+
+// GitHub GitHub OAuth App
+func GitHub(clientID, clientSecret string) *Provider {
+	return &Provider{
+		Name:         ProviderGitHub,
+		DisplayName:  "GitHub",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		AuthURL:      "https://github.com/login/oauth/authorize",
+		TokenURL:     "https://github.com/login/oauth/access_token",
+		UserInfoURL:  "https://api.github.com/user",
+		EmailsURL:    "https://api.github.com/user/emails",
+		Scopes:       []string{"read:user", "user:email"},
+	}
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// 发现文档缓存一小时
+var discoveryCache = struct {
+	sync.Mutex
+	m map[string]cachedDiscovery
+}{m: make(map[string]cachedDiscovery)}
+
+type cachedDiscovery struct {
+	doc     discovery
+	fetched time.Time
+}
+
+func discover(discoveryURL string) (*discovery, error) {
+	if !strings.Contains(discoveryURL, "/.well-known/") {
+		discoveryURL = strings.TrimRight(discoveryURL, "/") + "/.well-known/openid-configuration"
+	}
+	discoveryCache.Lock()
+	cached, ok := discoveryCache.m[discoveryURL]
+	discoveryCache.Unlock()
+	if ok && time.Since(cached.fetched) < time.Hour {
+		return &cached.doc, nil
+	}
+
+	var doc discovery
+	if err := getJSON(context.Background(), discoveryURL, "", &doc); err != nil {
+		return nil, fmt.Errorf("获取 OIDC 发现文档失败: %w", err)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.UserinfoEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC 发现文档缺少必要的端点: %s", discoveryURL)
+	}
+	if doc.Issuer != "" && !strings.HasPrefix(discoveryURL, strings.TrimRight(doc.Issuer, "/")+"/") {
+		return nil, fmt.Errorf("OIDC issuer 与发现地址不一致: %s", doc.Issuer)
+	}
+
+	discoveryCache.Lock()
+	discoveryCache.m[discoveryURL] = cachedDiscovery{doc: doc, fetched: time.Now()}
+	discoveryCache.Unlock()
+	return &doc, nil
+}
+
+// NewOIDCProvider 通过发现文档创建 OIDC 登录方式
+func NewOIDCProvider(name, displayName, discoveryURL, clientID, clientSecret, scopes string) (*Provider, error) {
+	doc, err := discover(discoveryURL)
+	if err != nil {
+		return nil, err
+	}
+	scopeList := strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+	if len(scopeList) == 0 {
+		scopeList = []string{"openid", "email", "profile"}
+	}
+	return &Provider{
+		Name:         name,
+		DisplayName:  displayName,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		AuthURL:      doc.AuthorizationEndpoint,
+		TokenURL:     doc.TokenEndpoint,
+		UserInfoURL:  doc.UserinfoEndpoint,
+		Issuer:       doc.Issuer,
+		JWKSURL:      doc.JWKSURI,
+		Scopes:       scopeList,
+		OIDC:         true,
+	}, nil
+}
+
+// State 授权过程中保存的状态，回调时校验并取出。
+// 保存在 kvstore 中，多实例部署时回调可以落到任意实例
+type State struct {
+	Provider    string `json:"provider"`
+	RedirectURI string `json:"redirect_uri"`
+	Verifier    string `json:"verifier"`
+	Nonce       string `json:"nonce"`
+	InviteCode  string `json:"invite_code"`
+	// LinkUserID 非零表示已登录用户绑定第三方账号
+	LinkUserID uint `json:"link_user_id"`
+}
+
+func stateKey(state string) string {
+	return "oauth:state:" + state
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthCodeURL 生成授权地址（授权码模式 + PKCE），返回地址与 state
+func (p *Provider) AuthCodeURL(redirectURI, inviteCode string, linkUserID uint) (string, string, error) {
+	state, err := randomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString(16)
+	if err != nil {
+		return "", "", err
+	}
+	data, err := json.Marshal(&State{
+		Provider:    p.Name,
+		RedirectURI: redirectURI,
+		Verifier:    verifier,
+		Nonce:       nonce,
+		InviteCode:  inviteCode,
+		LinkUserID:  linkUserID,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if err := kvstore.Default().Set(stateKey(state), string(data), stateTTL); err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("scope", strings.Join(p.Scopes, " "))
+	q.Set("state", state)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	if p.OIDC {
+		q.Set("nonce", nonce)
+	}
+	sep := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		sep = "&"
+	}
+	return p.AuthURL + sep + q.Encode(), state, nil
+}
+
+// TakeState 取出 state（只能使用一次）
+func TakeState(state, provider string) (*State, error) {
+	if state == "" {
+		return nil, ErrStateNotFound
+	}
+	data, ok, err := kvstore.Take(kvstore.Default(), stateKey(state))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+	var s State
+	if err := json.Unmarshal([]byte(data), &s); err != nil || s.Provider != provider {
+		return nil, ErrStateNotFound
+	}
+	return &s, nil
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange 用授权码换取令牌并获取账号信息
+func (p *Provider) Exchange(ctx context.Context, code string, state *State) (*Identity, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", state.RedirectURI)
+	form.Set("client_id", p.ClientID)
+	form.Set("client_secret", p.ClientSecret)
+	form.Set("code_verifier", state.Verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求令牌失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("解析令牌响应失败: HTTP %d", resp.StatusCode)
+	}
+	if token.Error != "" || token.AccessToken == "" {
+		return nil, fmt.Errorf("获取令牌失败: %s %s", token.Error, token.ErrorDescription)
+	}
+
+	if p.OIDC {
+		return p.oidcIdentity(ctx, &token, state.Nonce)
+	}
+	return p.githubIdentity(ctx, token.AccessToken)
+}
+
+// oidcIdentity 账号信息以 userinfo 为准；id_token 经签发方公钥验签后，
+// 校验 nonce 与授权请求一致、sub 与 userinfo 一致
+func (p *Provider) oidcIdentity(ctx context.Context, token *tokenResponse, nonce string) (*Identity, error) {
+	var info struct {
+		Sub               string      `json:"sub"`
+		Email             string      `json:"email"`
+		EmailVerified     interface{} `json:"email_verified"`
+		Name              string      `json:"name"`
+		PreferredUsername string      `json:"preferred_username"`
+		Picture           string      `json:"picture"`
+	}
+	if err := getJSON(ctx, p.UserInfoURL, token.AccessToken, &info); err != nil {
+		return nil, fmt.Errorf("获取用户信息失败: %w", err)
+	}
+	if info.Sub == "" {
+		return nil, errors.New("用户信息缺少 sub")
+	}
+	// 授权请求总是带 nonce，令牌响应必须包含 id_token 并原样返回
+	if token.IDToken == "" {
+		return nil, errors.New("令牌响应缺少 id_token")
+	}
+	claims, err := p.verifyIDToken(ctx, token.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject != info.Sub {
+		return nil, errors.New("id_token 与用户信息不一致")
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("id_token nonce 校验失败")
+	}
+	verified := false
+	switch v := info.EmailVerified.(type) {
+	case bool:
+		verified = v
+	case string:
+		verified, _ = strconv.ParseBool(v)
+	}
+	return &Identity{
+		Subject:       info.Sub,
+		Email:         strings.ToLower(strings.TrimSpace(info.Email)),
+		EmailVerified: verified,
+		Name:          info.Name,
+		Username:      info.PreferredUsername,
+		AvatarURL:     info.Picture,
+	}, nil
+}
+
+func (p *Provider) githubIdentity(ctx context.Context, accessToken string) (*Identity, error) {
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := getJSON(ctx, p.UserInfoURL, accessToken, &user); err != nil {
+		return nil, fmt.Errorf("获取 GitHub 用户信息失败: %w", err)
+	}
+	if user.ID == 0 {
+		return nil, errors.New("GitHub 用户信息缺少 id")
+	}
+	id := &Identity{
+		Subject:   strconv.FormatInt(user.ID, 10),
+		Name:      user.Name,
+		Username:  user.Login,
+		AvatarURL: user.AvatarURL,
+	}
+
+	// /user 返回的公开邮箱不保证已验证，以 /user/emails 的主邮箱为准
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, p.EmailsURL, accessToken, &emails); err == nil {
+		for _, e := range emails {
+			if e.Primary && e.Verified {
+				id.Email = strings.ToLower(e.Email)
+				id.EmailVerified = true
+				break
+			}
+		}
+	}
+	return id, nil
+}
+
+func getJSON(ctx context.Context, rawURL, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,266 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"cboard-go/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// mockIssuer 本地 OIDC 签发方：发现文档、JWKS、授权码换令牌（校验 PKCE）、userinfo
+type mockIssuer struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	clientID  string
+	challenge string
+	nonce     string
+	idNonce   string
+	sub       string
+	// signIDToken 默认使用签发方私钥签名，测试中替换为伪造的 id_token
+	signIDToken func(claims jwt.MapClaims) string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key, clientID: "cboard", sub: "user-42"}
+	m.signIDToken = func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		signed, _ := token.SignedString(m.key)
+		return signed
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"userinfo_endpoint":      m.URL + "/userinfo",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "good-code" || r.PostForm.Get("client_secret") != "secret" ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		nonce := m.nonce
+		if m.idNonce != "" {
+			nonce = m.idNonce
+		}
+		claims := jwt.MapClaims{"sub": m.sub, "aud": m.clientID, "iss": m.URL, "exp": time.Now().Add(time.Hour).Unix()}
+		if nonce != "-" {
+			claims["nonce"] = nonce
+		}
+		idToken := m.signIDToken(claims)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at-1", "token_type": "Bearer", "id_token": idToken})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer at-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sub": m.sub, "email": "Alice@Example.com", "email_verified": true,
+			"name": "Alice", "preferred_username": "alice",
+		})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// authorize 模拟用户在签发方完成授权，记录 PKCE challenge 与 nonce
+func (m *mockIssuer) authorize(t *testing.T, authURL string) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != m.clientID || q.Get("code_challenge_method") != "S256" || q.Get("response_type") != "code" {
+		t.Fatalf("unexpected authorize request %s", authURL)
+	}
+	m.challenge = q.Get("code_challenge")
+	m.nonce = q.Get("nonce")
+	return q.Get("state")
+}
+
+func newTestDB(t *testing.T, configs map[string]string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&models.SystemConfig{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for k, v := range configs {
+		db.Create(&models.SystemConfig{Key: k, Value: v, Category: "oauth"})
+	}
+	return db
+}
+
+func TestOIDCProviderAgainstMockIssuer(t *testing.T) {
+	issuer := newMockIssuer(t)
+	db := newTestDB(t, map[string]string{
+		"oidc_enabled":       "true",
+		"oidc_display_name":  "Company SSO",
+		"oidc_discovery_url": issuer.URL,
+		"oidc_client_id":     "cboard",
+		"oidc_client_secret": "secret",
+	})
+	settings, err := LoadSettings(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !settings.AutoRegister || settings.LinkByEmail {
+		t.Errorf("auto register should default to true and link by email to false")
+	}
+	p, err := settings.Provider(ProviderOIDC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := settings.Provider(ProviderGitHub); !errors.Is(err, ErrProviderNotFound) {
+		t.Errorf("disabled provider should not be returned")
+	}
+
+	authURL, _, err := p.AuthCodeURL("https://panel.example.com/oauth/callback/oidc", "INVITE1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateID := issuer.authorize(t, authURL)
+	state, err := TakeState(stateID, ProviderOIDC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.InviteCode != "INVITE1" {
+		t.Errorf("invite code not carried in state: %q", state.InviteCode)
+	}
+	if _, err := TakeState(stateID, ProviderOIDC); !errors.Is(err, ErrStateNotFound) {
+		t.Fatal("state must be single use")
+	}
+
+	id, err := p.Exchange(context.Background(), "good-code", state)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if id.Subject != "user-42" || id.Email != "alice@example.com" || !id.EmailVerified || id.Username != "alice" {
+		t.Fatalf("unexpected identity %+v", id)
+	}
+
+	if _, err := p.Exchange(context.Background(), "bad-code", state); err == nil {
+		t.Fatal("invalid code must fail")
+	}
+
+	// id_token 中的 nonce 与授权请求不一致
+	authURL, _, _ = p.AuthCodeURL("https://panel.example.com/oauth/callback/oidc", "", 0)
+	state, _ = TakeState(issuer.authorize(t, authURL), ProviderOIDC)
+	issuer.idNonce = "forged"
+	if _, err := p.Exchange(context.Background(), "good-code", state); err == nil {
+		t.Fatal("nonce mismatch must be rejected")
+	}
+
+	// 授权请求带了 nonce，id_token 中缺少 nonce
+	authURL, _, _ = p.AuthCodeURL("https://panel.example.com/oauth/callback/oidc", "", 0)
+	state, _ = TakeState(issuer.authorize(t, authURL), ProviderOIDC)
+	issuer.idNonce = "-"
+	if _, err := p.Exchange(context.Background(), "good-code", state); err == nil {
+		t.Fatal("missing nonce must be rejected")
+	}
+	issuer.idNonce = ""
+
+	// 未签名或由其他密钥签名的 id_token
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forgers := map[string]func(jwt.MapClaims) string{
+		"alg none": func(claims jwt.MapClaims) string {
+			signed, _ := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return signed
+		},
+		"foreign key": func(claims jwt.MapClaims) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+			token.Header["kid"] = "k1"
+			signed, _ := token.SignedString(other)
+			return signed
+		},
+	}
+	sign := issuer.signIDToken
+	for name, forge := range forgers {
+		issuer.signIDToken = forge
+		authURL, _, _ = p.AuthCodeURL("https://panel.example.com/oauth/callback/oidc", "", 0)
+		state, _ = TakeState(issuer.authorize(t, authURL), ProviderOIDC)
+		if _, err := p.Exchange(context.Background(), "good-code", state); err == nil {
+			t.Fatalf("%s id_token must be rejected", name)
+		}
+	}
+	issuer.signIDToken = sign
+}
+
+func TestGitHubProviderUsesVerifiedPrimaryEmail(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "gh-token"})
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 1001, "login": "octocat", "name": "Octo"})
+	})
+	mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"email": "old@example.com", "primary": false, "verified": true},
+			{"email": "Octo@Example.com", "primary": true, "verified": true},
+		})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := GitHub("id", "secret")
+	p.AuthURL, p.TokenURL, p.UserInfoURL, p.EmailsURL = srv.URL+"/authorize", srv.URL+"/token", srv.URL+"/user", srv.URL+"/user/emails"
+
+	authURL, stateID, err := p.AuthCodeURL("https://panel.example.com/oauth/callback/github", "", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := url.Parse(authURL); u.Query().Get("nonce") != "" {
+		t.Error("nonce should only be sent to OIDC providers")
+	}
+	state, err := TakeState(stateID, ProviderGitHub)
+	if err != nil || state.LinkUserID != 7 {
+		t.Fatalf("state = %+v, err = %v", state, err)
+	}
+	id, err := p.Exchange(context.Background(), "code", state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Subject != "1001" || id.Email != "octo@example.com" || !id.EmailVerified || id.Username != "octocat" {
+		t.Fatalf("unexpected identity %+v", id)
+	}
+}
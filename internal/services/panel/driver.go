@@ -0,0 +1,57 @@
+package panel
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"time"
+)
+
+const (
+	TypeXUI     = "xui"
+	TypeMarzban = "marzban"
+)
+
+// Client 远程面板上的一个用户（客户端）
+type Client struct {
+	Email    string // 面板内唯一标识
+	UUID     string
+	Password string
+	Protocol string // vless, vmess, trojan, ss
+	Inbound  string // 3x-ui 入站ID / Marzban 入站标签
+	ExpireAt *time.Time
+	Enable   bool
+}
+
+type Usage struct {
+	Upload   int64
+	Download int64
+}
+
+// Driver 外部面板驱动
+type Driver interface {
+	Login() error
+	AddClient(client *Client) (string, error)
+	UpdateClient(remoteID string, client *Client) (string, error)
+	GetUsage(remoteID string, client *Client) (*Usage, error)
+	// DeleteClient 删除远程客户端，客户端已不存在时视为成功
+	DeleteClient(remoteID string, client *Client) error
+}
+
+func NewDriver(panelType, baseURL, username, password string) (Driver, error) {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if baseURL == "" {
+		return nil, fmt.Errorf("面板地址不能为空")
+	}
+	jar, _ := cookiejar.New(nil)
+	httpClient := &http.Client{Timeout: 15 * time.Second, Jar: jar}
+
+	switch panelType {
+	case TypeXUI:
+		return &XUIDriver{baseURL: baseURL, username: username, password: password, client: httpClient}, nil
+	case TypeMarzban:
+		return &MarzbanDriver{baseURL: baseURL, username: username, password: password, client: httpClient}, nil
+	}
+	return nil, fmt.Errorf("不支持的面板类型: %s", panelType)
+}
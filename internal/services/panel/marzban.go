@@ -0,0 +1,197 @@
+package panel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// MarzbanDriver Marzban 面板驱动
+type MarzbanDriver struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+	token    string
+}
+
+func (d *MarzbanDriver) Login() error {
+	form := url.Values{}
+	form.Set("username", d.username)
+	form.Set("password", d.password)
+	resp, err := d.client.PostForm(d.baseURL+"/api/admin/token", form)
+	if err != nil {
+		return fmt.Errorf("连接面板失败: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("面板登录失败: 状态码 %d", resp.StatusCode)
+	}
+	var r struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil || r.AccessToken == "" {
+		return fmt.Errorf("面板登录失败: 未返回令牌")
+	}
+	d.token = r.AccessToken
+	return nil
+}
+
+func (d *MarzbanDriver) AddClient(client *Client) (string, error) {
+	body, err := d.userPayload(client, true)
+	if err != nil {
+		return "", err
+	}
+	if _, err := d.do(http.MethodPost, "/api/user", body); err != nil {
+		return "", err
+	}
+	return client.Email, nil
+}
+
+func (d *MarzbanDriver) UpdateClient(remoteID string, client *Client) (string, error) {
+	if remoteID == "" {
+		return d.AddClient(client)
+	}
+	body, err := d.userPayload(client, false)
+	if err != nil {
+		return "", err
+	}
+	if _, err := d.do(http.MethodPut, "/api/user/"+url.PathEscape(remoteID), body); err != nil {
+		return "", err
+	}
+	return remoteID, nil
+}
+
+// GetUsage Marzban 只提供总流量，计入下行
+func (d *MarzbanDriver) GetUsage(remoteID string, client *Client) (*Usage, error) {
+	if remoteID == "" {
+		remoteID = client.Email
+	}
+	data, err := d.do(http.MethodGet, "/api/user/"+url.PathEscape(remoteID), nil)
+	if err != nil {
+		return nil, err
+	}
+	var r struct {
+		UsedTraffic int64 `json:"used_traffic"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("解析流量数据失败: %w", err)
+	}
+	return &Usage{Download: r.UsedTraffic}, nil
+}
+
+func (d *MarzbanDriver) DeleteClient(remoteID string, client *Client) error {
+	if remoteID == "" {
+		remoteID = client.Email
+	}
+	if d.token == "" {
+		if err := d.Login(); err != nil {
+			return err
+		}
+	}
+	_, status, err := d.request(http.MethodDelete, "/api/user/"+url.PathEscape(remoteID), nil)
+	if err == nil && status == http.StatusUnauthorized {
+		if err := d.Login(); err != nil {
+			return err
+		}
+		_, status, err = d.request(http.MethodDelete, "/api/user/"+url.PathEscape(remoteID), nil)
+	}
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound || (status >= 200 && status < 300) {
+		return nil
+	}
+	return fmt.Errorf("面板返回状态码 %d", status)
+}
+
+func (d *MarzbanDriver) userPayload(client *Client, create bool) ([]byte, error) {
+	protocol := client.Protocol
+	proxy := map[string]interface{}{}
+	switch protocol {
+	case "vless", "vmess":
+		proxy["id"] = client.UUID
+	case "trojan":
+		proxy["password"] = client.Password
+	case "ss":
+		protocol = "shadowsocks"
+		proxy["password"] = client.Password
+	default:
+		return nil, fmt.Errorf("Marzban 不支持的协议: %s", client.Protocol)
+	}
+
+	status := "active"
+	if !client.Enable {
+		status = "disabled"
+	}
+	var expire int64
+	if client.ExpireAt != nil {
+		expire = client.ExpireAt.Unix()
+	}
+	payload := map[string]interface{}{
+		"proxies": map[string]interface{}{protocol: proxy},
+		"status":  status,
+		"expire":  expire,
+	}
+	if create {
+		payload["username"] = client.Email
+		payload["data_limit"] = 0
+	}
+	if client.Inbound != "" {
+		payload["inbounds"] = map[string][]string{protocol: {client.Inbound}}
+	}
+	return json.Marshal(payload)
+}
+
+func (d *MarzbanDriver) do(method, path string, body []byte) ([]byte, error) {
+	if d.token == "" {
+		if err := d.Login(); err != nil {
+			return nil, err
+		}
+	}
+	data, status, err := d.request(method, path, body)
+	if err == nil && status == http.StatusUnauthorized {
+		// 令牌过期，重新登录后重试一次
+		if err := d.Login(); err != nil {
+			return nil, err
+		}
+		data, status, err = d.request(method, path, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if status < 200 || status >= 300 {
+		var r struct {
+			Detail interface{} `json:"detail"`
+		}
+		json.Unmarshal(data, &r)
+		return nil, fmt.Errorf("面板返回状态码 %d: %v", status, r.Detail)
+	}
+	return data, nil
+}
+
+func (d *MarzbanDriver) request(method, path string, body []byte) ([]byte, int, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, d.baseURL+path, reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+d.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return data, resp.StatusCode, err
+}
@@ -0,0 +1,266 @@
+package panel
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/config_update"
+)
+
+// fakeXUI 模拟 3x-ui 面板 API
+type fakeXUI struct {
+	mu      sync.Mutex
+	clients map[string]map[string]interface{}
+}
+
+func newFakeXUI() (*fakeXUI, *httptest.Server) {
+	f := &fakeXUI{clients: make(map[string]map[string]interface{})}
+	mux := http.NewServeMux()
+	ok := func(w http.ResponseWriter, obj interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "msg": "", "obj": obj})
+	}
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.FormValue("username") != "admin" || r.FormValue("password") != "secret" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "msg": "wrong password"})
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "3x-ui", Value: "session", Path: "/"})
+		ok(w, nil)
+	})
+	authed := func(r *http.Request) bool {
+		cookie, err := r.Cookie("3x-ui")
+		return err == nil && cookie.Value == "session"
+	}
+	saveClient := func(w http.ResponseWriter, r *http.Request, oldID string) {
+		if !authed(r) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body struct {
+			ID       int    `json:"id"`
+			Settings string `json:"settings"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		var settings struct {
+			Clients []map[string]interface{} `json:"clients"`
+		}
+		json.Unmarshal([]byte(body.Settings), &settings)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, c := range settings.Clients {
+			email := c["email"].(string)
+			if oldID == "" {
+				if _, exists := f.clients[email]; exists {
+					json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "msg": "duplicate email"})
+					return
+				}
+			}
+			f.clients[email] = c
+		}
+		ok(w, nil)
+	}
+	mux.HandleFunc("/panel/api/inbounds/addClient", func(w http.ResponseWriter, r *http.Request) {
+		saveClient(w, r, "")
+	})
+	mux.HandleFunc("/panel/api/inbounds/updateClient/", func(w http.ResponseWriter, r *http.Request) {
+		saveClient(w, r, strings.TrimPrefix(r.URL.Path, "/panel/api/inbounds/updateClient/"))
+	})
+	mux.HandleFunc("/panel/api/inbounds/3/delClient/", func(w http.ResponseWriter, r *http.Request) {
+		if !authed(r) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/panel/api/inbounds/3/delClient/")
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for email, c := range f.clients {
+			if c["id"] == id || c["password"] == id || email == id {
+				delete(f.clients, email)
+				ok(w, nil)
+				return
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "msg": "Client Not Found"})
+	})
+	mux.HandleFunc("/panel/api/inbounds/getClientTraffics/", func(w http.ResponseWriter, r *http.Request) {
+		if !authed(r) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ok(w, map[string]interface{}{"up": 100, "down": 200})
+	})
+	return f, httptest.NewServer(mux)
+}
+
+func TestXUIDriver(t *testing.T) {
+	fake, server := newFakeXUI()
+	defer server.Close()
+
+	driver, err := NewDriver(TypeXUI, server.URL+"/", "admin", "secret")
+	if err != nil {
+		t.Fatalf("创建驱动失败: %v", err)
+	}
+
+	client := &Client{Email: "cb1_u1", UUID: "uuid-1", Protocol: "vless", Inbound: "3", Enable: true}
+	remoteID, err := driver.AddClient(client)
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+	if remoteID != "uuid-1" {
+		t.Errorf("vless 客户端标识应为 UUID，实际为 %s", remoteID)
+	}
+	if fake.clients["cb1_u1"]["id"] != "uuid-1" || fake.clients["cb1_u1"]["enable"] != true {
+		t.Errorf("远程客户端数据不正确: %v", fake.clients["cb1_u1"])
+	}
+
+	client.Enable = false
+	client.UUID = "uuid-2"
+	remoteID, err = driver.UpdateClient(remoteID, client)
+	if err != nil {
+		t.Fatalf("更新客户端失败: %v", err)
+	}
+	if remoteID != "uuid-2" || fake.clients["cb1_u1"]["enable"] != false {
+		t.Errorf("禁用客户端失败: %v", fake.clients["cb1_u1"])
+	}
+
+	usage, err := driver.GetUsage(remoteID, client)
+	if err != nil {
+		t.Fatalf("获取流量失败: %v", err)
+	}
+	if usage.Upload != 100 || usage.Download != 200 {
+		t.Errorf("流量数据不正确: %+v", usage)
+	}
+
+	if _, err := driver.AddClient(&Client{Email: "cb2_u1", Protocol: "vless", Inbound: "abc"}); err == nil {
+		t.Error("无效的入站ID应返回错误")
+	}
+
+	if err := driver.DeleteClient(remoteID, client); err != nil {
+		t.Fatalf("删除客户端失败: %v", err)
+	}
+	if _, exists := fake.clients["cb1_u1"]; exists {
+		t.Error("远程客户端应已删除")
+	}
+	if err := driver.DeleteClient(remoteID, client); err != nil {
+		t.Errorf("客户端已不存在时删除应视为成功: %v", err)
+	}
+	if _, err := driver.AddClient(client); err != nil {
+		t.Errorf("删除后重新创建失败: %v", err)
+	}
+}
+
+func TestXUIDriverLoginFailed(t *testing.T) {
+	_, server := newFakeXUI()
+	defer server.Close()
+
+	driver, _ := NewDriver(TypeXUI, server.URL, "admin", "wrong")
+	if err := driver.Login(); err == nil {
+		t.Error("错误的密码应登录失败")
+	}
+}
+
+func TestMarzbanDriver(t *testing.T) {
+	users := make(map[string]map[string]interface{})
+	tokenIssued := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/admin/token", func(w http.ResponseWriter, r *http.Request) {
+		tokenIssued++
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "tok", "token_type": "bearer"})
+	})
+	mux.HandleFunc("/api/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		users[body["username"].(string)] = body
+		json.NewEncoder(w).Encode(body)
+	})
+	mux.HandleFunc("/api/user/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/api/user/")
+		u, ok := users[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"detail": "User not found"})
+			return
+		}
+		if r.Method == http.MethodPut {
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			for k, v := range body {
+				u[k] = v
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"username": name, "status": u["status"], "used_traffic": 4096})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	driver, _ := NewDriver(TypeMarzban, server.URL, "admin", "secret")
+	client := &Client{Email: "cb5_u2", Password: "pw", Protocol: "trojan", Inbound: "Trojan TCP", Enable: true}
+	remoteID, err := driver.AddClient(client)
+	if err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	if remoteID != "cb5_u2" || users["cb5_u2"]["status"] != "active" {
+		t.Errorf("远程用户数据不正确: %v", users["cb5_u2"])
+	}
+	proxies := users["cb5_u2"]["proxies"].(map[string]interface{})
+	if proxies["trojan"].(map[string]interface{})["password"] != "pw" {
+		t.Errorf("远程用户密码不正确: %v", proxies)
+	}
+
+	client.Enable = false
+	if _, err := driver.UpdateClient(remoteID, client); err != nil {
+		t.Fatalf("禁用用户失败: %v", err)
+	}
+	if users["cb5_u2"]["status"] != "disabled" {
+		t.Errorf("用户状态应为 disabled，实际为 %v", users["cb5_u2"]["status"])
+	}
+
+	usage, err := driver.GetUsage(remoteID, client)
+	if err != nil {
+		t.Fatalf("获取流量失败: %v", err)
+	}
+	if usage.Download != 4096 {
+		t.Errorf("流量应为 4096，实际为 %d", usage.Download)
+	}
+	if tokenIssued != 1 {
+		t.Errorf("令牌应只申请一次，实际为 %d", tokenIssued)
+	}
+
+	if _, err := driver.UpdateClient("missing", client); err == nil {
+		t.Error("不存在的用户应返回错误")
+	}
+}
+
+func TestNewDriverUnsupported(t *testing.T) {
+	if _, err := NewDriver("unknown", "http://127.0.0.1", "", ""); err == nil {
+		t.Error("不支持的面板类型应返回错误")
+	}
+	if _, err := NewDriver(TypeXUI, " ", "", ""); err == nil {
+		t.Error("空面板地址应返回错误")
+	}
+}
+
+func TestBuildClientSS2022Key(t *testing.T) {
+	s := &PanelService{}
+	un := &models.UserCustomNode{ID: 3, UserID: 7, Password: "user-pass"}
+	node := &models.CustomNode{Protocol: "ss", Config: `{"type":"ss","cipher":"2022-blake3-aes-128-gcm","password":"c2VydmVy"}`}
+	client := s.buildClient(un, node, true)
+	if client.Password != config_update.SSUserKey("2022-blake3-aes-128-gcm", "user-pass") || client.Password == "user-pass" {
+		t.Errorf("SS2022 应使用派生的用户PSK，实际为 %s", client.Password)
+	}
+
+	node.Config = `{"type":"ss","cipher":"aes-256-gcm"}`
+	if client := s.buildClient(un, node, true); client.Password != "user-pass" {
+		t.Errorf("普通 SS 应使用原始密码，实际为 %s", client.Password)
+	}
+}
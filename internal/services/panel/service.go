@@ -0,0 +1,275 @@
+package panel
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/config_update"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+type PanelService struct {
+	db      *gorm.DB
+	drivers map[uint]Driver
+}
+
+func NewPanelService() *PanelService {
+	return &PanelService{
+		db:      database.GetDB(),
+		drivers: make(map[uint]Driver),
+	}
+}
+
+// DriverForPanel 根据面板记录创建驱动（密码解密后使用）
+func DriverForPanel(p *models.NodePanel) (Driver, error) {
+	password := p.Password
+	if password != "" {
+		plain, err := utils.DecryptAES(password)
+		if err != nil {
+			return nil, fmt.Errorf("解密面板密码失败: %w", err)
+		}
+		password = plain
+	}
+	return NewDriver(p.Type, p.BaseURL, p.Username, password)
+}
+
+func (s *PanelService) driverFor(node *models.CustomNode) (Driver, error) {
+	if node.PanelID == nil {
+		return nil, nil
+	}
+	if d, ok := s.drivers[*node.PanelID]; ok {
+		return d, nil
+	}
+	var p models.NodePanel
+	if err := s.db.First(&p, *node.PanelID).Error; err != nil {
+		return nil, fmt.Errorf("面板不存在: %w", err)
+	}
+	if !p.IsActive {
+		return nil, nil
+	}
+	d, err := DriverForPanel(&p)
+	if err != nil {
+		return nil, err
+	}
+	s.drivers[p.ID] = d
+	return d, nil
+}
+
+func clientEmail(un *models.UserCustomNode) string {
+	return fmt.Sprintf("cb%d_u%d", un.ID, un.UserID)
+}
+
+func (s *PanelService) buildClient(un *models.UserCustomNode, node *models.CustomNode, enable bool) *Client {
+	protocol := strings.ToLower(node.Protocol)
+	if protocol == "shadowsocks" {
+		protocol = "ss"
+	}
+	password := un.Password
+	if protocol == "ss" {
+		// SS2022 的用户PSK由密码派生，需与订阅链接和节点后端使用的一致
+		var proxyNode config_update.ProxyNode
+		if json.Unmarshal([]byte(node.Config), &proxyNode) == nil {
+			password = config_update.SSUserKey(proxyNode.Cipher, un.Password)
+		}
+	}
+	return &Client{
+		Email:    clientEmail(un),
+		UUID:     un.UUID,
+		Password: password,
+		Protocol: protocol,
+		Inbound:  node.PanelInbound,
+		Enable:   enable,
+	}
+}
+
+func (s *PanelService) loadUserNode(un *models.UserCustomNode) error {
+	if un.CustomNode.ID == 0 {
+		if err := s.db.First(&un.CustomNode, un.CustomNodeID).Error; err != nil {
+			return err
+		}
+	}
+	return config_update.EnsureUserNodeCredentials(s.db, un)
+}
+
+func (s *PanelService) saveRemoteState(un *models.UserCustomNode, remoteID, status string) {
+	un.RemoteClientID = remoteID
+	un.RemoteStatus = status
+	s.db.Model(&models.UserCustomNode{}).Where("id = ?", un.ID).Updates(map[string]interface{}{
+		"remote_client_id": remoteID,
+		"remote_status":    status,
+	})
+}
+
+// setEnabled 在远程面板上创建/启用或禁用该分配对应的客户端
+func (s *PanelService) setEnabled(un *models.UserCustomNode, enable bool) error {
+	if err := s.loadUserNode(un); err != nil {
+		return err
+	}
+	driver, err := s.driverFor(&un.CustomNode)
+	if err != nil || driver == nil {
+		return err
+	}
+	client := s.buildClient(un, &un.CustomNode, enable)
+	var remoteID string
+	if un.RemoteClientID == "" {
+		remoteID, err = driver.AddClient(client)
+	} else {
+		remoteID, err = driver.UpdateClient(un.RemoteClientID, client)
+	}
+	if err != nil {
+		s.saveRemoteState(un, un.RemoteClientID, "error")
+		return err
+	}
+	status := "active"
+	if !enable {
+		status = "disabled"
+	}
+	s.saveRemoteState(un, remoteID, status)
+	return nil
+}
+
+// Provision 分配专线后在远程面板创建客户端
+func (s *PanelService) Provision(un *models.UserCustomNode) error {
+	return s.setEnabled(un, true)
+}
+
+// Disable 取消分配或到期时禁用远程客户端
+func (s *PanelService) Disable(un *models.UserCustomNode) error {
+	if un.RemoteClientID == "" {
+		return nil
+	}
+	return s.setEnabled(un, false)
+}
+
+// Remove 取消分配前删除远程客户端，否则本地记录删除后面板上会残留无人管理的客户端
+func (s *PanelService) Remove(un *models.UserCustomNode) error {
+	if un.RemoteClientID == "" {
+		return nil
+	}
+	if err := s.loadUserNode(un); err != nil {
+		return err
+	}
+	driver, err := s.driverFor(&un.CustomNode)
+	if err != nil {
+		return err
+	}
+	if driver == nil {
+		if un.CustomNode.PanelID == nil {
+			return nil
+		}
+		// 面板停用时无法删除，报错让调用方保留本地记录，避免客户端残留在面板上无人管理
+		return fmt.Errorf("面板已停用，无法删除远程客户端")
+	}
+	if err := driver.DeleteClient(un.RemoteClientID, s.buildClient(un, &un.CustomNode, false)); err != nil {
+		s.saveRemoteState(un, un.RemoteClientID, "error")
+		return err
+	}
+	s.saveRemoteState(un, "", "")
+	return nil
+}
+
+// RemoveByNode 删除专线节点前删除其所有远程客户端，有客户端删除失败时返回错误，调用方不能删除节点
+func (s *PanelService) RemoveByNode(nodeIDs []uint) error {
+	var userNodes []models.UserCustomNode
+	if err := s.db.Preload("CustomNode").Where("custom_node_id IN ? AND remote_client_id != ?", nodeIDs, "").
+		Find(&userNodes).Error; err != nil {
+		return err
+	}
+	var failed int
+	var lastErr error
+	for i := range userNodes {
+		if err := s.Remove(&userNodes[i]); err != nil {
+			utils.LogWarn("删除远程客户端失败: assignment=%d, %v", userNodes[i].ID, err)
+			failed++
+			lastErr = err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个远程客户端删除失败: %w", failed, lastErr)
+	}
+	return nil
+}
+
+// SyncUserCredentials 订阅重置后将新凭据同步到远程面板
+func (s *PanelService) SyncUserCredentials(userID uint) {
+	var userNodes []models.UserCustomNode
+	s.db.Preload("CustomNode").Where("user_id = ? AND remote_client_id != ?", userID, "").Find(&userNodes)
+	for i := range userNodes {
+		if err := s.setEnabled(&userNodes[i], userNodes[i].RemoteStatus != "disabled"); err != nil {
+			utils.LogWarn("同步远程客户端凭据失败: assignment=%d, %v", userNodes[i].ID, err)
+		}
+	}
+}
+
+// SyncAll 按到期状态启用/禁用远程客户端，并拉取流量使用情况
+func (s *PanelService) SyncAll() error {
+	var userNodes []models.UserCustomNode
+	if err := s.db.Preload("CustomNode").Preload("User").
+		Joins("JOIN custom_nodes ON custom_nodes.id = user_custom_nodes.custom_node_id").
+		Where("custom_nodes.panel_id IS NOT NULL").
+		Find(&userNodes).Error; err != nil {
+		return err
+	}
+
+	now := utils.GetBeijingTime()
+	panelErrors := make(map[uint]string)
+	for i := range userNodes {
+		un := &userNodes[i]
+		node := un.CustomNode
+		var sub models.Subscription
+		s.db.Where("user_id = ?", un.UserID).First(&sub)
+
+		shouldEnable := node.IsActive && un.User.IsActive && !config_update.IsCustomNodeExpired(un.User, sub, node, now)
+		var err error
+		if shouldEnable && un.RemoteStatus != "active" {
+			err = s.setEnabled(un, true)
+		} else if !shouldEnable && un.RemoteClientID != "" && un.RemoteStatus != "disabled" {
+			// 上次禁用失败（error）时也要重试，否则到期用户的远程客户端会一直可用
+			err = s.setEnabled(un, false)
+		}
+		if err != nil {
+			panelErrors[*node.PanelID] = err.Error()
+			continue
+		}
+		if un.RemoteClientID == "" {
+			continue
+		}
+
+		driver, err := s.driverFor(&node)
+		if err != nil || driver == nil {
+			continue
+		}
+		usage, err := driver.GetUsage(un.RemoteClientID, s.buildClient(un, &node, shouldEnable))
+		if err != nil {
+			panelErrors[*node.PanelID] = err.Error()
+			continue
+		}
+		s.db.Model(&models.UserCustomNode{}).Where("id = ?", un.ID).Updates(map[string]interface{}{
+			"upload":          usage.Upload,
+			"download":        usage.Download,
+			"usage_synced_at": now,
+		})
+	}
+
+	for panelID := range s.drivers {
+		s.db.Model(&models.NodePanel{}).Where("id = ?", panelID).Updates(map[string]interface{}{
+			"last_sync_at": now,
+			"last_error":   panelErrors[panelID],
+		})
+	}
+	return nil
+}
+
+// TestPanel 测试面板连接
+func TestPanel(p *models.NodePanel) error {
+	driver, err := DriverForPanel(p)
+	if err != nil {
+		return err
+	}
+	return driver.Login()
+}
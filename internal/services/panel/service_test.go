@@ -0,0 +1,123 @@
+package panel
+
+import (
+	"errors"
+	"testing"
+
+	"cboard-go/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// stubDriver 记录调用，fail 非空时返回该错误
+type stubDriver struct {
+	fail    error
+	updates []*Client
+	deleted []string
+}
+
+func (d *stubDriver) Login() error { return nil }
+
+func (d *stubDriver) AddClient(client *Client) (string, error) {
+	if d.fail != nil {
+		return "", d.fail
+	}
+	return client.Email, nil
+}
+
+func (d *stubDriver) UpdateClient(remoteID string, client *Client) (string, error) {
+	if d.fail != nil {
+		return "", d.fail
+	}
+	d.updates = append(d.updates, client)
+	return remoteID, nil
+}
+
+func (d *stubDriver) GetUsage(remoteID string, client *Client) (*Usage, error) {
+	return &Usage{}, nil
+}
+
+func (d *stubDriver) DeleteClient(remoteID string, client *Client) error {
+	if d.fail != nil {
+		return d.fail
+	}
+	d.deleted = append(d.deleted, remoteID)
+	return nil
+}
+
+func setupService(t *testing.T, driver Driver) (*PanelService, *models.CustomNode) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Subscription{}, &models.NodePanel{},
+		&models.CustomNode{}, &models.UserCustomNode{}); err != nil {
+		t.Fatal(err)
+	}
+	p := models.NodePanel{Name: "panel", Type: TypeXUI, BaseURL: "http://127.0.0.1", IsActive: true}
+	db.Create(&p)
+	node := &models.CustomNode{Name: "hk", Protocol: "vless", PanelID: &p.ID, PanelInbound: "3", IsActive: true}
+	db.Create(node)
+	return &PanelService{db: db, drivers: map[uint]Driver{p.ID: driver}}, node
+}
+
+func TestSyncAllRetriesFailedDisable(t *testing.T) {
+	driver := &stubDriver{fail: errors.New("panel unavailable")}
+	s, node := setupService(t, driver)
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true}
+	s.db.Create(&user)
+	// 账户被禁用后远程客户端应被禁用
+	s.db.Model(&user).Update("is_active", false)
+	un := models.UserCustomNode{UserID: user.ID, CustomNodeID: node.ID, UUID: "u", Password: "p",
+		RemoteClientID: "c1", RemoteStatus: "active"}
+	s.db.Create(&un)
+
+	if err := s.SyncAll(); err != nil {
+		t.Fatal(err)
+	}
+	s.db.First(&un, un.ID)
+	if un.RemoteStatus != "error" {
+		t.Fatalf("failed disable should be recorded, got %q", un.RemoteStatus)
+	}
+
+	driver.fail = nil
+	if err := s.SyncAll(); err != nil {
+		t.Fatal(err)
+	}
+	s.db.First(&un, un.ID)
+	if un.RemoteStatus != "disabled" || len(driver.updates) != 1 || driver.updates[0].Enable {
+		t.Fatalf("disable should be retried after an error, status %q, updates %d", un.RemoteStatus, len(driver.updates))
+	}
+}
+
+func TestRemoveByNodeReportsFailures(t *testing.T) {
+	driver := &stubDriver{fail: errors.New("panel unavailable")}
+	s, node := setupService(t, driver)
+	un := models.UserCustomNode{UserID: 1, CustomNodeID: node.ID, UUID: "u", Password: "p",
+		RemoteClientID: "c1", RemoteStatus: "active"}
+	s.db.Create(&un)
+
+	if err := s.RemoveByNode([]uint{node.ID}); err == nil {
+		t.Fatal("failed remote removal must be reported")
+	}
+
+	// 面板停用时同样不能当作删除成功
+	driver.fail = nil
+	s.db.Model(&models.NodePanel{}).Where("id = ?", *node.PanelID).Update("is_active", false)
+	s.drivers = make(map[uint]Driver)
+	if err := s.RemoveByNode([]uint{node.ID}); err == nil {
+		t.Fatal("inactive panel must not count as removed")
+	}
+
+	s.drivers[*node.PanelID] = driver
+	if err := s.RemoveByNode([]uint{node.ID}); err != nil {
+		t.Fatal(err)
+	}
+	s.db.First(&un, un.ID)
+	if len(driver.deleted) != 1 || un.RemoteClientID != "" {
+		t.Fatalf("remote client should be deleted, deleted %v, remote id %q", driver.deleted, un.RemoteClientID)
+	}
+}
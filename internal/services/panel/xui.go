@@ -0,0 +1,187 @@
+package panel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// XUIDriver 3x-ui 面板驱动
+type XUIDriver struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+	loggedIn bool
+}
+
+type xuiResponse struct {
+	Success bool            `json:"success"`
+	Msg     string          `json:"msg"`
+	Obj     json.RawMessage `json:"obj"`
+}
+
+func (d *XUIDriver) Login() error {
+	form := url.Values{}
+	form.Set("username", d.username)
+	form.Set("password", d.password)
+	resp, err := d.client.PostForm(d.baseURL+"/login", form)
+	if err != nil {
+		return fmt.Errorf("连接面板失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if _, err := d.decode(resp); err != nil {
+		return fmt.Errorf("面板登录失败: %w", err)
+	}
+	d.loggedIn = true
+	return nil
+}
+
+func (d *XUIDriver) AddClient(client *Client) (string, error) {
+	body, err := d.clientPayload(client)
+	if err != nil {
+		return "", err
+	}
+	if _, err := d.post("/panel/api/inbounds/addClient", body); err != nil {
+		return "", err
+	}
+	return d.clientID(client), nil
+}
+
+func (d *XUIDriver) UpdateClient(remoteID string, client *Client) (string, error) {
+	if remoteID == "" {
+		return d.AddClient(client)
+	}
+	body, err := d.clientPayload(client)
+	if err != nil {
+		return "", err
+	}
+	if _, err := d.post("/panel/api/inbounds/updateClient/"+url.PathEscape(remoteID), body); err != nil {
+		return "", err
+	}
+	return d.clientID(client), nil
+}
+
+func (d *XUIDriver) GetUsage(_ string, client *Client) (*Usage, error) {
+	if err := d.ensureLogin(); err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Get(d.baseURL + "/panel/api/inbounds/getClientTraffics/" + url.PathEscape(client.Email))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	obj, err := d.decode(resp)
+	if err != nil {
+		return nil, err
+	}
+	var traffic struct {
+		Up   int64 `json:"up"`
+		Down int64 `json:"down"`
+	}
+	if len(obj) > 0 && string(obj) != "null" {
+		if err := json.Unmarshal(obj, &traffic); err != nil {
+			return nil, fmt.Errorf("解析流量数据失败: %w", err)
+		}
+	}
+	return &Usage{Upload: traffic.Up, Download: traffic.Down}, nil
+}
+
+func (d *XUIDriver) DeleteClient(remoteID string, client *Client) error {
+	inboundID, err := strconv.Atoi(strings.TrimSpace(client.Inbound))
+	if err != nil {
+		return fmt.Errorf("3x-ui 入站ID无效: %s", client.Inbound)
+	}
+	if remoteID == "" {
+		remoteID = d.clientID(client)
+	}
+	_, err = d.post(fmt.Sprintf("/panel/api/inbounds/%d/delClient/%s", inboundID, url.PathEscape(remoteID)), nil)
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "not found") {
+		return nil
+	}
+	return err
+}
+
+// clientID 3x-ui 更新客户端时使用的标识：vless/vmess 为 UUID，trojan 为密码，shadowsocks 为邮箱
+func (d *XUIDriver) clientID(client *Client) string {
+	switch client.Protocol {
+	case "vless", "vmess":
+		return client.UUID
+	case "trojan":
+		return client.Password
+	}
+	return client.Email
+}
+
+func (d *XUIDriver) clientPayload(client *Client) ([]byte, error) {
+	inboundID, err := strconv.Atoi(strings.TrimSpace(client.Inbound))
+	if err != nil {
+		return nil, fmt.Errorf("3x-ui 入站ID无效: %s", client.Inbound)
+	}
+	var expiry int64
+	if client.ExpireAt != nil {
+		expiry = client.ExpireAt.UnixMilli()
+	}
+	c := map[string]interface{}{
+		"email":      client.Email,
+		"enable":     client.Enable,
+		"expiryTime": expiry,
+		"limitIp":    0,
+		"totalGB":    0,
+	}
+	switch client.Protocol {
+	case "vless", "vmess":
+		c["id"] = client.UUID
+	case "trojan", "ss":
+		c["password"] = client.Password
+	default:
+		return nil, fmt.Errorf("3x-ui 不支持的协议: %s", client.Protocol)
+	}
+	settings, _ := json.Marshal(map[string]interface{}{"clients": []interface{}{c}})
+	return json.Marshal(map[string]interface{}{
+		"id":       inboundID,
+		"settings": string(settings),
+	})
+}
+
+func (d *XUIDriver) ensureLogin() error {
+	if d.loggedIn {
+		return nil
+	}
+	return d.Login()
+}
+
+func (d *XUIDriver) post(path string, body []byte) (json.RawMessage, error) {
+	if err := d.ensureLogin(); err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Post(d.baseURL+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return d.decode(resp)
+}
+
+func (d *XUIDriver) decode(resp *http.Response) (json.RawMessage, error) {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("面板返回状态码 %d", resp.StatusCode)
+	}
+	var r xuiResponse
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("解析面板响应失败: %w", err)
+	}
+	if !r.Success {
+		return nil, fmt.Errorf("面板返回错误: %s", r.Msg)
+	}
+	return r.Obj, nil
+}
@@ -0,0 +1,420 @@
+package passkey
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"cboard-go/internal/core/kvstore"
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	PurposeRegister = "register"
+	// PurposeLogin 已通过密码验证的用户使用通行密钥作为第二步
+	PurposeLogin = "login"
+	// PurposePasskey 无密码登录，由验证器返回的 userHandle 确定用户
+	PurposePasskey = "passkey"
+
+	sessionTTL = 5 * time.Minute
+)
+
+var (
+	ErrSessionNotFound = errors.New("验证会话不存在或已过期")
+	ErrNoCredentials   = errors.New("未绑定通行密钥")
+	ErrCloneWarning    = errors.New("通行密钥签名计数异常，可能已被复制")
+)
+
+// RelyingParty 依赖方配置，RPID 为站点域名，Origins 为允许发起验证的页面来源
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// RelyingPartyFromRequest 根据系统域名配置（未配置时使用请求地址）生成依赖方配置
+func RelyingPartyFromRequest(r *http.Request, db *gorm.DB, name string) RelyingParty {
+	base := utils.GetBuildBaseURL(r, db)
+	rp := RelyingParty{Name: name, Origins: []string{base}}
+	if u, err := url.Parse(base); err == nil {
+		rp.ID = u.Hostname()
+	}
+	// 前端与 API 端口不同（开发环境）时，同域名下的页面来源同样允许
+	if origin := r.Header.Get("Origin"); origin != "" && origin != base {
+		if u, err := url.Parse(origin); err == nil && rp.ID != "" &&
+			(u.Hostname() == rp.ID || strings.HasSuffix(u.Hostname(), "."+rp.ID)) {
+			rp.Origins = append(rp.Origins, origin)
+		}
+	}
+	return rp
+}
+
+type session struct {
+	Data    webauthn.SessionData `json:"data"`
+	UserID  uint                 `json:"user_id"`
+	Purpose string               `json:"purpose"`
+}
+
+// 验证会话保存在 kvstore 中，多实例部署时 begin/finish 可以落到不同实例；
+// 有效期 5 分钟，且只能使用一次
+func sessionKey(id string) string {
+	return "passkey:session:" + id
+}
+
+func putSession(s *session) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	if err := kvstore.Default().Set(sessionKey(id), string(data), sessionTTL); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func takeSession(id, purpose string) (*session, error) {
+	if id == "" {
+		return nil, ErrSessionNotFound
+	}
+	data, ok, err := kvstore.Take(kvstore.Default(), sessionKey(id))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	var s session
+	if err := json.Unmarshal([]byte(data), &s); err != nil || s.Purpose != purpose {
+		return nil, ErrSessionNotFound
+	}
+	return &s, nil
+}
+
+// UserHandle 用户在验证器中的标识，使用用户 ID 的大端编码
+func UserHandle(userID uint) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(userID))
+	return b
+}
+
+func userIDFromHandle(handle []byte) (uint, bool) {
+	if len(handle) != 8 {
+		return 0, false
+	}
+	return uint(binary.BigEndian.Uint64(handle)), true
+}
+
+// EncodeCredentialID 凭据 ID 以 base64url 保存
+func EncodeCredentialID(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+type waUser struct {
+	user  *models.User
+	creds []models.WebAuthnCredential
+}
+
+func (u *waUser) WebAuthnID() []byte {
+	return UserHandle(u.user.ID)
+}
+
+func (u *waUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *waUser) WebAuthnDisplayName() string {
+	if u.user.Nickname.Valid && u.user.Nickname.String != "" {
+		return u.user.Nickname.String
+	}
+	return u.user.Username
+}
+
+func (u *waUser) WebAuthnCredentials() []webauthn.Credential {
+	list := make([]webauthn.Credential, 0, len(u.creds))
+	for _, c := range u.creds {
+		list = append(list, toCredential(c))
+	}
+	return list
+}
+
+func toCredential(c models.WebAuthnCredential) webauthn.Credential {
+	id, _ := base64.RawURLEncoding.DecodeString(c.CredentialID)
+	var aaguid []byte
+	if u, err := uuid.Parse(c.AAGUID); err == nil {
+		aaguid = u[:]
+	}
+	var transports []protocol.AuthenticatorTransport
+	for _, t := range strings.Split(c.Transports, ",") {
+		if t != "" {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+	}
+	return webauthn.Credential{
+		ID:              id,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		Transport:       transports,
+		Flags:           webauthn.NewCredentialFlags(protocol.AuthenticatorFlags(c.Flags)),
+		Authenticator: webauthn.Authenticator{
+			AAGUID:       aaguid,
+			SignCount:    c.SignCount,
+			CloneWarning: c.CloneWarning,
+		},
+	}
+}
+
+type Service struct {
+	db *gorm.DB
+	wa *webauthn.WebAuthn
+}
+
+func NewService(db *gorm.DB, rp RelyingParty) (*Service, error) {
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          rp.ID,
+		RPDisplayName: rp.Name,
+		RPOrigins:     rp.Origins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: sessionTTL, TimeoutUVD: sessionTTL},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: sessionTTL, TimeoutUVD: sessionTTL},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("WebAuthn 配置错误: %w", err)
+	}
+	return &Service{db: db, wa: wa}, nil
+}
+
+// ListCredentials 获取用户绑定的通行密钥
+func ListCredentials(db *gorm.DB, userID uint) ([]models.WebAuthnCredential, error) {
+	var creds []models.WebAuthnCredential
+	err := db.Where("user_id = ?", userID).Order("id ASC").Find(&creds).Error
+	return creds, err
+}
+
+// CountCredentials 用户绑定的通行密钥数量
+func CountCredentials(db *gorm.DB, userID uint) int64 {
+	var n int64
+	db.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&n)
+	return n
+}
+
+func (s *Service) loadUser(user *models.User) (*waUser, error) {
+	creds, err := ListCredentials(s.db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &waUser{user: user, creds: creds}, nil
+}
+
+// BeginRegistration 开始绑定通行密钥，已绑定的验证器不会重复注册
+func (s *Service) BeginRegistration(user *models.User) (*protocol.CredentialCreation, string, error) {
+	u, err := s.loadUser(user)
+	if err != nil {
+		return nil, "", err
+	}
+	creation, data, err := s.wa.BeginRegistration(u,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+		webauthn.WithExclusions(webauthn.Credentials(u.WebAuthnCredentials()).CredentialDescriptors()),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := putSession(&session{Data: *data, UserID: user.ID, Purpose: PurposeRegister})
+	return creation, id, err
+}
+
+// FinishRegistration 校验验证器返回的注册数据并保存凭据
+func (s *Service) FinishRegistration(user *models.User, sessionID, name string, body []byte) (*models.WebAuthnCredential, error) {
+	sess, err := takeSession(sessionID, PurposeRegister)
+	if err != nil {
+		return nil, err
+	}
+	if sess.UserID != user.ID {
+		return nil, ErrSessionNotFound
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.loadUser(user)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := s.wa.CreateCredential(u, sess.Data, parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	transports := make([]string, 0, len(cred.Transport))
+	for _, t := range cred.Transport {
+		transports = append(transports, string(t))
+	}
+	aaguid := ""
+	if a, err := uuid.FromBytes(cred.Authenticator.AAGUID); err == nil {
+		aaguid = a.String()
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = fmt.Sprintf("通行密钥 %d", len(u.creds)+1)
+	}
+	record := &models.WebAuthnCredential{
+		UserID:          user.ID,
+		Name:            name,
+		CredentialID:    EncodeCredentialID(cred.ID),
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		AAGUID:          aaguid,
+		SignCount:       cred.Authenticator.SignCount,
+		Flags:           uint8(cred.Flags.ProtocolValue()),
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+		Transports:      strings.Join(transports, ","),
+	}
+	if err := s.db.Create(record).Error; err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// BeginLogin 为指定用户发起验证（用作第二步验证）
+func (s *Service) BeginLogin(user *models.User) (*protocol.CredentialAssertion, string, error) {
+	u, err := s.loadUser(user)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(u.creds) == 0 {
+		return nil, "", ErrNoCredentials
+	}
+	assertion, data, err := s.wa.BeginLogin(u)
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := putSession(&session{Data: *data, UserID: user.ID, Purpose: PurposeLogin})
+	return assertion, id, err
+}
+
+// FinishLogin 校验指定用户的验证结果
+func (s *Service) FinishLogin(user *models.User, sessionID string, body []byte) (*models.WebAuthnCredential, error) {
+	sess, err := takeSession(sessionID, PurposeLogin)
+	if err != nil {
+		return nil, err
+	}
+	if sess.UserID != user.ID {
+		return nil, ErrSessionNotFound
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.loadUser(user)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := s.wa.ValidateLogin(u, sess.Data, parsed)
+	if err != nil {
+		return nil, err
+	}
+	return s.markUsed(u, cred)
+}
+
+// BeginPasskeyLogin 发起无密码登录，要求验证器完成用户验证（指纹、PIN 等）
+func (s *Service) BeginPasskeyLogin() (*protocol.CredentialAssertion, string, error) {
+	assertion, data, err := s.wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := putSession(&session{Data: *data, Purpose: PurposePasskey})
+	return assertion, id, err
+}
+
+// FinishPasskeyLogin 校验无密码登录结果，返回对应用户
+func (s *Service) FinishPasskeyLogin(sessionID string, body []byte) (*models.User, *models.WebAuthnCredential, error) {
+	sess, err := takeSession(sessionID, PurposePasskey)
+	if err != nil {
+		return nil, nil, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	var found *waUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, ok := userIDFromHandle(userHandle)
+		if !ok {
+			return nil, errors.New("无效的用户标识")
+		}
+		var user models.User
+		if err := s.db.First(&user, userID).Error; err != nil {
+			return nil, err
+		}
+		u, err := s.loadUser(&user)
+		if err != nil {
+			return nil, err
+		}
+		found = u
+		return u, nil
+	}
+	_, cred, err := s.wa.ValidatePasskeyLogin(handler, sess.Data, parsed)
+	if err != nil {
+		return nil, nil, err
+	}
+	record, err := s.markUsed(found, cred)
+	if err != nil {
+		if errors.Is(err, ErrCloneWarning) {
+			return found.user, record, err
+		}
+		return nil, nil, err
+	}
+	return found.user, record, nil
+}
+
+// markUsed 更新签名计数与最后使用时间；签名计数回退视为凭据被复制，拒绝本次验证
+func (s *Service) markUsed(u *waUser, cred *webauthn.Credential) (*models.WebAuthnCredential, error) {
+	id := EncodeCredentialID(cred.ID)
+	var record *models.WebAuthnCredential
+	for i := range u.creds {
+		if u.creds[i].CredentialID == id {
+			record = &u.creds[i]
+			break
+		}
+	}
+	if record == nil {
+		return nil, ErrNoCredentials
+	}
+	if cred.Authenticator.CloneWarning {
+		s.db.Model(record).Update("clone_warning", true)
+		record.CloneWarning = true
+		return record, ErrCloneWarning
+	}
+	now := utils.GetBeijingTime()
+	record.SignCount = cred.Authenticator.SignCount
+	record.BackupState = cred.Flags.BackupState
+	record.LastUsedAt = &now
+	if err := s.db.Model(record).Updates(map[string]interface{}{
+		"sign_count":   record.SignCount,
+		"backup_state": record.BackupState,
+		"last_used_at": now,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return record, nil
+}
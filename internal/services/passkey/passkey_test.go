@@ -0,0 +1,263 @@
+package passkey
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"cboard-go/internal/models"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+
+	flagUP = 0x01
+	flagUV = 0x04
+	flagAT = 0x40
+)
+
+var b64 = base64.RawURLEncoding
+
+// softAuthenticator 软件实现的验证器：ES256 密钥，attestation 格式为 none
+type softAuthenticator struct {
+	key        *ecdsa.PrivateKey
+	credID     []byte
+	userHandle []byte
+	counter    uint32
+	origin     string
+	uv         bool
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{key: key, credID: id, origin: testOrigin, uv: true}
+}
+
+func (a *softAuthenticator) flags() byte {
+	f := byte(flagUP)
+	if a.uv {
+		f |= flagUV
+	}
+	return f
+}
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpHash := sha256.Sum256([]byte(testRPID))
+	data := append([]byte{}, rpHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	return append(data, attested...)
+}
+
+func (a *softAuthenticator) clientData(typ string, challenge protocol.URLEncodedBase64) []byte {
+	b, _ := json.Marshal(map[string]interface{}{
+		"type":      typ,
+		"challenge": challenge.String(),
+		"origin":    a.origin,
+	})
+	return b
+}
+
+func (a *softAuthenticator) create(t *testing.T, creation *protocol.CredentialCreation) []byte {
+	t.Helper()
+	a.userHandle = creation.Response.User.ID.(protocol.URLEncodedBase64)
+	x := a.key.X.FillBytes(make([]byte, 32))
+	y := a.key.Y.FillBytes(make([]byte, 32))
+	coseKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         1,
+		XCoord:        x,
+		YCoord:        y,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attested := make([]byte, 16) // AAGUID 全零
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credID)))
+	attested = append(attested, a.credID...)
+	attested = append(attested, coseKey...)
+
+	attObj, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(a.flags()|flagAT, attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.credID),
+		"rawId": b64.EncodeToString(a.credID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64.EncodeToString(a.clientData("webauthn.create", creation.Response.Challenge)),
+			"attestationObject": b64.EncodeToString(attObj),
+			"transports":        []string{"internal"},
+		},
+	})
+	return body
+}
+
+func (a *softAuthenticator) get(t *testing.T, assertion *protocol.CredentialAssertion) []byte {
+	t.Helper()
+	a.counter++
+	authData := a.authData(a.flags(), nil)
+	clientData := a.clientData("webauthn.get", assertion.Response.Challenge)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.credID),
+		"rawId": b64.EncodeToString(a.credID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64.EncodeToString(clientData),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(sig),
+			"userHandle":        b64.EncodeToString(a.userHandle),
+		},
+	})
+	return body
+}
+
+func newTestService(t *testing.T) (*Service, *models.User) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.WebAuthnCredential{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: "x"}
+	db.Create(&user)
+	svc, err := NewService(db, RelyingParty{ID: testRPID, Name: "CBoard", Origins: []string{testOrigin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc, &user
+}
+
+func register(t *testing.T, svc *Service, user *models.User, a *softAuthenticator, name string) *models.WebAuthnCredential {
+	t.Helper()
+	creation, sessionID, err := svc.BeginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := svc.FinishRegistration(user, sessionID, name, a.create(t, creation))
+	if err != nil {
+		t.Fatalf("registration failed: %v", err)
+	}
+	return cred
+}
+
+func TestRegistrationAndSecondFactor(t *testing.T) {
+	svc, user := newTestService(t)
+	a := newSoftAuthenticator(t)
+	cred := register(t, svc, user, a, "  笔记本  ")
+	if cred.Name != "笔记本" || cred.CredentialID != EncodeCredentialID(a.credID) || cred.Transports != "internal" {
+		t.Fatalf("unexpected credential record %+v", cred)
+	}
+
+	// 第二个验证器，未命名时使用默认名称
+	second := register(t, svc, user, newSoftAuthenticator(t), "")
+	if second.Name != "通行密钥 2" {
+		t.Errorf("default name = %q", second.Name)
+	}
+	if n := CountCredentials(svc.db, user.ID); n != 2 {
+		t.Fatalf("expected 2 credentials, got %d", n)
+	}
+
+	assertion, sessionID, err := svc.BeginLogin(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assertion.Response.AllowedCredentials) != 2 {
+		t.Errorf("allowCredentials should list both authenticators")
+	}
+	body := a.get(t, assertion)
+	used, err := svc.FinishLogin(user, sessionID, body)
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if used.ID != cred.ID || used.SignCount != 1 || used.LastUsedAt == nil {
+		t.Fatalf("credential not updated: %+v", used)
+	}
+
+	// 会话只能使用一次
+	if _, err := svc.FinishLogin(user, sessionID, body); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("replayed session should be rejected, got %v", err)
+	}
+}
+
+func TestPasswordlessLogin(t *testing.T) {
+	svc, user := newTestService(t)
+	a := newSoftAuthenticator(t)
+	register(t, svc, user, a, "手机")
+
+	assertion, sessionID, err := svc.BeginPasskeyLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, cred, err := svc.FinishPasskeyLogin(sessionID, a.get(t, assertion))
+	if err != nil {
+		t.Fatalf("passkey login failed: %v", err)
+	}
+	if got.ID != user.ID || cred.Name != "手机" {
+		t.Fatalf("unexpected user %d / credential %s", got.ID, cred.Name)
+	}
+
+	// 无密码登录必须完成用户验证
+	a.uv = false
+	assertion, sessionID, _ = svc.BeginPasskeyLogin()
+	if _, _, err := svc.FinishPasskeyLogin(sessionID, a.get(t, assertion)); err == nil {
+		t.Fatal("assertion without user verification must be rejected")
+	}
+}
+
+func TestRejectsWrongOriginAndClonedCounter(t *testing.T) {
+	svc, user := newTestService(t)
+	a := newSoftAuthenticator(t)
+	register(t, svc, user, a, "")
+
+	a.origin = "https://evil.example.net"
+	assertion, sessionID, _ := svc.BeginLogin(user)
+	if _, err := svc.FinishLogin(user, sessionID, a.get(t, assertion)); err == nil {
+		t.Fatal("assertion from a foreign origin must be rejected")
+	}
+
+	a.origin = testOrigin
+	a.counter = 10
+	assertion, sessionID, _ = svc.BeginLogin(user)
+	if _, err := svc.FinishLogin(user, sessionID, a.get(t, assertion)); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	a.counter = 3
+	assertion, sessionID, _ = svc.BeginLogin(user)
+	if _, err := svc.FinishLogin(user, sessionID, a.get(t, assertion)); !errors.Is(err, ErrCloneWarning) {
+		t.Fatalf("counter rollback should raise clone warning, got %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package privacy
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/panel"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// DefaultCoolingOffDays 注销申请默认冷静期
+const DefaultCoolingOffDays = 7
+
+// ErrAdminAccount 管理员账号不能自助注销
+var ErrAdminAccount = errors.New("管理员账号不能自助注销，请联系其他管理员处理")
+
+// CoolingOffDays 读取 security.account_deletion_cooling_days，最少 1 天
+func CoolingOffDays(db *gorm.DB) int {
+	var config models.SystemConfig
+	if err := db.Where("category = ? AND key = ?", "security", "account_deletion_cooling_days").First(&config).Error; err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(config.Value)); err == nil && n >= 1 {
+			return n
+		}
+	}
+	return DefaultCoolingOffDays
+}
+
+// DeletedAccount 已注销账号在匿名化之前的联系信息，用于发送确认邮件
+type DeletedAccount struct {
+	UserID   uint
+	Username string
+	Email    string
+}
+
+// 删除远程面板上的专线客户端，任一失败时返回错误，测试时可替换
+var disableRemoteClients = func(db *gorm.DB, userID uint) error {
+	var userNodes []models.UserCustomNode
+	if err := db.Where("user_id = ? AND remote_client_id != ?", userID, "").Find(&userNodes).Error; err != nil {
+		return err
+	}
+	if len(userNodes) == 0 {
+		return nil
+	}
+	panelService := panel.NewPanelService()
+	var failed int
+	var lastErr error
+	for i := range userNodes {
+		if err := panelService.Remove(&userNodes[i]); err != nil {
+			utils.LogWarn("注销账号时删除远程客户端失败: assignment=%d, %v", userNodes[i].ID, err)
+			failed++
+			lastErr = err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个远程客户端删除失败: %w", failed, lastErr)
+	}
+	return nil
+}
+
+// Anonymize 注销账号：删除个人数据，订单、支付、充值等财务记录保留但去除个人信息，
+// 用户记录改为不可登录的匿名占位，保证财务记录的关联不失效。
+// 审计日志受哈希链保护，不做修改，按审计日志的保留策略归档
+func Anonymize(db *gorm.DB, userID uint) (*DeletedAccount, error) {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.IsAdmin {
+		return nil, ErrAdminAccount
+	}
+	account := &DeletedAccount{UserID: user.ID, Username: user.Username, Email: user.Email}
+
+	// 远程客户端删除失败时不匿名化，申请保持待处理，下次任务重试
+	if err := disableRemoteClients(db, user.ID); err != nil {
+		return nil, err
+	}
+
+	var exports []models.DataExport
+	db.Where("user_id = ?", user.ID).Find(&exports)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		byUser := []interface{}{
+			&models.SubscriptionReset{}, &models.SubscriptionFetch{}, &models.SharingScore{},
+			&models.UserCustomNode{}, &models.LoginHistory{}, &models.UserActivity{},
+			&models.PasswordHistory{}, &models.Notification{}, &models.TicketRead{},
+			&models.RecoveryCode{}, &models.WebAuthnCredential{}, &models.OAuthIdentity{},
+			&models.UserSession{}, &models.APIKey{}, &models.LoginRiskEvent{},
+			&models.DataExport{},
+		}
+		steps := []*gorm.DB{
+			tx.Where("user_id = ? OR subscription_id IN (SELECT id FROM subscriptions WHERE user_id = ?)", user.ID, user.ID).
+				Delete(&models.Device{}),
+			tx.Where("user_id = ?", user.ID).Delete(&models.Subscription{}),
+			tx.Where("ticket_id IN (SELECT id FROM tickets WHERE user_id = ?)", user.ID).Delete(&models.TicketAttachment{}),
+			tx.Where("ticket_id IN (SELECT id FROM tickets WHERE user_id = ?)", user.ID).Delete(&models.TicketReply{}),
+			tx.Where("user_id = ?", user.ID).Delete(&models.Ticket{}),
+			tx.Where("user_id = ? AND used_count = 0", user.ID).Delete(&models.InviteCode{}),
+			tx.Model(&models.InviteCode{}).Where("user_id = ?", user.ID).Update("is_active", false),
+			tx.Where("username IN ?", []string{user.Username, user.Email}).Delete(&models.LoginAttempt{}),
+			tx.Where("email = ?", user.Email).Delete(&models.VerificationCode{}),
+			tx.Where("to_email = ?", user.Email).Delete(&models.EmailQueue{}),
+			tx.Model(&models.RechargeRecord{}).Where("user_id = ?", user.ID).Updates(map[string]interface{}{
+				"ip_address": nil, "user_agent": nil, "payment_url": nil, "payment_qr_code": nil,
+			}),
+			// 支付回调原文包含付款账号（如支付宝 buyer_logon_id）
+			tx.Model(&models.PaymentCallback{}).
+				Where("payment_transaction_id IN (SELECT id FROM payment_transactions WHERE user_id = ?)", user.ID).
+				Updates(map[string]interface{}{"callback_data": "{}", "raw_request": nil}),
+			tx.Model(&models.PaymentTransaction{}).Where("user_id = ?", user.ID).Update("callback_data", nil),
+		}
+		if configs := userConfigs(tx, user.ID); len(configs) > 0 {
+			steps = append(steps, tx.Delete(&configs))
+		}
+		for _, model := range byUser {
+			steps = append(steps, tx.Where("user_id = ?", user.ID).Delete(model))
+		}
+		for _, step := range steps {
+			if step.Error != nil {
+				return step.Error
+			}
+		}
+
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"username":             fmt.Sprintf("deleted_%d", user.ID),
+			"email":                fmt.Sprintf("deleted_%d@deleted.invalid", user.ID),
+			"password":             "",
+			"is_active":            false,
+			"is_verified":          false,
+			"nickname":             sql.NullString{},
+			"avatar":               sql.NullString{},
+			"verification_token":   sql.NullString{},
+			"verification_expires": sql.NullTime{},
+			"reset_token":          sql.NullString{},
+			"reset_expires":        sql.NullTime{},
+			"two_factor_enabled":   false,
+			"totp_secret":          sql.NullString{},
+			"totp_pending_secret":  sql.NullString{},
+			"notification_types":   "",
+			"email_notifications":  false,
+			"data_sharing":         false,
+			"analytics":            false,
+			"invite_code_used":     sql.NullString{},
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range exports {
+		removeExportFile(&exports[i])
+	}
+	return account, nil
+}
+
+// ProcessDueDeletions 执行冷静期已结束的注销申请
+func ProcessDueDeletions(db *gorm.DB, now time.Time) []DeletedAccount {
+	var requests []models.AccountDeletionRequest
+	if err := db.Where("status = ? AND scheduled_at <= ?", models.DeletionPending, now).Find(&requests).Error; err != nil {
+		utils.LogErrorMsg("查询到期的注销申请失败: %v", err)
+		return nil
+	}
+
+	var deleted []DeletedAccount
+	for _, req := range requests {
+		account, err := Anonymize(db, req.UserID)
+		if err != nil {
+			utils.LogErrorMsg("执行注销申请失败: request=%d user=%d, %v", req.ID, req.UserID, err)
+			continue
+		}
+		db.Model(&models.AccountDeletionRequest{}).Where("id = ?", req.ID).
+			Updates(map[string]interface{}{"status": models.DeletionCompleted, "completed_at": now, "reason": ""})
+		deleted = append(deleted, *account)
+	}
+	return deleted
+}
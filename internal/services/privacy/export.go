@@ -0,0 +1,375 @@
+package privacy
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// ExportTTL 导出文件的下载有效期
+const ExportTTL = 7 * 24 * time.Hour
+
+// exportTimeout 超过该时间仍未完成的导出视为失败（如服务重启中断）
+const exportTimeout = time.Hour
+
+// ErrExportNotFound 下载链接无效或已过期
+var ErrExportNotFound = errors.New("下载链接无效或已过期")
+
+var (
+	exportMu  sync.RWMutex
+	exportDir string
+)
+
+// SetExportDir 设置导出文件目录
+func SetExportDir(dir string) {
+	exportMu.Lock()
+	exportDir = dir
+	exportMu.Unlock()
+}
+
+// ExportDir 当前导出目录
+func ExportDir() string {
+	exportMu.RLock()
+	defer exportMu.RUnlock()
+	return exportDir
+}
+
+// section 导出包中的一类数据，single 为 true 时 JSON 输出单个对象
+type section struct {
+	name    string
+	records []map[string]interface{}
+	single  bool
+}
+
+// normalize 将 sql.NullXxx 序列化出的 {"String": "", "Valid": false} 展开为值或 null
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if valid, ok := x["Valid"].(bool); ok && len(x) == 2 {
+			if !valid {
+				return nil
+			}
+			for k, inner := range x {
+				if k != "Valid" {
+					return normalize(inner)
+				}
+			}
+		}
+		for k, inner := range x {
+			x[k] = normalize(inner)
+		}
+	case []interface{}:
+		for i := range x {
+			x[i] = normalize(x[i])
+		}
+	}
+	return v
+}
+
+// toRecords 按模型的 JSON 字段导出，omit 中的字段（内部备注、网关原始数据等）不导出
+func toRecords(rows interface{}, omit ...string) ([]map[string]interface{}, error) {
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return nil, err
+	}
+	var records []map[string]interface{}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		for _, k := range omit {
+			delete(r, k)
+		}
+		normalize(r)
+	}
+	if records == nil {
+		records = []map[string]interface{}{}
+	}
+	return records, nil
+}
+
+// userConfigs 用户个人设置（保存在 system_configs 中，key 为 user_<id>_xxx）
+func userConfigs(db *gorm.DB, userID uint) []models.SystemConfig {
+	prefix := fmt.Sprintf("user_%d_", userID)
+	var configs, matched []models.SystemConfig
+	db.Where("key LIKE ?", prefix+"%").Find(&configs)
+	// LIKE 中的下划线是通配符，user_1_% 也会匹配 user_12_xxx
+	for _, c := range configs {
+		if strings.HasPrefix(c.Key, prefix) {
+			matched = append(matched, c)
+		}
+	}
+	return matched
+}
+
+func collect(db *gorm.DB, userID uint) ([]section, error) {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var (
+		subscriptions []models.Subscription
+		orders        []models.Order
+		payments      []models.PaymentTransaction
+		recharges     []models.RechargeRecord
+		devices       []models.Device
+		logins        []models.LoginHistory
+		activities    []models.UserActivity
+		tickets       []models.Ticket
+		replies       []models.TicketReply
+		notifications []models.Notification
+	)
+	queries := []*gorm.DB{
+		db.Where("user_id = ?", userID).Order("id ASC").Find(&subscriptions),
+		db.Where("user_id = ?", userID).Order("id ASC").Find(&orders),
+		db.Where("user_id = ?", userID).Order("id ASC").Find(&payments),
+		db.Where("user_id = ?", userID).Order("id ASC").Find(&recharges),
+		db.Where("user_id = ? OR subscription_id IN (SELECT id FROM subscriptions WHERE user_id = ?)", userID, userID).
+			Order("id ASC").Find(&devices),
+		db.Where("user_id = ?", userID).Order("id ASC").Find(&logins),
+		db.Where("user_id = ?", userID).Order("id ASC").Find(&activities),
+		db.Where("user_id = ?", userID).Order("id ASC").Find(&tickets),
+		db.Where("ticket_id IN (SELECT id FROM tickets WHERE user_id = ?)", userID).Order("id ASC").Find(&replies),
+		db.Where("user_id = ?", userID).Order("id ASC").Find(&notifications),
+	}
+	for _, q := range queries {
+		if q.Error != nil {
+			return nil, q.Error
+		}
+	}
+
+	prefix := fmt.Sprintf("user_%d_", userID)
+	settings := []map[string]interface{}{}
+	for _, c := range userConfigs(db, userID) {
+		settings = append(settings, map[string]interface{}{
+			"category": c.Category, "key": strings.TrimPrefix(c.Key, prefix), "value": c.Value,
+		})
+	}
+
+	sections := []section{{name: "settings", records: settings}}
+	for _, s := range []struct {
+		name   string
+		rows   interface{}
+		omit   []string
+		single bool
+	}{
+		{name: "profile", rows: []models.User{user}, single: true},
+		{name: "subscriptions", rows: subscriptions},
+		{name: "orders", rows: orders},
+		{name: "payments", rows: payments, omit: []string{"callback_data"}},
+		{name: "recharge_records", rows: recharges},
+		{name: "devices", rows: devices},
+		{name: "login_history", rows: logins},
+		{name: "activities", rows: activities},
+		{name: "tickets", rows: tickets, omit: []string{"admin_notes"}},
+		{name: "ticket_replies", rows: replies},
+		{name: "notifications", rows: notifications},
+	} {
+		records, err := toRecords(s.rows, s.omit...)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, section{name: s.name, records: records, single: s.single})
+	}
+	return sections, nil
+}
+
+func csvValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(x)
+	default:
+		data, _ := json.Marshal(x)
+		return string(data)
+	}
+}
+
+func writeCSV(w *zip.Writer, s section) error {
+	columnSet := make(map[string]bool)
+	for _, r := range s.records {
+		for k := range r {
+			columnSet[k] = true
+		}
+	}
+	columns := make([]string, 0, len(columnSet))
+	for k := range columnSet {
+		columns = append(columns, k)
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		if (columns[i] == "id") != (columns[j] == "id") {
+			return columns[i] == "id"
+		}
+		return columns[i] < columns[j]
+	})
+
+	f, err := w.Create(s.name + ".csv")
+	if err != nil {
+		return err
+	}
+	// 带 BOM，Excel 打开中文不乱码
+	if _, err := f.Write([]byte("\xEF\xBB\xBF")); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	for _, r := range s.records {
+		row := make([]string, len(columns))
+		for i, k := range columns {
+			row[i] = csvValue(r[k])
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeArchive(path string, sections []section) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := zip.NewWriter(file)
+	for _, s := range sections {
+		var payload interface{} = s.records
+		if s.single && len(s.records) == 1 {
+			payload = s.records[0]
+		}
+		data, err := json.MarshalIndent(payload, "", "  ")
+		if err != nil {
+			return err
+		}
+		f, err := w.Create(s.name + ".json")
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			return err
+		}
+		if err := writeCSV(w, s); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func failExport(db *gorm.DB, export *models.DataExport, err error) error {
+	msg := err.Error()
+	if len(msg) > 255 {
+		msg = msg[:255]
+	}
+	db.Model(export).Updates(map[string]interface{}{"status": models.DataExportFailed, "error": msg})
+	return err
+}
+
+// BuildExport 生成导出包并返回下载令牌，数据库中只保存令牌哈希
+func BuildExport(db *gorm.DB, export *models.DataExport) (string, error) {
+	dir := ExportDir()
+	if dir == "" {
+		return "", failExport(db, export, fmt.Errorf("未配置数据导出目录"))
+	}
+	db.Model(export).Update("status", models.DataExportProcessing)
+
+	sections, err := collect(db, export.UserID)
+	if err != nil {
+		return "", failExport(db, export, fmt.Errorf("读取用户数据失败: %w", err))
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", failExport(db, export, fmt.Errorf("创建导出目录失败: %w", err))
+	}
+	name := fmt.Sprintf("export-%d-%s-%d.zip", export.UserID, time.Now().Format("20060102-150405"), export.ID)
+	path := filepath.Join(dir, name)
+	if err := writeArchive(path, sections); err != nil {
+		os.Remove(path)
+		return "", failExport(db, export, fmt.Errorf("写入导出文件失败: %w", err))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", failExport(db, export, err)
+	}
+
+	token := utils.GenerateSubscriptionURL()
+	hash := utils.HashToken(token)
+	now := utils.GetBeijingTime()
+	expiresAt := now.Add(ExportTTL)
+	if err := db.Model(export).Updates(map[string]interface{}{
+		"status":       models.DataExportReady,
+		"file_name":    name,
+		"file_size":    info.Size(),
+		"token_hash":   hash,
+		"expires_at":   expiresAt,
+		"completed_at": now,
+	}).Error; err != nil {
+		os.Remove(path)
+		return "", failExport(db, export, err)
+	}
+	export.Status, export.FileName, export.FileSize = models.DataExportReady, name, info.Size()
+	export.TokenHash, export.ExpiresAt, export.CompletedAt = &hash, &expiresAt, &now
+	return token, nil
+}
+
+// FindDownload 根据下载令牌查找导出记录与文件路径
+func FindDownload(db *gorm.DB, token string) (*models.DataExport, string, error) {
+	var export models.DataExport
+	if token == "" || db.Where("token_hash = ? AND status = ? AND expires_at > ?",
+		utils.HashToken(token), models.DataExportReady, utils.GetBeijingTime()).First(&export).Error != nil {
+		return nil, "", ErrExportNotFound
+	}
+	path := filepath.Join(ExportDir(), filepath.Base(export.FileName))
+	if _, err := os.Stat(path); err != nil {
+		return nil, "", ErrExportNotFound
+	}
+	return &export, path, nil
+}
+
+func removeExportFile(export *models.DataExport) {
+	if export.FileName == "" || ExportDir() == "" {
+		return
+	}
+	path := filepath.Join(ExportDir(), filepath.Base(export.FileName))
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		utils.LogWarn("删除导出文件失败: %s, %v", path, err)
+	}
+}
+
+// CleanupExports 删除过期的导出文件，并将长时间未完成的导出标记为失败
+func CleanupExports(db *gorm.DB, now time.Time) {
+	var expired []models.DataExport
+	db.Where("status = ? AND expires_at < ?", models.DataExportReady, now).Find(&expired)
+	for i := range expired {
+		removeExportFile(&expired[i])
+		db.Model(&expired[i]).Updates(map[string]interface{}{"status": models.DataExportExpired, "token_hash": nil})
+	}
+	db.Model(&models.DataExport{}).
+		Where("status IN ? AND created_at < ?", []string{models.DataExportPending, models.DataExportProcessing}, now.Add(-exportTimeout)).
+		Updates(map[string]interface{}{"status": models.DataExportFailed, "error": "导出超时"})
+}
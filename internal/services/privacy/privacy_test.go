@@ -0,0 +1,265 @@
+package privacy
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(
+		&models.User{}, &models.Subscription{}, &models.Device{}, &models.SubscriptionReset{},
+		&models.SubscriptionFetch{}, &models.SharingScore{}, &models.UserCustomNode{},
+		&models.Order{}, &models.PaymentTransaction{}, &models.PaymentCallback{}, &models.RechargeRecord{},
+		&models.LoginHistory{}, &models.UserActivity{}, &models.PasswordHistory{},
+		&models.Ticket{}, &models.TicketReply{}, &models.TicketAttachment{}, &models.TicketRead{},
+		&models.Notification{}, &models.InviteCode{}, &models.SystemConfig{}, &models.LoginAttempt{},
+		&models.VerificationCode{}, &models.EmailQueue{}, &models.RecoveryCode{},
+		&models.WebAuthnCredential{}, &models.OAuthIdentity{}, &models.UserSession{},
+		&models.APIKey{}, &models.LoginRiskEvent{}, &models.DataExport{}, &models.AccountDeletionRequest{},
+	); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func seedUser(t *testing.T, db *gorm.DB, name string) *models.User {
+	user := &models.User{Username: name, Email: name + "@example.com", Password: "hash", IsActive: true,
+		Nickname: sql.NullString{String: "昵称", Valid: true}}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	sub := models.Subscription{UserID: user.ID, SubscriptionURL: "sub-" + name, ExpireTime: time.Now().Add(time.Hour)}
+	db.Create(&sub)
+	db.Create(&models.Device{SubscriptionID: sub.ID, DeviceFingerprint: "fp-" + name})
+	db.Create(&models.Order{OrderNo: "order-" + name, UserID: user.ID, PackageID: 1, Amount: 10, Status: "paid"})
+	txn := models.PaymentTransaction{OrderID: 1, UserID: user.ID, PaymentMethodID: 1, Amount: 1000,
+		CallbackData: sql.NullString{String: `{"sign":"x","buyer_logon_id":"` + name + `@alipay"}`, Valid: true}}
+	db.Create(&txn)
+	db.Create(&models.PaymentCallback{PaymentTransactionID: txn.ID, CallbackType: "notify",
+		CallbackData: `{"buyer_logon_id":"` + name + `@alipay"}`, RawRequest: sql.NullString{String: "buyer_logon_id=" + name, Valid: true}})
+	db.Create(&models.RechargeRecord{UserID: user.ID, OrderNo: "recharge-" + name, Amount: 5,
+		IPAddress: sql.NullString{String: "1.2.3.4", Valid: true}})
+	db.Create(&models.LoginHistory{UserID: user.ID, IPAddress: sql.NullString{String: "1.2.3.4", Valid: true}})
+	ticket := models.Ticket{TicketNo: "T-" + name, UserID: user.ID, Title: "工单", Content: "内容", AdminNotes: strPtr("内部备注")}
+	db.Create(&ticket)
+	db.Create(&models.TicketReply{TicketID: ticket.ID, UserID: user.ID, Content: "回复"})
+	db.Create(&models.Notification{UserID: sql.NullInt64{Int64: int64(user.ID), Valid: true}, Title: "通知", Content: "内容"})
+	return user
+}
+
+func strPtr(s string) *string { return &s }
+
+func count(db *gorm.DB, model interface{}, query string, args ...interface{}) int64 {
+	var n int64
+	db.Model(model).Where(query, args...).Count(&n)
+	return n
+}
+
+func TestBuildExport(t *testing.T) {
+	db := setupDB(t)
+	SetExportDir(t.TempDir())
+	t.Cleanup(func() { SetExportDir("") })
+
+	user := seedUser(t, db, "alice")
+	db.Create(&models.SystemConfig{Category: "user_preferences", Key: "user_1_theme", Value: "dark"})
+	db.Create(&models.SystemConfig{Category: "user_preferences", Key: "user_12_theme", Value: "light"})
+
+	export := &models.DataExport{UserID: user.ID}
+	db.Create(export)
+	token, err := BuildExport(db, export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, path, err := FindDownload(db, token)
+	if err != nil || found.ID != export.ID {
+		t.Fatalf("download: %v", err)
+	}
+	if _, _, err := FindDownload(db, "wrong"); err != ErrExportNotFound {
+		t.Fatal("invalid token should not be found")
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	for _, name := range []string{"profile", "orders", "payments", "devices", "login_history", "tickets", "notifications", "settings"} {
+		if _, ok := files[name+".json"]; !ok {
+			t.Fatalf("missing %s.json", name)
+		}
+		if _, ok := files[name+".csv"]; !ok {
+			t.Fatalf("missing %s.csv", name)
+		}
+	}
+
+	var profile map[string]interface{}
+	if err := json.Unmarshal([]byte(files["profile.json"]), &profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile["nickname"] != "昵称" || profile["password"] != nil {
+		t.Fatalf("profile: %v", profile)
+	}
+	if strings.Contains(files["payments.json"], "sign") || strings.Contains(files["tickets.json"], "内部备注") {
+		t.Fatal("internal fields should not be exported")
+	}
+	if !strings.Contains(files["settings.json"], "dark") || strings.Contains(files["settings.json"], "light") {
+		t.Fatalf("settings: %s", files["settings.json"])
+	}
+	if !strings.HasPrefix(strings.TrimPrefix(files["devices.csv"], "\xEF\xBB\xBF"), "id,") {
+		t.Fatalf("csv header: %s", files["devices.csv"])
+	}
+
+	// 过期后文件被删除，链接失效
+	CleanupExports(db, utils.GetBeijingTime().Add(ExportTTL+time.Hour))
+	if _, _, err := FindDownload(db, token); err != ErrExportNotFound {
+		t.Fatal("expired export should not be downloadable")
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	db := setupDB(t)
+	user := seedUser(t, db, "alice")
+	other := seedUser(t, db, "bob")
+	db.Create(&models.SystemConfig{Category: "user_preferences", Key: "user_1_theme", Value: "dark"})
+	db.Create(&models.SystemConfig{Category: "user_preferences", Key: "user_12_theme", Value: "light"})
+
+	account, err := Anonymize(db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Email != "alice@example.com" {
+		t.Fatalf("account: %+v", account)
+	}
+
+	var tombstone models.User
+	db.First(&tombstone, user.ID)
+	if tombstone.Email == user.Email || tombstone.Password != "" || tombstone.IsActive || tombstone.Nickname.Valid {
+		t.Fatalf("user not anonymised: %+v", tombstone)
+	}
+
+	// 个人数据删除
+	for name, model := range map[string]interface{}{
+		"subscriptions": &models.Subscription{}, "login_history": &models.LoginHistory{},
+		"tickets": &models.Ticket{}, "notifications": &models.Notification{},
+	} {
+		if n := count(db, model, "user_id = ?", user.ID); n != 0 {
+			t.Fatalf("%s not deleted: %d", name, n)
+		}
+	}
+	if n := count(db, &models.Device{}, "device_fingerprint = ?", "fp-alice"); n != 0 {
+		t.Fatal("devices not deleted")
+	}
+	// 财务记录保留，去除个人信息
+	if count(db, &models.Order{}, "user_id = ?", user.ID) != 1 || count(db, &models.PaymentTransaction{}, "user_id = ?", user.ID) != 1 {
+		t.Fatal("financial records should be kept")
+	}
+	if count(db, &models.RechargeRecord{}, "user_id = ? AND ip_address IS NULL", user.ID) != 1 {
+		t.Fatal("recharge ip should be cleared")
+	}
+	if count(db, &models.PaymentTransaction{}, "user_id = ? AND callback_data IS NULL", user.ID) != 1 {
+		t.Fatal("payment callback data should be cleared")
+	}
+	if count(db, &models.PaymentCallback{}, "raw_request IS NULL AND callback_data NOT LIKE ?", "%alipay%") != 1 ||
+		count(db, &models.PaymentTransaction{}, "user_id = ? AND callback_data LIKE ?", other.ID, "%bob@alipay%") != 1 {
+		t.Fatal("only the deleted user's payment callbacks should be cleared")
+	}
+	// 其他用户不受影响
+	if count(db, &models.SystemConfig{}, "key = ?", "user_12_theme") != 1 || count(db, &models.SystemConfig{}, "key = ?", "user_1_theme") != 0 {
+		t.Fatal("user configs removed incorrectly")
+	}
+	if count(db, &models.Ticket{}, "user_id = ?", other.ID) != 1 || count(db, &models.Device{}, "device_fingerprint = ?", "fp-bob") != 1 {
+		t.Fatal("other user's data removed")
+	}
+
+	admin := &models.User{Username: "root", Email: "root@example.com", Password: "x", IsAdmin: true}
+	db.Create(admin)
+	if _, err := Anonymize(db, admin.ID); err != ErrAdminAccount {
+		t.Fatalf("admin: %v", err)
+	}
+}
+
+func TestProcessDueDeletions(t *testing.T) {
+	db := setupDB(t)
+	due := seedUser(t, db, "alice")
+	later := seedUser(t, db, "bob")
+	now := time.Now()
+	db.Create(&models.AccountDeletionRequest{UserID: due.ID, Status: models.DeletionPending, ScheduledAt: now.Add(-time.Minute)})
+	db.Create(&models.AccountDeletionRequest{UserID: later.ID, Status: models.DeletionPending, ScheduledAt: now.Add(24 * time.Hour)})
+
+	deleted := ProcessDueDeletions(db, now)
+	if len(deleted) != 1 || deleted[0].UserID != due.ID {
+		t.Fatalf("deleted: %+v", deleted)
+	}
+	if count(db, &models.AccountDeletionRequest{}, "user_id = ? AND status = ?", due.ID, models.DeletionCompleted) != 1 {
+		t.Fatal("request not completed")
+	}
+	if count(db, &models.User{}, "id = ? AND is_active = ?", later.ID, true) != 1 {
+		t.Fatal("request in cooling-off period should not run")
+	}
+	if len(ProcessDueDeletions(db, now)) != 0 {
+		t.Fatal("completed request processed twice")
+	}
+}
+
+func TestProcessDueDeletionsRetriesRemoteFailure(t *testing.T) {
+	db := setupDB(t)
+	user := seedUser(t, db, "alice")
+	now := time.Now()
+	db.Create(&models.AccountDeletionRequest{UserID: user.ID, Status: models.DeletionPending, ScheduledAt: now.Add(-time.Minute)})
+
+	orig := disableRemoteClients
+	defer func() { disableRemoteClients = orig }()
+	disableRemoteClients = func(*gorm.DB, uint) error { return errors.New("panel unavailable") }
+
+	if len(ProcessDueDeletions(db, now)) != 0 {
+		t.Fatal("deletion should fail while remote clients cannot be removed")
+	}
+	if count(db, &models.AccountDeletionRequest{}, "user_id = ? AND status = ?", user.ID, models.DeletionPending) != 1 ||
+		count(db, &models.User{}, "id = ? AND email = ?", user.ID, user.Email) != 1 {
+		t.Fatal("request should stay pending and the account untouched")
+	}
+
+	disableRemoteClients = func(*gorm.DB, uint) error { return nil }
+	if deleted := ProcessDueDeletions(db, now); len(deleted) != 1 || deleted[0].UserID != user.ID {
+		t.Fatalf("retry: %+v", deleted)
+	}
+}
+
+func TestCoolingOffDays(t *testing.T) {
+	db := setupDB(t)
+	if CoolingOffDays(db) != DefaultCoolingOffDays {
+		t.Fatal("default cooling-off days")
+	}
+	db.Create(&models.SystemConfig{Category: "security", Key: "account_deletion_cooling_days", Value: "0"})
+	if CoolingOffDays(db) != DefaultCoolingOffDays {
+		t.Fatal("cooling-off days below 1 should fall back to default")
+	}
+	db.Model(&models.SystemConfig{}).Where("key = ?", "account_deletion_cooling_days").Update("value", "14")
+	if CoolingOffDays(db) != 14 {
+		t.Fatal("configured cooling-off days")
+	}
+}
@@ -8,10 +8,15 @@ import (
 
 	"cboard-go/internal/core/database"
 	"cboard-go/internal/models"
+	"cboard-go/internal/services/auditchain"
 	"cboard-go/internal/services/config_update"
 	"cboard-go/internal/services/email"
 	"cboard-go/internal/services/node_health"
 	"cboard-go/internal/services/notification"
+	"cboard-go/internal/services/panel"
+	"cboard-go/internal/services/privacy"
+	"cboard-go/internal/services/session"
+	"cboard-go/internal/services/sharing"
 	"cboard-go/internal/utils"
 
 	"gorm.io/gorm"
@@ -45,6 +50,8 @@ func (s *Scheduler) Start() {
 	go s.cleanupExpiredData()
 	go s.checkNodeHealth()
 	go s.autoUpdateNodes()
+	go s.syncNodePanels()
+	go s.detectSubscriptionSharing()
 }
 
 func (s *Scheduler) Stop() {
@@ -226,10 +233,16 @@ func (s *Scheduler) cleanupExpiredDataNow() {
 
 	s.db.Where("status = ? AND sent_at < ?", "sent", thirtyDaysAgo).Delete(&models.EmailQueue{})
 
+	session.Cleanup(s.db)
+	_ = models.CleanExpiredTokens(s.db)
+
 	s.checkUsersForDeletionWarning(now)
 
 	s.checkUsersForDeletion(now)
 
+	privacy.CleanupExports(s.db, now)
+	s.processAccountDeletions(now)
+
 	log.Println("过期数据清理完成")
 }
 
@@ -356,6 +369,29 @@ func (s *Scheduler) checkUsersForDeletion(now time.Time) {
 	}
 }
 
+// processAccountDeletions 执行冷静期已结束的自助注销申请
+func (s *Scheduler) processAccountDeletions(now time.Time) {
+	deleted := privacy.ProcessDueDeletions(s.db, now)
+	if len(deleted) == 0 {
+		return
+	}
+	templateBuilder := email.NewEmailTemplateBuilder()
+	deletionDate := now.Format("2006-01-02 15:04:05")
+	for _, account := range deleted {
+		if err := auditchain.Append(s.db, &models.AuditLog{
+			ActionType:        "account_deleted",
+			ResourceType:      database.NullString("user"),
+			ResourceID:        database.NullInt64(int64(account.UserID)),
+			ActionDescription: database.NullString(fmt.Sprintf("用户自助注销已执行，账号已匿名化 (用户ID: %d)", account.UserID)),
+		}); err != nil {
+			utils.LogErrorMsg("保存注销审计日志失败: user=%d, %v", account.UserID, err)
+		}
+		content := templateBuilder.GetAccountDeletionTemplate(account.Username, deletionDate, "用户申请注销", "财务记录匿名保留，其余数据已删除")
+		_ = s.emailService.QueueEmail(account.Email, "账号删除确认", content, "account_deletion")
+	}
+	utils.LogInfo("已执行 %d 个账号注销申请", len(deleted))
+}
+
 func (s *Scheduler) checkNodeHealth() {
 	interval := 30 * time.Minute
 
@@ -406,6 +442,38 @@ func (s *Scheduler) checkNodeHealthNow() {
 	}
 }
 
+func (s *Scheduler) syncNodePanels() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			if err := panel.NewPanelService().SyncAll(); err != nil {
+				utils.LogErrorMsg("同步外部节点面板失败: %v", err)
+			}
+		}
+	}
+}
+
+func (s *Scheduler) detectSubscriptionSharing() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			if err := sharing.NewDetector().RunDetection(); err != nil {
+				utils.LogErrorMsg("订阅共享检测失败: %v", err)
+			}
+		}
+	}
+}
+
 func (s *Scheduler) autoUpdateNodes() {
 	checkInterval := 1 * time.Hour
 	ticker := time.NewTicker(checkInterval)
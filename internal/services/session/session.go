@@ -0,0 +1,294 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"cboard-go/internal/core/config"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/device"
+	"cboard-go/internal/services/geoip"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// reuseGrace 并发刷新（多个标签页同时刷新）时，上一个刷新令牌在该时间内仍可使用
+	reuseGrace = 10 * time.Second
+
+	ReasonLogout          = "logout"
+	ReasonUserRevoked     = "user_revoked"
+	ReasonOtherLogout     = "logout_others"
+	ReasonAdminLogout     = "admin_logout"
+	ReasonReuse           = "refresh_token_reuse"
+	ReasonPasswordChanged = "password_changed"
+	ReasonLoginAlert      = "login_alert"
+)
+
+var (
+	ErrInvalidToken   = errors.New("无效的刷新令牌")
+	ErrSessionRevoked = errors.New("会话已失效，请重新登录")
+	// ErrTokenReuse 已轮换的刷新令牌被再次使用，整个会话已被撤销
+	ErrTokenReuse = errors.New("刷新令牌已被使用，会话已失效，请重新登录")
+)
+
+// Tokens 登录或刷新后签发的令牌
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	SessionID    string
+}
+
+// Client 发起请求的客户端信息
+type Client struct {
+	IP          string
+	UserAgent   string
+	LoginMethod string
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func location(ip string) string {
+	if !geoip.IsEnabled() {
+		return ""
+	}
+	return geoip.GetLocationString(ip).String
+}
+
+// DeviceName 由浏览器 UA 生成会话名称，如 "Chrome · Windows 10.0"
+func DeviceName(ua string) string {
+	if ua == "" {
+		return "未知设备"
+	}
+	browser := "未知浏览器"
+	lower := strings.ToLower(ua)
+	switch {
+	case strings.Contains(lower, "edg/"):
+		browser = "Edge"
+	case strings.Contains(lower, "opr/") || strings.Contains(lower, "opera"):
+		browser = "Opera"
+	case strings.Contains(lower, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(lower, "micromessenger"):
+		browser = "微信"
+	case strings.Contains(lower, "chrome/") || strings.Contains(lower, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(lower, "safari/"):
+		browser = "Safari"
+	case !strings.HasPrefix(lower, "mozilla/"):
+		browser = strings.SplitN(ua, " ", 2)[0]
+	}
+	info := device.NewDeviceManager().ParseUserAgent(ua)
+	if info.OSName == "" || info.OSName == "Unknown" {
+		return browser
+	}
+	osName := info.OSName
+	if info.OSVersion != "" {
+		osName += " " + info.OSVersion
+	}
+	name := []rune(browser + " · " + osName)
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	return string(name)
+}
+
+// rotatedTokenID 轮换后的刷新令牌 ID 由被轮换令牌的哈希派生：同时拿着同一个令牌刷新的标签页
+// 得到的是同一个新令牌，不会互相把对方的令牌变成旧令牌
+func rotatedTokenID(sessionID, rotatedHash string) (string, error) {
+	if config.AppConfig == nil {
+		return "", errors.New("配置未初始化")
+	}
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.SecretKey))
+	mac.Write([]byte(sessionID + ":" + rotatedHash))
+	return hex.EncodeToString(mac.Sum(nil)[:16]), nil
+}
+
+func issue(user *models.User, sessionID, jti string) (*Tokens, string, error) {
+	atk, err := utils.CreateAccessToken(user.ID, user.Email, user.IsAdmin, sessionID)
+	if err != nil {
+		return nil, "", fmt.Errorf("生成令牌失败: %w", err)
+	}
+	rtk, err := utils.CreateRefreshToken(user.ID, user.Email, sessionID, jti)
+	if err != nil {
+		return nil, "", fmt.Errorf("生成刷新令牌失败: %w", err)
+	}
+	return &Tokens{AccessToken: atk, RefreshToken: rtk, SessionID: sessionID}, utils.HashToken(jti), nil
+}
+
+// Create 登录成功后创建会话并签发令牌
+func Create(db *gorm.DB, user *models.User, client Client) (*Tokens, error) {
+	sessionID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	jti, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	tokens, hash, err := issue(user, sessionID, jti)
+	if err != nil {
+		return nil, err
+	}
+	now := utils.GetBeijingTime()
+	s := models.UserSession{
+		UserID:           user.ID,
+		SessionID:        sessionID,
+		RefreshTokenHash: hash,
+		DeviceName:       DeviceName(client.UserAgent),
+		UserAgent:        client.UserAgent,
+		IPAddress:        client.IP,
+		Location:         location(client.IP),
+		LoginMethod:      client.LoginMethod,
+		LastSeenAt:       now,
+		ExpiresAt:        now.Add(utils.RefreshTokenTTL()),
+	}
+	if err := db.Create(&s).Error; err != nil {
+		return nil, fmt.Errorf("创建会话失败: %w", err)
+	}
+	return tokens, nil
+}
+
+// Refresh 校验并轮换刷新令牌；已轮换的旧令牌再次出现视为泄露，撤销整个会话。
+// 找到会话时总是返回会话记录，便于调用方记录日志
+func Refresh(db *gorm.DB, refreshToken string, client Client) (*Tokens, *models.UserSession, error) {
+	claims, err := utils.VerifyToken(refreshToken)
+	if err != nil || claims.Type != "refresh" || claims.SessionID == "" || claims.ID == "" {
+		return nil, nil, ErrInvalidToken
+	}
+
+	var s models.UserSession
+	if err := db.Where("session_id = ?", claims.SessionID).First(&s).Error; err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+	now := utils.GetBeijingTime()
+	if s.RevokedAt != nil || now.After(s.ExpiresAt) || s.UserID != claims.UserID {
+		return nil, &s, ErrSessionRevoked
+	}
+
+	presented := utils.HashToken(claims.ID)
+	inGrace := false
+	if presented != s.RefreshTokenHash {
+		inGrace = presented == s.PreviousHash && s.RotatedAt != nil && now.Sub(*s.RotatedAt) < reuseGrace
+		if !inGrace {
+			Revoke(db, &s, ReasonReuse)
+			return nil, &s, ErrTokenReuse
+		}
+	}
+
+	var user models.User
+	if err := db.First(&user, s.UserID).Error; err != nil {
+		return nil, &s, ErrInvalidToken
+	}
+	if !user.IsActive {
+		Revoke(db, &s, ReasonAdminLogout)
+		return nil, &s, ErrSessionRevoked
+	}
+
+	updates := map[string]interface{}{"last_seen_at": now}
+	if client.IP != "" && client.IP != s.IPAddress {
+		updates["ip_address"] = client.IP
+		updates["location"] = location(client.IP)
+	}
+
+	if inGrace {
+		// 另一个标签页刚轮换过：重新签发当前令牌，不再轮换，
+		// 否则刚发给那个标签页的令牌会变成旧令牌，宽限期过后再刷新就被当作泄露
+		jti, err := rotatedTokenID(s.SessionID, s.PreviousHash)
+		if err != nil {
+			return nil, &s, err
+		}
+		tokens, hash, err := issue(&user, s.SessionID, jti)
+		if err != nil {
+			return nil, &s, err
+		}
+		if hash != s.RefreshTokenHash {
+			return nil, &s, ErrSessionRevoked
+		}
+		db.Model(&models.UserSession{}).Where("id = ?", s.ID).Updates(updates)
+		return tokens, &s, nil
+	}
+
+	jti, err := rotatedTokenID(s.SessionID, s.RefreshTokenHash)
+	if err != nil {
+		return nil, &s, err
+	}
+	tokens, hash, err := issue(&user, s.SessionID, jti)
+	if err != nil {
+		return nil, &s, err
+	}
+	updates["refresh_token_hash"] = hash
+	updates["previous_hash"] = s.RefreshTokenHash
+	updates["rotated_at"] = now
+	updates["expires_at"] = now.Add(utils.RefreshTokenTTL())
+	// 以当前哈希为条件更新，避免两个请求同时轮换同一个令牌
+	result := db.Model(&models.UserSession{}).
+		Where("id = ? AND refresh_token_hash = ?", s.ID, s.RefreshTokenHash).
+		Updates(updates)
+	if result.Error != nil {
+		return nil, &s, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// 同时到达的另一个请求已完成轮换，两者得到的是同一个新令牌
+		var current models.UserSession
+		if db.Select("refresh_token_hash", "revoked_at").First(&current, s.ID).Error != nil ||
+			current.RevokedAt != nil || current.RefreshTokenHash != hash {
+			return nil, &s, ErrSessionRevoked
+		}
+	}
+	return tokens, &s, nil
+}
+
+// Revoke 撤销单个会话
+func Revoke(db *gorm.DB, s *models.UserSession, reason string) error {
+	now := utils.GetBeijingTime()
+	return db.Model(&models.UserSession{}).
+		Where("id = ? AND revoked_at IS NULL", s.ID).
+		Updates(map[string]interface{}{"revoked_at": now, "revoke_reason": reason}).Error
+}
+
+// RevokeBySessionID 按会话 ID 撤销（登出）
+func RevokeBySessionID(db *gorm.DB, sessionID, reason string) error {
+	now := utils.GetBeijingTime()
+	return db.Model(&models.UserSession{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Updates(map[string]interface{}{"revoked_at": now, "revoke_reason": reason}).Error
+}
+
+// RevokeUser 撤销用户的全部会话，exceptSessionID 非空时保留当前会话
+func RevokeUser(db *gorm.DB, userID uint, exceptSessionID, reason string) (int64, error) {
+	now := utils.GetBeijingTime()
+	q := db.Model(&models.UserSession{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if exceptSessionID != "" {
+		q = q.Where("session_id <> ?", exceptSessionID)
+	}
+	result := q.Updates(map[string]interface{}{"revoked_at": now, "revoke_reason": reason})
+	return result.RowsAffected, result.Error
+}
+
+// ListActive 用户当前有效的会话
+func ListActive(db *gorm.DB, userID uint) ([]models.UserSession, error) {
+	var list []models.UserSession
+	err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, utils.GetBeijingTime()).
+		Order("last_seen_at DESC").Find(&list).Error
+	return list, err
+}
+
+// Cleanup 删除过期或已撤销超过 30 天的会话记录
+func Cleanup(db *gorm.DB) {
+	cutoff := utils.GetBeijingTime().Add(-30 * 24 * time.Hour)
+	db.Where("expires_at < ? OR revoked_at < ?", cutoff, cutoff).Delete(&models.UserSession{})
+}
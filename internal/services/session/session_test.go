@@ -0,0 +1,145 @@
+package session
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"cboard-go/internal/core/config"
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36"
+
+func newTestDB(t *testing.T) (*gorm.DB, *models.User) {
+	t.Helper()
+	config.AppConfig = &config.Config{SecretKey: "test-secret", AccessTokenExpireMinutes: 30, RefreshTokenExpireDays: 7}
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.UserSession{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true}
+	db.Create(&user)
+	return db, &user
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	db, user := newTestDB(t)
+	tokens, err := Create(db, user, Client{IP: "1.2.3.4", UserAgent: testUA, LoginMethod: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := utils.VerifyToken(tokens.AccessToken)
+	if err != nil || claims.SessionID != tokens.SessionID {
+		t.Fatalf("access token should carry session id, claims=%+v err=%v", claims, err)
+	}
+
+	next, s, err := Refresh(db, tokens.RefreshToken, Client{IP: "5.6.7.8"})
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if next.SessionID != tokens.SessionID || next.RefreshToken == tokens.RefreshToken {
+		t.Fatal("refresh should keep the session and rotate the token")
+	}
+	if s.DeviceName != "Chrome · Windows 10.0" {
+		t.Errorf("device name = %q", s.DeviceName)
+	}
+	var stored models.UserSession
+	db.First(&stored, s.ID)
+	if stored.IPAddress != "5.6.7.8" || stored.PreviousHash != s.RefreshTokenHash {
+		t.Errorf("session not updated: %+v", stored)
+	}
+
+	// 宽限期内重复使用上一个令牌（并发刷新）仍然成功
+	if _, _, err := Refresh(db, tokens.RefreshToken, Client{}); err != nil {
+		t.Fatalf("refresh within grace window should succeed: %v", err)
+	}
+}
+
+// 两个标签页同时用同一个刷新令牌刷新，之后各自再刷新都不应被当作令牌泄露
+func TestConcurrentTabsRefresh(t *testing.T) {
+	db, user := newTestDB(t)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	first, _ := Create(db, user, Client{UserAgent: testUA})
+
+	var wg sync.WaitGroup
+	tabs := make([]*Tokens, 2)
+	errs := make([]error, 2)
+	for i := range tabs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tabs[i], _, errs[i] = Refresh(db, first.RefreshToken, Client{})
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("tab %d concurrent refresh failed: %v", i, err)
+		}
+	}
+
+	// 宽限期过后两个标签页先后再次刷新
+	db.Model(&models.UserSession{}).Where("session_id = ?", first.SessionID).
+		Update("rotated_at", utils.GetBeijingTime().Add(-11*time.Second))
+	for i, tab := range tabs {
+		if _, _, err := Refresh(db, tab.RefreshToken, Client{}); err != nil {
+			t.Fatalf("tab %d refresh after grace window failed: %v", i, err)
+		}
+	}
+	if !models.IsSessionActive(db, first.SessionID, utils.GetBeijingTime()) {
+		t.Fatal("session should stay active")
+	}
+}
+
+func TestReuseRevokesSession(t *testing.T) {
+	db, user := newTestDB(t)
+	first, _ := Create(db, user, Client{UserAgent: testUA})
+	second, _, err := Refresh(db, first.RefreshToken, Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&models.UserSession{}).Where("session_id = ?", first.SessionID).
+		Update("rotated_at", utils.GetBeijingTime().Add(-time.Minute))
+
+	if _, _, err := Refresh(db, first.RefreshToken, Client{}); !errors.Is(err, ErrTokenReuse) {
+		t.Fatalf("reused token should be detected, got %v", err)
+	}
+	if _, _, err := Refresh(db, second.RefreshToken, Client{}); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("whole session should be revoked after reuse, got %v", err)
+	}
+	if models.IsSessionActive(db, first.SessionID, utils.GetBeijingTime()) {
+		t.Fatal("session should be inactive")
+	}
+}
+
+func TestRevokeUserKeepsCurrentSession(t *testing.T) {
+	db, user := newTestDB(t)
+	current, _ := Create(db, user, Client{})
+	other, _ := Create(db, user, Client{})
+	third, _ := Create(db, user, Client{})
+
+	n, err := RevokeUser(db, user.ID, current.SessionID, ReasonOtherLogout)
+	if err != nil || n != 2 {
+		t.Fatalf("revoked %d sessions, err %v", n, err)
+	}
+	list, _ := ListActive(db, user.ID)
+	if len(list) != 1 || list[0].SessionID != current.SessionID {
+		t.Fatalf("only the current session should remain, got %d", len(list))
+	}
+	for _, sid := range []string{other.SessionID, third.SessionID} {
+		if models.IsSessionActive(db, sid, utils.GetBeijingTime()) {
+			t.Errorf("session %s should be revoked", sid)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package sharing
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/geoip"
+	"cboard-go/internal/services/subscription"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// 同一令牌、IP、UA 在该时间内重复拉取只记录一次
+	fetchDedupWindow = 10 * time.Minute
+	fetchRetention   = 7 * 24 * time.Hour
+	// 单个订阅参与分析的最大拉取记录数
+	maxFetchesPerSubscription = 2000
+
+	ResetTypeAutoSharing = "auto_sharing"
+)
+
+type Settings struct {
+	Enabled            bool
+	ScoreThreshold     int
+	AutoReset          bool
+	AutoResetThreshold int
+}
+
+// LoadSettings 读取 sharing_detection 分类下的配置
+func LoadSettings(db *gorm.DB) Settings {
+	settings := Settings{Enabled: true, ScoreThreshold: 60, AutoResetThreshold: 90}
+	var configs []models.SystemConfig
+	db.Where("category = ?", "sharing_detection").Find(&configs)
+	for _, cfg := range configs {
+		switch cfg.Key {
+		case "enabled":
+			settings.Enabled = cfg.Value == "true" || cfg.Value == "1"
+		case "score_threshold":
+			if v, err := strconv.Atoi(cfg.Value); err == nil && v > 0 && v <= 100 {
+				settings.ScoreThreshold = v
+			}
+		case "auto_reset":
+			settings.AutoReset = cfg.Value == "true" || cfg.Value == "1"
+		case "auto_reset_threshold":
+			if v, err := strconv.Atoi(cfg.Value); err == nil && v > 0 && v <= 100 {
+				settings.AutoResetThreshold = v
+			}
+		}
+	}
+	return settings
+}
+
+type Detector struct {
+	db *gorm.DB
+}
+
+func NewDetector() *Detector {
+	return &Detector{db: database.GetDB()}
+}
+
+// RecordFetch 记录一次订阅拉取及其地理位置、ASN
+func (d *Detector) RecordFetch(sub *models.Subscription, token, ip, ua string) {
+	if sub == nil || !LoadSettings(d.db).Enabled {
+		return
+	}
+
+	now := utils.GetBeijingTime()
+	var recent int64
+	d.db.Model(&models.SubscriptionFetch{}).
+		Where("token = ? AND ip_address = ? AND user_agent = ? AND created_at > ?", token, ip, ua, now.Add(-fetchDedupWindow)).
+		Count(&recent)
+	if recent > 0 {
+		return
+	}
+
+	fetch := models.SubscriptionFetch{
+		SubscriptionID: sub.ID,
+		UserID:         sub.UserID,
+		Token:          token,
+		IPAddress:      ip,
+		UserAgent:      ua,
+		CreatedAt:      now,
+	}
+	if loc, err := geoip.GetLocation(ip); err == nil {
+		fetch.CountryCode = loc.CountryCode
+		fetch.City = loc.City
+		fetch.Latitude = loc.Latitude
+		fetch.Longitude = loc.Longitude
+	}
+	if asn, err := geoip.GetASN(ip); err == nil {
+		fetch.ASN = asn.Number
+		fetch.ASOrg = asn.Organization
+	}
+	if err := d.db.Create(&fetch).Error; err != nil {
+		utils.LogWarn("记录订阅拉取失败: subscription_id=%d, error=%v", sub.ID, err)
+	}
+}
+
+// AnalyzeSubscription 按令牌分别分析订阅最近的拉取记录，返回得分最高的结果
+func (d *Detector) AnalyzeSubscription(subscriptionID uint) (*Report, error) {
+	var rows []models.SubscriptionFetch
+	since := utils.GetBeijingTime().Add(-fetchRetention)
+	if err := d.db.Where("subscription_id = ? AND created_at >= ?", subscriptionID, since).
+		Order("created_at DESC").Limit(maxFetchesPerSubscription).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	byToken := make(map[string][]Fetch)
+	for _, r := range rows {
+		byToken[r.Token] = append(byToken[r.Token], Fetch{
+			Token:       r.Token,
+			IP:          r.IPAddress,
+			UserAgent:   r.UserAgent,
+			CountryCode: r.CountryCode,
+			City:        r.City,
+			Latitude:    r.Latitude,
+			Longitude:   r.Longitude,
+			ASN:         r.ASN,
+			Time:        r.CreatedAt,
+		})
+	}
+
+	best := &Report{Evidence: []Evidence{}}
+	for _, fetches := range byToken {
+		if report := Analyze(fetches); report.Score > best.Score {
+			best = report
+		}
+	}
+	return best, nil
+}
+
+// RunDetection 分析所有近期有拉取记录的订阅，保存得分，并按配置自动重置高风险订阅
+func (d *Detector) RunDetection() error {
+	settings := LoadSettings(d.db)
+	if !settings.Enabled {
+		return nil
+	}
+
+	now := utils.GetBeijingTime()
+	d.db.Where("created_at < ?", now.Add(-fetchRetention)).Delete(&models.SubscriptionFetch{})
+
+	var subIDs []uint
+	if err := d.db.Model(&models.SubscriptionFetch{}).Distinct("subscription_id").Pluck("subscription_id", &subIDs).Error; err != nil {
+		return err
+	}
+
+	for _, subID := range subIDs {
+		report, err := d.AnalyzeSubscription(subID)
+		if err != nil {
+			utils.LogWarn("订阅共享分析失败: subscription_id=%d, error=%v", subID, err)
+			continue
+		}
+		score, err := d.saveScore(subID, report, now)
+		if err != nil {
+			utils.LogWarn("保存订阅共享得分失败: subscription_id=%d, error=%v", subID, err)
+			continue
+		}
+		if settings.AutoReset && report.Score >= settings.AutoResetThreshold {
+			if err := d.autoReset(score, report, now); err != nil {
+				utils.LogWarn("自动重置共享订阅失败: subscription_id=%d, error=%v", subID, err)
+			}
+		}
+	}
+
+	// 近期已无拉取记录的订阅，其旧得分不再有意义
+	if len(subIDs) == 0 {
+		return d.db.Where("1 = 1").Delete(&models.SharingScore{}).Error
+	}
+	return d.db.Where("subscription_id NOT IN ?", subIDs).Delete(&models.SharingScore{}).Error
+}
+
+func (d *Detector) saveScore(subID uint, report *Report, now time.Time) (*models.SharingScore, error) {
+	var sub models.Subscription
+	if err := d.db.First(&sub, subID).Error; err != nil {
+		return nil, err
+	}
+	evidence, _ := json.Marshal(report)
+
+	var score models.SharingScore
+	if err := d.db.Where("subscription_id = ?", subID).First(&score).Error; err != nil {
+		score = models.SharingScore{SubscriptionID: subID}
+	}
+	score.UserID = sub.UserID
+	score.Score = report.Score
+	score.Window = report.Window
+	score.FetchCount = report.FetchCount
+	score.Evidence = string(evidence)
+	score.AnalyzedAt = now
+	return &score, d.db.Save(&score).Error
+}
+
+func (d *Detector) autoReset(score *models.SharingScore, report *Report, now time.Time) error {
+	var sub models.Subscription
+	if err := d.db.First(&sub, score.SubscriptionID).Error; err != nil {
+		return err
+	}
+
+	reason := fmt.Sprintf("疑似共享订阅，共享得分 %d", report.Score)
+	resetBy := "system"
+	if err := subscription.ResetSubscription(d.db, &sub, ResetTypeAutoSharing, reason, &resetBy); err != nil {
+		return err
+	}
+	// 清除旧地址的拉取记录，避免重置后被重复判定
+	d.db.Where("subscription_id = ?", sub.ID).Delete(&models.SubscriptionFetch{})
+	score.AutoResetAt = &now
+	d.db.Save(score)
+
+	d.db.Create(&models.Notification{
+		UserID:   sql.NullInt64{Int64: int64(sub.UserID), Valid: true},
+		Title:    "订阅地址已自动重置",
+		Content:  "系统检测到您的订阅在多个地区/网络同时使用，疑似被共享，订阅地址已自动重置。请登录后获取新的订阅地址并重新导入客户端。",
+		Type:     "subscription",
+		IsActive: true,
+	})
+	utils.LogInfo("订阅 %d 共享得分 %d，已自动重置", sub.ID, report.Score)
+	return nil
+}
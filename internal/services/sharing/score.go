@@ -0,0 +1,213 @@
+package sharing
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	EvidenceCountries = "countries"
+	EvidenceCities    = "cities"
+	EvidenceASNs      = "asns"
+	EvidenceTravel    = "impossible_travel"
+	EvidenceUserAgent = "user_agents"
+
+	// 两次拉取之间的距离和速度同时超过阈值才视为不可能的移动
+	travelMinDistanceKm = 500.0
+	travelMaxSpeedKmh   = 900.0
+)
+
+// Windows 依次分析的滑动窗口大小
+var Windows = []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour}
+
+type Fetch struct {
+	Token       string
+	IP          string
+	UserAgent   string
+	CountryCode string
+	City        string
+	Latitude    float64
+	Longitude   float64
+	ASN         uint
+	Time        time.Time
+}
+
+type Evidence struct {
+	Type   string `json:"type"`
+	Points int    `json:"points"`
+	Detail string `json:"detail"`
+}
+
+type Report struct {
+	Score       int        `json:"score"`
+	Window      string     `json:"window"`
+	WindowStart time.Time  `json:"window_start"`
+	WindowEnd   time.Time  `json:"window_end"`
+	FetchCount  int        `json:"fetch_count"`
+	Countries   []string   `json:"countries"`
+	Cities      []string   `json:"cities"`
+	ASNs        []uint     `json:"asns"`
+	UserAgents  int        `json:"user_agents"`
+	MaxSpeedKmh float64    `json:"max_speed_kmh"`
+	Evidence    []Evidence `json:"evidence"`
+}
+
+// Analyze 在每个窗口大小下滑动分析同一令牌的拉取记录，返回得分最高的窗口
+func Analyze(fetches []Fetch) *Report {
+	sorted := make([]Fetch, len(fetches))
+	copy(sorted, fetches)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	best := &Report{Evidence: []Evidence{}}
+	for _, window := range Windows {
+		end := 0
+		for start := range sorted {
+			if end < start {
+				end = start
+			}
+			for end+1 < len(sorted) && sorted[end+1].Time.Sub(sorted[start].Time) <= window {
+				end++
+			}
+			report := scoreWindow(sorted[start : end+1])
+			report.Window = formatWindow(window)
+			if report.Score > best.Score {
+				best = report
+			}
+			if end == len(sorted)-1 {
+				break
+			}
+		}
+	}
+	return best
+}
+
+func scoreWindow(fetches []Fetch) *Report {
+	report := &Report{
+		FetchCount:  len(fetches),
+		WindowStart: fetches[0].Time,
+		WindowEnd:   fetches[len(fetches)-1].Time,
+		Evidence:    []Evidence{},
+	}
+
+	countries := make(map[string]bool)
+	cities := make(map[string]bool)
+	asns := make(map[uint]bool)
+	agents := make(map[string]bool)
+	for _, f := range fetches {
+		if f.CountryCode != "" && !countries[f.CountryCode] {
+			countries[f.CountryCode] = true
+			report.Countries = append(report.Countries, f.CountryCode)
+		}
+		if f.City != "" {
+			key := f.CountryCode + "/" + f.City
+			if !cities[key] {
+				cities[key] = true
+				report.Cities = append(report.Cities, f.City)
+			}
+		}
+		if f.ASN != 0 && !asns[f.ASN] {
+			asns[f.ASN] = true
+			report.ASNs = append(report.ASNs, f.ASN)
+		}
+		if family := uaFamily(f.UserAgent); family != "" {
+			agents[family] = true
+		}
+	}
+	report.UserAgents = len(agents)
+
+	if n := len(countries); n > 1 {
+		report.add(EvidenceCountries, capPoints((n-1)*20, 40), "%d 个不同国家/地区: %s", n, strings.Join(report.Countries, ", "))
+	}
+	if n := len(cities); n > 2 {
+		report.add(EvidenceCities, capPoints((n-2)*5, 20), "%d 个不同城市", n)
+	}
+	if n := len(asns); n > 2 {
+		report.add(EvidenceASNs, capPoints((n-2)*8, 24), "%d 个不同运营商网络(ASN)", n)
+	}
+
+	jumps := 0
+	var worst string
+	for i := 1; i < len(fetches); i++ {
+		prev, cur := fetches[i-1], fetches[i]
+		if !hasCoords(prev) || !hasCoords(cur) {
+			continue
+		}
+		distance := haversineKm(prev.Latitude, prev.Longitude, cur.Latitude, cur.Longitude)
+		hours := math.Max(cur.Time.Sub(prev.Time).Hours(), 1.0/60)
+		speed := distance / hours
+		if distance >= travelMinDistanceKm && speed >= travelMaxSpeedKmh {
+			jumps++
+			if speed > report.MaxSpeedKmh {
+				report.MaxSpeedKmh = math.Round(speed)
+				worst = fmt.Sprintf("%s → %s %.0f km / %s", placeName(prev), placeName(cur), distance, cur.Time.Sub(prev.Time).Round(time.Minute))
+			}
+		}
+	}
+	if jumps > 0 {
+		report.add(EvidenceTravel, capPoints(jumps*15, 45), "%d 次不可能的移动，最快 %.0f km/h (%s)", jumps, report.MaxSpeedKmh, worst)
+	}
+
+	if n := len(agents); n > 3 {
+		report.add(EvidenceUserAgent, capPoints((n-3)*5, 15), "%d 种不同客户端", n)
+	}
+
+	if report.Score > 100 {
+		report.Score = 100
+	}
+	return report
+}
+
+func (r *Report) add(kind string, points int, format string, args ...interface{}) {
+	r.Score += points
+	r.Evidence = append(r.Evidence, Evidence{Type: kind, Points: points, Detail: fmt.Sprintf(format, args...)})
+}
+
+func capPoints(points, max int) int {
+	if points > max {
+		return max
+	}
+	return points
+}
+
+func hasCoords(f Fetch) bool {
+	return f.Latitude != 0 || f.Longitude != 0
+}
+
+func placeName(f Fetch) string {
+	if f.City != "" {
+		return f.City
+	}
+	return f.CountryCode
+}
+
+func formatWindow(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", int(d/(24*time.Hour)))
+	}
+	return fmt.Sprintf("%dh", int(d/time.Hour))
+}
+
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371.0
+	toRad := func(d float64) float64 { return d * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+var uaVersionPattern = regexp.MustCompile(`[/ v]?\d+(\.\d+)*`)
+
+// uaFamily 去掉版本号，避免同一客户端升级后被计为不同客户端
+func uaFamily(ua string) string {
+	ua = strings.ToLower(strings.TrimSpace(ua))
+	if ua == "" {
+		return ""
+	}
+	return strings.TrimSpace(uaVersionPattern.ReplaceAllString(ua, ""))
+}
@@ -0,0 +1,54 @@
+package sharing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnalyzeSingleHome(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var fetches []Fetch
+	for i := 0; i < 48; i++ {
+		fetches = append(fetches, Fetch{
+			UserAgent: "clash-verge/v1.6.0", CountryCode: "CN", City: "上海",
+			Latitude: 31.23, Longitude: 121.47, ASN: 4812, Time: base.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	if report := Analyze(fetches); report.Score != 0 {
+		t.Fatalf("expected score 0, got %d: %+v", report.Score, report.Evidence)
+	}
+}
+
+func TestAnalyzeImpossibleTravel(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	fetches := []Fetch{
+		{UserAgent: "clash-verge/v1.6.0", CountryCode: "CN", City: "上海", Latitude: 31.23, Longitude: 121.47, ASN: 4812, Time: base},
+		{UserAgent: "Shadowrocket/2.2", CountryCode: "US", City: "Los Angeles", Latitude: 34.05, Longitude: -118.24, ASN: 7018, Time: base.Add(20 * time.Minute)},
+		{UserAgent: "ClashforWindows/0.20", CountryCode: "DE", City: "Berlin", Latitude: 52.52, Longitude: 13.40, ASN: 3320, Time: base.Add(40 * time.Minute)},
+	}
+	report := Analyze(fetches)
+	if report.Window != "1h" {
+		t.Fatalf("expected 1h window, got %s", report.Window)
+	}
+	kinds := make(map[string]bool)
+	for _, e := range report.Evidence {
+		kinds[e.Type] = true
+	}
+	for _, kind := range []string{EvidenceCountries, EvidenceTravel, EvidenceASNs, EvidenceCities} {
+		if !kinds[kind] {
+			t.Errorf("missing evidence %s: %+v", kind, report.Evidence)
+		}
+	}
+	if report.Score < 80 {
+		t.Fatalf("expected high score, got %d", report.Score)
+	}
+}
+
+func TestUAFamilyIgnoresVersion(t *testing.T) {
+	if uaFamily("clash-verge/v1.6.0") != uaFamily("clash-verge/v1.7.2") {
+		t.Fatal("same client with different versions should share a family")
+	}
+	if uaFamily("clash-verge/v1.6.0") == uaFamily("Shadowrocket/2.2") {
+		t.Fatal("different clients should not share a family")
+	}
+}
@@ -7,6 +7,8 @@ import (
 
 	"cboard-go/internal/core/database"
 	"cboard-go/internal/models"
+	"cboard-go/internal/services/config_update"
+	"cboard-go/internal/services/panel"
 	"cboard-go/internal/utils"
 
 	"gorm.io/gorm"
@@ -153,3 +155,38 @@ func (s *SubscriptionService) CheckExpired() error {
 			"is_active": false,
 		}).Error
 }
+
+// ResetSubscription 重置订阅地址、清空设备并重新生成专线凭据
+func ResetSubscription(db *gorm.DB, sub *models.Subscription, resetType, reason string, resetBy *string) error {
+	oldURL := sub.SubscriptionURL
+	var deviceCountBefore int64
+	db.Model(&models.Device{}).Where("subscription_id = ? AND is_active = ?", sub.ID, true).Count(&deviceCountBefore)
+
+	newURL := utils.GenerateSubscriptionURL()
+	sub.SubscriptionURL = newURL
+	sub.CurrentDevices = 0
+
+	if err := db.Save(sub).Error; err != nil {
+		return err
+	}
+
+	reset := models.SubscriptionReset{
+		UserID:             sub.UserID,
+		SubscriptionID:     sub.ID,
+		ResetType:          resetType,
+		Reason:             reason,
+		OldSubscriptionURL: &oldURL,
+		NewSubscriptionURL: &newURL,
+		DeviceCountBefore:  int(deviceCountBefore),
+		DeviceCountAfter:   0,
+		ResetBy:            resetBy,
+	}
+	if err := db.Create(&reset).Error; err != nil {
+		return err
+	}
+	if err := config_update.RegenerateUserNodeCredentials(db, sub.UserID); err != nil {
+		return err
+	}
+	go panel.NewPanelService().SyncUserCredentials(sub.UserID)
+	return db.Where("subscription_id = ?", sub.ID).Delete(&models.Device{}).Error
+}
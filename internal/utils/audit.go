@@ -9,6 +9,7 @@ import (
 
 	"cboard-go/internal/core/database"
 	"cboard-go/internal/models"
+	"cboard-go/internal/services/auditchain"
 	"cboard-go/internal/services/geoip"
 
 	"github.com/gin-gonic/gin"
@@ -79,7 +80,7 @@ func CreateAuditLog(c *gin.Context, actionType, resourceType string, resourceID
 	}
 
 	go func() {
-		if err := db.Create(&auditLog).Error; err != nil {
+		if err := auditchain.Append(db, &auditLog); err != nil {
 			if userID.Valid {
 				LogAudit(uint(userID.Int64), actionType, resourceType, resourceID, description)
 			}
@@ -175,7 +176,7 @@ func CreateSecurityLog(c *gin.Context, eventType, severity, description string,
 	}
 
 	go func() {
-		if err := db.Create(&auditLog).Error; err != nil {
+		if err := auditchain.Append(db, &auditLog); err != nil {
 			if AppLogger != nil {
 				AppLogger.Error("[安全日志保存失败] %s - %s: %s, 错误: %v", severity, eventType, description, err)
 			}
@@ -314,7 +315,7 @@ func CreateSystemErrorLog(c *gin.Context, statusCode int, message string, err er
 
 	go func() {
 		errDetail := err
-		if saveErr := db.Create(&auditLog).Error; saveErr != nil {
+		if saveErr := auditchain.Append(db, &auditLog); saveErr != nil {
 			if AppLogger != nil {
 				AppLogger.Error("[系统错误日志保存失败] %s: %v, 错误: %v", message, errDetail, saveErr)
 			}
@@ -13,10 +13,12 @@ type JWTClaims struct {
 	Email   string `json:"email"`
 	IsAdmin bool   `json:"is_admin"`
 	Type    string `json:"type"`
+	// SessionID 登录会话 ID，会话被撤销后令牌立即失效
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func CreateAccessToken(userID uint, email string, isAdmin bool) (string, error) {
+func CreateAccessToken(userID uint, email string, isAdmin bool, sessionID string) (string, error) {
 	cfg := config.AppConfig
 	if cfg == nil {
 		return "", errors.New("配置未初始化")
@@ -25,10 +27,11 @@ func CreateAccessToken(userID uint, email string, isAdmin bool) (string, error)
 	expiresAt := time.Now().Add(time.Duration(cfg.AccessTokenExpireMinutes) * time.Minute)
 
 	claims := JWTClaims{
-		UserID:  userID,
-		Email:   email,
-		IsAdmin: isAdmin,
-		Type:    "access",
+		UserID:    userID,
+		Email:     email,
+		IsAdmin:   isAdmin,
+		Type:      "access",
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -39,19 +42,22 @@ func CreateAccessToken(userID uint, email string, isAdmin bool) (string, error)
 	return token.SignedString([]byte(cfg.SecretKey))
 }
 
-func CreateRefreshToken(userID uint, email string) (string, error) {
+// CreateRefreshToken tokenID 写入 jti，每次刷新轮换，服务端只保存当前 jti 的哈希
+func CreateRefreshToken(userID uint, email, sessionID, tokenID string) (string, error) {
 	cfg := config.AppConfig
 	if cfg == nil {
 		return "", errors.New("配置未初始化")
 	}
 
-	expiresAt := time.Now().Add(time.Duration(cfg.RefreshTokenExpireDays) * 24 * time.Hour)
+	expiresAt := time.Now().Add(RefreshTokenTTL())
 
 	claims := JWTClaims{
-		UserID: userID,
-		Email:  email,
-		Type:   "refresh",
+		UserID:    userID,
+		Email:     email,
+		Type:      "refresh",
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
@@ -61,6 +67,15 @@ func CreateRefreshToken(userID uint, email string) (string, error) {
 	return token.SignedString([]byte(cfg.SecretKey))
 }
 
+// RefreshTokenTTL 刷新令牌（即登录会话）的有效期
+func RefreshTokenTTL() time.Duration {
+	days := 7
+	if cfg := config.AppConfig; cfg != nil && cfg.RefreshTokenExpireDays > 0 {
+		days = cfg.RefreshTokenExpireDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
 func VerifyToken(tokenString string) (*JWTClaims, error) {
 	cfg := config.AppConfig
 	if cfg == nil {
@@ -84,3 +99,24 @@ func VerifyToken(tokenString string) (*JWTClaims, error) {
 
 	return nil, errors.New("无效的令牌")
 }
+
+// CreateChallengeToken 生成两步验证用的短期令牌，purpose 为 2fa_challenge 或 2fa_enroll，不能用于访问接口
+func CreateChallengeToken(userID uint, email, purpose string, ttl time.Duration) (string, error) {
+	cfg := config.AppConfig
+	if cfg == nil {
+		return "", errors.New("配置未初始化")
+	}
+
+	claims := JWTClaims{
+		UserID: userID,
+		Email:  email,
+		Type:   purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(cfg.SecretKey))
+}
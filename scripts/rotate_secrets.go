@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"cboard-go/internal/core/config"
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/core/secrets"
+	"cboard-go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// 用当前 SECRETS_MASTER_KEY 重新加密所有支付密钥与 SMTP 密码（包括尚未加密的明文）。
+// 轮换步骤：将旧密钥移到 SECRETS_PREVIOUS_KEYS，设置新的 SECRETS_MASTER_KEY 后运行本脚本，
+// 完成后即可从 SECRETS_PREVIOUS_KEYS 中删除旧密钥
+
+func paymentNeedsRotation(raw *models.PaymentConfig) bool {
+	for _, field := range raw.SecretFields() {
+		if field.Valid && secrets.NeedsRotation(field.String) {
+			return true
+		}
+	}
+	if !raw.ConfigJSON.Valid {
+		return false
+	}
+	var data map[string]interface{}
+	if json.Unmarshal([]byte(raw.ConfigJSON.String), &data) != nil {
+		return false
+	}
+	for _, key := range models.PaymentSecretConfigKeys {
+		if str, ok := data[key].(string); ok && secrets.NeedsRotation(str) {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	checkOnly := len(os.Args) > 1 && os.Args[1] == "--check"
+	if len(os.Args) > 1 && !checkOnly {
+		fmt.Println("用法: go run scripts/rotate_secrets.go [--check]")
+		fmt.Println("  --check  只统计需要重新加密的配置，不写入数据库")
+		os.Exit(1)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil || cfg == nil {
+		fmt.Printf("❌ 配置加载失败: %v\n", err)
+		os.Exit(1)
+	}
+	if err := secrets.Configure(cfg.SecretsMasterKey, cfg.SecretsPreviousKeys); err != nil {
+		fmt.Printf("❌ 加载主密钥失败: %v\n", err)
+		os.Exit(1)
+	}
+	if !secrets.Enabled() {
+		fmt.Println("❌ 未设置 SECRETS_MASTER_KEY，无法加密")
+		os.Exit(1)
+	}
+	if err := database.InitDatabase(); err != nil {
+		fmt.Printf("❌ 数据库连接失败: %v\n", err)
+		os.Exit(1)
+	}
+	db := database.GetDB()
+	// 跳过模型钩子读取数据库中的原始值，判断哪些记录需要重新加密
+	raw := db.Session(&gorm.Session{SkipHooks: true})
+
+	var rawPayments []models.PaymentConfig
+	if err := raw.Order("id ASC").Find(&rawPayments).Error; err != nil {
+		fmt.Printf("❌ 读取支付配置失败: %v\n", err)
+		os.Exit(1)
+	}
+	var paymentIDs []uint
+	for i := range rawPayments {
+		if paymentNeedsRotation(&rawPayments[i]) {
+			paymentIDs = append(paymentIDs, rawPayments[i].ID)
+		}
+	}
+
+	var rawConfigs []models.SystemConfig
+	if err := raw.Where("category = ?", "email").Order("id ASC").Find(&rawConfigs).Error; err != nil {
+		fmt.Printf("❌ 读取邮件配置失败: %v\n", err)
+		os.Exit(1)
+	}
+	var configIDs []uint
+	for _, c := range rawConfigs {
+		if models.IsSecretSystemConfig(c.Category, c.Key) && secrets.NeedsRotation(c.Value) {
+			configIDs = append(configIDs, c.ID)
+		}
+	}
+
+	fmt.Printf("📋 支付配置 %d 条，需要重新加密 %d 条\n", len(rawPayments), len(paymentIDs))
+	fmt.Printf("📋 SMTP 密码需要重新加密 %d 条\n", len(configIDs))
+	if checkOnly || len(paymentIDs)+len(configIDs) == 0 {
+		if len(paymentIDs)+len(configIDs) == 0 {
+			fmt.Println("✅ 所有密钥均已使用当前主密钥加密")
+		}
+		return
+	}
+
+	// 读取时由模型钩子解密，保存时用当前主密钥重新加密
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, id := range paymentIDs {
+			var payment models.PaymentConfig
+			if err := tx.First(&payment, id).Error; err != nil {
+				return err
+			}
+			if err := tx.Save(&payment).Error; err != nil {
+				return fmt.Errorf("支付配置 #%d: %w", id, err)
+			}
+		}
+		for _, id := range configIDs {
+			var c models.SystemConfig
+			if err := tx.First(&c, id).Error; err != nil {
+				return err
+			}
+			if err := tx.Save(&c).Error; err != nil {
+				return fmt.Errorf("配置 %s.%s: %w", c.Category, c.Key, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("❌ 重新加密失败，已回滚: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ 已重新加密 %d 条支付配置、%d 条 SMTP 密码\n", len(paymentIDs), len(configIDs))
+	if len(cfg.SecretsPreviousKeys) > 0 {
+		fmt.Println("💡 可以从 SECRETS_PREVIOUS_KEYS 中删除旧密钥了")
+	}
+}
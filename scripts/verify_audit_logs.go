@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"cboard-go/internal/core/config"
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/auditchain"
+)
+
+func printReport(title string, report *auditchain.Report) {
+	if report.Valid {
+		fmt.Printf("✅ %s: 校验通过，已校验 %d 条，未签名的历史记录 %d 条\n", title, report.Checked, report.Legacy)
+	} else {
+		fmt.Printf("❌ %s: 发现 %d 个问题（已校验 %d 条）\n", title, report.IssueCount, report.Checked)
+		for _, issue := range report.Issues {
+			fmt.Printf("   #%d [%s] %s\n", issue.ID, issue.Kind, issue.Detail)
+		}
+		if report.IssueCount > len(report.Issues) {
+			fmt.Printf("   ……其余 %d 个问题未列出\n", report.IssueCount-len(report.Issues))
+		}
+	}
+	if report.HeadHash != "" {
+		fmt.Printf("   链尾哈希: %s\n", report.HeadHash)
+	}
+}
+
+func main() {
+	checkArchives := len(os.Args) > 1 && os.Args[1] == "--archives"
+	if len(os.Args) > 1 && !checkArchives {
+		fmt.Println("用法: go run scripts/verify_audit_logs.go [--archives]")
+		fmt.Println("  --archives  同时校验归档文件（目录由 AUDIT_ARCHIVE_DIR 指定，默认 ./data/audit_archive）")
+		os.Exit(1)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil || cfg == nil {
+		fmt.Printf("❌ 配置加载失败: %v\n", err)
+		os.Exit(1)
+	}
+	if err := database.InitDatabase(); err != nil {
+		fmt.Printf("❌ 数据库连接失败: %v\n", err)
+		os.Exit(1)
+	}
+	db := database.GetDB()
+
+	report, err := auditchain.Verify(db)
+	if err != nil {
+		fmt.Printf("❌ 校验失败: %v\n", err)
+		os.Exit(1)
+	}
+	printReport("审计日志", report)
+	valid := report.Valid
+
+	if checkArchives {
+		dir := os.Getenv("AUDIT_ARCHIVE_DIR")
+		if dir == "" {
+			dir = "./data/audit_archive"
+		}
+		var anchors []models.AuditLogAnchor
+		db.Order("id ASC").Find(&anchors)
+		for i := range anchors {
+			title := fmt.Sprintf("归档 %s (#%d-#%d)", anchors[i].ArchiveFile, anchors[i].FirstID, anchors[i].LastID)
+			r, err := auditchain.VerifyArchive(dir, &anchors[i])
+			if err != nil {
+				fmt.Printf("❌ %s: %v\n", title, err)
+				valid = false
+				continue
+			}
+			printReport(title, r)
+			valid = valid && r.Valid
+		}
+	}
+
+	if !valid {
+		os.Exit(2)
+	}
+}